@@ -2,15 +2,33 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/chaos"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/config"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/logging"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/metrics"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/middleware"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/openapi"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/proxy"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/ratelimit"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/scenario"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/script"
 	"github.com/TykTechnologies/tyk-devops-assignement/internal/server"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/systemd"
 )
 
 // Build information - set via ldflags during build
@@ -28,44 +46,361 @@ func printVersion() {
 }
 
 func main() {
-	// Parse command-line flags
-	host := flag.String("host", "0.0.0.0", "Host to bind the server to")
-	port := flag.Int("port", 8080, "Port to bind the server to")
-	showVersion := flag.Bool("version", false, "Show version information")
-	flag.Parse()
+	// Resolve configuration from defaults, config file, env and flags
+	cfg, opts, err := config.Parse(os.Args[0], os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
 
 	// Show version and exit if requested
-	if *showVersion {
+	if opts.ShowVersion {
 		printVersion()
 		os.Exit(0)
 	}
 
+	// Set up structured logging; the level can change on reload
+	level := new(slog.LevelVar)
+	lvl, _ := logging.ParseLevel(cfg.Log.Level)
+	level.Set(lvl)
+	logger, _ := logging.New(os.Stderr, cfg.Log.Format, level)
+	slog.SetDefault(logger)
+
+	// Rules from the config file can be changed via the admin API or reload
+	chaosEngine, err := chaos.NewEngine(cfg.Chaos.Rules)
+	if err != nil {
+		fatal("Invalid chaos rules", err)
+	}
+
+	running := *cfg
+	reload := &reloader{args: os.Args[1:], cfg: &running, level: level, chaos: chaosEngine}
+
+	serverOpts, closers, err := serverOptions(cfg, level)
+	if err != nil {
+		fatal("Failed to configure server", err)
+	}
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+
 	// Create server
-	addr := fmt.Sprintf("%s:%d", *host, *port)
-	srv := server.New(addr)
+	srv := server.New(cfg.Addr(), append(serverOpts, server.WithReloadFunc(reload.Reload), server.WithChaos(chaosEngine))...)
+	reload.srv = srv
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Starting httpbin server on %s (version: %s, commit: %s)", addr, version, commit)
-		if err := srv.Start(); err != nil {
-			log.Fatalf("Server failed to start: %v", err)
+		slog.Info("Starting httpbin server", "listeners", srv.Listeners(), "version", version, "commit", commit)
+		if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Server failed to start", err)
 		}
 	}()
 
-	// Wait for interrupt signal for graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Reload on SIGHUP; wait for interrupt signal for graceful shutdown
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if err := reload.Reload(); err != nil {
+			slog.Error("Configuration reload failed", "error", err)
+		}
+	}
+
+	// Fail readiness first so load balancers stop sending new traffic
+	srv.SetReady(false)
+	if cfg.ShutdownDrain > 0 {
+		slog.Info("Draining before shutdown", "delay", cfg.ShutdownDrain)
+		time.Sleep(cfg.ShutdownDrain)
+	}
 
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server...")
 
 	// Create context with timeout for shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", err)
+	}
+
+	slog.Info("Server exited")
+}
+
+// handlerSettings translates the configuration into handler settings
+func handlerSettings(cfg *config.Config) *handlers.Settings {
+	trusted, _ := config.ParsePrefixes(cfg.TrustedProxies)
+	return &handlers.Settings{
+		TrustedProxies: trusted,
+		ProblemDetails: cfg.ProblemDetails,
+		PrettyJSON:     cfg.PrettyJSON,
+		OriginChain:    cfg.OriginChain,
+		MaxDelay:       cfg.MaxDelay,
+		TemplatesDir:   cfg.TemplatesDir,
+		SchemasDir:     cfg.SchemasDir,
+		EnvPrefixes:    cfg.EnvPrefixes,
+		PodInfoDir:     cfg.PodInfoDir,
+		MetadataMock:   cfg.MetadataMock,
+		Seed:           cfg.Seed,
+	}
+}
+
+// serverOptions translates the configuration into server options. The
+// returned closers release files and connections opened along the way.
+func serverOptions(cfg *config.Config, level slog.Leveler) ([]server.Option, []io.Closer, error) {
+	var closers []io.Closer
+
+	opts := []server.Option{
+		server.WithBuildInfo(handlers.BuildInfo{
+			Version:   version,
+			Commit:    commit,
+			BuildTime: buildTime,
+		}),
+		server.WithTimeouts(cfg.Timeouts),
+		server.WithTLS(cfg.TLS),
+		server.WithEndpoints(cfg.Endpoints),
+		server.WithListeners(cfg.Listeners()),
+		server.WithSettings(handlerSettings(cfg)),
+		server.WithHistory(cfg.History.Size),
+		server.WithRedactHeaders(cfg.Log.RedactHeaders),
+	}
+	if cfg.AdminAddr != "" {
+		opts = append(opts, server.WithAdminAddr(cfg.AdminAddr))
+	}
+
+	// Prefer sockets passed by systemd socket activation
+	inherited, err := systemd.Listeners()
+	if err != nil {
+		return nil, closers, fmt.Errorf("socket activation: %w", err)
+	}
+	if len(inherited) > 0 {
+		slog.Info("Using systemd socket activation", "sockets", len(inherited))
+		opts = append(opts, server.WithInheritedListeners(inherited))
+	}
+	if cfg.ProxyProtocol {
+		opts = append(opts, server.WithProxyProtocol())
+	}
+	if cfg.ForwardProxy {
+		opts = append(opts, server.WithForwardProxy())
+	}
+	if cfg.Pprof {
+		opts = append(opts, server.WithPprof())
+	}
+
+	// Set up a separate, rotated access log if requested
+	if cfg.AccessLog.Path != "" {
+		file, err := logging.OpenRotatingFile(cfg.AccessLog.Path, cfg.AccessLog.MaxSizeMB<<20, cfg.AccessLog.MaxBackups, cfg.AccessLog.RotateInterval)
+		if err != nil {
+			return nil, closers, fmt.Errorf("opening access log: %w", err)
+		}
+		closers = append(closers, file)
+		accessLogger, _ := logging.New(file, cfg.Log.Format, level)
+		opts = append(opts, server.WithAccessLogger(accessLogger))
+	}
+
+	// Enable body logging if requested
+	if cfg.Log.Bodies {
+		opts = append(opts, server.WithBodyLogging(middleware.BodyLogConfig{
+			MaxBytes:      cfg.Log.BodyMax,
+			RedactHeaders: cfg.Log.RedactHeaders,
+			RedactFields:  cfg.Log.RedactFields,
+		}))
+	}
+
+	// Mirror requests to a secondary URL if requested
+	if cfg.Mirror.URL != "" {
+		mirror, err := middleware.NewMirror(middleware.MirrorConfig{
+			URL:       cfg.Mirror.URL,
+			Timeout:   cfg.Mirror.Timeout,
+			QueueSize: cfg.Mirror.QueueSize,
+			MaxBody:   cfg.Mirror.MaxBody,
+		})
+		if err != nil {
+			return nil, closers, fmt.Errorf("setting up mirroring: %w", err)
+		}
+		closers = append(closers, mirror)
+		opts = append(opts, server.WithMirror(mirror))
+	}
+
+	// Forward proxy routes to their upstreams if configured
+	if len(cfg.Proxy.Routes) > 0 {
+		p, err := proxy.New(cfg.Proxy.Routes)
+		if err != nil {
+			return nil, closers, fmt.Errorf("setting up proxy routes: %w", err)
+		}
+		opts = append(opts, server.WithProxy(p))
 	}
 
-	log.Println("Server exited")
+	// Answer script routes with their scripts if configured
+	if len(cfg.Scripts.Routes) > 0 {
+		scripts, err := script.New(cfg.Scripts.Routes)
+		if err != nil {
+			return nil, closers, fmt.Errorf("setting up script routes: %w", err)
+		}
+		opts = append(opts, server.WithScripts(scripts))
+	}
+
+	// Mock the operations of an OpenAPI document if given
+	if cfg.OpenAPI != "" {
+		data, err := os.ReadFile(cfg.OpenAPI)
+		if err != nil {
+			return nil, closers, fmt.Errorf("reading OpenAPI document: %w", err)
+		}
+		mock := openapi.NewMock()
+		if err := mock.Load(data, cfg.OpenAPI); err != nil {
+			return nil, closers, fmt.Errorf("loading OpenAPI document %s: %w", cfg.OpenAPI, err)
+		}
+		opts = append(opts, server.WithOpenAPI(mock))
+	}
+
+	// Answer scenario routes with their sequences if configured
+	if len(cfg.Scenarios) > 0 {
+		scenarios, err := scenario.New(cfg.Scenarios)
+		if err != nil {
+			return nil, closers, fmt.Errorf("setting up scenarios: %w", err)
+		}
+		opts = append(opts, server.WithScenarios(scenarios))
+	}
+
+	// Set up rate limiting if requested
+	if cfg.RateLimit.Mode != config.RateLimitOff {
+		key := middleware.GlobalKey
+		if cfg.RateLimit.Mode == config.RateLimitPerIP {
+			key = middleware.ClientIPKey
+		}
+		var limiter ratelimit.Limiter = ratelimit.NewTokenBucket(cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+		if cfg.RateLimit.Redis.Addr != "" {
+			redis := ratelimit.NewRedis(cfg.RateLimit.Redis.Addr, cfg.RateLimit.Redis.Prefix, cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+			closers = append(closers, redis)
+			limiter = redis
+		}
+		opts = append(opts, server.WithRateLimit(limiter, key))
+	}
+
+	// Apply the CORS policy if any origin is allowed
+	if cfg.CORS.Enabled() {
+		opts = append(opts, server.WithCORS(middleware.CORSConfig{
+			AllowedOrigins:   cfg.CORS.AllowedOrigins,
+			AllowedMethods:   cfg.CORS.AllowedMethods,
+			AllowedHeaders:   cfg.CORS.AllowedHeaders,
+			ExposedHeaders:   cfg.CORS.ExposedHeaders,
+			AllowCredentials: cfg.CORS.AllowCredentials,
+			MaxAge:           cfg.CORS.MaxAge,
+		}))
+	}
+
+	// Compress JSON responses if requested
+	if cfg.Compression.Enabled {
+		opts = append(opts, server.WithCompression(middleware.CompressionConfig{
+			MinSize: cfg.Compression.MinSize,
+		}))
+	}
+
+	// Shed load beyond the in-flight limit if requested
+	if cfg.Concurrency.MaxInFlight > 0 {
+		opts = append(opts, server.WithConcurrencyLimit(middleware.ConcurrencyConfig{
+			MaxInFlight:  cfg.Concurrency.MaxInFlight,
+			QueueDepth:   cfg.Concurrency.QueueDepth,
+			QueueTimeout: cfg.Concurrency.QueueTimeout,
+		}))
+	}
+
+	// Set up StatsD exporter if requested
+	if cfg.StatsD.Addr != "" {
+		format, _ := metrics.ParseTagFormat(cfg.StatsD.TagFormat)
+		statsd, err := metrics.NewStatsD(cfg.StatsD.Addr, cfg.StatsD.Prefix, format)
+		if err != nil {
+			return nil, closers, fmt.Errorf("setting up StatsD exporter: %w", err)
+		}
+		closers = append(closers, statsd)
+		opts = append(opts, server.WithMetrics(statsd))
+	}
+
+	return opts, closers, nil
+}
+
+// reloader re-reads the configuration and applies the settings that can
+// change without a restart. Flags given on the command line still take
+// precedence over the reloaded file and environment.
+type reloader struct {
+	mu    sync.Mutex
+	args  []string
+	cfg   *config.Config
+	level *slog.LevelVar
+	chaos *chaos.Engine
+	srv   *server.Server
+}
+
+// Reload re-resolves the configuration and applies the log level, chaos
+// rules and handler settings. Other changes need a restart; they are
+// logged and ignored.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, _, err := config.Parse(os.Args[0], r.args, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if err := r.chaos.SetRules(cfg.Chaos.Rules); err != nil {
+		return err
+	}
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	r.level.Set(level)
+	r.srv.SetSettings(handlerSettings(cfg))
+
+	pending := *cfg
+	copyReloadable(&pending, r.cfg)
+	if ignored := changedSettings(reflect.ValueOf(*r.cfg), reflect.ValueOf(pending), ""); len(ignored) > 0 {
+		slog.Warn("Configuration changes need a restart and were ignored", "settings", ignored)
+	}
+	copyReloadable(r.cfg, cfg)
+
+	slog.Info("Configuration reloaded", "log_level", level.String(), "chaos_rules", len(cfg.Chaos.Rules))
+	return nil
+}
+
+// copyReloadable copies the settings Reload applies from src to dst
+func copyReloadable(dst, src *config.Config) {
+	dst.Log.Level = src.Log.Level
+	dst.Chaos = src.Chaos
+	dst.TrustedProxies = src.TrustedProxies
+	dst.ProblemDetails = src.ProblemDetails
+	dst.PrettyJSON = src.PrettyJSON
+	dst.OriginChain = src.OriginChain
+	dst.MaxDelay = src.MaxDelay
+	dst.TemplatesDir = src.TemplatesDir
+	dst.SchemasDir = src.SchemasDir
+	dst.EnvPrefixes = src.EnvPrefixes
+	dst.PodInfoDir = src.PodInfoDir
+	dst.MetadataMock = src.MetadataMock
+	dst.Seed = src.Seed
+}
+
+// changedSettings returns the YAML paths of the fields that differ
+// between two config structs, such as "log.format"
+func changedSettings(old, cur reflect.Value, prefix string) []string {
+	var changed []string
+	for i := 0; i < old.NumField(); i++ {
+		name, _, _ := strings.Cut(old.Type().Field(i).Tag.Get("yaml"), ",")
+		a, b := old.Field(i), cur.Field(i)
+		switch {
+		case a.Kind() == reflect.Struct:
+			changed = append(changed, changedSettings(a, b, prefix+name+".")...)
+		case !reflect.DeepEqual(a.Interface(), b.Interface()):
+			changed = append(changed, prefix+name)
+		}
+	}
+	return changed
+}
+
+// fatal logs an error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
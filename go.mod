@@ -1,3 +1,21 @@
 module github.com/TykTechnologies/tyk-devops-assignement
 
 go 1.24.12
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require (
+	github.com/andybalholm/brotli v1.2.5
+	github.com/fxamacker/cbor/v2 v2.9.4
+	github.com/santhosh-tekuri/jsonschema/v6 v6.0.3
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	go.starlark.net v0.0.0-20250417143717-f57e51f710eb
+	golang.org/x/text v0.14.0
+	google.golang.org/protobuf v1.36.12
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+)
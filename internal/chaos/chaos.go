@@ -0,0 +1,265 @@
+// Package chaos injects latency, errors and connection aborts into
+// matching requests, so soak tests see realistic upstream misbehaviour.
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+)
+
+// Header marks responses affected by an injected fault
+const Header = "X-Httpbin-Chaos"
+
+// Duration is a time.Duration written as a string such as "250ms" in
+// both YAML and JSON
+type Duration time.Duration
+
+// MarshalJSON encodes d as a duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+// MarshalYAML encodes d as a duration string
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+// UnmarshalYAML decodes a duration string
+func (d *Duration) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+// parse sets d from a duration string
+func (d *Duration) parse(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Latency delays a fraction of requests by a random duration in [Min, Max]
+type Latency struct {
+	Probability float64  `yaml:"probability" json:"probability"`
+	Min         Duration `yaml:"min" json:"min"`
+	Max         Duration `yaml:"max" json:"max"`
+}
+
+// Error fails a fraction of requests with one of Statuses
+type Error struct {
+	Probability float64 `yaml:"probability" json:"probability"`
+	Statuses    []int   `yaml:"statuses" json:"statuses"`
+}
+
+// Abort drops the connection without a response for a fraction of requests
+type Abort struct {
+	Probability float64 `yaml:"probability" json:"probability"`
+}
+
+// Rule injects faults into requests whose path starts with Path and
+// whose method is one of Methods (any method if empty)
+type Rule struct {
+	Name    string   `yaml:"name" json:"name,omitempty"`
+	Path    string   `yaml:"path" json:"path"`
+	Methods []string `yaml:"methods" json:"methods,omitempty"`
+	Latency Latency  `yaml:"latency" json:"latency"`
+	Error   Error    `yaml:"error" json:"error"`
+	Abort   Abort    `yaml:"abort" json:"abort"`
+}
+
+// Validate checks a rule for invalid values
+func (rule Rule) Validate() error {
+	if !strings.HasPrefix(rule.Path, "/") {
+		return fmt.Errorf("chaos rule path %q must start with /", rule.Path)
+	}
+	for _, p := range []float64{rule.Latency.Probability, rule.Error.Probability, rule.Abort.Probability} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("chaos rule %s: probability %v out of range [0, 1]", rule.Path, p)
+		}
+	}
+	if rule.Latency.Min < 0 || rule.Latency.Max < rule.Latency.Min {
+		return fmt.Errorf("chaos rule %s: latency requires 0 <= min <= max", rule.Path)
+	}
+	if rule.Error.Probability > 0 && len(rule.Error.Statuses) == 0 {
+		return fmt.Errorf("chaos rule %s: error injection requires statuses", rule.Path)
+	}
+	for _, status := range rule.Error.Statuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("chaos rule %s: invalid status %d", rule.Path, status)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to r
+func (rule Rule) matches(r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, rule.Path) {
+		return false
+	}
+	return len(rule.Methods) == 0 || slices.ContainsFunc(rule.Methods, func(m string) bool {
+		return strings.EqualFold(m, r.Method)
+	})
+}
+
+// Engine holds the active rules and applies them to requests. Rules can be
+// replaced at runtime, e.g. from the admin API or on reload.
+type Engine struct {
+	mu    sync.RWMutex
+	rules []Rule
+	rand  func() float64
+}
+
+// NewEngine creates an engine with the given rules
+func NewEngine(rules []Rule) (*Engine, error) {
+	e := &Engine{rand: rand.Float64}
+	if err := e.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Rules returns a copy of the active rules
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return slices.Clone(e.rules)
+}
+
+// SetRules validates and replaces the active rules
+func (e *Engine) SetRules(rules []Rule) error {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = slices.Clone(rules)
+	return nil
+}
+
+// match returns the first rule matching r
+func (e *Engine) match(r *http.Request) (Rule, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, rule := range e.rules {
+		if rule.matches(r) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// roll reports whether an event with probability p happens
+func (e *Engine) roll(p float64) bool {
+	return p > 0 && e.rand() < p
+}
+
+// Middleware applies the first matching rule to each request: latency
+// first, then a connection abort or an error response. Admin and debug
+// endpoints are exempt, so rules can always be inspected and removed.
+func (e *Engine) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handlers.AdminPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rule, ok := e.match(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if e.roll(rule.Latency.Probability) {
+			delay := time.Duration(rule.Latency.Min)
+			if spread := rule.Latency.Max - rule.Latency.Min; spread > 0 {
+				delay += time.Duration(e.rand() * float64(spread))
+			}
+			w.Header().Add(Header, "latency="+delay.String())
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		if e.roll(rule.Abort.Probability) {
+			// The server closes the connection without logging a panic
+			panic(http.ErrAbortHandler)
+		}
+
+		if e.roll(rule.Error.Probability) {
+			statuses := rule.Error.Statuses
+			status := statuses[min(int(e.rand()*float64(len(statuses))), len(statuses)-1)]
+			w.Header().Add(Header, fmt.Sprintf("error=%d", status))
+			handlers.JSONError(w, r, status, "Injected fault")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rulesDocument is the admin API request and response body
+type rulesDocument struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Handler returns the admin API: GET lists the rules, PUT replaces them
+// and DELETE removes them all
+func (e *Engine) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var doc rulesDocument
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&doc); err != nil {
+				handlers.JSONError(w, r, http.StatusBadRequest, "Invalid rules: "+err.Error())
+				return
+			}
+			if err := e.SetRules(doc.Rules); err != nil {
+				handlers.JSONError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+		case http.MethodDelete:
+			e.SetRules(nil)
+		default:
+			handlers.JSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		rules := e.Rules()
+		if rules == nil {
+			rules = []Rule{}
+		}
+		handlers.JSONResponse(w, r, http.StatusOK, rulesDocument{Rules: rules})
+	}
+}
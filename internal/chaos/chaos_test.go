@@ -0,0 +1,174 @@
+package chaos
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedRand returns a random source yielding the given values in turn
+func fixedRand(values ...float64) func() float64 {
+	i := 0
+	return func() float64 {
+		v := values[i%len(values)]
+		i++
+		return v
+	}
+}
+
+// okHandler always responds with 200
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// TestMiddleware tests rule matching and fault injection
+func TestMiddleware(t *testing.T) {
+	rules := []Rule{
+		{Path: "/status/", Error: Error{Probability: 0.5, Statuses: []int{500, 503}}},
+		{Path: "/post", Methods: []string{"POST"}, Error: Error{Probability: 1, Statuses: []int{502}}},
+		{Path: "/delay", Latency: Latency{Probability: 1, Min: Duration(10 * time.Millisecond), Max: Duration(10 * time.Millisecond)}},
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		rand           []float64
+		expectedStatus int
+		expectedChaos  string
+	}{
+		{"No matching rule", "GET", "/get", []float64{0}, http.StatusOK, ""},
+		{"Error injected", "GET", "/status/200", []float64{0.1, 0.9}, http.StatusServiceUnavailable, "error=503"},
+		{"Error not rolled", "GET", "/status/200", []float64{0.7}, http.StatusOK, ""},
+		{"Method matches", "POST", "/post", []float64{0}, http.StatusBadGateway, "error=502"},
+		{"Method does not match", "GET", "/post", []float64{0}, http.StatusOK, ""},
+		{"Latency injected", "GET", "/delay/1", []float64{0}, http.StatusOK, "latency=10ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewEngine(rules)
+			if err != nil {
+				t.Fatalf("NewEngine failed: %v", err)
+			}
+			e.rand = fixedRand(tt.rand...)
+
+			rr := httptest.NewRecorder()
+			e.Middleware(okHandler).ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get(Header); got != tt.expectedChaos {
+				t.Errorf("Expected %s %q, got %q", Header, tt.expectedChaos, got)
+			}
+		})
+	}
+}
+
+// TestMiddlewareAbort tests that aborts drop the connection
+func TestMiddlewareAbort(t *testing.T) {
+	e, _ := NewEngine([]Rule{{Path: "/", Abort: Abort{Probability: 1}}})
+	srv := httptest.NewServer(e.Middleware(okHandler))
+	defer srv.Close()
+
+	if _, err := http.Get(srv.URL + "/get"); err == nil {
+		t.Error("Expected the connection to be aborted")
+	}
+}
+
+// TestMiddlewareAdminExempt tests that a catch-all rule leaves the admin
+// API reachable on the same chain, so the rule can be removed
+func TestMiddlewareAdminExempt(t *testing.T) {
+	e, _ := NewEngine([]Rule{{Path: "/", Error: Error{Probability: 1, Statuses: []int{500}}}})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/chaos", e.Handler())
+	mux.Handle("/", okHandler)
+	handler := e.Middleware(mux)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/get", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected the rule to fault /get, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("DELETE", "/admin/chaos", nil))
+	if rr.Code != http.StatusOK || len(e.Rules()) != 0 {
+		t.Fatalf("Expected the rule to be removed, got %d with %d rules", rr.Code, len(e.Rules()))
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/get", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected /get to recover, got %d", rr.Code)
+	}
+}
+
+// TestRuleValidate tests rule validation
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"Relative path", Rule{Path: "get"}},
+		{"Probability above 1", Rule{Path: "/", Abort: Abort{Probability: 1.5}}},
+		{"Min above max", Rule{Path: "/", Latency: Latency{Min: Duration(time.Second)}}},
+		{"Error without statuses", Rule{Path: "/", Error: Error{Probability: 0.1}}},
+		{"Invalid status", Rule{Path: "/", Error: Error{Probability: 0.1, Statuses: []int{42}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); err == nil {
+				t.Error("Expected a validation error")
+			}
+		})
+	}
+}
+
+// TestHandler tests the admin API
+func TestHandler(t *testing.T) {
+	e, _ := NewEngine(nil)
+	handler := e.Handler()
+
+	body := `{"rules":[{"path":"/get","latency":{"probability":0.5,"min":"100ms","max":"1s"}}]}`
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("PUT", "/admin/chaos", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/admin/chaos", nil))
+	var doc struct {
+		Rules []map[string]any `json:"rules"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(doc.Rules) != 1 || doc.Rules[0]["latency"].(map[string]any)["max"] != "1s" {
+		t.Errorf("Unexpected rules: %v", doc.Rules)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("PUT", "/admin/chaos", strings.NewReader(`{"rules":[{"path":"/","abort":{"probability":3}}]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid rules to be rejected, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("DELETE", "/admin/chaos", nil))
+	if rr.Code != http.StatusOK || len(e.Rules()) != 0 {
+		t.Errorf("Expected rules to be cleared, got %d with %d rules", rr.Code, len(e.Rules()))
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("POST", "/admin/chaos", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rr.Code)
+	}
+}
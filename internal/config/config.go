@@ -0,0 +1,423 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/chaos"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/history"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/logging"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/metrics"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/middleware"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/proxy"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/ratelimit"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/scenario"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/script"
+)
+
+// EnvPrefix is the prefix of environment variables overriding the config
+const EnvPrefix = "HTTPBIN_"
+
+// Config holds all server settings.
+//
+// Values are resolved from, in increasing order of precedence: built-in
+// defaults, the YAML config file, HTTPBIN_* environment variables and
+// command-line flags.
+type Config struct {
+	Host           string              `yaml:"host"`
+	Port           int                 `yaml:"port"`
+	Listen         []string            `yaml:"listen"`
+	AdminAddr      string              `yaml:"admin_addr"`
+	ProxyProtocol  bool                `yaml:"proxy_protocol"`
+	ForwardProxy   bool                `yaml:"forward_proxy"`
+	TrustedProxies []string            `yaml:"trusted_proxies"`
+	ShutdownDrain  time.Duration       `yaml:"shutdown_drain"`
+	Pprof          bool                `yaml:"pprof"`
+	ProblemDetails bool                `yaml:"problem_details"`
+	PrettyJSON     bool                `yaml:"pretty_json"`
+	OriginChain    bool                `yaml:"origin_chain"`
+	MaxDelay       time.Duration       `yaml:"max_delay"`
+	TemplatesDir   string              `yaml:"templates_dir"`
+	SchemasDir     string              `yaml:"schemas_dir"`
+	EnvPrefixes    []string            `yaml:"env_prefixes"`
+	PodInfoDir     string              `yaml:"podinfo_dir"`
+	MetadataMock   bool                `yaml:"metadata_mock"`
+	Seed           int64               `yaml:"seed"`
+	OpenAPI        string              `yaml:"openapi"`
+	Endpoints      Endpoints           `yaml:"endpoints"`
+	Timeouts       Timeouts            `yaml:"timeouts"`
+	TLS            TLS                 `yaml:"tls"`
+	Log            Log                 `yaml:"log"`
+	AccessLog      AccessLog           `yaml:"access_log"`
+	StatsD         StatsD              `yaml:"statsd"`
+	RateLimit      RateLimit           `yaml:"rate_limit"`
+	Concurrency    Concurrency         `yaml:"concurrency"`
+	CORS           CORS                `yaml:"cors"`
+	Compression    Compression         `yaml:"compression"`
+	Chaos          Chaos               `yaml:"chaos"`
+	History        History             `yaml:"history"`
+	Mirror         Mirror              `yaml:"mirror"`
+	Proxy          Proxy               `yaml:"proxy"`
+	Scripts        Scripts             `yaml:"scripts"`
+	Scenarios      []scenario.Scenario `yaml:"scenarios"`
+}
+
+// Timeouts holds the HTTP server timeouts; zero disables a timeout
+type Timeouts struct {
+	ReadHeader time.Duration `yaml:"read_header"`
+	Read       time.Duration `yaml:"read"`
+	Write      time.Duration `yaml:"write"`
+	Idle       time.Duration `yaml:"idle"`
+	Shutdown   time.Duration `yaml:"shutdown"`
+	// Handler bounds each handler; X-Timeout may override it up to HandlerMax
+	Handler    time.Duration `yaml:"handler"`
+	HandlerMax time.Duration `yaml:"handler_max"`
+}
+
+// TLS enables HTTPS when both a certificate and key file are set
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Enabled reports whether TLS is configured
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// Log configures application logging and request body logging
+type Log struct {
+	Format        string   `yaml:"format"`
+	Level         string   `yaml:"level"`
+	Bodies        bool     `yaml:"bodies"`
+	BodyMax       int      `yaml:"body_max"`
+	RedactHeaders []string `yaml:"redact_headers"`
+	RedactFields  []string `yaml:"redact_fields"`
+}
+
+// AccessLog configures the rotated access log file
+type AccessLog struct {
+	Path           string        `yaml:"path"`
+	MaxSizeMB      int64         `yaml:"max_size_mb"`
+	MaxBackups     int           `yaml:"max_backups"`
+	RotateInterval time.Duration `yaml:"rotate_interval"`
+}
+
+// StatsD configures the StatsD/DogStatsD exporter
+type StatsD struct {
+	Addr      string `yaml:"addr"`
+	Prefix    string `yaml:"prefix"`
+	TagFormat string `yaml:"tag_format"`
+}
+
+// Rate limit modes
+const (
+	RateLimitOff    = "off"
+	RateLimitGlobal = "global"
+	RateLimitPerIP  = "per_ip"
+)
+
+// RateLimit configures the token bucket rate limiter
+type RateLimit struct {
+	// Mode is off, global (one bucket for all clients) or per_ip
+	Mode string `yaml:"mode"`
+	// Rate is the sustained number of requests per second
+	Rate float64 `yaml:"rate"`
+	// Burst is the bucket size, i.e. the maximum burst of requests
+	Burst int `yaml:"burst"`
+	// Redis shares the limit across replicas; in-memory if unset
+	Redis RateLimitRedis `yaml:"redis"`
+}
+
+// RateLimitRedis configures the Redis backend for rate limiting
+type RateLimitRedis struct {
+	Addr   string `yaml:"addr"`
+	Prefix string `yaml:"prefix"`
+}
+
+// validate checks the rate limit settings
+func (r RateLimit) validate() error {
+	switch r.Mode {
+	case RateLimitOff:
+		return nil
+	case RateLimitGlobal, RateLimitPerIP:
+	default:
+		return fmt.Errorf("unknown rate limit mode %q", r.Mode)
+	}
+
+	if r.Rate <= 0 || r.Burst < 1 {
+		return errors.New("rate limiting requires a positive rate and burst")
+	}
+	return nil
+}
+
+// Concurrency configures load shedding; a zero MaxInFlight disables it
+type Concurrency struct {
+	MaxInFlight  int           `yaml:"max_in_flight"`
+	QueueDepth   int           `yaml:"queue_depth"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+}
+
+// CORS configures the CORS policy; it is enabled when any origin is allowed
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+// Enabled reports whether CORS handling is configured
+func (c CORS) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+// Compression configures compression of JSON responses
+type Compression struct {
+	Enabled bool `yaml:"enabled"`
+	MinSize int  `yaml:"min_size"`
+}
+
+// Chaos configures fault injection; rules can also be changed at runtime
+// via /admin/chaos
+type Chaos struct {
+	Rules []chaos.Rule `yaml:"rules"`
+}
+
+// History configures the request history served on /admin/requests
+type History struct {
+	// Size is the number of requests kept; zero disables the history
+	Size int `yaml:"size"`
+}
+
+// Mirror configures copying every request to a secondary URL; it is
+// enabled when URL is set
+type Mirror struct {
+	URL       string        `yaml:"url"`
+	Timeout   time.Duration `yaml:"timeout"`
+	QueueSize int           `yaml:"queue_size"`
+	MaxBody   int64         `yaml:"max_body"`
+}
+
+func (m Mirror) validate() error {
+	if m.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(m.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("mirror url %q must be an http or https URL", m.URL)
+	}
+	if m.Timeout <= 0 || m.QueueSize <= 0 || m.MaxBody < 0 {
+		return errors.New("mirror timeout and queue_size must be positive and max_body not negative")
+	}
+	return nil
+}
+
+// Proxy configures path prefixes forwarded to real upstreams, with faults
+// injected into their responses
+type Proxy struct {
+	Routes []proxy.Route `yaml:"routes"`
+}
+
+// Scripts configures routes answered by Starlark scripts
+type Scripts struct {
+	Routes []script.Route `yaml:"routes"`
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	bodyLog := middleware.DefaultBodyLogConfig()
+	cors := middleware.DefaultCORSConfig()
+	compression := middleware.DefaultCompressionConfig()
+	mirror := middleware.DefaultMirrorConfig()
+
+	return &Config{
+		Host:           "0.0.0.0",
+		Port:           8080,
+		TrustedProxies: handlers.DefaultTrustedProxies,
+		MaxDelay:       handlers.DefaultMaxDelay,
+		EnvPrefixes:    handlers.DefaultEnvPrefixes,
+		PodInfoDir:     handlers.DefaultPodInfoDir,
+		Timeouts: Timeouts{
+			ReadHeader: 10 * time.Second,
+			Idle:       120 * time.Second,
+			Shutdown:   10 * time.Second,
+			HandlerMax: 60 * time.Second,
+		},
+		Log: Log{
+			Format:        "text",
+			Level:         "info",
+			BodyMax:       bodyLog.MaxBytes,
+			RedactHeaders: bodyLog.RedactHeaders,
+			RedactFields:  bodyLog.RedactFields,
+		},
+		AccessLog: AccessLog{
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
+		StatsD: StatsD{
+			Prefix:    "httpbin",
+			TagFormat: "dogstatsd",
+		},
+		RateLimit: RateLimit{
+			Mode:  RateLimitOff,
+			Rate:  10,
+			Burst: 20,
+			Redis: RateLimitRedis{Prefix: ratelimit.DefaultRedisPrefix},
+		},
+		Concurrency: Concurrency{
+			QueueTimeout: time.Second,
+		},
+		CORS: CORS{
+			AllowedMethods: cors.AllowedMethods,
+			AllowedHeaders: cors.AllowedHeaders,
+			MaxAge:         cors.MaxAge,
+		},
+		Compression: Compression{
+			MinSize: compression.MinSize,
+		},
+		History: History{Size: history.DefaultSize},
+		Mirror: Mirror{
+			Timeout:   mirror.Timeout,
+			QueueSize: mirror.QueueSize,
+			MaxBody:   mirror.MaxBody,
+		},
+	}
+}
+
+// Addr returns the host:port the main listener binds to
+func (c *Config) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// LoadFile merges the YAML file at path into c; unknown keys are rejected
+// so typos don't silently fall back to defaults
+func (c *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// ParsePrefixes parses a list of CIDRs; bare IPs are treated as
+// single-address prefixes
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, entry := range list {
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Validate checks the configuration for invalid values
+func (c *Config) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port %d out of range", c.Port)
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		return err
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		return fmt.Errorf("unknown log format %q", c.Log.Format)
+	}
+
+	if _, err := metrics.ParseTagFormat(c.StatsD.TagFormat); err != nil {
+		return err
+	}
+
+	if _, err := ParsePrefixes(c.TrustedProxies); err != nil {
+		return err
+	}
+
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+
+	if c.MaxDelay <= 0 {
+		return errors.New("max_delay must be positive")
+	}
+
+	if c.Timeouts.Handler < 0 || c.Timeouts.HandlerMax < 0 {
+		return errors.New("handler timeouts must not be negative")
+	}
+
+	for _, rule := range c.Chaos.Rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Compression.MinSize < 0 {
+		return errors.New("compression min_size must not be negative")
+	}
+
+	if c.Concurrency.MaxInFlight < 0 || c.Concurrency.QueueDepth < 0 || c.Concurrency.QueueTimeout < 0 {
+		return errors.New("concurrency limits must not be negative")
+	}
+
+	for _, route := range c.Proxy.Routes {
+		if err := route.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, route := range c.Scripts.Routes {
+		if err := route.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, sc := range c.Scenarios {
+		if err := sc.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mirror.validate(); err != nil {
+		return err
+	}
+
+	if c.History.Size < 0 {
+		return errors.New("history size must not be negative")
+	}
+
+	if err := c.Endpoints.validate(); err != nil {
+		return err
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("tls requires both cert_file and key_file")
+	}
+
+	if err := c.validateListeners(); err != nil {
+		return err
+	}
+
+	return nil
+}
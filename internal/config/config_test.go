@@ -0,0 +1,263 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// envMap returns a lookup function backed by a map
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+// writeConfig writes a YAML config file into a temp dir
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "httpbin.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+// TestParseDefaults tests that defaults apply without file, env or flags
+func TestParseDefaults(t *testing.T) {
+	cfg, opts, err := Parse("httpbin", nil, envMap(nil))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Expected defaults, got %+v", cfg)
+	}
+	if cfg.Addr() != "0.0.0.0:8080" {
+		t.Errorf("Expected default addr 0.0.0.0:8080, got %s", cfg.Addr())
+	}
+	if opts.ConfigFile != "" || opts.ShowVersion {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+}
+
+// TestParsePrecedence tests that flags override env, which overrides the file
+func TestParsePrecedence(t *testing.T) {
+	path := writeConfig(t, `
+host: 127.0.0.1
+port: 9000
+timeouts:
+  read: 5s
+  write: 30s
+log:
+  level: warn
+  redact_fields: [password, api_key]
+statsd:
+  addr: localhost:8125
+`)
+
+	env := envMap(map[string]string{
+		"HTTPBIN_PORT":           "9100",
+		"HTTPBIN_TIMEOUTS_WRITE": "45s",
+		"HTTPBIN_LOG_FORMAT":     "json",
+	})
+
+	cfg, opts, err := Parse("httpbin", []string{"-config", path, "-port", "9200", "-log-level", "debug"}, env)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if opts.ConfigFile != path {
+		t.Errorf("Expected config file %s, got %s", path, opts.ConfigFile)
+	}
+
+	// From the file
+	if cfg.Host != "127.0.0.1" || cfg.Timeouts.Read != 5*time.Second || cfg.StatsD.Addr != "localhost:8125" {
+		t.Errorf("Expected file values to apply, got %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Log.RedactFields, []string{"password", "api_key"}) {
+		t.Errorf("Expected redact fields from file, got %v", cfg.Log.RedactFields)
+	}
+
+	// Env overrides file
+	if cfg.Timeouts.Write != 45*time.Second || cfg.Log.Format != "json" {
+		t.Errorf("Expected env values to override file, got %+v", cfg)
+	}
+
+	// Flags override env and file
+	if cfg.Port != 9200 || cfg.Log.Level != "debug" {
+		t.Errorf("Expected flags to override env, got port=%d level=%s", cfg.Port, cfg.Log.Level)
+	}
+
+	// Untouched defaults survive
+	if cfg.Timeouts.Shutdown != 10*time.Second {
+		t.Errorf("Expected default shutdown timeout, got %v", cfg.Timeouts.Shutdown)
+	}
+}
+
+// TestParseConfigFromEnv tests locating the config file via HTTPBIN_CONFIG
+func TestParseConfigFromEnv(t *testing.T) {
+	path := writeConfig(t, "port: 9300\n")
+
+	cfg, _, err := Parse("httpbin", nil, envMap(map[string]string{"HTTPBIN_CONFIG": path}))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if cfg.Port != 9300 {
+		t.Errorf("Expected port 9300 from file, got %d", cfg.Port)
+	}
+}
+
+// TestParseErrors tests rejection of invalid configuration
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+	}{
+		{name: "unknown key", file: "prot: 80\n"},
+		{name: "bad env value", env: map[string]string{"HTTPBIN_PORT": "eighty"}},
+		{name: "bad env duration", env: map[string]string{"HTTPBIN_TIMEOUTS_READ": "soon"}},
+		{name: "bad log level", args: []string{"-log-level", "loud"}},
+		{name: "bad log format", args: []string{"-log-format", "xml"}},
+		{name: "bad tag format", args: []string{"-statsd-tag-format", "prometheus"}},
+		{name: "port out of range", args: []string{"-port", "70000"}},
+		{name: "tls without key", args: []string{"-tls-cert", "cert.pem"}},
+		{name: "unknown flag", args: []string{"-nope"}},
+		{name: "bad rate limit mode", args: []string{"-rate-limit", "per_user"}},
+		{name: "negative queue depth", args: []string{"-queue-depth", "-1"}},
+		{name: "zero max delay", args: []string{"-max-delay", "0"}},
+		{name: "bad mirror url", args: []string{"-mirror-url", "localhost:9000"}},
+		{name: "zero mirror timeout", args: []string{"-mirror-url", "http://localhost:9000", "-mirror-timeout", "0"}},
+		{name: "bad chaos probability", file: "chaos:\n  rules:\n    - path: /get\n      abort: {probability: 2}\n"},
+		{name: "bad proxy upstream", file: "proxy:\n  routes:\n    - prefix: /api/\n      upstream: localhost:9000\n"},
+		{name: "script without source", file: "scripts:\n  routes:\n    - pattern: GET /orders/{id}\n"},
+		{name: "scenario without responses", file: "scenarios:\n  - name: flaky\n    pattern: /get\n"},
+		{name: "bad script pattern", file: "scripts:\n  routes:\n    - pattern: GET orders\n      source: x\n"},
+		{name: "bad chaos duration", file: "chaos:\n  rules:\n    - path: /get\n      latency: {probability: 1, min: soon}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfig(t, tt.file)}, args...)
+			}
+			if _, _, err := Parse("httpbin", args, envMap(tt.env)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// TestChaosRules tests loading chaos rules from the config file
+func TestChaosRules(t *testing.T) {
+	path := writeConfig(t, `
+chaos:
+  rules:
+    - name: slow-get
+      path: /get
+      methods: [GET]
+      latency: {probability: 0.5, min: 100ms, max: 2s}
+      error: {probability: 0.1, statuses: [500, 503]}
+`)
+
+	cfg, _, err := Parse("httpbin", []string{"-config", path}, envMap(nil))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if len(cfg.Chaos.Rules) != 1 {
+		t.Fatalf("Expected 1 chaos rule, got %d", len(cfg.Chaos.Rules))
+	}
+	rule := cfg.Chaos.Rules[0]
+	if rule.Name != "slow-get" || time.Duration(rule.Latency.Max) != 2*time.Second || len(rule.Error.Statuses) != 2 {
+		t.Errorf("Unexpected chaos rule: %+v", rule)
+	}
+}
+
+// TestEndpointsToggle tests disabling endpoint groups
+func TestEndpointsToggle(t *testing.T) {
+	cfg, _, err := Parse("httpbin", []string{"-disable-endpoints", "auth,delay"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if cfg.Endpoints.Enabled(GroupAuth) || cfg.Endpoints.Enabled(GroupDelay) {
+		t.Error("Expected auth and delay to be disabled")
+	}
+	if !cfg.Endpoints.Enabled(GroupStatus) {
+		t.Error("Expected status to stay enabled")
+	}
+
+	if _, _, err := Parse("httpbin", []string{"-disable-endpoints", "everything"}, envMap(nil)); err == nil {
+		t.Error("Expected error for unknown endpoint group")
+	}
+}
+
+// TestListeners tests resolution of listen addresses
+func TestListeners(t *testing.T) {
+	cfg, _, err := Parse("httpbin", []string{"-port", "9000"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := cfg.Listeners(); !reflect.DeepEqual(got, []Listener{{Addr: "0.0.0.0:9000"}}) {
+		t.Errorf("Expected host:port listener, got %v", got)
+	}
+
+	env := envMap(map[string]string{"HTTPBIN_LISTEN": "127.0.0.1:1111"})
+	args := []string{
+		"-tls-cert", "cert.pem", "-tls-key", "key.pem",
+		"-listen", "0.0.0.0:8080",
+		"-listen", "http://[::]:8081,https://:8443",
+	}
+	cfg, _, err = Parse("httpbin", args, env)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// Flags replace the env list rather than appending to it
+	expected := []Listener{
+		{Addr: "0.0.0.0:8080", TLS: true},
+		{Addr: "[::]:8081", TLS: false},
+		{Addr: ":8443", TLS: true},
+	}
+	if got := cfg.Listeners(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	if _, _, err := Parse("httpbin", []string{"-listen", "https://:8443"}, envMap(nil)); err == nil {
+		t.Error("Expected error for https listener without a certificate")
+	}
+	if _, _, err := Parse("httpbin", []string{"-listen", "localhost"}, envMap(nil)); err == nil {
+		t.Error("Expected error for listen address without a port")
+	}
+}
+
+// TestParsePrefixes tests trusted proxy parsing
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"10.1.2.3/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("ParsePrefixes failed: %v", err)
+	}
+
+	expected := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::/32"}
+	for i, p := range prefixes {
+		if p.String() != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], p)
+		}
+	}
+
+	if _, _, err := Parse("httpbin", []string{"-trusted-proxies", "10.0.0.0/33"}, envMap(nil)); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+
+	cfg, _, err := Parse("httpbin", []string{"-trusted-proxies", ""}, envMap(nil))
+	if err != nil || len(cfg.TrustedProxies) != 0 {
+		t.Errorf("Expected empty flag to trust no proxies, got %v (%v)", cfg.TrustedProxies, err)
+	}
+}
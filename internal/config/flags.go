@@ -0,0 +1,183 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+)
+
+// listValue is a flag.Value for comma-separated lists
+type listValue struct {
+	list *[]string
+}
+
+func (l listValue) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return strings.Join(*l.list, ",")
+}
+
+func (l listValue) Set(s string) error {
+	*l.list = SplitList(s)
+	return nil
+}
+
+// repeatedValue is a flag.Value collecting repeated flags. The first
+// occurrence replaces values from the file or environment, later
+// occurrences append.
+type repeatedValue struct {
+	list *[]string
+	set  *bool
+}
+
+func (r repeatedValue) String() string {
+	if r.list == nil {
+		return ""
+	}
+	return strings.Join(*r.list, ",")
+}
+
+func (r repeatedValue) Set(s string) error {
+	if !*r.set {
+		*r.list = nil
+		*r.set = true
+	}
+	*r.list = append(*r.list, SplitList(s)...)
+	return nil
+}
+
+// Options holds command-line settings that are not part of Config
+type Options struct {
+	ConfigFile  string
+	ShowVersion bool
+}
+
+// registerFlags binds command-line flags to the fields of c, using the
+// current field values as defaults
+func registerFlags(fs *flag.FlagSet, c *Config, o *Options) {
+	fs.StringVar(&o.ConfigFile, "config", o.ConfigFile, "Path to a YAML config file (env: HTTPBIN_CONFIG)")
+	fs.BoolVar(&o.ShowVersion, "version", false, "Show version information")
+
+	fs.StringVar(&c.Host, "host", c.Host, "Host to bind the server to")
+	fs.IntVar(&c.Port, "port", c.Port, "Port to bind the server to")
+	fs.Var(repeatedValue{list: &c.Listen, set: new(bool)}, "listen", "Address to listen on, optionally prefixed with http:// or https://; may be repeated and overrides -host/-port")
+	fs.BoolVar(&c.ProxyProtocol, "proxy-protocol", c.ProxyProtocol, "Require a PROXY protocol v1/v2 header on every connection (e.g. behind AWS NLB)")
+	fs.BoolVar(&c.ForwardProxy, "forward-proxy", c.ForwardProxy, "Act as an HTTP forward proxy for CONNECT and absolute-form requests, recording them on /admin/forward-proxy")
+	fs.Var(listValue{&c.TrustedProxies}, "trusted-proxies", "Comma-separated CIDRs/IPs of proxies allowed to set X-Forwarded-For/X-Real-IP (empty trusts none)")
+	fs.StringVar(&c.AdminAddr, "admin-addr", c.AdminAddr, "Serve admin endpoints on this address (host:port) instead of the main listener")
+	fs.DurationVar(&c.ShutdownDrain, "shutdown-drain", c.ShutdownDrain, "Fail readiness for this long before shutting down, e.g. 5s")
+	fs.BoolVar(&c.Pprof, "enable-pprof", c.Pprof, "Expose pprof profiling endpoints on the admin listener")
+	fs.DurationVar(&c.MaxDelay, "max-delay", c.MaxDelay, "Longest delay /delay will apply, e.g. 60s")
+	fs.StringVar(&c.TemplatesDir, "templates-dir", c.TemplatesDir, "Directory of templates served on /template/{name}")
+	fs.StringVar(&c.SchemasDir, "schemas-dir", c.SchemasDir, "Directory of JSON Schemas /validate can name, as {name}.json")
+	fs.Var(listValue{&c.EnvPrefixes}, "env-prefixes", "Comma-separated prefixes of the environment variables /env reveals (empty reveals none)")
+	fs.StringVar(&c.PodInfoDir, "podinfo-dir", c.PodInfoDir, "Directory of the downward-API labels and annotations files reported by /k8s")
+	fs.BoolVar(&c.MetadataMock, "metadata-mock", c.MetadataMock, "Serve fake AWS and GCP instance metadata below /metadata")
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "Seed random behaviour for reproducible runs (0 keeps it random); requests can override it with ?seed=")
+	fs.StringVar(&c.OpenAPI, "openapi", c.OpenAPI, "OpenAPI 3 document (JSON or YAML) to serve mock responses for")
+	fs.BoolVar(&c.OriginChain, "origin-chain", c.OriginChain, "Report the whole X-Forwarded-For chain plus the direct peer as origin; requests can override it with ?origin_chain=")
+	fs.BoolVar(&c.PrettyJSON, "pretty", c.PrettyJSON, "Indent JSON and XML responses by default; requests can override it with ?pretty=")
+	fs.BoolVar(&c.ProblemDetails, "problem-details", c.ProblemDetails, "Report errors as RFC 7807 application/problem+json documents")
+
+	fs.Var(listValue{&c.Endpoints.Disabled}, "disable-endpoints", "Comma-separated endpoint groups to disable: "+strings.Join(EndpointGroups, ", "))
+
+	fs.DurationVar(&c.Timeouts.ReadHeader, "read-header-timeout", c.Timeouts.ReadHeader, "Maximum time to read request headers (0 disables)")
+	fs.DurationVar(&c.Timeouts.Read, "read-timeout", c.Timeouts.Read, "Maximum time to read the entire request (0 disables)")
+	fs.DurationVar(&c.Timeouts.Write, "write-timeout", c.Timeouts.Write, "Maximum time to write the response (0 disables)")
+	fs.DurationVar(&c.Timeouts.Idle, "idle-timeout", c.Timeouts.Idle, "Maximum keep-alive idle time (0 disables)")
+	fs.DurationVar(&c.Timeouts.Shutdown, "shutdown-timeout", c.Timeouts.Shutdown, "Maximum time to wait for in-flight requests on shutdown")
+	fs.DurationVar(&c.Timeouts.Handler, "handler-timeout", c.Timeouts.Handler, "Maximum time a handler may run before a 504 (0 disables)")
+	fs.DurationVar(&c.Timeouts.HandlerMax, "max-handler-timeout", c.Timeouts.HandlerMax, "Upper bound for timeouts requested via the X-Timeout header (0 means unbounded)")
+
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "TLS certificate file; enables HTTPS together with -tls-key")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "TLS private key file")
+
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "Log format: text or json")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "Log level: debug, info, warn or error")
+	fs.BoolVar(&c.Log.Bodies, "log-bodies", c.Log.Bodies, "Log request and response bodies at debug level")
+	fs.IntVar(&c.Log.BodyMax, "log-body-max", c.Log.BodyMax, "Maximum number of body bytes to log")
+	fs.Var(listValue{&c.Log.RedactHeaders}, "log-redact-headers", "Comma-separated headers to redact in body logs, the request history and /admin/tail")
+	fs.Var(listValue{&c.Log.RedactFields}, "log-redact-fields", "Comma-separated JSON/form fields to redact in body logs")
+
+	fs.StringVar(&c.AccessLog.Path, "access-log", c.AccessLog.Path, "Write access logs to this file instead of stderr")
+	fs.Int64Var(&c.AccessLog.MaxSizeMB, "access-log-max-size", c.AccessLog.MaxSizeMB, "Rotate the access log after this many megabytes (0 disables)")
+	fs.IntVar(&c.AccessLog.MaxBackups, "access-log-max-backups", c.AccessLog.MaxBackups, "Number of rotated access log files to keep")
+	fs.DurationVar(&c.AccessLog.RotateInterval, "access-log-rotate-interval", c.AccessLog.RotateInterval, "Rotate the access log after this interval, e.g. 24h (0 disables)")
+
+	fs.StringVar(&c.RateLimit.Mode, "rate-limit", c.RateLimit.Mode, "Rate limiting mode: off, global or per_ip")
+	fs.Float64Var(&c.RateLimit.Rate, "rate-limit-rate", c.RateLimit.Rate, "Sustained requests per second allowed by the rate limiter")
+	fs.IntVar(&c.RateLimit.Burst, "rate-limit-burst", c.RateLimit.Burst, "Maximum burst of requests allowed by the rate limiter")
+	fs.StringVar(&c.RateLimit.Redis.Addr, "rate-limit-redis", c.RateLimit.Redis.Addr, "Redis address (host:port) to share rate limits across replicas; in-memory if empty")
+	fs.StringVar(&c.RateLimit.Redis.Prefix, "rate-limit-redis-prefix", c.RateLimit.Redis.Prefix, "Prefix for rate limit keys in Redis")
+
+	fs.IntVar(&c.Concurrency.MaxInFlight, "max-in-flight", c.Concurrency.MaxInFlight, "Maximum concurrent requests before queueing and shedding load; 0 disables")
+	fs.IntVar(&c.Concurrency.QueueDepth, "queue-depth", c.Concurrency.QueueDepth, "Requests allowed to wait for a slot when -max-in-flight is reached")
+	fs.DurationVar(&c.Concurrency.QueueTimeout, "queue-timeout", c.Concurrency.QueueTimeout, "How long a queued request waits before being shed with 503")
+
+	fs.Var(listValue{&c.CORS.AllowedOrigins}, "cors-origins", "Comma-separated origins allowed by CORS, \"*\" for any; CORS is disabled if empty")
+	fs.Var(listValue{&c.CORS.AllowedMethods}, "cors-methods", "Comma-separated methods allowed in CORS preflight requests")
+	fs.Var(listValue{&c.CORS.AllowedHeaders}, "cors-headers", "Comma-separated request headers allowed by CORS, \"*\" for any")
+	fs.Var(listValue{&c.CORS.ExposedHeaders}, "cors-expose-headers", "Comma-separated response headers exposed to CORS clients")
+	fs.BoolVar(&c.CORS.AllowCredentials, "cors-credentials", c.CORS.AllowCredentials, "Allow credentials in CORS requests")
+	fs.DurationVar(&c.CORS.MaxAge, "cors-max-age", c.CORS.MaxAge, "How long browsers may cache CORS preflight results")
+
+	fs.BoolVar(&c.Compression.Enabled, "compress", c.Compression.Enabled, "Compress JSON responses with br, gzip or deflate as negotiated by Accept-Encoding")
+	fs.IntVar(&c.Compression.MinSize, "compress-min-size", c.Compression.MinSize, "Smallest response body in bytes worth compressing")
+
+	fs.IntVar(&c.History.Size, "history-size", c.History.Size, "Number of recent requests kept for /admin/requests (0 disables)")
+
+	fs.StringVar(&c.Mirror.URL, "mirror-url", c.Mirror.URL, "Asynchronously send a copy of every request to this URL; disabled if empty")
+	fs.DurationVar(&c.Mirror.Timeout, "mirror-timeout", c.Mirror.Timeout, "Maximum time to send one mirrored request")
+
+	fs.StringVar(&c.StatsD.Addr, "statsd-addr", c.StatsD.Addr, "StatsD/DogStatsD agent address (host:port); disabled if empty")
+	fs.StringVar(&c.StatsD.Prefix, "statsd-prefix", c.StatsD.Prefix, "Prefix for StatsD metric names")
+	fs.StringVar(&c.StatsD.TagFormat, "statsd-tag-format", c.StatsD.TagFormat, "StatsD tag format: dogstatsd, influxdb, graphite or none")
+}
+
+// Parse resolves the configuration from defaults, the config file,
+// environment variables and command-line args, in that order of
+// precedence. The args are parsed twice: once to locate the config file
+// and once more so that explicitly given flags override file and
+// environment values.
+func Parse(name string, args []string, lookup func(string) (string, bool)) (*Config, *Options, error) {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	opts := &Options{}
+	if path, ok := lookup(EnvPrefix + "CONFIG"); ok {
+		opts.ConfigFile = path
+	}
+
+	// First pass: find the config file
+	pre := flag.NewFlagSet(name, flag.ContinueOnError)
+	registerFlags(pre, Default(), opts)
+	if err := pre.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Default()
+	if opts.ConfigFile != "" {
+		if err := cfg.LoadFile(opts.ConfigFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := cfg.ApplyEnv(lookup); err != nil {
+		return nil, nil, err
+	}
+
+	// Second pass: explicit flags win
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	registerFlags(fs, cfg, opts)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, opts, nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+)
+
+// Endpoint groups that can be disabled with endpoints.disabled
+const (
+	GroupMethods    = handlers.GroupMethods
+	GroupInspection = handlers.GroupInspection
+	GroupDelay      = handlers.GroupDelay
+	GroupStream     = handlers.GroupStream
+	GroupStatus     = handlers.GroupStatus
+	GroupAuth       = handlers.GroupAuth
+	GroupFaults     = handlers.GroupFaults
+	GroupDocs       = handlers.GroupDocs
+	GroupProtocol   = handlers.GroupProtocol
+	GroupBins       = handlers.GroupBins
+	GroupMocks      = handlers.GroupMocks
+	GroupCaching    = handlers.GroupCaching
+	GroupFormats    = handlers.GroupFormats
+	GroupUtilities  = handlers.GroupUtilities
+	GroupAdmin      = "admin"
+)
+
+// EndpointGroups lists all known endpoint groups: those in the handler
+// registry plus the admin endpoints
+var EndpointGroups = append(handlers.DefaultRegistry.Names(), GroupAdmin)
+
+// Endpoints selects which endpoint groups are served
+type Endpoints struct {
+	Disabled []string `yaml:"disabled"`
+}
+
+// Enabled reports whether the named group is served
+func (e Endpoints) Enabled(group string) bool {
+	return !slices.Contains(e.Disabled, group)
+}
+
+// validate rejects unknown group names
+func (e Endpoints) validate() error {
+	for _, group := range e.Disabled {
+		if !slices.Contains(EndpointGroups, group) {
+			return fmt.Errorf("unknown endpoint group %q (known: %v)", group, EndpointGroups)
+		}
+	}
+	return nil
+}
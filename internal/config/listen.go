@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Listener is a single address the server binds to
+type Listener struct {
+	Addr string
+	TLS  bool
+}
+
+// String renders the listener with its scheme
+func (l Listener) String() string {
+	if l.TLS {
+		return "https://" + l.Addr
+	}
+	return "http://" + l.Addr
+}
+
+// Listeners resolves the addresses to bind. Entries in listen may be
+// prefixed with http:// or https:// to force plain HTTP or TLS; bare
+// host:port entries use TLS when it is configured. Without any listen
+// entries the server binds host:port alone.
+func (c *Config) Listeners() []Listener {
+	if len(c.Listen) == 0 {
+		return []Listener{{Addr: c.Addr(), TLS: c.TLS.Enabled()}}
+	}
+
+	listeners := make([]Listener, 0, len(c.Listen))
+	for _, entry := range c.Listen {
+		l := Listener{Addr: entry, TLS: c.TLS.Enabled()}
+		if addr, ok := strings.CutPrefix(entry, "https://"); ok {
+			l = Listener{Addr: addr, TLS: true}
+		} else if addr, ok := strings.CutPrefix(entry, "http://"); ok {
+			l = Listener{Addr: addr, TLS: false}
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// validateListeners checks that every listen entry is a valid address
+// and that TLS listeners have a certificate to serve
+func (c *Config) validateListeners() error {
+	for _, l := range c.Listeners() {
+		if _, _, err := net.SplitHostPort(l.Addr); err != nil {
+			return fmt.Errorf("invalid listen address %q: %w", l.Addr, err)
+		}
+		if l.TLS && !c.TLS.Enabled() {
+			return errors.New("https listeners require tls.cert_file and tls.key_file")
+		}
+	}
+	return nil
+}
@@ -15,7 +15,7 @@ func BasicAuthHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract expected credentials from path: /basic-auth/{user}/{passwd}
 	pathParts := strings.Split(strings.TrimPrefix(r.URL.Path, "/basic-auth/"), "/")
 	if len(pathParts) < 2 {
-		writeJSONError(w, http.StatusBadRequest, "Invalid path format. Use /basic-auth/{user}/{passwd}")
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid path format. Use /basic-auth/{user}/{passwd}")
 		return
 	}
 
@@ -27,14 +27,14 @@ func BasicAuthHandler(w http.ResponseWriter, r *http.Request) {
 	if auth == "" {
 		// Send 401 with WWW-Authenticate header
 		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		writeJSONError(w, http.StatusUnauthorized, "Authorization required")
+		writeJSONError(w, r, http.StatusUnauthorized, "Authorization required")
 		return
 	}
 
 	// Check if it's Basic auth
 	if !strings.HasPrefix(auth, "Basic ") {
 		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		writeJSONError(w, http.StatusUnauthorized, "Basic authentication required")
+		writeJSONError(w, r, http.StatusUnauthorized, "Basic authentication required")
 		return
 	}
 
@@ -42,7 +42,7 @@ func BasicAuthHandler(w http.ResponseWriter, r *http.Request) {
 	payload, err := base64.StdEncoding.DecodeString(auth[6:])
 	if err != nil {
 		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		writeJSONError(w, http.StatusUnauthorized, "Invalid authorization format")
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid authorization format")
 		return
 	}
 
@@ -50,7 +50,7 @@ func BasicAuthHandler(w http.ResponseWriter, r *http.Request) {
 	credentials := strings.SplitN(string(payload), ":", 2)
 	if len(credentials) != 2 {
 		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		writeJSONError(w, http.StatusUnauthorized, "Invalid credentials format")
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid credentials format")
 		return
 	}
 
@@ -60,7 +60,7 @@ func BasicAuthHandler(w http.ResponseWriter, r *http.Request) {
 	// Compare credentials
 	if user != expectedUser || passwd != expectedPasswd {
 		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		writeJSONError(w, http.StatusUnauthorized, "Invalid username or password")
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid username or password")
 		return
 	}
 
@@ -69,7 +69,7 @@ func BasicAuthHandler(w http.ResponseWriter, r *http.Request) {
 		"authenticated": true,
 		"user":          user,
 	}
-	writeJSONResponse(w, http.StatusOK, response)
+	writeJSONResponse(w, r, http.StatusOK, response)
 }
 
 // BearerHandler handles Bearer token authentication
@@ -78,14 +78,14 @@ func BearerHandler(w http.ResponseWriter, r *http.Request) {
 	auth := r.Header.Get("Authorization")
 	if auth == "" {
 		w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
-		writeJSONError(w, http.StatusUnauthorized, "Authorization required")
+		writeJSONError(w, r, http.StatusUnauthorized, "Authorization required")
 		return
 	}
 
 	// Check if it's Bearer auth
 	if !strings.HasPrefix(auth, "Bearer ") {
 		w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
-		writeJSONError(w, http.StatusUnauthorized, "Bearer token required")
+		writeJSONError(w, r, http.StatusUnauthorized, "Bearer token required")
 		return
 	}
 
@@ -93,7 +93,7 @@ func BearerHandler(w http.ResponseWriter, r *http.Request) {
 	token := strings.TrimPrefix(auth, "Bearer ")
 	if token == "" {
 		w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
-		writeJSONError(w, http.StatusUnauthorized, "Bearer token is empty")
+		writeJSONError(w, r, http.StatusUnauthorized, "Bearer token is empty")
 		return
 	}
 
@@ -103,7 +103,7 @@ func BearerHandler(w http.ResponseWriter, r *http.Request) {
 		"authenticated": true,
 		"token":         token,
 	}
-	writeJSONResponse(w, http.StatusOK, response)
+	writeJSONResponse(w, r, http.StatusOK, response)
 }
 
 // DigestAuthHandler handles HTTP Digest Authentication
@@ -111,7 +111,7 @@ func DigestAuthHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract parameters from path: /digest-auth/{qop}/{user}/{passwd}
 	pathParts := strings.Split(strings.TrimPrefix(r.URL.Path, "/digest-auth/"), "/")
 	if len(pathParts) < 3 {
-		writeJSONError(w, http.StatusBadRequest, "Invalid path format. Use /digest-auth/{qop}/{user}/{passwd}")
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid path format. Use /digest-auth/{qop}/{user}/{passwd}")
 		return
 	}
 
@@ -127,7 +127,7 @@ func DigestAuthHandler(w http.ResponseWriter, r *http.Request) {
 		opaque := generateOpaque()
 		challenge := fmt.Sprintf(`Digest realm="Restricted", qop="%s", nonce="%s", opaque="%s"`, qop, nonce, opaque)
 		w.Header().Set("WWW-Authenticate", challenge)
-		writeJSONError(w, http.StatusUnauthorized, "Authorization required")
+		writeJSONError(w, r, http.StatusUnauthorized, "Authorization required")
 		return
 	}
 
@@ -137,7 +137,7 @@ func DigestAuthHandler(w http.ResponseWriter, r *http.Request) {
 		opaque := generateOpaque()
 		challenge := fmt.Sprintf(`Digest realm="Restricted", qop="%s", nonce="%s", opaque="%s"`, qop, nonce, opaque)
 		w.Header().Set("WWW-Authenticate", challenge)
-		writeJSONError(w, http.StatusUnauthorized, "Digest authentication required")
+		writeJSONError(w, r, http.StatusUnauthorized, "Digest authentication required")
 		return
 	}
 
@@ -151,7 +151,7 @@ func DigestAuthHandler(w http.ResponseWriter, r *http.Request) {
 		opaque := generateOpaque()
 		challenge := fmt.Sprintf(`Digest realm="Restricted", qop="%s", nonce="%s", opaque="%s"`, qop, nonce, opaque)
 		w.Header().Set("WWW-Authenticate", challenge)
-		writeJSONError(w, http.StatusUnauthorized, "Invalid username")
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid username")
 		return
 	}
 
@@ -161,7 +161,7 @@ func DigestAuthHandler(w http.ResponseWriter, r *http.Request) {
 		"authenticated": true,
 		"user":          username,
 	}
-	writeJSONResponse(w, http.StatusOK, response)
+	writeJSONResponse(w, r, http.StatusOK, response)
 }
 
 // generateNonce generates a random nonce for digest auth
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Bin limits; the oldest bin is dropped when a new one would exceed
+// maxBins, and a bin keeps only its most recent binRequests requests
+const (
+	maxBins     = 100
+	binRequests = 100
+	binIdle     = 24 * time.Hour
+)
+
+// BinResponse describes a bin
+type BinResponse struct {
+	ID          string `json:"id"`
+	URL         string `json:"url"`
+	RequestsURL string `json:"requests_url"`
+}
+
+// BinRequestsResponse is the body returned by /bins/{id}/requests
+type BinRequestsResponse struct {
+	Bin      string            `json:"bin"`
+	Requests []CapturedRequest `json:"requests"`
+}
+
+// bin holds the requests captured for one id
+type bin struct {
+	created  time.Time
+	last     time.Time
+	nextID   int64
+	requests []CapturedRequest
+}
+
+// Bins is a requestbin: POST /bins creates a bin, every request to
+// /bin/{id}/... is captured, and /bins/{id}/requests lists them. Bins
+// unused for a day are dropped.
+type Bins struct {
+	mu   sync.Mutex
+	bins map[string]*bin
+	now  func() time.Time
+}
+
+// NewBins creates a Bins handler with no bins
+func NewBins() *Bins {
+	return &Bins{bins: make(map[string]*bin), now: time.Now}
+}
+
+// CreateHandler creates a bin, answering 201 with its URLs
+func (b *Bins) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	raw := make([]byte, 8)
+	rand.Read(raw)
+	id := hex.EncodeToString(raw)
+
+	b.mu.Lock()
+	now := b.now()
+	b.sweep(now)
+	if len(b.bins) >= maxBins {
+		b.dropOldest()
+	}
+	b.bins[id] = &bin{created: now, last: now}
+	b.mu.Unlock()
+
+	base := baseURL(r)
+	resp := BinResponse{ID: id, URL: base + "/bin/" + id, RequestsURL: base + "/bins/" + id + "/requests"}
+	w.Header().Set("Location", resp.URL)
+	writeJSONResponse(w, r, http.StatusCreated, resp)
+}
+
+// CaptureHandler stores any request to /bin/{id} or below it
+func (b *Bins) CaptureHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	captured, err := captureRequest(r, b.now())
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	b.mu.Lock()
+	bn, ok := b.bins[id]
+	if ok {
+		bn.nextID++
+		captured.ID = bn.nextID
+		bn.last = captured.Time
+		bn.requests = append(bn.requests, captured)
+		if len(bn.requests) > binRequests {
+			bn.requests = bn.requests[len(bn.requests)-binRequests:]
+		}
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		writeJSONError(w, r, http.StatusNotFound, "Unknown bin")
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, map[string]any{"bin": id, "id": captured.ID})
+}
+
+// RequestsHandler lists a bin's captured requests, oldest first, or clears
+// them on DELETE
+func (b *Bins) RequestsHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	b.mu.Lock()
+	bn, ok := b.bins[id]
+	var requests []CapturedRequest
+	if ok {
+		switch r.Method {
+		case http.MethodGet:
+			requests = append([]CapturedRequest{}, bn.requests...)
+		case http.MethodDelete:
+			bn.requests = nil
+		}
+	}
+	b.mu.Unlock()
+
+	switch {
+	case r.Method != http.MethodGet && r.Method != http.MethodDelete:
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	case !ok:
+		writeJSONError(w, r, http.StatusNotFound, "Unknown bin")
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONResponse(w, r, http.StatusOK, BinRequestsResponse{Bin: id, Requests: requests})
+	}
+}
+
+// DeleteHandler removes a bin and its requests
+func (b *Bins) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	id := r.PathValue("id")
+
+	b.mu.Lock()
+	_, ok := b.bins[id]
+	delete(b.bins, id)
+	b.mu.Unlock()
+
+	if !ok {
+		writeJSONError(w, r, http.StatusNotFound, "Unknown bin")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sweep drops idle bins; callers hold mu
+func (b *Bins) sweep(now time.Time) {
+	for id, bn := range b.bins {
+		if now.Sub(bn.last) > binIdle {
+			delete(b.bins, id)
+		}
+	}
+}
+
+// dropOldest drops the bin created first; callers hold mu
+func (b *Bins) dropOldest() {
+	var oldest string
+	for id, bn := range b.bins {
+		if oldest == "" || bn.created.Before(b.bins[oldest].created) {
+			oldest = id
+		}
+	}
+	delete(b.bins, oldest)
+}
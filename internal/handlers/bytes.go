@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxStreamBytes caps the body size of /bytes, /stream-bytes and /drip
+const maxStreamBytes = 10 << 20
+
+// defaultChunkSize is the /stream-bytes chunk size unless ?chunk_size= is
+// given
+const defaultChunkSize = 10 << 10
+
+// parseByteCount parses a body size between 0 and maxStreamBytes
+func parseByteCount(raw string) (int, bool) {
+	n, err := strconv.Atoi(raw)
+	return n, err == nil && n >= 0 && n <= maxStreamBytes
+}
+
+// throttled wraps w to honour ?rate=, reporting false if it is invalid
+func throttled(w http.ResponseWriter, r *http.Request) (io.Writer, bool) {
+	raw := r.URL.Query().Get(RateQuery)
+	if raw == "" {
+		return w, true
+	}
+	rate, err := parseRate(raw)
+	if err != nil {
+		return nil, false
+	}
+	return newThrottledWriter(r.Context(), w, rate), true
+}
+
+// BytesHandler returns /bytes/{n} random bytes, reproducible with ?seed=
+// and paced by ?rate=
+func BytesHandler(w http.ResponseWriter, r *http.Request) {
+	n, ok := parseByteCount(strings.TrimPrefix(r.URL.Path, "/bytes/"))
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Byte count must be between 0 and "+strconv.Itoa(maxStreamBytes))
+		return
+	}
+	src, ok := randomSource(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
+		return
+	}
+	out, ok := throttled(w, r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid rate")
+		return
+	}
+
+	body := make([]byte, n)
+	src.Read(body)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(n))
+	out.Write(body)
+}
+
+// StreamBytesHandler streams /stream-bytes/{n} random bytes in chunks of
+// ?chunk_size=, without a Content-Length, reproducible with ?seed= and
+// paced by ?rate=
+func StreamBytesHandler(w http.ResponseWriter, r *http.Request) {
+	n, ok := parseByteCount(strings.TrimPrefix(r.URL.Path, "/stream-bytes/"))
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Byte count must be between 0 and "+strconv.Itoa(maxStreamBytes))
+		return
+	}
+	chunkSize := defaultChunkSize
+	if v := r.URL.Query().Get("chunk_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 1 || size > maxStreamBytes {
+			writeJSONError(w, r, http.StatusBadRequest, "chunk_size must be between 1 and "+strconv.Itoa(maxStreamBytes))
+			return
+		}
+		chunkSize = size
+	}
+	src, ok := randomSource(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
+		return
+	}
+	out, ok := throttled(w, r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid rate")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+
+	chunk := make([]byte, chunkSize)
+	for n > 0 {
+		c := chunk[:min(n, chunkSize)]
+		src.Read(c)
+		if _, err := out.Write(c); err != nil {
+			return
+		}
+		http.NewResponseController(w).Flush()
+		n -= len(c)
+	}
+}
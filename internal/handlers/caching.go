@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheFlags are the Cache-Control directives without a value, in the
+// order they are emitted
+var cacheFlags = []string{"public", "private", "no-cache", "no-store", "no-transform", "must-revalidate", "proxy-revalidate", "must-understand", "immutable"}
+
+// cacheDurations are the Cache-Control directives taking seconds, in the
+// order they are emitted
+var cacheDurations = []string{"max-age", "s-maxage", "stale-while-revalidate", "stale-if-error"}
+
+// CacheControlResponse is the body returned by /cache-control
+type CacheControlResponse struct {
+	CacheControl string    `json:"cache_control"`
+	GeneratedAt  time.Time `json:"generated_at"`
+}
+
+// CacheControlHandler sets a Cache-Control header built from the query:
+// directives such as ?max-age=60, ?s-maxage=, ?stale-while-revalidate=
+// and ?stale-if-error= take seconds, and flags such as ?no-store and
+// ?public are included unless set to false. The body stamps when it was
+// generated, so a cached copy can be told from a fresh one.
+func CacheControlHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var directives []string
+	for _, name := range cacheFlags {
+		if !query.Has(name) {
+			continue
+		}
+		if v := query.Get(name); v != "" {
+			on, err := strconv.ParseBool(v)
+			if err != nil {
+				writeJSONError(w, r, http.StatusBadRequest, "Invalid "+name+" value")
+				return
+			}
+			if !on {
+				continue
+			}
+		}
+		directives = append(directives, name)
+	}
+	if slices.Contains(directives, "public") && slices.Contains(directives, "private") {
+		writeJSONError(w, r, http.StatusBadRequest, "public and private are mutually exclusive")
+		return
+	}
+	for _, name := range cacheDurations {
+		if !query.Has(name) {
+			continue
+		}
+		seconds, err := strconv.Atoi(query.Get(name))
+		if err != nil || seconds < 0 {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid "+name+" value")
+			return
+		}
+		directives = append(directives, name+"="+strconv.Itoa(seconds))
+	}
+
+	cacheControl := strings.Join(directives, ", ")
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	writeJSONResponse(w, r, http.StatusOK, CacheControlResponse{
+		CacheControl: cacheControl,
+		GeneratedAt:  time.Now().UTC(),
+	})
+}
+
+// Vary limits
+const (
+	defaultVaryHeader = "Accept-Language"
+	maxVaryHeaders    = 20
+)
+
+// VaryResponse is the body returned by /vary. Variant identifies the
+// combination of header values, so responses cached under different keys
+// can be told apart.
+type VaryResponse struct {
+	Vary        []string          `json:"vary"`
+	Headers     map[string]string `json:"headers"`
+	Variant     string            `json:"variant"`
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+// VaryHandler answers with a body derived from the request headers named
+// in ?headers= (comma-separated, default Accept-Language) and lists them
+// in Vary, so the cache keys of intermediaries can be checked. ?headers=*
+// sends Vary: * instead.
+func VaryHandler(w http.ResponseWriter, r *http.Request) {
+	raw := defaultVaryHeader
+	if r.URL.Query().Has("headers") {
+		raw = r.URL.Query().Get("headers")
+	}
+
+	response := VaryResponse{Vary: []string{}, Headers: map[string]string{}, GeneratedAt: time.Now().UTC()}
+	sum := sha256.New()
+	if strings.TrimSpace(raw) == "*" {
+		response.Vary = append(response.Vary, "*")
+	} else {
+		for _, name := range strings.Split(raw, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if !validHeaderName(name) {
+				writeJSONError(w, r, http.StatusBadRequest, "Invalid header name "+name)
+				return
+			}
+			if _, seen := response.Headers[name]; seen {
+				continue
+			}
+			if len(response.Vary) == maxVaryHeaders {
+				writeJSONError(w, r, http.StatusBadRequest, "Too many headers")
+				return
+			}
+			value := strings.Join(r.Header.Values(name), ", ")
+			response.Vary = append(response.Vary, name)
+			response.Headers[name] = value
+			sum.Write([]byte(name + ": " + value + "\n"))
+		}
+	}
+	response.Variant = hex.EncodeToString(sum.Sum(nil))[:16]
+
+	if len(response.Vary) > 0 {
+		w.Header().Set("Vary", strings.Join(response.Vary, ", "))
+	}
+	writeJSONResponse(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCapturedBody is how much of a request body is kept when capturing it
+const maxCapturedBody = 64 << 10
+
+// CapturedRequest is a stored copy of a request, for inspecting it later
+type CapturedRequest struct {
+	ID      int64               `json:"id"`
+	Time    time.Time           `json:"time"`
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Headers map[string][]string `json:"headers"`
+	Origin  string              `json:"origin"`
+	// Body is the body as received; bodies that are not UTF-8 are base64
+	// encoded, as BodyEncoding then says
+	Body          string `json:"body,omitempty"`
+	BodyEncoding  string `json:"body_encoding,omitempty"`
+	BodySize      int64  `json:"body_size"`
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
+}
+
+// captureRequest copies r, keeping up to maxCapturedBody bytes of its body
+// and counting the rest
+func captureRequest(r *http.Request, now time.Time) (CapturedRequest, error) {
+	c := CapturedRequest{
+		Time:    now,
+		Method:  r.Method,
+		URL:     r.URL.String(),
+		Headers: r.Header.Clone(),
+		Origin:  reportedOrigin(r),
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCapturedBody))
+	if err != nil {
+		return c, err
+	}
+	rest, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		return c, err
+	}
+	c.BodySize, c.BodyTruncated = int64(len(body))+rest, rest > 0
+
+	c.Body = string(body)
+	if !utf8.Valid(body) {
+		c.Body, c.BodyEncoding = base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return c, nil
+}
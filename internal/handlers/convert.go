@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Conversion conventions shared by both directions: attributes are keys
+// prefixed with @, text beside child elements is #text, and repeated
+// elements become arrays
+const (
+	convertAttrPrefix = "@"
+	convertTextKey    = "#text"
+	// convertRoot names the root element when JSON has no single root key
+	convertRoot = "root"
+)
+
+// xmlAttrName returns the key of an attribute, keeping xmlns prefixes
+func xmlAttrName(name xml.Name) string {
+	if name.Space == "xmlns" {
+		return "xmlns:" + name.Local
+	}
+	return name.Local
+}
+
+// decodeXMLElement converts the element opened by start: a string for
+// elements holding only text, otherwise an object of its attributes,
+// children and text
+func decodeXMLElement(dec *xml.Decoder, start xml.StartElement) (any, error) {
+	obj := map[string]any{}
+	for _, attr := range start.Attr {
+		obj[convertAttrPrefix+xmlAttrName(attr.Name)] = attr.Value
+	}
+
+	var text strings.Builder
+	children := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			children = true
+			// Values are strings or objects, so an array marks repetition
+			switch existing := obj[t.Name.Local].(type) {
+			case nil:
+				obj[t.Name.Local] = child
+			case []any:
+				obj[t.Name.Local] = append(existing, child)
+			default:
+				obj[t.Name.Local] = []any{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if !children && len(start.Attr) == 0 {
+				return text.String(), nil
+			}
+			if s := strings.TrimSpace(text.String()); s != "" {
+				obj[convertTextKey] = s
+			}
+			return obj, nil
+		}
+	}
+}
+
+// xmlToJSON converts an XML document to {"root element": value}
+func xmlToJSON(body []byte) (map[string]any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var doc map[string]any
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if doc != nil {
+				return nil, errors.New("more than one root element")
+			}
+			root, err := decodeXMLElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			doc = map[string]any{t.Name.Local: root}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("text outside the root element")
+			}
+		}
+	}
+	if doc == nil {
+		return nil, errors.New("no root element")
+	}
+	return doc, nil
+}
+
+// xmlText renders a JSON scalar as element or attribute text
+func xmlText(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number, bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("cannot use %T as text", v)
+}
+
+// encodeJSONElement writes v as elements named name: an array as one
+// element per item, an object as attributes, text and children, anything
+// else as text. Names that are not valid element names are written as
+// <field name="..."> like other XML responses.
+func encodeJSONElement(enc *xml.Encoder, name string, v any) error {
+	if items, ok := v.([]any); ok {
+		for _, item := range items {
+			if err := encodeJSONElement(enc, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !validXMLName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: "field"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}},
+		}
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		text, err := xmlText(v)
+		if err != nil {
+			return err
+		}
+		return enc.EncodeElement(text, start)
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var children []string
+	for _, k := range keys {
+		attr, isAttr := strings.CutPrefix(k, convertAttrPrefix)
+		switch {
+		case isAttr:
+			value, err := xmlText(obj[k])
+			if err != nil {
+				return fmt.Errorf("attribute %s: %w", attr, err)
+			}
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attr}, Value: value})
+		case k != convertTextKey:
+			children = append(children, k)
+		}
+	}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if v, ok := obj[convertTextKey]; ok {
+		text, err := xmlText(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", convertTextKey, err)
+		}
+		if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	for _, k := range children {
+		if err := encodeJSONElement(enc, k, obj[k]); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// jsonToXML converts a JSON document to XML. An object with a single key
+// names the root element; anything else is wrapped in <root>, with array
+// entries as <item> elements.
+func jsonToXML(body []byte, pretty bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("more than one JSON value")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if pretty {
+		enc.Indent("", "  ")
+	}
+
+	var err error
+	obj, isObject := v.(map[string]any)
+	switch {
+	case isObject && len(obj) == 1:
+		for name, root := range obj {
+			if _, isArray := root.([]any); isArray || strings.HasPrefix(name, convertAttrPrefix) || name == convertTextKey {
+				err = encodeJSONElement(enc, convertRoot, obj)
+			} else {
+				err = encodeJSONElement(enc, name, root)
+			}
+		}
+	case isObject:
+		err = encodeJSONElement(enc, convertRoot, obj)
+	default:
+		if items, isArray := v.([]any); isArray {
+			v = map[string]any{"item": items}
+		}
+		err = encodeJSONElement(enc, convertRoot, v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// XMLToJSONHandler converts the posted XML document to JSON: the root
+// element becomes the single key, attributes are @-prefixed keys, text
+// beside child elements is #text and repeated elements become arrays.
+// Element text stays a string, as XML has no types.
+func XMLToJSONHandler(w http.ResponseWriter, r *http.Request) {
+	body, _, err := readBody(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	doc, err := xmlToJSON(body)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid XML document: "+err.Error())
+		return
+	}
+	out, _ := marshalJSON(doc, prettyOutput(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// JSONToXMLHandler converts the posted JSON document to XML following the
+// conventions of XMLToJSONHandler, so documents survive a round trip
+// apart from element order
+func JSONToXMLHandler(w http.ResponseWriter, r *http.Request) {
+	body, _, err := readBody(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	out, err := jsonToXML(body, prettyOutput(r))
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Cannot convert JSON document: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(out)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// CORSDecision records how the CORS middleware treated a request
+type CORSDecision struct {
+	Enabled     bool     `json:"enabled"`
+	Origin      string   `json:"origin,omitempty"`
+	Allowed     bool     `json:"allowed"`
+	Preflight   bool     `json:"preflight"`
+	Reason      string   `json:"reason"`
+	Methods     []string `json:"allowed_methods,omitempty"`
+	Headers     []string `json:"allowed_headers,omitempty"`
+	Credentials bool     `json:"credentials"`
+	MaxAge      int      `json:"max_age,omitempty"`
+}
+
+// corsKey is the context key for CORSDecision
+type corsKey struct{}
+
+// WithCORSDecision returns a copy of ctx carrying the CORS decision
+func WithCORSDecision(ctx context.Context, d *CORSDecision) context.Context {
+	return context.WithValue(ctx, corsKey{}, d)
+}
+
+// CORSEchoResponse is returned by the CORS echo endpoint
+type CORSEchoResponse struct {
+	Decision        *CORSDecision     `json:"decision"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+}
+
+// CORSEchoHandler reports the CORS decision made for the request and the
+// Access-Control-* headers sent with the response
+func CORSEchoHandler(w http.ResponseWriter, r *http.Request) {
+	d, ok := r.Context().Value(corsKey{}).(*CORSDecision)
+	if !ok || d == nil {
+		d = &CORSDecision{Origin: r.Header.Get("Origin"), Reason: "CORS is not enabled"}
+	}
+
+	headers := make(map[string]string)
+	for name, values := range w.Header() {
+		if strings.HasPrefix(name, "Access-Control-") || name == "Vary" {
+			headers[name] = strings.Join(values, ", ")
+		}
+	}
+
+	writeJSONResponse(w, r, http.StatusOK, CORSEchoResponse{Decision: d, ResponseHeaders: headers})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"math/rand"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CSV defaults and limits
+const (
+	defaultCSVRows = 10
+	defaultCSVCols = 4
+	maxCSVRows     = 100_000
+	maxCSVCols     = 100
+)
+
+// csvWords are the text cells of /csv; some need quoting, to exercise
+// CSV parsers
+var csvWords = []string{"alpha", "bravo", "charlie", "delta", "echo", "Smith, Jr.", `say "hi"`, "multi\nline", "ünïcödé", ""}
+
+// csvCell generates the cell of a column: after the id, columns cycle
+// through text, integers, decimals and booleans
+func csvCell(src *rand.Rand, col int) string {
+	switch col % 4 {
+	case 1:
+		return csvWords[src.Intn(len(csvWords))]
+	case 2:
+		return strconv.Itoa(src.Intn(10000))
+	case 3:
+		return strconv.FormatFloat(src.Float64()*1000, 'f', 2, 64)
+	}
+	return strconv.FormatBool(src.Intn(2) == 1)
+}
+
+// csvKinds name the kinds of column csvCell generates
+var csvKinds = [...]string{"flag", "text", "number", "amount"}
+
+// csvHeader names the columns: id, then each column's kind and number
+func csvHeader(cols int) []string {
+	header := []string{"id"}
+	for col := 1; col < cols; col++ {
+		header = append(header, csvKinds[col%4]+strconv.Itoa(col))
+	}
+	return header
+}
+
+// CSVHandler returns ?rows= rows (default 10) of ?cols= generated columns
+// (default 4) as text/csv, after a header row unless ?header=false. The
+// first column numbers the rows and the rest mix text, some of which
+// needs quoting, numbers and booleans; ?seed= makes them reproducible.
+// ?filename= sends the CSV as an attachment with that name.
+func CSVHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	rows, ok := queryInt(query, "rows", defaultCSVRows, maxCSVRows)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid rows value")
+		return
+	}
+	cols, ok := queryInt(query, "cols", defaultCSVCols, maxCSVCols)
+	if !ok || cols == 0 {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid cols value")
+		return
+	}
+	header := true
+	if v := query.Get("header"); v != "" {
+		var err error
+		if header, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid header value")
+			return
+		}
+	}
+	filename := query.Get("filename")
+	if strings.ContainsAny(filename, "/\\") {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid filename")
+		return
+	}
+	src, ok := randomSource(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
+		return
+	}
+
+	presence := "absent"
+	if header {
+		presence = "present"
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8; header="+presence)
+	if filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+
+	cw := csv.NewWriter(w)
+	// RFC 4180 ends lines with CRLF
+	cw.UseCRLF = true
+	if header {
+		cw.Write(csvHeader(cols))
+	}
+	record := make([]string, cols)
+	for row := 1; row <= rows; row++ {
+		record[0] = strconv.Itoa(row)
+		for col := 1; col < cols; col++ {
+			record[col] = csvCell(src, col)
+		}
+		if err := cw.Write(record); err != nil {
+			return
+		}
+	}
+	cw.Flush()
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// maxDecodedBody bounds decompressed request bodies to guard against
+// decompression bombs
+const maxDecodedBody = 10 << 20
+
+// bodyError is a request body problem reported to the client with status
+type bodyError struct {
+	status  int
+	message string
+}
+
+func (e *bodyError) Error() string { return e.message }
+
+// writeBodyError reports a failure to read the request body
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var be *bodyError
+	if errors.As(err, &be) {
+		writeJSONError(w, r, be.status, be.message)
+		return
+	}
+	writeJSONError(w, r, http.StatusInternalServerError, "Failed to read request body")
+}
+
+// readBody reads the request body, undoing any gzip, deflate or br
+// Content-Encoding. It returns the decoded body and the encoding removed.
+func readBody(r *http.Request) ([]byte, string, error) {
+	defer r.Body.Close()
+
+	encoding := strings.TrimSpace(r.Header.Get("Content-Encoding"))
+	if encoding == "" || strings.EqualFold(encoding, "identity") {
+		body, err := io.ReadAll(r.Body)
+		return body, "", err
+	}
+
+	// Codings are listed in the order they were applied
+	codings := strings.Split(encoding, ",")
+	var body io.Reader = r.Body
+	for i := len(codings) - 1; i >= 0; i-- {
+		dec, err := decoder(strings.ToLower(strings.TrimSpace(codings[i])), body)
+		if err != nil {
+			return nil, "", err
+		}
+		body = dec
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(body, maxDecodedBody+1))
+	if err != nil {
+		return nil, "", &bodyError{http.StatusBadRequest, fmt.Sprintf("Invalid %s request body", encoding)}
+	}
+	if len(decoded) > maxDecodedBody {
+		return nil, "", &bodyError{http.StatusRequestEntityTooLarge, "Decompressed request body too large"}
+	}
+	return decoded, encoding, nil
+}
+
+// decoder wraps body in a reader for a single content coding
+func decoder(coding string, body io.Reader) (io.Reader, error) {
+	var (
+		dec io.Reader
+		err error
+	)
+	switch coding {
+	case "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		dec, err = gzip.NewReader(body)
+	case "deflate":
+		dec, err = zlib.NewReader(body)
+	case "br":
+		return brotli.NewReader(body), nil
+	default:
+		return nil, &bodyError{http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported Content-Encoding %q", coding)}
+	}
+	if err != nil {
+		return nil, &bodyError{http.StatusBadRequest, fmt.Sprintf("Invalid %s request body", coding)}
+	}
+	return dec, nil
+}
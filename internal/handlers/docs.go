@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// docsPage is the Swagger UI page; it loads the spec from spec.json
+// relative to itself, so it works below a mount prefix
+//
+//go:embed swaggerui/index.html
+var docsPage []byte
+
+// docsAssets holds the bundled Swagger UI scripts and styles
+//
+//go:embed swaggerui/swagger-ui-bundle.js swaggerui/swagger-ui.css
+var docsAssets embed.FS
+
+// DocsHandler serves the Swagger UI page
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(docsPage)
+}
+
+// DocsAssetsHandler serves the Swagger UI scripts and styles below /docs/;
+// /docs/ itself redirects to the page
+func DocsAssetsHandler() http.Handler {
+	assets, _ := fs.Sub(docsAssets, "swaggerui")
+	files := http.StripPrefix("/docs/", http.FileServerFS(assets))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/docs/" {
+			http.Redirect(w, r, "../docs", http.StatusFound)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
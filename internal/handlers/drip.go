@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DripHandler drips ?numbytes= bytes (default 10) evenly over ?duration=
+// (default 2s) after an initial ?delay=, answering with ?code= (default
+// 200). Durations are seconds or Go durations, capped like /delay.
+// ?keepalive= sends newlines or 102 Processing during long gaps, and
+// ?rate= can slow the drip further.
+func DripHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := settingsFrom(r).maxDelay()
+
+	duration := 2 * time.Second
+	if v := query.Get("duration"); v != "" {
+		var err error
+		if duration, err = parseDelay(v, limit); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid duration value")
+			return
+		}
+	}
+
+	var delay time.Duration
+	if v := query.Get("delay"); v != "" {
+		var err error
+		if delay, err = parseDelay(v, limit); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid delay value")
+			return
+		}
+	}
+
+	numBytes := 10
+	if v := query.Get("numbytes"); v != "" {
+		n, ok := parseByteCount(v)
+		if !ok {
+			writeJSONError(w, r, http.StatusBadRequest, "numbytes must be between 0 and "+strconv.Itoa(maxStreamBytes))
+			return
+		}
+		numBytes = n
+	}
+
+	code := http.StatusOK
+	if v := query.Get("code"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 200 || n > 599 {
+			writeJSONError(w, r, http.StatusBadRequest, "code must be between 200 and 599")
+			return
+		}
+		code = n
+	}
+
+	k, ok := parseKeepalive(query, limit)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid keepalive value")
+		return
+	}
+	kw := newKeepaliveWriter(w, k)
+	out, ok := throttled(kw, r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid rate")
+		return
+	}
+
+	// Newline keepalives add to the body, so its length is not known
+	kw.Header().Set("Content-Type", "application/octet-stream")
+	if !k.newlines() {
+		kw.Header().Set("Content-Length", strconv.Itoa(numBytes))
+	}
+
+	if !kw.wait(r, delay) {
+		aborted(kw, r, delay)
+		return
+	}
+	kw.WriteHeader(code)
+	http.NewResponseController(kw).Flush()
+
+	if numBytes == 0 {
+		return
+	}
+	interval := duration / time.Duration(numBytes)
+	for i := range numBytes {
+		if i > 0 && !kw.wait(r, interval) {
+			return
+		}
+		if _, err := out.Write([]byte("*")); err != nil {
+			return
+		}
+		http.NewResponseController(kw).Flush()
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+)
+
+// DumpHandler returns the request as received, request line, headers and
+// raw body, as text/plain. The body is not decompressed. Go's HTTP parser
+// does not keep the original header order or case, so headers appear in
+// canonical form, sorted by name.
+func DumpHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDecodedBody)
+	dump, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+		writeJSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dump)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// EncodeValueQuery is the query parameter the encoding endpoints transform
+// in place of the request body
+const EncodeValueQuery = "value"
+
+// encodeInput returns ?value= if present, otherwise the request body
+func encodeInput(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if query := r.URL.Query(); query.Has(EncodeValueQuery) {
+		return []byte(query.Get(EncodeValueQuery)), true
+	}
+	body, _, err := readBody(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return nil, false
+	}
+	return body, true
+}
+
+// writeEncoded writes the result of an encoding endpoint as is: text, or
+// application/octet-stream when it is not valid UTF-8
+func writeEncoded(w http.ResponseWriter, out []byte) {
+	contentType := "text/plain; charset=utf-8"
+	if !utf8.Valid(out) {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.Write(out)
+}
+
+// base64Encoding returns the alphabet ?urlsafe= and ?padding= select
+func base64Encoding(r *http.Request) *base64.Encoding {
+	query := r.URL.Query()
+	enc := base64.StdEncoding
+	if urlsafe, _ := strconv.ParseBool(query.Get("urlsafe")); urlsafe {
+		enc = base64.URLEncoding
+	}
+	if padding, err := strconv.ParseBool(query.Get("padding")); err == nil && !padding {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	return enc
+}
+
+// EncodeBase64Handler returns ?value= or the request body base64-encoded,
+// with the URL-safe alphabet if ?urlsafe=1 and unpadded if ?padding=0
+func EncodeBase64Handler(w http.ResponseWriter, r *http.Request) {
+	in, ok := encodeInput(w, r)
+	if !ok {
+		return
+	}
+	enc := base64Encoding(r)
+	out := make([]byte, enc.EncodedLen(len(in)))
+	enc.Encode(out, in)
+	writeEncoded(w, out)
+}
+
+// DecodeBase64Handler decodes ?value= or the request body from base64 in
+// either alphabet, padded or not, ignoring whitespace such as line breaks
+func DecodeBase64Handler(w http.ResponseWriter, r *http.Request) {
+	in, ok := encodeInput(w, r)
+	if !ok {
+		return
+	}
+	s := strings.TrimRight(strings.Join(strings.Fields(string(in)), ""), "=")
+	enc := base64.RawStdEncoding
+	if strings.ContainsAny(s, "-_") {
+		enc = base64.RawURLEncoding
+	}
+	out, err := enc.DecodeString(s)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid base64: "+err.Error())
+		return
+	}
+	writeEncoded(w, out)
+}
+
+// escapesPath reports whether ?component=path selects path escaping
+// rather than query escaping, which writes spaces as +
+func escapesPath(r *http.Request) bool {
+	return r.URL.Query().Get("component") == "path"
+}
+
+// EncodeURLHandler percent-encodes ?value= or the request body for a query
+// string, or for a path segment if ?component=path
+func EncodeURLHandler(w http.ResponseWriter, r *http.Request) {
+	in, ok := encodeInput(w, r)
+	if !ok {
+		return
+	}
+	out := url.QueryEscape(string(in))
+	if escapesPath(r) {
+		out = url.PathEscape(string(in))
+	}
+	writeEncoded(w, []byte(out))
+}
+
+// DecodeURLHandler decodes percent-encoded ?value= or request body, with +
+// as a space unless ?component=path
+func DecodeURLHandler(w http.ResponseWriter, r *http.Request) {
+	in, ok := encodeInput(w, r)
+	if !ok {
+		return
+	}
+	unescape := url.QueryUnescape
+	if escapesPath(r) {
+		unescape = url.PathUnescape
+	}
+	out, err := unescape(string(in))
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid percent-encoding: "+err.Error())
+		return
+	}
+	writeEncoded(w, []byte(out))
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import "net/http"
+
+// Endpoint describes a route in the /endpoints listing
+type Endpoint struct {
+	Pattern string `json:"pattern"`
+	// Methods is omitted when the route accepts any method
+	Methods     []string `json:"methods,omitempty"`
+	Description string   `json:"description"`
+	Example     string   `json:"example"`
+}
+
+// EndpointGroup describes a group in the /endpoints listing
+type EndpointGroup struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Endpoints   []Endpoint `json:"endpoints"`
+}
+
+// EndpointsResponse is the body returned by /endpoints
+type EndpointsResponse struct {
+	Groups []EndpointGroup `json:"groups"`
+}
+
+// describeGroups converts built groups into their public description
+func describeGroups(groups []GroupRoutes) []EndpointGroup {
+	described := make([]EndpointGroup, 0, len(groups))
+	for _, g := range groups {
+		group := EndpointGroup{Name: g.Name, Description: g.Description, Endpoints: []Endpoint{}}
+		for _, route := range g.Routes {
+			group.Endpoints = append(group.Endpoints, Endpoint{
+				Pattern:     route.Pattern,
+				Methods:     route.Methods,
+				Description: route.Description,
+				Example:     route.ExamplePath(),
+			})
+		}
+		described = append(described, group)
+	}
+	return described
+}
+
+// EndpointsHandler lists the routes returned by catalog, grouped by
+// endpoint group. catalog is called on every request, so the listing
+// always matches what is being served.
+func EndpointsHandler(catalog func() []GroupRoutes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		writeJSONResponse(w, r, http.StatusOK, EndpointsResponse{Groups: describeGroups(catalog())})
+	}
+}
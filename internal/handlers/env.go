@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DefaultEnvPrefixes are the environment variable prefixes /env reveals
+// by default: httpbin's own settings and Kubernetes downward-API values
+var DefaultEnvPrefixes = []string{"HTTPBIN_", "POD_", "NODE_"}
+
+// envSecretWords mark variable names whose values /env hides even when
+// their prefix is allowed
+var envSecretWords = []string{"SECRET", "PASSWORD", "PASSWD", "TOKEN", "CREDENTIAL", "PRIVATE", "API_KEY"}
+
+// redactedEnv replaces the values of secret-looking variables
+const redactedEnv = "[REDACTED]"
+
+// EnvResponse is the body of /env
+type EnvResponse struct {
+	Prefixes  []string          `json:"prefixes"`
+	Variables map[string]string `json:"variables"`
+}
+
+// EnvHandler returns the environment variables whose names start with
+// one of the configured prefixes, so values injected through the
+// Kubernetes downward API can be checked without exec-ing into the pod.
+// Every other variable is left out, and values of allowed ones named like
+// secrets, e.g. HTTPBIN_API_TOKEN, are redacted.
+func EnvHandler(w http.ResponseWriter, r *http.Request) {
+	prefixes := settingsFrom(r).EnvPrefixes
+	resp := EnvResponse{Prefixes: prefixes, Variables: map[string]string{}}
+	if resp.Prefixes == nil {
+		resp.Prefixes = []string{}
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !hasAnyPrefix(name, prefixes) {
+			continue
+		}
+		upper := strings.ToUpper(name)
+		for _, word := range envSecretWords {
+			if strings.Contains(upper, word) {
+				value = redactedEnv
+				break
+			}
+		}
+		resp.Variables[name] = value
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(w, r, http.StatusOK, resp)
+}
+
+// hasAnyPrefix reports whether s starts with one of the non-empty
+// prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if p != "" && strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ExpectResponse is the body returned by /expect-100
+type ExpectResponse struct {
+	Expect string `json:"expect"`
+	// Delay is how long the server waited before sending 100 Continue
+	Delay    string `json:"delay"`
+	BodySize int64  `json:"body_size"`
+}
+
+// ExpectHandler exercises Expect: 100-continue. By default it reads the
+// body straight away, so the server sends 100 Continue immediately.
+// ?delay= postpones that (capped like /delay) and ?reject=1 answers 417 Expectation
+// Failed without reading the body.
+func ExpectHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var delay time.Duration
+	if v := query.Get("delay"); v != "" {
+		var err error
+		delay, err = time.ParseDuration(v)
+		if err != nil || delay < 0 {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid delay value")
+			return
+		}
+		delay = min(delay, settingsFrom(r).maxDelay())
+	}
+
+	if reject, _ := strconv.ParseBool(query.Get("reject")); reject {
+		// Not reading the body means 100 Continue is never sent
+		writeJSONError(w, r, http.StatusExpectationFailed, "Expectation rejected")
+		return
+	}
+
+	// net/http sends 100 Continue when the body is first read
+	if !wait(r.Context(), delay) {
+		aborted(w, r, delay)
+		return
+	}
+	size, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	writeJSONResponse(w, r, http.StatusOK, ExpectResponse{
+		Expect:   r.Header.Get("Expect"),
+		Delay:    delay.String(),
+		BodySize: size,
+	})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// flakyWindow is the span covered by the rolling /flaky counters
+const flakyWindow = time.Minute
+
+// FlakyCounts counts /flaky outcomes
+type FlakyCounts struct {
+	Requests  int64 `json:"requests"`
+	Successes int64 `json:"successes"`
+	Failures  int64 `json:"failures"`
+}
+
+// FlakyStats is the body returned by /flaky/stats
+type FlakyStats struct {
+	Total      FlakyCounts `json:"total"`
+	LastMinute FlakyCounts `json:"last_minute"`
+}
+
+// flakySecond holds the counts for one second of the rolling window
+type flakySecond struct {
+	unix   int64
+	counts FlakyCounts
+}
+
+// Flaky serves /flaky, failing a requested fraction of requests, and
+// keeps counters so retry behaviour can be checked afterwards
+type Flaky struct {
+	mu      sync.Mutex
+	total   FlakyCounts
+	seconds [int(flakyWindow / time.Second)]flakySecond
+	rand    func() float64
+	now     func() time.Time
+}
+
+// NewFlaky creates a Flaky handler with empty counters
+func NewFlaky() *Flaky {
+	return &Flaky{rand: rand.Float64, now: time.Now}
+}
+
+// Handler fails ?rate= of requests (default 0.5) with ?status= (default
+// 503) and echoes the request otherwise
+func (f *Flaky) Handler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	rate := 0.5
+	if v := query.Get("rate"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			writeJSONError(w, r, http.StatusBadRequest, "rate must be between 0 and 1")
+			return
+		}
+		rate = parsed
+	}
+
+	status := http.StatusServiceUnavailable
+	if v := query.Get("status"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 100 || parsed > 599 {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid status code")
+			return
+		}
+		status = parsed
+	}
+
+	src, ok := seededSource(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
+		return
+	}
+	roll := f.rand
+	if src != nil {
+		roll = src.Float64
+	}
+	failed := roll() < rate
+	f.record(failed)
+
+	if failed {
+		writeJSONError(w, r, status, "Flaky failure")
+		return
+	}
+
+	info, err := extractRequestInfo(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, info)
+}
+
+// StatsHandler reports the counters (GET) or resets them (DELETE)
+func (f *Flaky) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		f.mu.Lock()
+		f.total = FlakyCounts{}
+		f.seconds = [len(f.seconds)]flakySecond{}
+		f.mu.Unlock()
+	default:
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	writeJSONResponse(w, r, http.StatusOK, f.Stats())
+}
+
+// Stats returns the total and rolling counters
+func (f *Flaky) Stats() FlakyStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := FlakyStats{Total: f.total}
+	now := f.now().Unix()
+	for _, s := range f.seconds {
+		if now-s.unix < int64(len(f.seconds)) {
+			stats.LastMinute.add(s.counts)
+		}
+	}
+	return stats
+}
+
+// record counts an outcome in the totals and the current second
+func (f *Flaky) record(failed bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now().Unix()
+	slot := &f.seconds[now%int64(len(f.seconds))]
+	if slot.unix != now {
+		*slot = flakySecond{unix: now}
+	}
+
+	outcome := FlakyCounts{Requests: 1, Successes: 1}
+	if failed {
+		outcome = FlakyCounts{Requests: 1, Failures: 1}
+	}
+	f.total.add(outcome)
+	slot.counts.add(outcome)
+}
+
+// add accumulates other into c
+func (c *FlakyCounts) add(other FlakyCounts) {
+	c.Requests += other.Requests
+	c.Successes += other.Successes
+	c.Failures += other.Failures
+}
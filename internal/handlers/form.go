@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// FileContentQuery is the query parameter that adds the base64 content of
+// uploaded files to the echoed request, e.g. ?file_content=1
+const FileContentQuery = "file_content"
+
+// FileInfo describes a file uploaded in a multipart/form-data body
+type FileInfo struct {
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+	// Content is the base64-encoded file, only included on request
+	Content string `json:"content,omitempty"`
+}
+
+// parseMultipart splits a multipart/form-data body into form fields and
+// files keyed by field name
+func parseMultipart(body []byte, boundary string, withContent bool) (map[string][]string, map[string][]FileInfo, error) {
+	form := map[string][]string{}
+	files := map[string][]FileInfo{}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, &bodyError{http.StatusBadRequest, "Invalid multipart request body"}
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, &bodyError{http.StatusBadRequest, "Invalid multipart request body"}
+		}
+
+		name := part.FormName()
+		if part.FileName() == "" {
+			form[name] = append(form[name], string(data))
+			continue
+		}
+
+		file := FileInfo{
+			Filename:    part.FileName(),
+			Size:        int64(len(data)),
+			ContentType: part.Header.Get("Content-Type"),
+		}
+		if withContent {
+			file.Content = base64.StdEncoding.EncodeToString(data)
+		}
+		files[name] = append(files[name], file)
+	}
+
+	return form, files, nil
+}
+
+// multipartBoundary returns the boundary of a multipart/form-data request,
+// or "" for other content types
+func multipartBoundary(r *http.Request) string {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return ""
+	}
+	return params["boundary"]
+}
+
+// isURLEncodedForm reports whether the request body is an HTML form
+func isURLEncodedForm(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// parseURLEncoded parses an application/x-www-form-urlencoded body
+func parseURLEncoded(body []byte) (map[string][]string, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, &bodyError{http.StatusBadRequest, "Invalid form request body"}
+	}
+	return form, nil
+}
+
+// wantFileContent reports whether the request asked for file contents
+func wantFileContent(r *http.Request) bool {
+	include, _ := strconv.ParseBool(r.URL.Query().Get(FileContentQuery))
+	return include
+}
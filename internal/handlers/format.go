@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatQuery is the query parameter overriding Accept negotiation, e.g.
+// ?format=yaml
+const FormatQuery = "format"
+
+// responseFormat is a serialisation responses can be negotiated into
+type responseFormat struct {
+	name        string
+	contentType string
+	// mediaTypes are the Accept values selecting the format
+	mediaTypes []string
+	// marshal serialises data, indented if pretty and the format allows
+	marshal func(data any, pretty bool) ([]byte, error)
+	// binary formats cannot be preceded by whitespace
+	binary bool
+}
+
+var (
+	jsonFormat = &responseFormat{
+		name:        "json",
+		contentType: "application/json",
+		mediaTypes:  []string{"application/json", "text/json"},
+		marshal:     marshalJSON,
+	}
+	xmlFormat = &responseFormat{
+		name:        "xml",
+		contentType: "application/xml",
+		mediaTypes:  []string{"application/xml", "text/xml"},
+		marshal:     marshalXML,
+	}
+	yamlFormat = &responseFormat{
+		name:        "yaml",
+		contentType: "application/yaml",
+		mediaTypes:  []string{"application/yaml", "application/x-yaml", "text/yaml"},
+		marshal: func(data any, _ bool) ([]byte, error) {
+			return marshalGeneric(data, yaml.Marshal)
+		},
+	}
+	msgpackFormat = &responseFormat{
+		name:        "msgpack",
+		contentType: "application/msgpack",
+		mediaTypes:  []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+		marshal: func(data any, _ bool) ([]byte, error) {
+			return marshalGeneric(data, msgpack.Marshal)
+		},
+		binary: true,
+	}
+	cborFormat = &responseFormat{
+		name:        "cbor",
+		contentType: "application/cbor",
+		mediaTypes:  []string{"application/cbor"},
+		marshal: func(data any, _ bool) ([]byte, error) {
+			return marshalGeneric(data, cbor.Marshal)
+		},
+		binary: true,
+	}
+)
+
+// responseFormats are the supported formats; JSON comes first as it wins
+// ties and wildcards
+var responseFormats = []*responseFormat{jsonFormat, xmlFormat, yamlFormat, msgpackFormat, cborFormat}
+
+// negotiateFormat picks the response format from ?format= or, failing
+// that, the Accept header. Unsupported Accept values fall back to JSON, as
+// clients rarely handle 406; an unknown ?format= is an error. Browsers
+// list XML in Accept but are better served JSON, so an Accept header
+// including text/html selects JSON.
+func negotiateFormat(r *http.Request) (*responseFormat, error) {
+	if name := r.URL.Query().Get(FormatQuery); name != "" {
+		for _, f := range responseFormats {
+			if strings.EqualFold(f.name, name) {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported format %q", name)
+	}
+
+	best, bestQ := jsonFormat, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if mediaType == "text/html" {
+			return jsonFormat, nil
+		}
+		if q <= bestQ {
+			continue
+		}
+		for _, f := range responseFormats {
+			if slices.Contains(f.mediaTypes, mediaType) {
+				best, bestQ = f, q
+				break
+			}
+		}
+		if (mediaType == "*/*" || mediaType == "application/*") && q > bestQ {
+			best, bestQ = jsonFormat, q
+		}
+	}
+	return best, nil
+}
+
+// CallbackQuery is the query parameter requesting a JSONP response
+const CallbackQuery = "callback"
+
+// textContentType returns the Content-Type writeJSONResponse will use for
+// r, if it is a text format that tolerates leading whitespace
+func textContentType(r *http.Request) (string, bool) {
+	format, err := negotiateFormat(r)
+	if err != nil || format.binary {
+		return "", false
+	}
+	callback := r.URL.Query().Get(CallbackQuery)
+	if callback == "" || format != jsonFormat {
+		return format.contentType, true
+	}
+	return "application/javascript", jsonpCallback.MatchString(callback)
+}
+
+// jsonpCallback matches the callback names accepted for JSONP: dotted
+// JavaScript identifiers, so the name cannot inject script
+var jsonpCallback = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// wrapJSONP wraps a JSON body in a call to callback. The leading comment
+// stops the body being sniffed as anything but script.
+func wrapJSONP(callback string, body []byte) []byte {
+	out := make([]byte, 0, len(body)+len(callback)+10)
+	out = append(out, "/**/ "...)
+	out = append(out, callback...)
+	out = append(out, '(')
+	out = append(out, bytes.TrimRight(body, "\n")...)
+	return append(out, ");\n"...)
+}
+
+// generic converts data into maps, slices and scalars keyed by its JSON
+// field names, so every format uses the same names
+func generic(data any) (any, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(v), nil
+}
+
+// normalizeNumbers replaces json.Number values with int64 or float64
+func normalizeNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = normalizeNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeNumbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// PrettyQuery is the query parameter toggling indented JSON and XML,
+// e.g. ?pretty=1; it overrides the server-wide default
+const PrettyQuery = "pretty"
+
+// prettyOutput reports whether the response should be indented
+func prettyOutput(r *http.Request) bool {
+	if v := r.URL.Query().Get(PrettyQuery); v != "" {
+		pretty, err := strconv.ParseBool(v)
+		return err == nil && pretty
+	}
+	return settingsFrom(r).PrettyJSON
+}
+
+// marshalJSON encodes data as JSON followed by a newline, like
+// json.Encoder
+func marshalJSON(data any, pretty bool) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	err := enc.Encode(data)
+	return buf.Bytes(), err
+}
+
+// marshalGeneric marshals the generic form of data with marshal
+func marshalGeneric(data any, marshal func(any) ([]byte, error)) ([]byte, error) {
+	v, err := generic(data)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(v)
+}
+
+// marshalXML renders data as XML below a <response> root. Objects become
+// elements named after their keys, or <field name="..."> when a key is not
+// a valid element name; array entries become <item> elements.
+func marshalXML(data any, pretty bool) ([]byte, error) {
+	v, err := generic(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if pretty {
+		enc.Indent("", "  ")
+	}
+	if err := encodeXML(enc, xml.StartElement{Name: xml.Name{Local: "response"}}, v); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// encodeXML writes v as the element start
+func encodeXML(enc *xml.Encoder, start xml.StartElement, v any) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: k}}
+			if !validXMLName(k) {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "field"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: k}},
+				}
+			}
+			if err := encodeXML(enc, child, v[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := encodeXML(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// validXMLName reports whether name can be used as an element name as is
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case i > 0 && (c == '-' || c == '.' || c >= '0' && c <= '9'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// bodyIs reports whether the request body is in format f, judged by its
+// Content-Type: one of the format's media types or a +name suffix
+func bodyIs(r *http.Request, f *responseFormat) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (slices.Contains(f.mediaTypes, mediaType) || strings.HasSuffix(mediaType, "+"+f.name))
+}
+
+// jsonCompatible converts a decoded YAML or CBOR value for JSON encoding,
+// turning mappings with non-string keys into objects keyed by the keys'
+// text
+func jsonCompatible(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = jsonCompatible(item)
+		}
+		return v
+	case map[any]any:
+		obj := make(map[string]any, len(v))
+		for k, item := range v {
+			obj[fmt.Sprint(k)] = jsonCompatible(item)
+		}
+		return obj
+	case []any:
+		for i, item := range v {
+			v[i] = jsonCompatible(item)
+		}
+		return v
+	}
+	return v
+}
@@ -1,14 +1,47 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/netip"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"gopkg.in/yaml.v3"
 )
 
 // TestMethodHandler tests HTTP method handlers
@@ -229,6 +262,34 @@ func TestDelayHandler(t *testing.T) {
 			minDuration:    0,
 			maxDuration:    100 * time.Millisecond,
 		},
+		{
+			name:           "Fractional seconds",
+			path:           "/delay/0.25",
+			expectedStatus: http.StatusOK,
+			minDuration:    250 * time.Millisecond,
+			maxDuration:    400 * time.Millisecond,
+		},
+		{
+			name:           "Duration with unit",
+			path:           "/delay/150ms",
+			expectedStatus: http.StatusOK,
+			minDuration:    150 * time.Millisecond,
+			maxDuration:    300 * time.Millisecond,
+		},
+		{
+			name:           "Negative delay",
+			path:           "/delay/-1",
+			expectedStatus: http.StatusBadRequest,
+			minDuration:    0,
+			maxDuration:    100 * time.Millisecond,
+		},
+		{
+			name:           "Not a number",
+			path:           "/delay/NaN",
+			expectedStatus: http.StatusBadRequest,
+			minDuration:    0,
+			maxDuration:    100 * time.Millisecond,
+		},
 		{
 			name:           "Invalid delay",
 			path:           "/delay/abc",
@@ -319,6 +380,135 @@ func TestStatusHandlerWeighted(t *testing.T) {
 	}
 }
 
+// TestStatusHandlerList tests equally weighted comma-separated codes
+func TestStatusHandlerList(t *testing.T) {
+	weights, err := parseStatusCodes("/status/200,404,500", DefaultMaxDelay)
+	if err != nil {
+		t.Fatalf("parseStatusCodes failed: %v", err)
+	}
+	expected := []statusWeight{{code: 200, weight: 1}, {code: 404, weight: 1}, {code: 500, weight: 1}}
+	if !reflect.DeepEqual(weights, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, weights)
+	}
+
+	seen := make(map[int]bool)
+	for i := 0; i < 200; i++ {
+		rr := httptest.NewRecorder()
+		StatusHandler(rr, httptest.NewRequest("GET", "/status/200,404,500", nil))
+		seen[rr.Code] = true
+	}
+	if len(seen) != 3 || !seen[200] || !seen[404] || !seen[500] {
+		t.Errorf("Expected all three codes to be chosen, got %v", seen)
+	}
+
+	for _, path := range []string{"/status/200,abc", "/status/200,", "/status/200:x", "/status/200,999"} {
+		rr := httptest.NewRecorder()
+		StatusHandler(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", path, rr.Code)
+		}
+	}
+}
+
+// TestStatusHandlerDelay tests per-code delays in weighted specs
+func TestStatusHandlerDelay(t *testing.T) {
+	weights, err := parseStatusCodes("/status/200:0.9:0ms,500:0.1:2s,503:0:1m", DefaultMaxDelay)
+	if err != nil {
+		t.Fatalf("parseStatusCodes failed: %v", err)
+	}
+	expected := []statusWeight{
+		{code: 200, weight: 0.9},
+		{code: 500, weight: 0.1, delay: 2 * time.Second},
+		{code: 503, weight: 0, delay: DefaultMaxDelay},
+	}
+	if !reflect.DeepEqual(weights, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, weights)
+	}
+
+	if _, err := parseStatusCodes("/status/200:1:soon", DefaultMaxDelay); err == nil {
+		t.Error("Expected an error for an invalid delay")
+	}
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	StatusHandler(rr, httptest.NewRequest("GET", "/status/500:1:50ms,200:0:0s", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rr.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected a delay of at least 50ms, got %v", elapsed)
+	}
+}
+
+// TestStatusHandlerRetryAfter tests the retry_after query parameter
+func TestStatusHandlerRetryAfter(t *testing.T) {
+	tests := []struct {
+		name               string
+		target             string
+		expectedStatus     int
+		expectedRetryAfter string
+	}{
+		{"Seconds on 429", "/status/429?retry_after=30", http.StatusTooManyRequests, "30"},
+		{"HTTP-date on 503", "/status/503?retry_after=Wed,%2021%20Oct%202026%2007:28:00%20GMT", http.StatusServiceUnavailable, "Wed, 21 Oct 2026 07:28:00 GMT"},
+		{"Ignored on other codes", "/status/500?retry_after=30", http.StatusInternalServerError, ""},
+		{"Negative seconds", "/status/429?retry_after=-1", http.StatusBadRequest, ""},
+		{"Invalid value", "/status/429?retry_after=soon", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			StatusHandler(rr, httptest.NewRequest("GET", tt.target, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Retry-After"); got != tt.expectedRetryAfter {
+				t.Errorf("Expected Retry-After %q, got %q", tt.expectedRetryAfter, got)
+			}
+		})
+	}
+}
+
+// TestStatusHandlerBody tests custom bodies, content types and headers
+func TestStatusHandlerBody(t *testing.T) {
+	tests := []struct {
+		name                string
+		target              string
+		expectedStatus      int
+		expectedBody        string
+		expectedContentType string
+		expectedHeader      string
+	}{
+		{"Plain body", "/status/500?body=oops", http.StatusInternalServerError, "oops", "text/plain; charset=utf-8", ""},
+		{"JSON envelope", "/status/502?body=%7B%22error%22%3A%22bad%22%7D&content_type=application/json", http.StatusBadGateway, `{"error":"bad"}`, "application/json", ""},
+		{"HTML page", "/status/404?body=%3Ch1%3EGone%3C%2Fh1%3E&content_type=text/html", http.StatusNotFound, "<h1>Gone</h1>", "text/html", ""},
+		{"Extra header", "/status/200?header=X-Upstream:%20eu-1", http.StatusOK, "", "", "eu-1"},
+		{"No body on 204", "/status/204?body=ignored", http.StatusNoContent, "", "", ""},
+		{"Invalid header", "/status/200?header=novalue", http.StatusBadRequest, "", "application/json", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			StatusHandler(rr, httptest.NewRequest("GET", tt.target, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusBadRequest && rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, got)
+			}
+			if got := rr.Header().Get("X-Upstream"); got != tt.expectedHeader {
+				t.Errorf("Expected X-Upstream %q, got %q", tt.expectedHeader, got)
+			}
+		})
+	}
+}
+
 // TestBasicAuthHandler tests basic authentication
 func TestBasicAuthHandler(t *testing.T) {
 	tests := []struct {
@@ -515,16 +705,22 @@ func TestGetOriginIP(t *testing.T) {
 	}{
 		{
 			name:       "X-Forwarded-For header",
-			remoteAddr: "10.0.0.1:12345",
-			xff:        "192.168.1.1, 10.0.0.1",
+			remoteAddr: "127.0.0.1:12345",
+			xff:        "192.168.1.1, 127.0.0.1",
 			expectedIP: "192.168.1.1",
 		},
 		{
 			name:       "X-Real-IP header",
-			remoteAddr: "10.0.0.1:12345",
+			remoteAddr: "127.0.0.1:12345",
 			xri:        "192.168.1.1",
 			expectedIP: "192.168.1.1",
 		},
+		{
+			name:       "private peer is not trusted by default",
+			remoteAddr: "10.0.0.1:12345",
+			xff:        "6.6.6.6",
+			expectedIP: "10.0.0.1",
+		},
 		{
 			name:       "RemoteAddr only",
 			remoteAddr: "192.168.1.1:12345",
@@ -583,3 +779,3721 @@ func TestExtractRequestInfo(t *testing.T) {
 		t.Error("Expected headers to be captured")
 	}
 }
+
+// TestExtractRequestInfoFormats tests that YAML and CBOR bodies are
+// reported as JSON
+func TestExtractRequestInfoFormats(t *testing.T) {
+	cborBody := func(v any) string {
+		b, err := cbor.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		expectedJSON string
+	}{
+		{"application/yaml", "application/yaml", "name: httpbin\ntags: [a, b]\n", `{"name":"httpbin","tags":["a","b"]}`},
+		{"with charset", "application/x-yaml; charset=utf-8", "count: 3\n", `{"count":3}`},
+		{"text/yaml", "text/yaml", "- 1\n- two\n", `[1,"two"]`},
+		{"suffix", "application/vnd.config+yaml", "enabled: true\n", `{"enabled":true}`},
+		{"non-string keys", "application/yaml", "1: one\ntrue: yes\nnested:\n  2: two\n", `{"1":"one","nested":{"2":"two"},"true":"yes"}`},
+		{"invalid", "application/yaml", "a: [unclosed", `null`},
+		{"not yaml", "text/plain", "name: httpbin\n", `null`},
+		{"cbor", "application/cbor", cborBody(map[string]any{"device": "sensor-1", "reading": 21.5, "ok": true}), `{"device":"sensor-1","ok":true,"reading":21.5}`},
+		{"cbor suffix", "application/senml+cbor", cborBody([]any{uint64(1), "two"}), `[1,"two"]`},
+		{"cbor integer keys", "application/cbor", cborBody(map[int]any{1: "one", 2: map[int]string{3: "three"}}), `{"1":"one","2":{"3":"three"}}`},
+		{"invalid cbor", "application/cbor", "\xff\x00", `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/post", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			info, err := extractRequestInfo(req)
+			if err != nil {
+				t.Fatalf("Failed to extract request info: %v", err)
+			}
+			got, err := json.Marshal(info.JSON)
+			if err != nil {
+				t.Fatalf("Expected JSON-compatible data, got %v", err)
+			}
+			if string(got) != tt.expectedJSON {
+				t.Errorf("Expected json %s, got %s", tt.expectedJSON, got)
+			}
+			if info.Body != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, info.Body)
+			}
+		})
+	}
+}
+
+// TestHealthHandlers tests liveness, readiness and the readiness toggle
+func TestHealthHandlers(t *testing.T) {
+	h := NewHealth(BuildInfo{Version: "v1.2.3", Commit: "abc123"})
+
+	rr := httptest.NewRecorder()
+	h.LivenessHandler(rr, httptest.NewRequest("GET", "/livez", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected liveness 200, got %d", rr.Code)
+	}
+
+	var status HealthStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if status.Build.Version != "v1.2.3" || status.Build.Commit != "abc123" {
+		t.Errorf("Expected build info in response, got %+v", status.Build)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ReadinessHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected readiness 200, got %d", rr.Code)
+	}
+
+	// Drain via the toggle endpoint
+	rr = httptest.NewRecorder()
+	h.ReadyToggleHandler(rr, httptest.NewRequest("DELETE", "/admin/ready", nil))
+	if rr.Code != http.StatusOK || h.Ready() {
+		t.Errorf("Expected DELETE to mark server as draining")
+	}
+
+	rr = httptest.NewRecorder()
+	h.ReadinessHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness 503 while draining, got %d", rr.Code)
+	}
+
+	// Liveness is unaffected by draining
+	rr = httptest.NewRecorder()
+	h.LivenessHandler(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected liveness 200 while draining, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ReadyToggleHandler(rr, httptest.NewRequest("PUT", "/admin/ready", nil))
+	if !h.Ready() {
+		t.Error("Expected PUT to restore readiness")
+	}
+}
+
+// TestVersionHandler tests the build metadata endpoint
+func TestVersionHandler(t *testing.T) {
+	handler := VersionHandler(BuildInfo{Version: "v1.2.3", Commit: "abc123", BuildTime: "2024-01-01_00:00:00_UTC"})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/version", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &data); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	if data["version"] != "v1.2.3" || data["commit"] != "abc123" || data["build_time"] != "2024-01-01_00:00:00_UTC" {
+		t.Errorf("Unexpected version response: %v", data)
+	}
+	if data["go_version"] == "" {
+		t.Error("Expected go_version to be set")
+	}
+}
+
+// TestReloadHandler tests the configuration reload admin endpoint
+func TestReloadHandler(t *testing.T) {
+	calls := 0
+	handler := ReloadHandler(func() error {
+		calls++
+		if calls > 1 {
+			return errors.New("bad config")
+		}
+		return nil
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/admin/reload", nil))
+	if rr.Code != http.StatusMethodNotAllowed || calls != 0 {
+		t.Errorf("Expected GET to be rejected, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("POST", "/admin/reload", nil))
+	if rr.Code != http.StatusOK || calls != 1 {
+		t.Errorf("Expected successful reload, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("POST", "/admin/reload", nil))
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "bad config") {
+		t.Errorf("Expected reload error to be reported, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	ReloadHandler(nil)(rr, httptest.NewRequest("POST", "/admin/reload", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("Expected 501 without a reload function, got %d", rr.Code)
+	}
+}
+
+// TestGetOriginIPTrustedProxies tests that forwarding headers are only honoured from trusted peers
+func TestGetOriginIPTrustedProxies(t *testing.T) {
+	settings := &Settings{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		xri        string
+		expectedIP string
+	}{
+		{
+			name:       "untrusted peer ignores X-Forwarded-For",
+			remoteAddr: "203.0.113.9:5000",
+			xff:        "1.2.3.4",
+			expectedIP: "203.0.113.9",
+		},
+		{
+			name:       "untrusted peer ignores X-Real-IP",
+			remoteAddr: "203.0.113.9:5000",
+			xri:        "1.2.3.4",
+			expectedIP: "203.0.113.9",
+		},
+		{
+			name:       "trusted peer uses client hop",
+			remoteAddr: "10.0.0.1:5000",
+			xff:        "198.51.100.4",
+			expectedIP: "198.51.100.4",
+		},
+		{
+			name:       "spoofed leading entry is skipped",
+			remoteAddr: "10.0.0.1:5000",
+			xff:        "1.2.3.4, 198.51.100.4, 10.0.0.2",
+			expectedIP: "198.51.100.4",
+		},
+		{
+			name:       "invalid hop is not echoed",
+			remoteAddr: "10.0.0.1:5000",
+			xff:        "<script>",
+			expectedIP: "10.0.0.1",
+		},
+		{
+			name:       "walk stops at an invalid hop",
+			remoteAddr: "10.0.0.1:5000",
+			xff:        "1.2.3.4, garbage, 10.0.0.2",
+			expectedIP: "10.0.0.2",
+		},
+		{
+			name:       "invalid X-Real-IP is ignored",
+			remoteAddr: "10.0.0.1:5000",
+			xri:        "not-an-ip",
+			expectedIP: "10.0.0.1",
+		},
+		{
+			name:       "IPv6 peer without brackets",
+			remoteAddr: "[2001:db8::1]:5000",
+			xff:        "1.2.3.4",
+			expectedIP: "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(WithSettings(req.Context(), settings))
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.xri != "" {
+				req.Header.Set("X-Real-IP", tt.xri)
+			}
+
+			if ip := getOriginIP(req); ip != tt.expectedIP {
+				t.Errorf("Expected IP %s, got %s", tt.expectedIP, ip)
+			}
+		})
+	}
+}
+
+// TestCORSEchoHandler tests the CORS echo endpoint with and without a decision
+func TestCORSEchoHandler(t *testing.T) {
+	req := httptest.NewRequest("GET", "/cors-echo", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rr := httptest.NewRecorder()
+	CORSEchoHandler(rr, req)
+
+	var resp CORSEchoResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if resp.Decision.Enabled || resp.Decision.Origin != "https://app.example.com" {
+		t.Errorf("Expected disabled decision for the origin, got %+v", resp.Decision)
+	}
+
+	d := &CORSDecision{Enabled: true, Allowed: true, Reason: "origin allowed"}
+	req = req.WithContext(WithCORSDecision(req.Context(), d))
+	rr = httptest.NewRecorder()
+	rr.Header().Set("Access-Control-Allow-Origin", "https://app.example.com")
+	CORSEchoHandler(rr, req)
+
+	resp = CORSEchoResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if !resp.Decision.Allowed || resp.ResponseHeaders["Access-Control-Allow-Origin"] != "https://app.example.com" {
+		t.Errorf("Unexpected CORS echo response: %+v", resp)
+	}
+}
+
+// TestCompressedRequestBody tests that encoded request bodies are decoded
+func TestCompressedRequestBody(t *testing.T) {
+	payload := `{"hello":"world"}`
+
+	compress := func(encoding string) []byte {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "br":
+			w = brotli.NewWriter(&buf)
+		}
+		w.Write([]byte(payload))
+		w.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name           string
+		encoding       string
+		body           []byte
+		expectedStatus int
+	}{
+		{"gzip", "gzip", compress("gzip"), http.StatusOK},
+		{"deflate", "deflate", compress("deflate"), http.StatusOK},
+		{"br", "br", compress("br"), http.StatusOK},
+		{"identity", "identity", []byte(payload), http.StatusOK},
+		{"Corrupt gzip", "gzip", []byte("not gzip"), http.StatusBadRequest},
+		{"Unsupported encoding", "zstd", []byte(payload), http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/post", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", tt.encoding)
+			rr := httptest.NewRecorder()
+
+			MethodHandler("POST")(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var info RequestInfo
+			if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+			if info.Body != payload {
+				t.Errorf("Expected decoded body %q, got %q", payload, info.Body)
+			}
+			if info.JSON == nil {
+				t.Error("Expected decoded JSON to be parsed")
+			}
+			expectedEncoding := tt.encoding
+			if tt.encoding == "identity" {
+				expectedEncoding = ""
+			}
+			if info.ContentEncoding != expectedEncoding {
+				t.Errorf("Expected content_encoding %q, got %q", expectedEncoding, info.ContentEncoding)
+			}
+		})
+	}
+}
+
+// TestFlakyHandler tests failure injection and the rolling counters
+func TestFlakyHandler(t *testing.T) {
+	f := NewFlaky()
+	now := time.Unix(1000, 0)
+	f.now = func() time.Time { return now }
+
+	tests := []struct {
+		name           string
+		query          string
+		roll           float64
+		expectedStatus int
+	}{
+		{"Default rate fails", "", 0.4, http.StatusServiceUnavailable},
+		{"Default rate succeeds", "", 0.6, http.StatusOK},
+		{"Custom status", "?rate=0.3&status=502", 0.2, http.StatusBadGateway},
+		{"Custom rate succeeds", "?rate=0.3&status=502", 0.3, http.StatusOK},
+		{"Rate out of range", "?rate=1.5", 0, http.StatusBadRequest},
+		{"Invalid status", "?status=abc", 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.rand = func() float64 { return tt.roll }
+			rr := httptest.NewRecorder()
+			f.Handler(rr, httptest.NewRequest("GET", "/flaky"+tt.query, nil))
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+
+	stats := f.Stats()
+	expected := FlakyCounts{Requests: 4, Successes: 2, Failures: 2}
+	if stats.Total != expected || stats.LastMinute != expected {
+		t.Errorf("Expected %+v in both counters, got %+v", expected, stats)
+	}
+
+	// Outcomes older than a minute drop out of the rolling counters
+	now = now.Add(2 * time.Minute)
+	if stats := f.Stats(); stats.LastMinute != (FlakyCounts{}) || stats.Total != expected {
+		t.Errorf("Expected only totals after a minute, got %+v", stats)
+	}
+
+	rr := httptest.NewRecorder()
+	f.StatsHandler(rr, httptest.NewRequest("DELETE", "/flaky/stats", nil))
+	if rr.Code != http.StatusOK || f.Stats().Total != (FlakyCounts{}) {
+		t.Errorf("Expected counters to be reset, got %d %+v", rr.Code, f.Stats())
+	}
+}
+
+// TestUnstableHandler tests the deterministic failure/success sequence
+func TestUnstableHandler(t *testing.T) {
+	u := NewUnstable()
+
+	request := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		u.Handler(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	expected := []int{503, 503, 200, 503, 503, 200}
+	for i, status := range expected {
+		if rr := request("GET", "/unstable/2/1?key=a"); rr.Code != status {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, status, rr.Code)
+		}
+	}
+
+	// Keys and sequence shapes are tracked separately
+	if rr := request("GET", "/unstable/2/1?key=b&status=500"); rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected new key to start failing with 500, got %d", rr.Code)
+	}
+	if rr := request("GET", "/unstable/0/1?key=a"); rr.Code != http.StatusOK {
+		t.Errorf("Expected sequence without failures to succeed, got %d", rr.Code)
+	}
+
+	request("GET", "/unstable/2/1?key=a")
+	request("DELETE", "/unstable/2/1?key=a")
+	rr := request("GET", "/unstable/2/1?key=a")
+	var resp UnstableResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if resp.Request != 1 || resp.Phase != "failure" || resp.Remaining != 1 || rr.Header().Get("X-Unstable-Phase") != "failure" {
+		t.Errorf("Expected sequence to restart after DELETE, got %+v", resp)
+	}
+
+	for _, path := range []string{"/unstable/2", "/unstable/a/1", "/unstable/0/0", "/unstable/1/1?status=9"} {
+		if rr := request("GET", path); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", path, rr.Code)
+		}
+	}
+}
+
+// TestRateLimitedHandler tests the emulated upstream quota
+func TestRateLimitedHandler(t *testing.T) {
+	rl := NewRateLimited()
+	now := time.Unix(1000, 0)
+	rl.now = func() time.Time { return now }
+
+	request := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		rl.Handler(rr, httptest.NewRequest("GET", target, nil))
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		rr := request("/rate-limited?limit=2&window=30s&key=a")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i+1, rr.Code)
+		}
+		if rr.Header().Get("X-RateLimit-Remaining") != strconv.Itoa(1-i) {
+			t.Errorf("Request %d: expected %d remaining, got %s", i+1, 1-i, rr.Header().Get("X-RateLimit-Remaining"))
+		}
+	}
+
+	now = now.Add(10 * time.Second)
+	rr := request("/rate-limited?limit=2&window=30s&key=a")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "20" {
+		t.Errorf("Expected Retry-After 20, got %q", rr.Header().Get("Retry-After"))
+	}
+	if rr.Header().Get("X-RateLimit-Reset") != "1030" || rr.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Errorf("Unexpected rate limit headers: %v", rr.Header())
+	}
+
+	if rr := request("/rate-limited?limit=2&window=30s&key=b"); rr.Code != http.StatusOK {
+		t.Errorf("Expected other key to be allowed, got %d", rr.Code)
+	}
+
+	now = now.Add(20 * time.Second)
+	if rr := request("/rate-limited?limit=2&window=30s&key=a"); rr.Code != http.StatusOK {
+		t.Errorf("Expected a new window to be allowed, got %d", rr.Code)
+	}
+
+	for _, target := range []string{"/rate-limited?limit=-1", "/rate-limited?window=soon", "/rate-limited?window=500ms", "/rate-limited?window=2h"} {
+		if rr := request(target); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", target, rr.Code)
+		}
+	}
+}
+
+// TestRegistry tests group registration and route assembly
+func TestRegistry(t *testing.T) {
+	reg := &Registry{}
+	setups := 0
+	reg.Register(Group{Name: "one", Setup: func(env RouteEnv) []Route {
+		setups++
+		return []Route{{Pattern: "/one", Handler: VersionHandler(env.Build)}}
+	}})
+	reg.Register(Group{Name: "two", Setup: func(RouteEnv) []Route {
+		return []Route{{Pattern: "/two"}, {Pattern: "/two/more"}}
+	}})
+
+	if names := reg.Names(); !reflect.DeepEqual(names, []string{"one", "two"}) {
+		t.Errorf("Expected names in registration order, got %v", names)
+	}
+
+	groups := reg.Routes(RouteEnv{}, func(name string) bool { return name != "one" })
+	if len(groups) != 1 || groups[0].Name != "two" || len(groups[0].Routes) != 2 {
+		t.Errorf("Expected only the enabled group, got %+v", groups)
+	}
+	if setups != 0 {
+		t.Error("Expected disabled groups not to be set up")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected duplicate registration to panic")
+		}
+	}()
+	reg.Register(Group{Name: "one"})
+}
+
+// TestDefaultRegistry tests that the built-in groups are registered
+func TestDefaultRegistry(t *testing.T) {
+	expected := []string{GroupMethods, GroupInspection, GroupFormats, GroupUtilities, GroupDelay, GroupStream, GroupStatus, GroupCaching, GroupAuth, GroupFaults, GroupProtocol, GroupBins, GroupMocks, GroupDocs}
+	if names := DefaultRegistry.Names(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected built-in groups %v, got %v", expected, names)
+	}
+}
+
+// TestEndpointsHandler tests listing the served routes
+func TestEndpointsHandler(t *testing.T) {
+	catalog := func() []GroupRoutes {
+		return []GroupRoutes{{
+			Name:        "one",
+			Description: "First group",
+			Routes: []Route{
+				{Pattern: "/one", Methods: []string{"GET"}, Description: "Serves one"},
+				{Pattern: "/any", Description: "Serves any method", Example: "/any?x=1"},
+			},
+		}}
+	}
+	handler := EndpointsHandler(catalog)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/endpoints", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	var response EndpointsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := []EndpointGroup{{
+		Name:        "one",
+		Description: "First group",
+		Endpoints: []Endpoint{
+			{Pattern: "/one", Methods: []string{"GET"}, Description: "Serves one", Example: "/one"},
+			{Pattern: "/any", Description: "Serves any method", Example: "/any?x=1"},
+		},
+	}}
+	if !reflect.DeepEqual(response.Groups, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, response.Groups)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/endpoints", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rr.Code)
+	}
+}
+
+// TestIndexHandler tests the HTML landing page
+func TestIndexHandler(t *testing.T) {
+	catalog := func() []GroupRoutes {
+		return []GroupRoutes{{
+			Name:        "one",
+			Description: "First group",
+			Routes: []Route{
+				{Pattern: "/status/", Example: "/status/418", Description: "Returns a status"},
+				{Pattern: "/post", Methods: []string{"POST"}, Description: "Echoes a POST <request>"},
+			},
+		}}
+	}
+	handler := IndexHandler(catalog)
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected HTML content type, got %q", ct)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`<h2 id="one">one</h2>`,
+		`<a href="http://example.com/status/418">/status/</a>`,
+		"curl -X POST &#39;http://example.com/post&#39;",
+		"Echoes a POST &lt;request&gt;",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected page to contain %q", want)
+		}
+	}
+}
+
+// TestSpecHandler tests the generated OpenAPI document
+func TestSpecHandler(t *testing.T) {
+	catalog := func() []GroupRoutes {
+		return []GroupRoutes{{
+			Name:        "one",
+			Description: "First group",
+			Routes: []Route{
+				{Pattern: "/status/", Path: "/status/{codes}", Methods: []string{"GET"}, Description: "Returns a status"},
+				{Pattern: "/anything", Description: "Accepts any method"},
+			},
+		}}
+	}
+	build := BuildInfo{Version: "v1.2.3"}
+
+	tests := []struct {
+		format      string
+		contentType string
+		decode      func([]byte, any) error
+	}{
+		{SpecJSON, "application/json", json.Unmarshal},
+		{SpecYAML, "application/yaml", yaml.Unmarshal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			SpecHandler(build, catalog, tt.format).ServeHTTP(rr, httptest.NewRequest("GET", "http://example.com/spec."+tt.format, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Expected content type %s, got %s", tt.contentType, ct)
+			}
+
+			var doc openAPIDoc
+			if err := tt.decode(rr.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("Failed to decode spec: %v", err)
+			}
+			if doc.OpenAPI != "3.0.3" || doc.Info.Version != "v1.2.3" {
+				t.Errorf("Unexpected document header: %+v", doc)
+			}
+			if len(doc.Servers) != 1 || doc.Servers[0].URL != "http://example.com" {
+				t.Errorf("Expected server http://example.com, got %+v", doc.Servers)
+			}
+
+			status := doc.Paths["/status/{codes}"]
+			op, ok := status["get"]
+			if len(status) != 1 || !ok {
+				t.Fatalf("Expected a single GET operation, got %+v", status)
+			}
+			if op.OperationID != "getStatusCodes" || op.Tags[0] != "one" {
+				t.Errorf("Unexpected operation: %+v", op)
+			}
+			if len(op.Parameters) != 1 || op.Parameters[0].Name != "codes" || op.Parameters[0].In != "path" {
+				t.Errorf("Expected codes path parameter, got %+v", op.Parameters)
+			}
+
+			if n := len(doc.Paths["/anything"]); n != len(anyMethods) {
+				t.Errorf("Expected %d operations for any method, got %d", len(anyMethods), n)
+			}
+		})
+	}
+}
+
+// TestProblemDetails tests RFC 7807 error documents
+func TestProblemDetails(t *testing.T) {
+	req := httptest.NewRequest("GET", "/status/abc?x=1", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+
+	// The ad-hoc shape is kept unless problem details are enabled
+	rr := httptest.NewRecorder()
+	StatusHandler(rr, req)
+	if !strings.Contains(rr.Body.String(), `"error"`) || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected plain JSON error, got %s", rr.Body.String())
+	}
+
+	req = req.WithContext(WithSettings(req.Context(), &Settings{ProblemDetails: true}))
+	rr = httptest.NewRecorder()
+	StatusHandler(rr, req)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected application/problem+json, got %q", ct)
+	}
+	var problem Problem
+	if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	expected := Problem{
+		Type:      "about:blank",
+		Title:     "Bad Request",
+		Status:    http.StatusBadRequest,
+		Detail:    problem.Detail,
+		Instance:  "/status/abc?x=1",
+		RequestID: "req-42",
+	}
+	if problem != expected || problem.Detail == "" {
+		t.Errorf("Expected %+v, got %+v", expected, problem)
+	}
+}
+
+// TestFormatNegotiation tests serialising responses in the negotiated format
+func TestFormatNegotiation(t *testing.T) {
+	tests := []struct {
+		name           string
+		accept         string
+		format         string
+		expectedStatus int
+		contentType    string
+		decode         func([]byte, any) error
+	}{
+		{"default", "", "", http.StatusOK, "application/json", json.Unmarshal},
+		{"accept xml", "application/xml", "", http.StatusOK, "application/xml", xml.Unmarshal},
+		{"accept yaml", "application/x-yaml", "", http.StatusOK, "application/yaml", yaml.Unmarshal},
+		{"accept msgpack", "application/msgpack", "", http.StatusOK, "application/msgpack", msgpack.Unmarshal},
+		{"accept cbor", "application/cbor", "", http.StatusOK, "application/cbor", cbor.Unmarshal},
+		{"query cbor", "", "cbor", http.StatusOK, "application/cbor", cbor.Unmarshal},
+		{"q values", "application/json;q=0.5, application/yaml", "", http.StatusOK, "application/yaml", yaml.Unmarshal},
+		{"wildcard", "*/*", "", http.StatusOK, "application/json", json.Unmarshal},
+		{"unsupported accept", "image/png", "", http.StatusOK, "application/json", json.Unmarshal},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", http.StatusOK, "application/json", json.Unmarshal},
+		{"query override", "application/xml", "msgpack", http.StatusOK, "application/msgpack", msgpack.Unmarshal},
+		{"unknown query", "", "toml", http.StatusBadRequest, "application/json", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/get?a=1"
+			if tt.format != "" {
+				target += "&format=" + tt.format
+			}
+			req := httptest.NewRequest("GET", target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			MethodHandler("GET")(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Expected content type %s, got %s", tt.contentType, ct)
+			}
+			if vary := rr.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("Expected Vary: Accept, got %q", vary)
+			}
+			if tt.decode == nil {
+				return
+			}
+
+			if tt.contentType == "application/xml" {
+				var doc struct {
+					Method string `xml:"method"`
+					Args   struct {
+						A []string `xml:"a>item"`
+					} `xml:"args"`
+				}
+				if err := xml.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+					t.Fatalf("Failed to decode XML: %v", err)
+				}
+				if doc.Method != "GET" || len(doc.Args.A) != 1 || doc.Args.A[0] != "1" {
+					t.Errorf("Unexpected XML document: %s", rr.Body.String())
+				}
+				return
+			}
+
+			var doc map[string]any
+			if err := tt.decode(rr.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if doc["method"] != "GET" {
+				t.Errorf("Expected method GET, got %v", doc["method"])
+			}
+		})
+	}
+}
+
+// TestMsgpackHandler tests echoing MessagePack bodies
+func TestMsgpackHandler(t *testing.T) {
+	body, _ := msgpack.Marshal(map[string]any{"name": "httpbin", "ids": []int8{1, 2}, "raw": []byte{0xde, 0xad}})
+
+	tests := []struct {
+		name                string
+		body                []byte
+		contentType         string
+		accept              string
+		query               string
+		expectedStatus      int
+		expectedContentType string
+	}{
+		{"msgpack", body, "application/msgpack", "", "", http.StatusOK, "application/msgpack"},
+		{"no content type", body, "", "*/*", "", http.StatusOK, "application/msgpack"},
+		{"json accept", body, "application/x-msgpack", "application/json", "", http.StatusOK, "application/json"},
+		{"yaml format", body, "application/msgpack", "", "?format=yaml", http.StatusOK, "application/yaml"},
+		{"wrong content type", body, "application/json", "", "", http.StatusUnsupportedMediaType, "application/json"},
+		{"empty", nil, "application/msgpack", "", "", http.StatusBadRequest, "application/json"},
+		{"invalid", []byte{0xc1}, "application/msgpack", "", "", http.StatusBadRequest, "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/msgpack"+tt.query, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			MsgpackHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.expectedContentType {
+				t.Errorf("Expected content type %s, got %s", tt.expectedContentType, ct)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/msgpack", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/msgpack")
+		rr := httptest.NewRecorder()
+		MsgpackHandler(rr, req)
+
+		var echoed map[string]any
+		if err := msgpack.Unmarshal(rr.Body.Bytes(), &echoed); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if raw, ok := echoed["raw"].([]byte); !ok || !bytes.Equal(raw, []byte{0xde, 0xad}) {
+			t.Errorf("Expected the binary string to survive, got %#v", echoed["raw"])
+		}
+		if echoed["name"] != "httpbin" || !reflect.DeepEqual(echoed["ids"], []any{int8(1), int8(2)}) {
+			t.Errorf("Unexpected echo %#v", echoed)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/msgpack?format=json", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		MsgpackHandler(rr, req)
+		if got := strings.TrimSpace(rr.Body.String()); got != `{"ids":[1,2],"name":"httpbin","raw":"3q0="}` {
+			t.Errorf("Unexpected JSON echo %s", got)
+		}
+	})
+}
+
+// TestProtobufHandler tests the protobuf echo and its schema
+func TestProtobufHandler(t *testing.T) {
+	request := EchoRequest{Message: "hello", Metadata: map[string]string{"b": "2", "a": "1"}, Payload: []byte{0, 1, 2}}
+	// An unknown fixed64 field must be skipped
+	withUnknown := protowire.AppendFixed64(protowire.AppendTag(request.marshal(), 9, protowire.Fixed64Type), 7)
+
+	tests := []struct {
+		name           string
+		contentType    string
+		body           []byte
+		expectedStatus int
+		expected       EchoRequest
+	}{
+		{"echo", "application/x-protobuf", request.marshal(), http.StatusOK, request},
+		{"unknown fields", "application/protobuf", withUnknown, http.StatusOK, request},
+		{"empty", "", nil, http.StatusOK, EchoRequest{}},
+		{"wrong content type", "application/json", []byte(`{}`), http.StatusUnsupportedMediaType, EchoRequest{}},
+		{"truncated", "application/x-protobuf", request.marshal()[:4], http.StatusBadRequest, EchoRequest{}},
+		{"wrong wire type", "application/x-protobuf", protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1), http.StatusBadRequest, EchoRequest{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/protobuf?x=1", bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			req.Header.Set("X-Test", "yes")
+			rr := httptest.NewRecorder()
+			ProtobufHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/x-protobuf" {
+				t.Errorf("Expected application/x-protobuf, got %s", ct)
+			}
+
+			// Decode the EchoResponse: the embedded request, then the metadata
+			var echoed EchoRequest
+			// proto3 omits a zero body_size
+			metadata := map[protowire.Number][]byte{5: []byte("0")}
+			var receivedAt uint64
+			err := consumeFields(rr.Body.Bytes(), func(num protowire.Number, _ protowire.Type, varint uint64, b []byte) error {
+				var err error
+				switch num {
+				case 1:
+					echoed, err = unmarshalEchoRequest(b)
+				case 2:
+					err = consumeFields(b, func(num protowire.Number, _ protowire.Type, varint uint64, b []byte) error {
+						if num == 5 {
+							b = []byte(strconv.FormatUint(varint, 10))
+						}
+						if num != 4 {
+							metadata[num] = b
+						}
+						return nil
+					})
+				case 3:
+					receivedAt = varint
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatalf("Failed to decode EchoResponse: %v", err)
+			}
+			if !reflect.DeepEqual(echoed, tt.expected) {
+				t.Errorf("Expected the request %+v, got %+v", tt.expected, echoed)
+			}
+			if string(metadata[1]) != "POST" || string(metadata[2]) != "/protobuf?x=1" || string(metadata[5]) != strconv.Itoa(len(tt.body)) {
+				t.Errorf("Unexpected metadata %q", metadata)
+			}
+			if receivedAt == 0 {
+				t.Error("Expected received_at_unix_ms to be set")
+			}
+		})
+	}
+
+	t.Run("schema", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		ProtobufSchemaHandler(rr, httptest.NewRequest("GET", "/protobuf/schema", nil))
+		for _, want := range []string{"package httpbin.v1;", "message EchoRequest", "message EchoResponse"} {
+			if !strings.Contains(rr.Body.String(), want) {
+				t.Errorf("Expected the schema to contain %q", want)
+			}
+		}
+	})
+}
+
+// TestConvertHandlers tests converting between XML and JSON
+func TestConvertHandlers(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		body           string
+		expectedStatus int
+		expected       string
+	}{
+		{"xml to json", XMLToJSONHandler, `<?xml version="1.0"?><order id="7"><item>a</item><item>b</item><note/><total currency="EUR">9.50</total></order>`, http.StatusOK,
+			`{"order":{"@id":"7","item":["a","b"],"note":"","total":{"#text":"9.50","@currency":"EUR"}}}`},
+		{"xml mixed text", XMLToJSONHandler, "<p>\n  hello <b>world</b>\n</p>", http.StatusOK, `{"p":{"#text":"hello","b":"world"}}`},
+		{"xml namespaces", XMLToJSONHandler, `<s:Envelope xmlns:s="urn:s"><s:Body>x</s:Body></s:Envelope>`, http.StatusOK, `{"Envelope":{"@xmlns:s":"urn:s","Body":"x"}}`},
+		{"xml invalid", XMLToJSONHandler, `<a><b></a>`, http.StatusBadRequest, ""},
+		{"xml two roots", XMLToJSONHandler, `<a/><b/>`, http.StatusBadRequest, ""},
+		{"xml empty", XMLToJSONHandler, ``, http.StatusBadRequest, ""},
+		{"json to xml", JSONToXMLHandler, `{"order":{"@id":7,"item":["a","b"],"paid":true,"note":null,"total":{"@currency":"EUR","#text":"9.50"}}}`, http.StatusOK,
+			xml.Header + `<order id="7"><item>a</item><item>b</item><note></note><paid>true</paid><total currency="EUR">9.50</total></order>` + "\n"},
+		{"json several keys", JSONToXMLHandler, `{"a":1,"b":2.50}`, http.StatusOK, xml.Header + `<root><a>1</a><b>2.50</b></root>` + "\n"},
+		{"json array", JSONToXMLHandler, `[1,"x"]`, http.StatusOK, xml.Header + `<root><item>1</item><item>x</item></root>` + "\n"},
+		{"json invalid names", JSONToXMLHandler, `{"a":{"1st":"x"}}`, http.StatusOK, xml.Header + `<a><field name="1st">x</field></a>` + "\n"},
+		{"json object attribute", JSONToXMLHandler, `{"a":{"@b":{"c":1}}}`, http.StatusBadRequest, ""},
+		{"json invalid", JSONToXMLHandler, `{"a":`, http.StatusBadRequest, ""},
+		{"json trailing", JSONToXMLHandler, `{} {}`, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler(rr, httptest.NewRequest("POST", "/convert", strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expected != "" && strings.TrimSuffix(rr.Body.String(), "\n") != strings.TrimSuffix(tt.expected, "\n") {
+				t.Errorf("Expected %s, got %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		doc := `<order id="7"><item>a</item><item>b</item><total currency="EUR">9.50</total></order>`
+		rr := httptest.NewRecorder()
+		XMLToJSONHandler(rr, httptest.NewRequest("POST", "/convert/xml-json", strings.NewReader(doc)))
+		back := httptest.NewRecorder()
+		JSONToXMLHandler(back, httptest.NewRequest("POST", "/convert/json-xml", rr.Body))
+		if got := strings.TrimSpace(strings.TrimPrefix(back.Body.String(), xml.Header)); got != doc {
+			t.Errorf("Expected %s back, got %s", doc, got)
+		}
+	})
+}
+
+// TestValidateHandler tests validating documents against preloaded and
+// posted schemas
+func TestValidateHandler(t *testing.T) {
+	dir := t.TempDir()
+	schemas := map[string]string{
+		"user.json":    `{"type":"object","required":["name"],"properties":{"name":{"type":"string"},"age":{"type":"integer","minimum":0},"email":{"format":"email"},"address":{"$ref":"address.json"}}}`,
+		"address.json": `{"type":"object","required":["city"]}`,
+		"broken.json":  `{"type":5}`,
+		"escape.json":  `{"$ref":"file:///etc/passwd"}`,
+	}
+	for name, text := range schemas {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	multipartBody := func(parts map[string]string) (string, string) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for name, value := range parts {
+			mw.WriteField(name, value)
+		}
+		mw.Close()
+		return buf.String(), mw.FormDataContentType()
+	}
+
+	tests := []struct {
+		name           string
+		dir            string
+		query          string
+		header         string
+		parts          map[string]string
+		body           string
+		expectedStatus int
+		expectedErrors []ValidationIssue
+	}{
+		{"valid by query", dir, "?schema=user", "", nil, `{"name":"ada","age":36}`, http.StatusOK, []ValidationIssue{}},
+		{"invalid by header", dir, "", "user", nil, `{"age":-1,"email":"ada","address":{}}`, http.StatusUnprocessableEntity, []ValidationIssue{
+			{InstanceLocation: "", SchemaLocation: "user.json#/required", Message: "missing property 'name'"},
+			{InstanceLocation: "/address", SchemaLocation: "address.json#/required", Message: "missing property 'city'"},
+			{InstanceLocation: "/age", SchemaLocation: "user.json#/properties/age/minimum", Message: "minimum: got -1, want 0"},
+			{InstanceLocation: "/email", SchemaLocation: "user.json#/properties/email/format", Message: "'ada' is not valid email: missing @"},
+		}},
+		{"multipart", "", "", "", map[string]string{"schema": `{"required":["id"]}`, "document": `{}`}, "", http.StatusUnprocessableEntity, []ValidationIssue{
+			{InstanceLocation: "", SchemaLocation: "#/required", Message: "missing property 'id'"},
+		}},
+		{"multipart referencing a preloaded schema", dir, "", "", map[string]string{"schema": `{"items":{"$ref":"address.json"}}`, "document": `[{"city":"x"}]`}, "", http.StatusOK, []ValidationIssue{}},
+		{"multipart without document", dir, "", "", map[string]string{"schema": `{}`}, "", http.StatusBadRequest, nil},
+		{"no schema", dir, "", "", nil, `{}`, http.StatusBadRequest, nil},
+		{"no directory", "", "?schema=user", "", nil, `{}`, http.StatusNotFound, nil},
+		{"unknown schema", dir, "?schema=nope", "", nil, `{}`, http.StatusNotFound, nil},
+		{"invalid name", dir, "?schema=../user", "", nil, `{}`, http.StatusBadRequest, nil},
+		{"invalid schema", dir, "?schema=broken", "", nil, `{}`, http.StatusBadRequest, nil},
+		{"reference outside the directory", dir, "?schema=escape", "", nil, `{}`, http.StatusBadRequest, nil},
+		{"invalid document", dir, "?schema=user", "", nil, `{"name":`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := tt.body, "application/json"
+			if tt.parts != nil {
+				body, contentType = multipartBody(tt.parts)
+			}
+			req := httptest.NewRequest("POST", "/validate"+tt.query, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			if tt.header != "" {
+				req.Header.Set(SchemaHeader, tt.header)
+			}
+			req = req.WithContext(WithSettings(req.Context(), &Settings{SchemasDir: tt.dir}))
+			rr := httptest.NewRecorder()
+			ValidateHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedErrors == nil {
+				return
+			}
+			var resp ValidateResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Valid != (len(tt.expectedErrors) == 0) {
+				t.Errorf("Expected valid %v, got %v", len(tt.expectedErrors) == 0, resp.Valid)
+			}
+			if !reflect.DeepEqual(resp.Errors, tt.expectedErrors) {
+				t.Errorf("Expected errors %+v, got %+v", tt.expectedErrors, resp.Errors)
+			}
+		})
+	}
+}
+
+// TestHashHandler tests digesting request bodies
+func TestHashHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hash/{algo}", HashHandler)
+
+	tests := []struct {
+		algo           string
+		body           string
+		expectedStatus int
+		expectedHex    string
+	}{
+		{"md5", "hello", http.StatusOK, "5d41402abc4b2a76b9719d911017c592"},
+		{"sha1", "hello", http.StatusOK, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{"sha256", "hello", http.StatusOK, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"sha512", "", http.StatusOK, "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e"},
+		{"crc32", "hello", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algo, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("POST", "/hash/"+tt.algo, strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var resp HashResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			sum, _ := hex.DecodeString(tt.expectedHex)
+			expected := HashResponse{Algorithm: tt.algo, Bytes: int64(len(tt.body)), Hex: tt.expectedHex, Base64: base64.StdEncoding.EncodeToString(sum)}
+			if resp != expected {
+				t.Errorf("Expected %+v, got %+v", expected, resp)
+			}
+		})
+	}
+}
+
+// TestHMACHandler tests signing the body or a message with a key
+func TestHMACHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hmac/{algo}", HMACHandler)
+
+	tests := []struct {
+		name           string
+		path           string
+		key            string
+		body           string
+		expectedStatus int
+		expected       HMACResponse
+	}{
+		{"body with header key", "/hmac/sha256", "secret", "hello", http.StatusOK, HMACResponse{
+			Algorithm: "sha256",
+			Bytes:     5,
+			Hex:       "88aab3ede8d3adf94d26ab90d3bafd4a2083070c3bcce9c014ee04a443847c0b",
+			Base64:    "iKqz7ejTrflNJquQ07r9SiCDBww7zOnAFO4EpEOEfAs=",
+			Base64URL: "iKqz7ejTrflNJquQ07r9SiCDBww7zOnAFO4EpEOEfAs",
+			Header:    "sha256=88aab3ede8d3adf94d26ab90d3bafd4a2083070c3bcce9c014ee04a443847c0b",
+		}},
+		{"message with query key", "/hmac/md5?key=secret&message=hello", "", "ignored", http.StatusOK, HMACResponse{
+			Algorithm: "md5",
+			Bytes:     5,
+			Hex:       "bade63863c61ed0b3165806ecd6acefc",
+			Base64:    "ut5jhjxh7QsxZYBuzWrO/A==",
+			Base64URL: "ut5jhjxh7QsxZYBuzWrO_A",
+			Header:    "md5=bade63863c61ed0b3165806ecd6acefc",
+		}},
+		{"missing key", "/hmac/sha256", "", "hello", http.StatusBadRequest, HMACResponse{}},
+		{"unsupported algorithm", "/hmac/sha3", "secret", "hello", http.StatusBadRequest, HMACResponse{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set(HMACKeyHeader, tt.key)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var resp HMACResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, resp)
+			}
+		})
+	}
+}
+
+// TestEncodeHandlers tests the base64 and URL encoding utilities
+func TestEncodeHandlers(t *testing.T) {
+	tests := []struct {
+		name                string
+		handler             http.HandlerFunc
+		query               string
+		body                string
+		expectedStatus      int
+		expectedContentType string
+		expected            string
+	}{
+		{"base64 value", EncodeBase64Handler, "?value=hello", "", http.StatusOK, "text/plain; charset=utf-8", "aGVsbG8="},
+		{"base64 body", EncodeBase64Handler, "", "\xfb\xff", http.StatusOK, "text/plain; charset=utf-8", "+/8="},
+		{"base64 url safe unpadded", EncodeBase64Handler, "?urlsafe=1&padding=0", "\xfb\xff", http.StatusOK, "text/plain; charset=utf-8", "-_8"},
+		{"base64 empty value", EncodeBase64Handler, "?value=", "ignored", http.StatusOK, "text/plain; charset=utf-8", ""},
+		{"decode base64", DecodeBase64Handler, "?value=aGVsbG8%3D", "", http.StatusOK, "text/plain; charset=utf-8", "hello"},
+		{"decode base64 unpadded with line breaks", DecodeBase64Handler, "", "aGVs\nbG8\n", http.StatusOK, "text/plain; charset=utf-8", "hello"},
+		{"decode base64 url safe binary", DecodeBase64Handler, "", "-_8", http.StatusOK, "application/octet-stream", "\xfb\xff"},
+		{"decode base64 invalid", DecodeBase64Handler, "?value=a*b", "", http.StatusBadRequest, "", ""},
+		{"url query", EncodeURLHandler, "?value=a%20b%26c%2Fd", "", http.StatusOK, "text/plain; charset=utf-8", "a+b%26c%2Fd"},
+		{"url path", EncodeURLHandler, "?component=path", "a b&c/d", http.StatusOK, "text/plain; charset=utf-8", "a%20b&c%2Fd"},
+		{"decode url query", DecodeURLHandler, "", "a+b%26c", http.StatusOK, "text/plain; charset=utf-8", "a b&c"},
+		{"decode url path", DecodeURLHandler, "?component=path", "a+b%20c", http.StatusOK, "text/plain; charset=utf-8", "a+b c"},
+		{"decode url invalid", DecodeURLHandler, "", "100%", http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler(rr, httptest.NewRequest("POST", "/encode"+tt.query, strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expectedContentType, ct)
+			}
+			if rr.Body.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestUUIDHandler tests generating UUIDs of each version
+func TestUUIDHandler(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([147])[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	get := func(t *testing.T, query string) (int, UUIDsResponse) {
+		rr := httptest.NewRecorder()
+		UUIDHandler(rr, httptest.NewRequest("GET", "/uuid"+query, nil))
+		var resp UUIDsResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		expectedStatus  int
+		expectedCount   int
+		expectedVersion string
+	}{
+		{"default", "?count=1", http.StatusOK, 1, "4"},
+		{"version 1", "?version=1&count=20", http.StatusOK, 20, "1"},
+		{"version 7", "?version=v7&count=20", http.StatusOK, 20, "7"},
+		{"count capped", "?count=5000", http.StatusOK, maxUUIDCount, "4"},
+		{"empty batch", "?count=0", http.StatusOK, 0, ""},
+		{"unsupported version", "?version=3", http.StatusBadRequest, 0, ""},
+		{"invalid count", "?count=-1", http.StatusBadRequest, 0, ""},
+		{"invalid seed", "?seed=x", http.StatusBadRequest, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := get(t, tt.query)
+			if status != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+			if len(resp.UUIDs) != tt.expectedCount {
+				t.Fatalf("Expected %d UUIDs, got %d", tt.expectedCount, len(resp.UUIDs))
+			}
+			for _, id := range resp.UUIDs {
+				if m := uuidPattern.FindStringSubmatch(id); m == nil || m[1] != tt.expectedVersion {
+					t.Errorf("Expected a version %s UUID, got %s", tt.expectedVersion, id)
+				}
+			}
+		})
+	}
+
+	t.Run("single", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		UUIDHandler(rr, httptest.NewRequest("GET", "/uuid", nil))
+		var resp UUIDResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || !uuidPattern.MatchString(resp.UUID) {
+			t.Errorf("Expected a UUID, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("seeded", func(t *testing.T) {
+		for _, version := range []string{"1", "4", "7"} {
+			_, first := get(t, "?count=3&seed=42&version="+version)
+			_, second := get(t, "?count=3&seed=42&version="+version)
+			if !reflect.DeepEqual(first, second) {
+				t.Errorf("Expected the same version %s UUIDs for a seed, got %v and %v", version, first.UUIDs, second.UUIDs)
+			}
+		}
+	})
+
+	t.Run("time ordered", func(t *testing.T) {
+		// A stopped clock makes every UUID share a timestamp, and overflows
+		// the version 7 counter
+		now := func() time.Time { return seededUUIDTime }
+		v1Ticks := func(id string) int64 {
+			h := strings.ReplaceAll(id, "-", "")
+			ticks, _ := strconv.ParseInt(h[13:16]+h[8:12]+h[0:8], 16, 64)
+			return ticks
+		}
+		for _, version := range []int{1, 7} {
+			g := newUUIDGenerator(version, rand.New(rand.NewSource(1)), now)
+			prev := g.next()
+			for range 5000 {
+				id := g.next()
+				if version == 7 && id <= prev || version == 1 && v1Ticks(id) <= v1Ticks(prev) {
+					t.Fatalf("Expected version %d UUIDs to increase, got %s after %s", version, id, prev)
+				}
+				prev = id
+			}
+		}
+		g := newUUIDGenerator(7, rand.New(rand.NewSource(1)), now)
+		id := g.next()
+		if ms, _ := strconv.ParseInt(strings.ReplaceAll(id, "-", "")[:12], 16, 64); ms != seededUUIDTime.UnixMilli() {
+			t.Errorf("Expected timestamp %d, got %d", seededUUIDTime.UnixMilli(), ms)
+		}
+		g = newUUIDGenerator(1, rand.New(rand.NewSource(1)), now)
+		if ticks := v1Ticks(g.next()); ticks != seededUUIDTime.UnixNano()/100+gregorianOffset {
+			t.Errorf("Expected timestamp %d, got %d", seededUUIDTime.UnixNano()/100+gregorianOffset, ticks)
+		}
+	})
+}
+
+// TestNowHandler tests reporting the server time
+func TestNowHandler(t *testing.T) {
+	tests := []struct {
+		name              string
+		query             string
+		date              string
+		expectedStatus    int
+		expectedTimezone  string
+		expectedFormatted *regexp.Regexp
+		expectedSkew      float64
+	}{
+		{"defaults", "", "", http.StatusOK, "UTC", nil, 0},
+		{"named layout", "?layout=http", "", http.StatusOK, "UTC", regexp.MustCompile(`^\w{3}, \d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2} GMT$`), 0},
+		{"go layout and zone", "?layout=2006-01-02T15:04Z07:00&tz=Asia/Kolkata", "", http.StatusOK, "Asia/Kolkata", regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}\+05:30$`), 0},
+		{"client ahead", "", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), http.StatusOK, "UTC", nil, 3600},
+		{"client behind with numeric zone", "", time.Now().Add(-time.Minute).Format(time.RFC1123Z), http.StatusOK, "UTC", nil, -60},
+		{"unknown zone", "?tz=Mars/Olympus", "", http.StatusBadRequest, "", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/now"+tt.query, nil)
+			if tt.date != "" {
+				req.Header.Set("Date", tt.date)
+			}
+			before := time.Now()
+			rr := httptest.NewRecorder()
+			NowHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var resp NowResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Timezone != tt.expectedTimezone {
+				t.Errorf("Expected time zone %s, got %s", tt.expectedTimezone, resp.Timezone)
+			}
+			if parsed, err := time.Parse(time.RFC3339Nano, resp.RFC3339); err != nil || parsed.UnixMilli() != resp.UnixMillis || parsed.Unix() != resp.Unix {
+				t.Errorf("Expected matching times, got %+v", resp)
+			}
+			if d := time.UnixMilli(resp.UnixMillis).Sub(before.Truncate(time.Millisecond)); d < 0 || d > time.Second {
+				t.Errorf("Expected the current time, got %s off", d)
+			}
+			if tt.expectedFormatted != nil && !tt.expectedFormatted.MatchString(resp.Formatted) {
+				t.Errorf("Expected formatted time matching %s, got %q", tt.expectedFormatted, resp.Formatted)
+			}
+			switch {
+			case tt.date == "" && (resp.RequestDate != "" || resp.SkewSeconds != nil):
+				t.Errorf("Expected no request date, got %+v", resp)
+			case tt.date != "" && (resp.RequestDate != tt.date || resp.SkewSeconds == nil || math.Abs(*resp.SkewSeconds-tt.expectedSkew) > 1):
+				t.Errorf("Expected request date %s with skew %v, got %+v", tt.date, tt.expectedSkew, resp)
+			}
+			if cc := rr.Header().Get("Cache-Control"); cc != "no-store" {
+				t.Errorf("Expected Cache-Control no-store, got %q", cc)
+			}
+		})
+	}
+}
+
+// TestSleepUntilHandler tests holding responses until a wall-clock time
+func TestSleepUntilHandler(t *testing.T) {
+	settings := &Settings{MaxDelay: time.Second}
+	in := func(d time.Duration) time.Time { return time.Now().Add(d) }
+	fixed := func(t string) func() string { return func() string { return t } }
+
+	tests := []struct {
+		name           string
+		t              func() string
+		expectedStatus int
+		minWait        time.Duration
+		late           bool
+	}{
+		{"rfc3339", func() string { return in(200 * time.Millisecond).Format(time.RFC3339Nano) }, http.StatusOK, 150 * time.Millisecond, false},
+		{"fractional seconds", func() string {
+			return strconv.FormatFloat(float64(in(200*time.Millisecond).UnixMilli())/1e3, 'f', 3, 64)
+		}, http.StatusOK, 150 * time.Millisecond, false},
+		{"milliseconds", func() string { return strconv.FormatInt(in(200*time.Millisecond).UnixMilli(), 10) }, http.StatusOK, 150 * time.Millisecond, false},
+		{"past", fixed("2001-02-03T04:05:06Z"), http.StatusOK, 0, true},
+		{"beyond max delay", func() string { return in(time.Minute).Format(time.RFC3339) }, http.StatusBadRequest, 0, false},
+		{"far future", fixed("1e20"), http.StatusBadRequest, 0, false},
+		{"missing", fixed(""), http.StatusBadRequest, 0, false},
+		{"invalid", fixed("tomorrow"), http.StatusBadRequest, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/sleep-until?t="+url.QueryEscape(tt.t()), nil)
+			req = req.WithContext(WithSettings(req.Context(), settings))
+			start := time.Now()
+			rr := httptest.NewRecorder()
+			SleepUntilHandler(rr, req)
+			elapsed := time.Since(start)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var resp SleepUntilResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if elapsed < tt.minWait || elapsed > tt.minWait+time.Second {
+				t.Errorf("Expected to wait about %s, waited %s", tt.minWait, elapsed)
+			}
+			if resp.Late != tt.late {
+				t.Errorf("Expected late %v, got %+v", tt.late, resp)
+			}
+			target, _ := time.Parse(time.RFC3339Nano, resp.Target)
+			if now, _ := time.Parse(time.RFC3339Nano, resp.Now); now.Before(target) {
+				t.Errorf("Expected to answer after %s, answered at %s", resp.Target, resp.Now)
+			}
+		})
+	}
+}
+
+// TestHostnameHandler tests reporting the serving instance
+func TestHostnameHandler(t *testing.T) {
+	hostname, _ := os.Hostname()
+	local := &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 8080}
+	tests := []struct {
+		name     string
+		podIP    string
+		local    net.Addr
+		expected HostnameResponse
+	}{
+		{"connection address", "", local, HostnameResponse{Hostname: hostname, PodIP: "10.1.2.3", ListenAddr: "10.1.2.3:8080"}},
+		{"downward API", "10.9.9.9", local, HostnameResponse{Hostname: hostname, PodIP: "10.9.9.9", ListenAddr: "10.1.2.3:8080"}},
+		{"no connection", "", nil, HostnameResponse{Hostname: hostname}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_IP", tt.podIP)
+			req := httptest.NewRequest("GET", "/hostname", nil)
+			if tt.local != nil {
+				req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, tt.local))
+			}
+			rr := httptest.NewRecorder()
+			HostnameHandler(rr, req)
+
+			var resp HostnameResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, resp)
+			}
+			if served := rr.Header().Get(ServedByHeader); served != hostname {
+				t.Errorf("Expected %s %s, got %q", ServedByHeader, hostname, served)
+			}
+		})
+	}
+}
+
+// TestEnvHandler tests revealing only allowlisted environment variables
+func TestEnvHandler(t *testing.T) {
+	t.Setenv("POD_NAME", "httpbin-0")
+	t.Setenv("NODE_NAME", "worker-1")
+	t.Setenv("HTTPBIN_API_TOKEN", "hunter2")
+	t.Setenv("APP_SECRET", "hunter2")
+	t.Setenv("APP_REGION", "eu-1")
+
+	tests := []struct {
+		name       string
+		prefixes   []string
+		expected   map[string]string
+		unexpected []string
+	}{
+		{"defaults", DefaultEnvPrefixes, map[string]string{"POD_NAME": "httpbin-0", "NODE_NAME": "worker-1", "HTTPBIN_API_TOKEN": redactedEnv}, []string{"APP_SECRET", "APP_REGION", "PATH"}},
+		{"custom", []string{"APP_"}, map[string]string{"APP_REGION": "eu-1", "APP_SECRET": redactedEnv}, []string{"POD_NAME", "PATH"}},
+		{"none", nil, map[string]string{}, []string{"POD_NAME", "PATH"}},
+		{"empty prefix", []string{""}, map[string]string{}, []string{"POD_NAME", "PATH"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/env", nil)
+			req = req.WithContext(WithSettings(req.Context(), &Settings{EnvPrefixes: tt.prefixes}))
+			rr := httptest.NewRecorder()
+			EnvHandler(rr, req)
+
+			var resp EnvResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			for name, value := range tt.expected {
+				if got, ok := resp.Variables[name]; !ok || got != value {
+					t.Errorf("Expected %s=%s, got %q", name, value, got)
+				}
+			}
+			for _, name := range tt.unexpected {
+				if _, ok := resp.Variables[name]; ok {
+					t.Errorf("Expected %s to be hidden", name)
+				}
+			}
+			if strings.Contains(rr.Body.String(), "hunter2") {
+				t.Errorf("Expected secrets to be redacted, got %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestK8sHandler tests reporting downward-API metadata
+func TestK8sHandler(t *testing.T) {
+	podinfo := t.TempDir()
+	os.WriteFile(filepath.Join(podinfo, "labels"), []byte("app=\"httpbin\"\ntier=\"edge \\\"blue\\\"\"\n"), 0o644)
+	sa := t.TempDir()
+	os.WriteFile(filepath.Join(sa, "namespace"), []byte("testing\n"), 0o644)
+	defer func(dir string) { serviceAccountDir = dir }(serviceAccountDir)
+	serviceAccountDir = sa
+
+	for _, name := range []string{"KUBERNETES_SERVICE_HOST", "POD_NAMESPACE", "POD_NAME", "POD_IP", "NODE_NAME", "NODE_IP", "HOST_IP", "POD_SERVICE_ACCOUNT", "SERVICE_ACCOUNT"} {
+		t.Setenv(name, "")
+	}
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		dir      string
+		expected K8sResponse
+	}{
+		{"outside a cluster", nil, "", K8sResponse{Namespace: "testing"}},
+		{"downward API", map[string]string{
+			"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+			"POD_NAMESPACE":           "prod",
+			"POD_NAME":                "httpbin-0",
+			"POD_IP":                  "10.1.2.3",
+			"NODE_NAME":               "worker-1",
+			"HOST_IP":                 "192.0.2.1",
+			"POD_SERVICE_ACCOUNT":     "httpbin",
+		}, podinfo, K8sResponse{
+			InCluster:      true,
+			Namespace:      "prod",
+			PodName:        "httpbin-0",
+			PodIP:          "10.1.2.3",
+			NodeName:       "worker-1",
+			NodeIP:         "192.0.2.1",
+			ServiceAccount: "httpbin",
+			Labels:         map[string]string{"app": "httpbin", "tier": `edge "blue"`},
+		}},
+		{"hostname as pod name", map[string]string{"KUBERNETES_SERVICE_HOST": "10.0.0.1"}, t.TempDir(), K8sResponse{InCluster: true, Namespace: "testing", PodName: hostname}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			req := httptest.NewRequest("GET", "/k8s", nil)
+			req = req.WithContext(WithSettings(req.Context(), &Settings{PodInfoDir: tt.dir}))
+			rr := httptest.NewRecorder()
+			K8sHandler(rr, req)
+
+			var resp K8sResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(resp, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, resp)
+			}
+		})
+	}
+}
+
+// TestMetadataMock tests the fake AWS and GCP instance metadata
+func TestMetadataMock(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata/aws/{path...}", AWSMetadataHandler)
+	mux.HandleFunc("/metadata/gcp/{path...}", GCPMetadataHandler)
+	enabled := &Settings{MetadataMock: true}
+
+	do := func(settings *Settings, method, path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for name, values := range header {
+			for _, v := range values {
+				req.Header.Add(name, v)
+			}
+		}
+		req = req.WithContext(WithSettings(req.Context(), settings))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	issue := func(t *testing.T, ttl string) string {
+		rr := do(enabled, "PUT", "/metadata/aws/latest/api/token", http.Header{awsTokenTTLHeader: {ttl}})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected a token, got %d: %s", rr.Code, rr.Body.String())
+		}
+		return rr.Body.String()
+	}
+	google := http.Header{"Metadata-Flavor": {"Google"}}
+
+	tests := []struct {
+		name                string
+		settings            *Settings
+		method              string
+		path                string
+		header              http.Header
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"disabled", &Settings{}, "GET", "/metadata/aws/latest/meta-data/instance-id", nil, http.StatusNotFound, "application/json", ""},
+		{"aws value", enabled, "GET", "/metadata/aws/latest/meta-data/instance-id", nil, http.StatusOK, "text/plain; charset=utf-8", awsInstanceID},
+		{"aws nested value", enabled, "GET", "/metadata/aws/latest/meta-data/placement/region", nil, http.StatusOK, "text/plain; charset=utf-8", awsRegion},
+		{"aws listing", enabled, "GET", "/metadata/aws/latest/meta-data/iam/", nil, http.StatusOK, "text/plain; charset=utf-8", "info\nsecurity-credentials/"},
+		{"aws role listing", enabled, "GET", "/metadata/aws/latest/meta-data/iam/security-credentials/", nil, http.StatusOK, "text/plain; charset=utf-8", awsRole},
+		{"aws missing", enabled, "GET", "/metadata/aws/latest/meta-data/nope", nil, http.StatusNotFound, "text/plain; charset=utf-8", ""},
+		{"aws below a value", enabled, "GET", "/metadata/aws/latest/meta-data/instance-id/x", nil, http.StatusNotFound, "text/plain; charset=utf-8", ""},
+		{"aws invalid token", enabled, "GET", "/metadata/aws/latest/meta-data/instance-id", http.Header{awsTokenHeader: {"forged"}}, http.StatusUnauthorized, "text/plain; charset=utf-8", ""},
+		{"aws token without ttl", enabled, "PUT", "/metadata/aws/latest/api/token", nil, http.StatusBadRequest, "text/plain; charset=utf-8", ""},
+		{"aws token ttl too long", enabled, "PUT", "/metadata/aws/latest/api/token", http.Header{awsTokenTTLHeader: {"21601"}}, http.StatusBadRequest, "text/plain; charset=utf-8", ""},
+		{"aws token through a proxy", enabled, "PUT", "/metadata/aws/latest/api/token", http.Header{awsTokenTTLHeader: {"60"}, "X-Forwarded-For": {"203.0.113.9"}}, http.StatusForbidden, "text/plain; charset=utf-8", ""},
+		{"aws token by get", enabled, "GET", "/metadata/aws/latest/api/token", nil, http.StatusMethodNotAllowed, "text/plain; charset=utf-8", ""},
+		{"gcp value", enabled, "GET", "/metadata/gcp/computeMetadata/v1/project/project-id", google, http.StatusOK, "text/plain; charset=utf-8", gcpProjectID},
+		{"gcp listing", enabled, "GET", "/metadata/gcp/computeMetadata/v1/", google, http.StatusOK, "text/plain; charset=utf-8", "instance/\nproject/"},
+		{"gcp recursive", enabled, "GET", "/metadata/gcp/computeMetadata/v1/project/?recursive=true", google, http.StatusOK, "application/json", `{"numericProjectId":"123456789012","projectId":"example-project"}`},
+		{"gcp without flavor", enabled, "GET", "/metadata/gcp/computeMetadata/v1/project/project-id", nil, http.StatusForbidden, "text/plain; charset=utf-8", ""},
+		{"gcp through a proxy", enabled, "GET", "/metadata/gcp/computeMetadata/v1/project/project-id", http.Header{"Metadata-Flavor": {"Google"}, "X-Forwarded-For": {"203.0.113.9"}}, http.StatusForbidden, "text/plain; charset=utf-8", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(tt.settings, tt.method, tt.path, tt.header)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expectedContentType, ct)
+			}
+			if tt.expectedBody != "" && strings.TrimSpace(rr.Body.String()) != tt.expectedBody {
+				t.Errorf("Expected %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			if strings.HasPrefix(tt.path, "/metadata/gcp/") && rr.Header().Get("Metadata-Flavor") != "Google" {
+				t.Errorf("Expected a Metadata-Flavor: Google header")
+			}
+		})
+	}
+
+	t.Run("aws credentials with token", func(t *testing.T) {
+		token := issue(t, "60")
+		rr := do(enabled, "GET", "/metadata/aws/latest/meta-data/iam/security-credentials/"+awsRole, http.Header{awsTokenHeader: {token}})
+		var creds map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &creds); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("Expected credentials, got %d: %s", rr.Code, rr.Body.String())
+		}
+		expiry, err := time.Parse(time.RFC3339, creds["Expiration"])
+		if creds["Code"] != "Success" || creds["AccessKeyId"] == "" || err != nil || time.Until(expiry) < time.Hour {
+			t.Errorf("Expected placeholder credentials expiring in the future, got %v", creds)
+		}
+	})
+
+	t.Run("aws token expiry", func(t *testing.T) {
+		token := issue(t, "1")
+		if !validAWSToken(token, time.Now()) {
+			t.Errorf("Expected a fresh token to be valid")
+		}
+		if validAWSToken(token, time.Now().Add(2*time.Second)) {
+			t.Errorf("Expected an expired token to be invalid")
+		}
+	})
+
+	t.Run("gcp token", func(t *testing.T) {
+		rr := do(enabled, "GET", "/metadata/gcp/computeMetadata/v1/instance/service-accounts/default/token", google)
+		var token map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &token); err != nil || token["token_type"] != "Bearer" {
+			t.Errorf("Expected a bearer token, got %s", rr.Body.String())
+		}
+	})
+}
+
+// TestMarshalXML tests rendering keys that are not valid element names
+func TestMarshalXML(t *testing.T) {
+	body, err := marshalXML(map[string]any{"headers": map[string]any{"X-Id": "1", "1st": "a&b"}, "empty": nil}, false)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	expected := xml.Header + `<response><empty></empty><headers><field name="1st">a&amp;b</field><X-Id>1</X-Id></headers></response>` + "\n"
+	if string(body) != expected {
+		t.Errorf("Expected %s, got %s", expected, body)
+	}
+}
+
+// TestPrettyOutput tests indenting responses per request and by default
+func TestPrettyOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		settings *Settings
+		indented bool
+	}{
+		{"compact by default", "", nil, false},
+		{"query", "?pretty=1", nil, true},
+		{"server default", "", &Settings{PrettyJSON: true}, true},
+		{"query overrides default", "?pretty=false", &Settings{PrettyJSON: true}, false},
+		{"xml", "?pretty=true&format=xml", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/headers"+tt.query, nil)
+			if tt.settings != nil {
+				req = req.WithContext(WithSettings(req.Context(), tt.settings))
+			}
+			rr := httptest.NewRecorder()
+			HeadersHandler(rr, req)
+
+			if indented := strings.Contains(rr.Body.String(), "\n  "); indented != tt.indented {
+				t.Errorf("Expected indented=%v, got body %q", tt.indented, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestJSONP tests wrapping JSON responses in a callback
+func TestJSONP(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		contentType    string
+		prefix         string
+	}{
+		{"callback", "?callback=cb", http.StatusOK, "application/javascript", "/**/ cb({"},
+		{"dotted callback", "?callback=jQuery.fn_1", http.StatusOK, "application/javascript", "/**/ jQuery.fn_1({"},
+		{"invalid callback", "?callback=alert(1)", http.StatusBadRequest, "application/json", `{"error"`},
+		{"non-json format", "?callback=cb&format=yaml", http.StatusOK, "application/yaml", "headers:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			HeadersHandler(rr, httptest.NewRequest("GET", "/headers"+tt.query, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Expected content type %s, got %s", tt.contentType, ct)
+			}
+			if !strings.HasPrefix(rr.Body.String(), tt.prefix) {
+				t.Errorf("Expected body to start with %q, got %q", tt.prefix, rr.Body.String())
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	HeadersHandler(rr, httptest.NewRequest("GET", "/headers?callback=cb", nil))
+	if body := rr.Body.String(); !strings.HasSuffix(body, "});\n") {
+		t.Errorf("Expected call to be closed, got %q", body)
+	}
+}
+
+// TestMultipartForm tests echoing multipart form fields and files
+func TestMultipartForm(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("name", "alice")
+	mw.WriteField("name", "bob")
+	fw, _ := mw.CreateFormFile("upload", "hello.txt")
+	fw.Write([]byte("hello"))
+	mw.Close()
+	body := buf.Bytes()
+
+	tests := []struct {
+		name        string
+		query       string
+		wantContent string
+	}{
+		{"metadata only", "", ""},
+		{"with content", "?file_content=1", base64.StdEncoding.EncodeToString([]byte("hello"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/post"+tt.query, bytes.NewReader(body))
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			rr := httptest.NewRecorder()
+			MethodHandler("POST")(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			var info RequestInfo
+			if err := json.NewDecoder(rr.Body).Decode(&info); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if info.Body != "" {
+				t.Errorf("Expected raw body to be omitted, got %q", info.Body)
+			}
+			if !reflect.DeepEqual(info.Form["name"], []string{"alice", "bob"}) {
+				t.Errorf("Expected form fields, got %v", info.Form)
+			}
+			expected := FileInfo{Filename: "hello.txt", Size: 5, ContentType: "application/octet-stream", Content: tt.wantContent}
+			if files := info.Files["upload"]; len(files) != 1 || files[0] != expected {
+				t.Errorf("Expected file %+v, got %+v", expected, info.Files)
+			}
+		})
+	}
+
+	truncated := "--xyz\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nvalue"
+	req := httptest.NewRequest("POST", "/post", strings.NewReader(truncated))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+	rr := httptest.NewRecorder()
+	MethodHandler("POST")(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a malformed body, got %d", rr.Code)
+	}
+}
+
+// TestURLEncodedForm tests echoing URL-encoded form fields
+func TestURLEncodedForm(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedForm   map[string][]string
+	}{
+		{"fields", "name=alice&name=bob&city=New+York", http.StatusOK, map[string][]string{"name": {"alice", "bob"}, "city": {"New York"}}},
+		{"invalid escape", "name=%zz", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/post", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+			rr := httptest.NewRecorder()
+			MethodHandler("POST")(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var info RequestInfo
+			if err := json.NewDecoder(rr.Body).Decode(&info); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(info.Form, tt.expectedForm) || info.Body != "" {
+				t.Errorf("Expected form %v and no body, got form %v body %q", tt.expectedForm, info.Form, info.Body)
+			}
+		})
+	}
+}
+
+// TestRequestCookies tests reporting request cookies
+func TestRequestCookies(t *testing.T) {
+	req := httptest.NewRequest("GET", "/get", nil)
+	req.Header.Set("Cookie", "session=abc; theme=dark; session=shadowed")
+	rr := httptest.NewRecorder()
+	MethodHandler("GET")(rr, req)
+
+	var info RequestInfo
+	if err := json.NewDecoder(rr.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := map[string]string{"session": "abc", "theme": "dark"}
+	if !reflect.DeepEqual(info.Cookies, expected) {
+		t.Errorf("Expected cookies %v, got %v", expected, info.Cookies)
+	}
+
+	rr = httptest.NewRecorder()
+	MethodHandler("GET")(rr, httptest.NewRequest("GET", "/get", nil))
+	if strings.Contains(rr.Body.String(), `"cookies"`) {
+		t.Errorf("Expected no cookies field without cookies, got %s", rr.Body.String())
+	}
+}
+
+// TestOriginChain tests reporting the whole forwarding chain as origin
+func TestOriginChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		settings *Settings
+		xff      []string
+		expected string
+	}{
+		{"client IP by default", "", nil, []string{"203.0.113.1"}, "203.0.113.1"},
+		{"query", "?origin_chain=1", nil, []string{"203.0.113.1, 10.0.0.2"}, "203.0.113.1, 10.0.0.2, 127.0.0.1"},
+		{"repeated headers", "?origin_chain=true", nil, []string{"203.0.113.1", "10.0.0.2"}, "203.0.113.1, 10.0.0.2, 127.0.0.1"},
+		{"no forwarding", "?origin_chain=1", nil, nil, "127.0.0.1"},
+		{"server default", "", &Settings{OriginChain: true}, []string{"198.51.100.7"}, "198.51.100.7, 127.0.0.1"},
+		{"query overrides default", "?origin_chain=0", &Settings{OriginChain: true, TrustedProxies: DefaultSettings().TrustedProxies}, []string{"198.51.100.7"}, "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ip"+tt.query, nil)
+			req.RemoteAddr = "127.0.0.1:4321"
+			for _, xff := range tt.xff {
+				req.Header.Add("X-Forwarded-For", xff)
+			}
+			if tt.settings != nil {
+				req = req.WithContext(WithSettings(req.Context(), tt.settings))
+			}
+			rr := httptest.NewRecorder()
+			IPHandler(rr, req)
+
+			var response map[string]string
+			json.NewDecoder(rr.Body).Decode(&response)
+			if response["origin"] != tt.expected {
+				t.Errorf("Expected origin %q, got %q", tt.expected, response["origin"])
+			}
+		})
+	}
+}
+
+// TestExpectHandler tests Expect: 100-continue handling over a raw
+// connection, as the client libraries hide the interim response
+func TestExpectHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(ExpectHandler))
+	defer srv.Close()
+
+	tests := []struct {
+		name           string
+		query          string
+		expectContinue bool
+		expectedStatus int
+		minWait        time.Duration
+	}{
+		{"immediate", "", true, http.StatusOK, 0},
+		{"delayed", "?delay=50ms", true, http.StatusOK, 50 * time.Millisecond},
+		{"rejected", "?reject=1", false, http.StatusExpectationFailed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			start := time.Now()
+			fmt.Fprintf(conn, "POST /expect-100%s HTTP/1.1\r\nHost: test\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n", tt.query)
+			reader := bufio.NewReader(conn)
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+
+			if tt.expectContinue {
+				if !strings.HasPrefix(line, "HTTP/1.1 100") {
+					t.Fatalf("Expected 100 Continue, got %q", line)
+				}
+				if elapsed := time.Since(start); elapsed < tt.minWait {
+					t.Errorf("Expected 100 Continue after %v, got it after %v", tt.minWait, elapsed)
+				}
+				reader.ReadString('\n') // blank line ending the interim response
+				conn.Write([]byte("hello"))
+				line, err = reader.ReadString('\n')
+				if err != nil {
+					t.Fatalf("Read failed: %v", err)
+				}
+			}
+
+			if want := fmt.Sprintf("HTTP/1.1 %d", tt.expectedStatus); !strings.HasPrefix(line, want) {
+				t.Errorf("Expected %s, got %q", want, line)
+			}
+		})
+	}
+}
+
+// TestTrailersHandler tests request and response trailers end to end
+func TestTrailersHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(TrailersHandler))
+	defer srv.Close()
+
+	// A body of unknown length is sent chunked, which allows trailers
+	req, _ := http.NewRequest("POST", srv.URL+"/trailers?trailer=X-Status:done", io.MultiReader(strings.NewReader("hello")))
+	req.Trailer = http.Header{"X-Upload-Md5": {"abc"}}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var response TrailersResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !reflect.DeepEqual(response.RequestTrailers, map[string][]string{"X-Upload-Md5": {"abc"}}) {
+		t.Errorf("Expected request trailer, got %v", response.RequestTrailers)
+	}
+	if response.BodySize != 5 {
+		t.Errorf("Expected body size 5, got %d", response.BodySize)
+	}
+
+	// Trailers are only available once the body has been read
+	sum := sha256.Sum256(body)
+	if got := resp.Trailer.Get(ChecksumTrailer); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected checksum trailer %x, got %q", sum, got)
+	}
+	if got := resp.Trailer.Get("X-Status"); got != "done" {
+		t.Errorf("Expected X-Status trailer, got %q", got)
+	}
+	if resp.Header.Get(ChecksumTrailer) != "" {
+		t.Error("Expected checksum to be sent as a trailer only")
+	}
+
+	rr := httptest.NewRecorder()
+	TrailersHandler(rr, httptest.NewRequest("GET", "/trailers?trailer=bad", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid trailer, got %d", rr.Code)
+	}
+}
+
+// TestDumpHandler tests returning the raw request
+func TestDumpHandler(t *testing.T) {
+	req := httptest.NewRequest("POST", "/dump?a=1", strings.NewReader("raw body"))
+	req.Host = "example.com"
+	req.Header.Set("X-Custom", "value")
+	rr := httptest.NewRecorder()
+	DumpHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain, got %q", ct)
+	}
+	dump := rr.Body.String()
+	for _, want := range []string{"POST /dump?a=1 HTTP/1.1\r\n", "Host: example.com\r\n", "X-Custom: value\r\n", "\r\n\r\nraw body"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Expected dump to contain %q, got %q", want, dump)
+		}
+	}
+
+	req = httptest.NewRequest("POST", "/dump", strings.NewReader(strings.Repeat("x", maxDecodedBody+1)))
+	rr = httptest.NewRecorder()
+	DumpHandler(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a large body, got %d", rr.Code)
+	}
+}
+
+// TestDelayCancelled tests that delays end when the client goes away
+func TestDelayCancelled(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/delay/5":         DelayHandler,
+		"/status/200:1:5s": StatusHandler,
+	}
+
+	for path, handler := range handlers {
+		t.Run(path, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+			req := httptest.NewRequest("GET", path, nil).WithContext(ctx)
+			rr := httptest.NewRecorder()
+
+			start := time.Now()
+			handler(rr, req)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected the delay to be cut short, took %v", elapsed)
+			}
+			if rr.Code != StatusClientClosedRequest {
+				t.Errorf("Expected status %d, got %d", StatusClientClosedRequest, rr.Code)
+			}
+		})
+	}
+
+	// Deadlines are left to the timeout middleware to answer
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	rr := httptest.NewRecorder()
+	DelayHandler(rr, httptest.NewRequest("GET", "/delay/5", nil).WithContext(ctx))
+	if rr.Flushed || rr.Body.Len() > 0 || rr.Code != http.StatusOK {
+		t.Errorf("Expected nothing to be written on a deadline, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+// TestDelayMax tests the configurable delay cap, which also applies to
+// per-code /status delays, keepalive intervals and /expect-100 delays
+func TestDelayMax(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings *Settings
+		path     string
+		delay    string
+		maxDelay string
+		capped   time.Duration
+	}{
+		{"default cap", nil, "/delay/0.01", "10ms", "10s", DefaultMaxDelay},
+		{"lowered cap", &Settings{MaxDelay: 20 * time.Millisecond}, "/delay/5", "20ms", "20ms", 20 * time.Millisecond},
+		{"raised cap", &Settings{MaxDelay: time.Minute}, "/delay/30ms", "30ms", "1m0s", 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.settings != nil {
+				req = req.WithContext(WithSettings(req.Context(), tt.settings))
+			}
+			rr := httptest.NewRecorder()
+			DelayHandler(rr, req)
+
+			var response DelayResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Delay != tt.delay || response.MaxDelay != tt.maxDelay {
+				t.Errorf("Expected delay %s capped at %s, got %s capped at %s", tt.delay, tt.maxDelay, response.Delay, response.MaxDelay)
+			}
+			if response.RequestInfo == nil || response.Method != "GET" {
+				t.Errorf("Expected the request to be echoed, got %+v", response)
+			}
+
+			limit := settingsFrom(req).maxDelay()
+			weights, err := parseStatusCodes("/status/503:1:30s", limit)
+			if err != nil || weights[0].delay != tt.capped {
+				t.Errorf("Expected a status delay of %v, got %+v (%v)", tt.capped, weights, err)
+			}
+			if k, ok := parseKeepalive(url.Values{KeepaliveQuery: {"30s"}}, limit); !ok || k.interval != max(tt.capped, minKeepalive) {
+				t.Errorf("Expected a keepalive interval of %v, got %+v", max(tt.capped, minKeepalive), k)
+			}
+		})
+	}
+
+	// Expect delays are capped too, so this returns after 20ms
+	req := httptest.NewRequest("POST", "/expect-100?delay=5s", nil)
+	req = req.WithContext(WithSettings(req.Context(), &Settings{MaxDelay: 20 * time.Millisecond}))
+	rr := httptest.NewRecorder()
+	ExpectHandler(rr, req)
+	var expect ExpectResponse
+	if err := json.NewDecoder(rr.Body).Decode(&expect); err != nil || expect.Delay != "20ms" {
+		t.Errorf("Expected an expect delay of 20ms, got %+v (%v)", expect, err)
+	}
+}
+
+// TestDelayRange tests random delays from a range and jitter
+func TestDelayRange(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		lo, hi         time.Duration
+	}{
+		{"range", "/delay/10ms-40ms", http.StatusOK, 10 * time.Millisecond, 40 * time.Millisecond},
+		{"range in seconds", "/delay/0.01-0.02", http.StatusOK, 10 * time.Millisecond, 20 * time.Millisecond},
+		{"exponent is not a range", "/delay/1e-3", http.StatusOK, time.Millisecond, time.Millisecond},
+		{"jitter", "/delay/30ms?jitter=20ms", http.StatusOK, 10 * time.Millisecond, 50 * time.Millisecond},
+		{"jitter never negative", "/delay/0?jitter=10ms", http.StatusOK, 0, 10 * time.Millisecond},
+		{"inverted range", "/delay/2s-1s", http.StatusBadRequest, 0, 0},
+		{"open range", "/delay/1s-", http.StatusBadRequest, 0, 0},
+		{"invalid jitter", "/delay/1?jitter=lots", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 5 {
+				rr := httptest.NewRecorder()
+				DelayHandler(rr, httptest.NewRequest("GET", tt.path, nil))
+				if rr.Code != tt.expectedStatus {
+					t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+				}
+				if tt.expectedStatus != http.StatusOK {
+					return
+				}
+
+				var response DelayResponse
+				json.NewDecoder(rr.Body).Decode(&response)
+				delay, err := time.ParseDuration(response.Delay)
+				if err != nil || delay < tt.lo || delay > tt.hi {
+					t.Errorf("Expected a delay within [%v, %v], got %s", tt.lo, tt.hi, response.Delay)
+				}
+			}
+		})
+	}
+}
+
+// TestDripHandler tests dripping bytes over a duration
+func TestDripHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"defaults shortened", "?duration=20ms", http.StatusOK, "**********"},
+		{"numbytes and code", "?duration=10ms&numbytes=3&code=201", http.StatusCreated, "***"},
+		{"no bytes", "?numbytes=0&code=204", http.StatusNoContent, ""},
+		{"delay", "?delay=10ms&duration=0&numbytes=2", http.StatusOK, "**"},
+		{"invalid duration", "?duration=soon", http.StatusBadRequest, ""},
+		{"invalid numbytes", "?numbytes=-1", http.StatusBadRequest, ""},
+		{"too many bytes", "?numbytes=99999999", http.StatusBadRequest, ""},
+		{"invalid code", "?code=99", http.StatusBadRequest, ""},
+		{"invalid keepalive", "?keepalive=often", http.StatusBadRequest, ""},
+		{"invalid keepalive mode", "?keepalive=1s&keepalive_mode=smoke", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			DripHandler(rr, httptest.NewRequest("GET", "/drip"+tt.query, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code == http.StatusBadRequest {
+				return
+			}
+			if body := rr.Body.String(); body != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, body)
+			}
+			if cl := rr.Header().Get("Content-Length"); cl != strconv.Itoa(len(tt.expectedBody)) {
+				t.Errorf("Expected Content-Length %d, got %q", len(tt.expectedBody), cl)
+			}
+		})
+	}
+}
+
+// TestKeepalive tests newline and 102 Processing keepalives while waiting
+func TestKeepalive(t *testing.T) {
+	t.Run("newlines on delay", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		DelayHandler(rr, httptest.NewRequest("GET", "/delay/350ms?keepalive=100ms", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rr.Code)
+		}
+		body := rr.Body.String()
+		if !strings.HasPrefix(body, "\n\n\n") {
+			t.Errorf("Expected leading newlines, got %q", body)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Expected Content-Type application/json, got %q", ct)
+		}
+		var response DelayResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Delay != "350ms" {
+			t.Errorf("Expected a JSON body after the newlines, got %q (%v)", body, err)
+		}
+	})
+
+	t.Run("newlines need a text format", func(t *testing.T) {
+		for _, format := range []string{"msgpack", "cbor"} {
+			rr := httptest.NewRecorder()
+			DelayHandler(rr, httptest.NewRequest("GET", "/delay/1?keepalive=100ms&format="+format, nil))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for %s, got %d", format, rr.Code)
+			}
+		}
+	})
+
+	t.Run("newlines on drip", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		DripHandler(rr, httptest.NewRequest("GET", "/drip?delay=250ms&duration=0&numbytes=1&keepalive=100ms", nil))
+		if body := rr.Body.String(); body != "\n\n*" {
+			t.Errorf("Expected body %q, got %q", "\n\n*", body)
+		}
+		if cl := rr.Header().Get("Content-Length"); cl != "" {
+			t.Errorf("Expected no Content-Length, got %q", cl)
+		}
+	})
+
+	t.Run("processing", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(DelayHandler))
+		defer srv.Close()
+
+		var interim []int
+		trace := &httptrace.ClientTrace{
+			Got1xxResponse: func(code int, _ textproto.MIMEHeader) error {
+				interim = append(interim, code)
+				return nil
+			},
+		}
+		req, _ := http.NewRequest("GET", srv.URL+"/delay/250ms?keepalive=100ms&keepalive_mode=processing", nil)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", resp.StatusCode)
+		}
+		if !reflect.DeepEqual(interim, []int{http.StatusProcessing, http.StatusProcessing}) {
+			t.Errorf("Expected two 102 responses, got %v", interim)
+		}
+		var response DelayResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Errorf("Expected a JSON body, got %v", err)
+		}
+	})
+}
+
+// TestParseRate tests bandwidth parsing
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected float64
+		wantErr  bool
+	}{
+		{"1000", 1000, false},
+		{"64kbps", 8000, false},
+		{"8 Mbps", 1e6, false},
+		{"800bps", 100, false},
+		{"2KB/s", 2000, false},
+		{"1KiB/s", 1024, false},
+		{"1.5MiB/s", 1.5 * (1 << 20), false},
+		{"fast", 0, true},
+		{"0", 0, true},
+		{"-5kbps", 0, true},
+		{"4bps", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := parseRate(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %v bytes/s, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestBytesHandlers tests /bytes and /stream-bytes
+func TestBytesHandlers(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		path           string
+		expectedStatus int
+		expectedSize   int
+	}{
+		{"bytes", BytesHandler, "/bytes/100", http.StatusOK, 100},
+		{"bytes empty", BytesHandler, "/bytes/0", http.StatusOK, 0},
+		{"bytes throttled", BytesHandler, "/bytes/100?rate=1MB/s", http.StatusOK, 100},
+		{"bytes too many", BytesHandler, "/bytes/99999999", http.StatusBadRequest, 0},
+		{"bytes invalid", BytesHandler, "/bytes/lots", http.StatusBadRequest, 0},
+		{"bytes invalid seed", BytesHandler, "/bytes/10?seed=x", http.StatusBadRequest, 0},
+		{"bytes invalid rate", BytesHandler, "/bytes/10?rate=fast", http.StatusBadRequest, 0},
+		{"stream", StreamBytesHandler, "/stream-bytes/100?chunk_size=30", http.StatusOK, 100},
+		{"stream throttled", StreamBytesHandler, "/stream-bytes/100?rate=1MB/s", http.StatusOK, 100},
+		{"stream invalid chunk size", StreamBytesHandler, "/stream-bytes/100?chunk_size=0", http.StatusBadRequest, 0},
+		{"stream invalid rate", StreamBytesHandler, "/stream-bytes/100?rate=0", http.StatusBadRequest, 0},
+		{"drip invalid rate", DripHandler, "/drip?rate=slow", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus == http.StatusOK && rr.Body.Len() != tt.expectedSize {
+				t.Errorf("Expected %d bytes, got %d", tt.expectedSize, rr.Body.Len())
+			}
+		})
+	}
+
+	t.Run("seed", func(t *testing.T) {
+		bodies := make([]string, 3)
+		for i, path := range []string{"/bytes/64?seed=42", "/bytes/64?seed=42", "/stream-bytes/64?seed=42&chunk_size=10"} {
+			rr := httptest.NewRecorder()
+			if strings.HasPrefix(path, "/bytes/") {
+				BytesHandler(rr, httptest.NewRequest("GET", path, nil))
+			} else {
+				StreamBytesHandler(rr, httptest.NewRequest("GET", path, nil))
+			}
+			bodies[i] = rr.Body.String()
+		}
+		if bodies[0] != bodies[1] || bodies[0] != bodies[2] {
+			t.Error("Expected the same seed to produce the same bytes")
+		}
+	})
+}
+
+// TestRangeHandler tests single, multiple and unsatisfiable Range requests
+func TestRangeHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/range/{n}", RangeHandler)
+
+	tests := []struct {
+		name                 string
+		path                 string
+		headers              map[string]string
+		expectedStatus       int
+		expectedContentRange string
+		expectedBody         string
+	}{
+		{"whole", "/range/30", nil, http.StatusOK, "", "abcdefghijklmnopqrstuvwxyzabcd"},
+		{"single", "/range/30", map[string]string{"Range": "bytes=2-4"}, http.StatusPartialContent, "bytes 2-4/30", "cde"},
+		{"open ended", "/range/30", map[string]string{"Range": "bytes=26-"}, http.StatusPartialContent, "bytes 26-29/30", "abcd"},
+		{"suffix", "/range/30", map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "bytes 27-29/30", "bcd"},
+		{"clamped", "/range/30", map[string]string{"Range": "bytes=28-100"}, http.StatusPartialContent, "bytes 28-29/30", "cd"},
+		{"unsatisfiable", "/range/30", map[string]string{"Range": "bytes=30-40"}, http.StatusRequestedRangeNotSatisfiable, "bytes */30", ""},
+		{"malformed", "/range/30", map[string]string{"Range": "bytes=4-2"}, http.StatusOK, "", "abcdefghijklmnopqrstuvwxyzabcd"},
+		{"other unit", "/range/5", map[string]string{"Range": "items=0-1"}, http.StatusOK, "", "abcde"},
+		{"overlapping", "/range/5", map[string]string{"Range": "bytes=0-3,1-4"}, http.StatusOK, "", "abcde"},
+		{"if-range match", "/range/5", map[string]string{"Range": "bytes=0-1", "If-Range": `"range-5"`}, http.StatusPartialContent, "bytes 0-1/5", "ab"},
+		{"if-range mismatch", "/range/5", map[string]string{"Range": "bytes=0-1", "If-Range": `"other"`}, http.StatusOK, "", "abcde"},
+		{"invalid size", "/range/lots", nil, http.StatusBadRequest, "", ""},
+		{"forced unsatisfiable", "/range/30?mode=unsatisfiable", map[string]string{"Range": "bytes=0-1"}, http.StatusRequestedRangeNotSatisfiable, "bytes */30", ""},
+		{"forced unsatisfiable without range", "/range/30?mode=unsatisfiable", nil, http.StatusRequestedRangeNotSatisfiable, "bytes */30", ""},
+		{"ignored", "/range/5?mode=ignore", map[string]string{"Range": "bytes=0-1"}, http.StatusOK, "", "abcde"},
+		{"wrong content range", "/range/30?mode=wrong-content-range", map[string]string{"Range": "bytes=2-4"}, http.StatusPartialContent, "bytes 2-5/30", "cde"},
+		{"invalid mode", "/range/30?mode=chaos", nil, http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Content-Range"); got != tt.expectedContentRange {
+				t.Errorf("Expected Content-Range %q, got %q", tt.expectedContentRange, got)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusBadRequest && rr.Header().Get("Accept-Ranges") != "bytes" {
+				t.Error("Expected Accept-Ranges: bytes")
+			}
+		})
+	}
+
+	t.Run("multiple", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/range/30", nil)
+		req.Header.Set("Range", "bytes=0-2, 10-11, -2")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusPartialContent {
+			t.Fatalf("Expected status 206, got %d", rr.Code)
+		}
+		boundary, ok := strings.CutPrefix(rr.Header().Get("Content-Type"), "multipart/byteranges; boundary=")
+		if !ok {
+			t.Fatalf("Expected multipart/byteranges, got %q", rr.Header().Get("Content-Type"))
+		}
+		if got := rr.Header().Get("Content-Length"); got != strconv.Itoa(rr.Body.Len()) {
+			t.Errorf("Expected Content-Length %d, got %s", rr.Body.Len(), got)
+		}
+
+		expected := []struct{ contentRange, body string }{
+			{"bytes 0-2/30", "abc"},
+			{"bytes 10-11/30", "kl"},
+			{"bytes 28-29/30", "cd"},
+		}
+		mr := multipart.NewReader(rr.Body, boundary)
+		for _, want := range expected {
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Fatalf("Expected part %s: %v", want.contentRange, err)
+			}
+			body, _ := io.ReadAll(part)
+			if got := part.Header.Get("Content-Range"); got != want.contentRange {
+				t.Errorf("Expected Content-Range %q, got %q", want.contentRange, got)
+			}
+			if part.Header.Get("Content-Type") != "application/octet-stream" {
+				t.Errorf("Expected part Content-Type application/octet-stream, got %q", part.Header.Get("Content-Type"))
+			}
+			if string(body) != want.body {
+				t.Errorf("Expected part body %q, got %q", want.body, body)
+			}
+		}
+		if _, err := mr.NextPart(); err != io.EOF {
+			t.Errorf("Expected the parts to end, got %v", err)
+		}
+	})
+}
+
+// TestLargeHandler tests /large sizes, the pattern and Content-Length
+func TestLargeHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/large/{size}", LargeHandler)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedSize   int
+	}{
+		{"bytes", "/large/100", http.StatusOK, 100},
+		{"empty", "/large/0", http.StatusOK, 0},
+		{"si suffix", "/large/2MB", http.StatusOK, 2_000_000},
+		{"iec suffix", "/large/1mib", http.StatusOK, 1 << 20},
+		{"byte suffix", "/large/70000B", http.StatusOK, 70000},
+		{"throttled", "/large/100?rate=1MB/s", http.StatusOK, 100},
+		{"too large", "/large/11GiB", http.StatusBadRequest, 0},
+		{"negative", "/large/-1", http.StatusBadRequest, 0},
+		{"invalid", "/large/lots", http.StatusBadRequest, 0},
+		{"invalid rate", "/large/10?rate=fast", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Content-Length"); got != strconv.Itoa(tt.expectedSize) {
+				t.Errorf("Expected Content-Length %d, got %s", tt.expectedSize, got)
+			}
+			if rr.Body.Len() != tt.expectedSize {
+				t.Fatalf("Expected %d bytes, got %d", tt.expectedSize, rr.Body.Len())
+			}
+			if tt.expectedSize > 0 && !rr.Flushed {
+				t.Error("Expected the body to be flushed as it is written")
+			}
+			for i, b := range rr.Body.Bytes() {
+				if b != 'a'+byte(i%26) {
+					t.Fatalf("Expected the alphabet pattern, byte %d is %q", i, b)
+				}
+			}
+		})
+	}
+}
+
+// TestPadHandler tests the /pad envelope, its checksum and exact size
+func TestPadHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pad/{n}", PadHandler)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBytes  int
+	}{
+		{"padded", "/pad/100", http.StatusOK, 100},
+		{"empty", "/pad/0", http.StatusOK, 0},
+		{"pretty ignored", "/pad/10?pretty=true", http.StatusOK, 10},
+		{"too many", "/pad/99999999", http.StatusBadRequest, 0},
+		{"invalid", "/pad/lots", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Content-Length"); got != strconv.Itoa(rr.Body.Len()) {
+				t.Errorf("Expected Content-Length %d, got %s", rr.Body.Len(), got)
+			}
+			// The envelope around the padding is of fixed size
+			if overhead := rr.Body.Len() - tt.expectedBytes - len(strconv.Itoa(tt.expectedBytes)); overhead != 99 {
+				t.Errorf("Expected 99 bytes of envelope, got %d", overhead)
+			}
+
+			var response PadResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			sum := sha256.Sum256([]byte(response.Padding))
+			if response.Bytes != tt.expectedBytes || len(response.Padding) != tt.expectedBytes {
+				t.Errorf("Expected %d bytes of padding, got %d (%d reported)", tt.expectedBytes, len(response.Padding), response.Bytes)
+			}
+			if response.SHA256 != hex.EncodeToString(sum[:]) {
+				t.Errorf("Expected the checksum of the padding, got %s", response.SHA256)
+			}
+		})
+	}
+}
+
+// TestSeed tests that ?seed= and the server-wide seed make random
+// behaviour reproducible
+func TestSeed(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "random.tmpl"), []byte(`{{uuid}} {{randInt 0 1000000}}`), 0o644)
+	flaky := NewFlaky()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status/", StatusHandler)
+	mux.HandleFunc("/delay/", DelayHandler)
+	mux.HandleFunc("/bytes/", BytesHandler)
+	mux.HandleFunc("/flaky", flaky.Handler)
+	mux.HandleFunc("/template/{name}", TemplateHandler)
+
+	serve := func(settings *Settings, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(WithSettings(req.Context(), settings))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	// outcome reduces a response to its random part
+	outcome := func(path string, rr *httptest.ResponseRecorder) string {
+		switch {
+		case strings.HasPrefix(path, "/delay/"):
+			var response DelayResponse
+			json.Unmarshal(rr.Body.Bytes(), &response)
+			return response.Delay
+		case strings.HasPrefix(path, "/status/"), strings.HasPrefix(path, "/flaky"):
+			return strconv.Itoa(rr.Code)
+		}
+		return rr.Body.String()
+	}
+
+	paths := []string{
+		"/status/200:0.5,201:0.5",
+		"/delay/0-100ms?jitter=10ms",
+		"/bytes/32",
+		"/flaky?rate=0.5",
+		"/template/random",
+	}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			sep := "?"
+			if strings.Contains(path, "?") {
+				sep = "&"
+			}
+			settings := &Settings{TemplatesDir: dir}
+
+			// The same seed gives the same outcome; across seeds, both
+			// outcomes of the coin flips turn up
+			seen := map[string]bool{}
+			for seed := 1; seed <= 16; seed++ {
+				seeded := path + sep + "seed=" + strconv.Itoa(seed)
+				first, second := serve(settings, seeded), serve(settings, seeded)
+				if outcome(path, first) != outcome(path, second) {
+					t.Fatalf("Expected seed %d to repeat, got %q and %q", seed, outcome(path, first), outcome(path, second))
+				}
+				seen[outcome(path, first)] = true
+			}
+			if len(seen) < 2 {
+				t.Errorf("Expected seeds to vary the outcome, got %v", seen)
+			}
+
+			// Requests without ?seed= follow the server-wide sequence
+			var runs [2][]string
+			for i := range runs {
+				settings := &Settings{TemplatesDir: dir, Seed: 42}
+				for range 8 {
+					runs[i] = append(runs[i], outcome(path, serve(settings, path)))
+				}
+			}
+			if !slices.Equal(runs[0], runs[1]) {
+				t.Errorf("Expected the server-wide seed to repeat, got %v and %v", runs[0], runs[1])
+			}
+
+			if rr := serve(settings, path+sep+"seed=x"); rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for an invalid seed, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+// TestThrottle tests that ?rate= paces the response
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+	}{
+		// 2000 bytes at 10000 B/s take 200ms, less the 500 byte burst
+		{"bytes", BytesHandler, "/bytes/2000?rate=80kbps"},
+		{"stream-bytes", StreamBytesHandler, "/stream-bytes/2000?rate=10KB/s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			rr := httptest.NewRecorder()
+			tt.handler(rr, httptest.NewRequest("GET", tt.path, nil))
+			elapsed := time.Since(start)
+
+			if rr.Body.Len() != 2000 {
+				t.Errorf("Expected 2000 bytes, got %d", rr.Body.Len())
+			}
+			if elapsed < 120*time.Millisecond || elapsed > time.Second {
+				t.Errorf("Expected about 150ms, took %v", elapsed)
+			}
+		})
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		rr := httptest.NewRecorder()
+		BytesHandler(rr, httptest.NewRequest("GET", "/bytes/100000?rate=1000", nil).WithContext(ctx))
+		if rr.Body.Len() >= 100000 {
+			t.Error("Expected the throttled write to stop when the request is cancelled")
+		}
+	})
+}
+
+// TestStreamPostHandler tests per-line acknowledgements, including
+// interleaved with the upload over HTTP/1.1
+func TestStreamPostHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		expectedAcks    []StreamPostAck
+		expectedSummary StreamPostSummary
+	}{
+		{
+			name: "lines",
+			body: "{\"id\":1}\nnot json\n\n[1, 2]",
+			expectedAcks: []StreamPostAck{
+				{Line: 1, Bytes: 8, Valid: true},
+				{Line: 2, Bytes: 8, Error: "invalid character 'o' in literal null (expecting 'u')"},
+				{Line: 4, Bytes: 6, Valid: true},
+			},
+			expectedSummary: StreamPostSummary{Done: true, Lines: 3, Valid: 2, Invalid: 1, Bytes: 22},
+		},
+		{
+			name:            "empty",
+			body:            "",
+			expectedSummary: StreamPostSummary{Done: true},
+		},
+		{
+			name:            "line too long",
+			body:            `"` + strings.Repeat("x", maxStreamPostLine) + `"`,
+			expectedSummary: StreamPostSummary{Error: "Reading the body failed: bufio.Scanner: token too long"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			StreamPostHandler(rr, httptest.NewRequest("POST", "/stream-post", strings.NewReader(tt.body)))
+
+			if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Expected application/x-ndjson, got %s", ct)
+			}
+			dec := json.NewDecoder(rr.Body)
+			for _, want := range tt.expectedAcks {
+				var ack StreamPostAck
+				if err := dec.Decode(&ack); err != nil {
+					t.Fatalf("Failed to decode acknowledgement: %v", err)
+				}
+				if ack != want {
+					t.Errorf("Expected %+v, got %+v", want, ack)
+				}
+			}
+			var summary StreamPostSummary
+			if err := dec.Decode(&summary); err != nil {
+				t.Fatalf("Failed to decode summary: %v", err)
+			}
+			if summary != tt.expectedSummary {
+				t.Errorf("Expected summary %+v, got %+v", tt.expectedSummary, summary)
+			}
+		})
+	}
+
+	t.Run("interleaved", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(StreamPostHandler))
+		defer srv.Close()
+
+		pr, pw := io.Pipe()
+		defer pw.Close()
+		req, _ := http.NewRequest("POST", srv.URL, pr)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		// Each line is acknowledged before the next is sent
+		dec := json.NewDecoder(resp.Body)
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(pw, "{\"n\":%d}\n", i)
+			var ack StreamPostAck
+			if err := dec.Decode(&ack); err != nil {
+				t.Fatalf("Failed to read acknowledgement %d: %v", i, err)
+			}
+			if ack.Line != i || !ack.Valid {
+				t.Errorf("Unexpected acknowledgement %+v", ack)
+			}
+		}
+		pw.Close()
+
+		var summary StreamPostSummary
+		if err := dec.Decode(&summary); err != nil || !summary.Done || summary.Lines != 3 {
+			t.Errorf("Unexpected summary %+v (%v)", summary, err)
+		}
+	})
+}
+
+// TestSlowReadHandler tests slow and stalled reads of the request body
+func TestSlowReadHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		bodySize       int
+		expectedStatus int
+		expected       SlowReadResponse
+		minElapsed     time.Duration
+	}{
+		{"no limits", "", 100, http.StatusOK, SlowReadResponse{BytesRead: 100}, 0},
+		{"rate", "?rate=10KB/s", 2000, http.StatusOK, SlowReadResponse{BytesRead: 2000}, 120 * time.Millisecond},
+		{"stall", "?stall_after=10&stall=100ms", 100, http.StatusOK, SlowReadResponse{BytesRead: 10, Stalled: true}, 100 * time.Millisecond},
+		{"body ends at stall_after", "?stall_after=100&stall=5s", 100, http.StatusOK, SlowReadResponse{BytesRead: 100}, 0},
+		{"invalid rate", "?rate=slowly", 10, http.StatusBadRequest, SlowReadResponse{}, 0},
+		{"invalid stall_after", "?stall_after=-1", 10, http.StatusBadRequest, SlowReadResponse{}, 0},
+		{"invalid stall", "?stall_after=1&stall=forever", 10, http.StatusBadRequest, SlowReadResponse{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/slow-read"+tt.query, strings.NewReader(strings.Repeat("x", tt.bodySize)))
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			SlowReadHandler(rr, req)
+			elapsed := time.Since(start)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response SlowReadResponse
+			json.NewDecoder(rr.Body).Decode(&response)
+			if response.BytesRead != tt.expected.BytesRead || response.Stalled != tt.expected.Stalled {
+				t.Errorf("Expected %+v, got %+v", tt.expected, response)
+			}
+			if elapsed < tt.minElapsed {
+				t.Errorf("Expected at least %v, took %v", tt.minElapsed, elapsed)
+			}
+		})
+	}
+
+	t.Run("cancelled during stall", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		req := httptest.NewRequest("POST", "/slow-read?stall_after=1", strings.NewReader("abc")).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		SlowReadHandler(rr, req)
+		if rr.Code != StatusClientClosedRequest {
+			t.Errorf("Expected status %d, got %d", StatusClientClosedRequest, rr.Code)
+		}
+	})
+}
+
+// TestCloseHandler tests truncated responses from /close
+func TestCloseHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(CloseHandler))
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		query       string
+		wantGetErr  bool
+		wantBodyErr bool
+	}{
+		{"none", "", true, false},
+		{"headers", "?mode=headers", true, false},
+		{"body", "?mode=body", false, true},
+		{"chunked", "?mode=chunked&delay=10ms", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A fresh connection each time, so no request is retried
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			resp, err := client.Get(srv.URL + "/close" + tt.query)
+			if (err != nil) != tt.wantGetErr {
+				t.Fatalf("Expected request error %v, got %v", tt.wantGetErr, err)
+			}
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if (err != nil) != tt.wantBodyErr {
+				t.Errorf("Expected body error %v, got %v", tt.wantBodyErr, err)
+			}
+			if !strings.Contains(string(body), "cut short") {
+				t.Errorf("Expected a partial body, got %q", body)
+			}
+		})
+	}
+
+	t.Run("invalid mode", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		CloseHandler(rr, httptest.NewRequest("GET", "/close?mode=gently", nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("not hijackable", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		CloseHandler(rr, httptest.NewRequest("GET", "/close", nil))
+		if rr.Code != http.StatusNotImplemented {
+			t.Errorf("Expected status 501, got %d", rr.Code)
+		}
+	})
+}
+
+// TestResetHandler tests that /reset resets the connection
+func TestResetHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(ResetHandler))
+	defer srv.Close()
+
+	for _, mode := range []string{"none", "body"} {
+		t.Run(mode, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			resp, err := client.Get(srv.URL + "/reset?mode=" + mode)
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if !errors.Is(err, syscall.ECONNRESET) {
+				t.Errorf("Expected a connection reset, got %v", err)
+			}
+		})
+	}
+}
+
+// TestMalformedHandler tests that Go's client rejects each malformed
+// response
+func TestMalformedHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(MalformedHandler))
+	defer srv.Close()
+
+	for _, mode := range []string{"chunk-size", "header-bytes", "duplicate-headers"} {
+		t.Run(mode, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			resp, err := client.Get(srv.URL + "/malformed?mode=" + mode)
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if err == nil {
+				t.Error("Expected the response to be rejected")
+			}
+		})
+	}
+
+	t.Run("content-length", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "GET /malformed?mode=content-length HTTP/1.1\r\nHost: test\r\n\r\n")
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "short" {
+			t.Errorf("Expected body %q, got %q", "short", body)
+		}
+		// The leftover bytes parse as a second response
+		if next, err := http.ReadResponse(br, nil); err != nil || next.Header.Get("X-Smuggled") != "true" {
+			t.Errorf("Expected a smuggled response, got %v", err)
+		}
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		MalformedHandler(rr, httptest.NewRequest("GET", "/malformed", nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rr.Code)
+		}
+	})
+}
+
+// TestGarbageHandler tests that /garbage sends raw bytes instead of HTTP
+func TestGarbageHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(GarbageHandler))
+	defer srv.Close()
+
+	read := func(path string) []byte {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: test\r\n\r\n", path)
+		data, _ := io.ReadAll(conn)
+		return data
+	}
+
+	first, second := read("/garbage/256?seed=7"), read("/garbage/256?seed=7")
+	if len(first) != 256 {
+		t.Fatalf("Expected 256 bytes, got %d", len(first))
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("Expected the same seed to produce the same bytes")
+	}
+	if bytes.HasPrefix(first, []byte("HTTP/")) {
+		t.Error("Expected bytes that do not look like HTTP")
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	if resp, err := client.Get(srv.URL + "/garbage/64"); err == nil {
+		resp.Body.Close()
+		t.Error("Expected the client to reject the response")
+	}
+
+	rr := httptest.NewRecorder()
+	GarbageHandler(rr, httptest.NewRequest("GET", "/garbage/-1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
+
+// TestPollHandler tests long polls that fire or time out
+func TestPollHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"event fires", "?timeout=1s&event_after=20ms", http.StatusOK},
+		{"event within range", "?timeout=1s&event_after=10ms-30ms", http.StatusOK},
+		{"times out", "?timeout=20ms&event_after=5s", http.StatusNoContent},
+		{"no event", "?timeout=20ms", http.StatusNoContent},
+		{"invalid timeout", "?timeout=later", http.StatusBadRequest},
+		{"invalid event_after", "?event_after=", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			PollHandler(rr, httptest.NewRequest("GET", "/poll"+tt.query, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus == http.StatusNoContent && rr.Body.Len() != 0 {
+				t.Errorf("Expected no body, got %q", rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK {
+				var response PollResponse
+				json.NewDecoder(rr.Body).Decode(&response)
+				if response.Event != "fired" {
+					t.Errorf("Expected a fired event, got %+v", response)
+				}
+			}
+		})
+	}
+}
+
+// wsClient is a minimal WebSocket client for testing /ws
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialWS opens a WebSocket to path on srv
+func dialWS(t *testing.T, srv *httptest.Server, path string) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", path)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected a 101 handshake, got %v %v", resp, err)
+	}
+	return &wsClient{conn: conn, br: br}
+}
+
+// send writes a masked frame
+func (c *wsClient) send(op byte, payload string) {
+	frame := []byte{0x80 | op, 0x80 | byte(len(payload)), 0, 0, 0, 0}
+	c.conn.Write(append(frame, payload...))
+}
+
+// read reads one unmasked server frame of up to 125 bytes
+func (c *wsClient) read(t *testing.T) (bool, byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	payload := make([]byte, head[1]&0x7f)
+	io.ReadFull(c.br, payload)
+	return head[0]&0x80 != 0, head[0] & 0x0f, payload
+}
+
+// TestWebSocketHandler tests the /ws echo and its configurable behaviours
+func TestWebSocketHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(WebSocketHandler))
+	defer srv.Close()
+
+	t.Run("echo", func(t *testing.T) {
+		c := dialWS(t, srv, "/ws")
+		c.send(0x1, "hello")
+		if fin, op, payload := c.read(t); !fin || op != 0x1 || string(payload) != "hello" {
+			t.Errorf("Expected a text echo, got %v %d %q", fin, op, payload)
+		}
+		c.send(0x2, "\x00\x01")
+		if _, op, payload := c.read(t); op != 0x2 || string(payload) != "\x00\x01" {
+			t.Errorf("Expected a binary echo, got %d %q", op, payload)
+		}
+	})
+
+	t.Run("fragment", func(t *testing.T) {
+		c := dialWS(t, srv, "/ws?fragment=2")
+		c.send(0x1, "abcde")
+		var got []string
+		for {
+			fin, _, payload := c.read(t)
+			got = append(got, string(payload))
+			if fin {
+				break
+			}
+		}
+		if strings.Join(got, "|") != "ab|cd|e" {
+			t.Errorf("Expected 2 byte fragments, got %q", got)
+		}
+	})
+
+	t.Run("close after", func(t *testing.T) {
+		c := dialWS(t, srv, "/ws?close_after=1&close_code=4000&close_reason=done")
+		c.send(0x1, "one")
+		c.read(t)
+		_, op, payload := c.read(t)
+		if op != 0x8 || len(payload) < 2 || binary.BigEndian.Uint16(payload) != 4000 || string(payload[2:]) != "done" {
+			t.Errorf("Expected a 4000 close, got %d %q", op, payload)
+		}
+	})
+
+	t.Run("max message", func(t *testing.T) {
+		c := dialWS(t, srv, "/ws?max_message=3")
+		c.send(0x1, "toolong")
+		if _, op, payload := c.read(t); op != 0x8 || binary.BigEndian.Uint16(payload) != 1009 {
+			t.Errorf("Expected a 1009 close, got %d %q", op, payload)
+		}
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		c := dialWS(t, srv, "/ws?ping=100ms")
+		if _, op, _ := c.read(t); op != 0x9 {
+			t.Errorf("Expected a ping, got %d", op)
+		}
+	})
+
+	invalid := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"not a handshake", "", http.StatusUpgradeRequired},
+		{"invalid ping", "?ping=1ms", http.StatusBadRequest},
+		{"invalid close code", "?close_code=1005", http.StatusBadRequest},
+		{"invalid fragment", "?fragment=0", http.StatusBadRequest},
+		{"invalid max_message", "?max_message=0", http.StatusBadRequest},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ws"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			WebSocketHandler(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// TestBins tests creating bins and capturing and listing requests
+func TestBins(t *testing.T) {
+	bins := NewBins()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bins", bins.CreateHandler)
+	mux.HandleFunc("/bins/{id}", bins.DeleteHandler)
+	mux.HandleFunc("/bins/{id}/requests", bins.RequestsHandler)
+	mux.HandleFunc("/bin/{id}", bins.CaptureHandler)
+	mux.HandleFunc("/bin/{id}/{path...}", bins.CaptureHandler)
+
+	do := func(method, path string, body io.Reader) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, path, body))
+		return rr
+	}
+
+	rr := do("POST", "/bins", nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", rr.Code)
+	}
+	var created BinResponse
+	json.NewDecoder(rr.Body).Decode(&created)
+	if created.URL != "http://example.com/bin/"+created.ID || rr.Header().Get("Location") != created.URL {
+		t.Errorf("Unexpected bin URLs: %+v", created)
+	}
+
+	do("POST", "/bin/"+created.ID+"/hooks/github?event=push", strings.NewReader(`{"ref":"main"}`))
+	do("PUT", "/bin/"+created.ID, bytes.NewReader([]byte{0xff, 0xfe}))
+
+	rr = do("GET", "/bins/"+created.ID+"/requests", nil)
+	var listed BinRequestsResponse
+	json.NewDecoder(rr.Body).Decode(&listed)
+	if len(listed.Requests) != 2 {
+		t.Fatalf("Expected 2 captured requests, got %d", len(listed.Requests))
+	}
+	first, second := listed.Requests[0], listed.Requests[1]
+	if first.ID != 1 || first.Method != "POST" || first.URL != "/bin/"+created.ID+"/hooks/github?event=push" || first.Body != `{"ref":"main"}` {
+		t.Errorf("Unexpected first request: %+v", first)
+	}
+	if second.BodyEncoding != "base64" || second.Body != "//4=" || second.BodySize != 2 {
+		t.Errorf("Expected a base64 body, got %+v", second)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"capture in unknown bin", "GET", "/bin/missing", http.StatusNotFound},
+		{"list unknown bin", "GET", "/bins/missing/requests", http.StatusNotFound},
+		{"create with GET", "GET", "/bins", http.StatusMethodNotAllowed},
+		{"clear requests", "DELETE", "/bins/" + created.ID + "/requests", http.StatusNoContent},
+		{"delete bin", "DELETE", "/bins/" + created.ID, http.StatusNoContent},
+		{"delete again", "DELETE", "/bins/" + created.ID, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := do(tt.method, tt.path, nil); rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+
+	t.Run("limits", func(t *testing.T) {
+		now := time.Now()
+		bins.now = func() time.Time { return now }
+		var ids []string
+		for range maxBins + 1 {
+			var b BinResponse
+			json.NewDecoder(do("POST", "/bins", nil).Body).Decode(&b)
+			ids = append(ids, b.ID)
+			now = now.Add(time.Second)
+		}
+		if len(bins.bins) != maxBins || bins.bins[ids[0]] != nil {
+			t.Errorf("Expected the oldest of %d bins to be dropped", maxBins+1)
+		}
+
+		for range binRequests + 5 {
+			do("GET", "/bin/"+ids[1], nil)
+		}
+		var listed BinRequestsResponse
+		json.NewDecoder(do("GET", "/bins/"+ids[1]+"/requests", nil).Body).Decode(&listed)
+		if len(listed.Requests) != binRequests || listed.Requests[0].ID != 6 {
+			t.Errorf("Expected the %d most recent requests, got %d from id %d", binRequests, len(listed.Requests), listed.Requests[0].ID)
+		}
+
+		now = now.Add(binIdle + time.Minute)
+		do("POST", "/bins", nil)
+		if len(bins.bins) != 1 {
+			t.Errorf("Expected idle bins to be dropped, got %d", len(bins.bins))
+		}
+	})
+}
+
+// TestWebhooks tests recording, listing and replaying webhook deliveries
+func TestWebhooks(t *testing.T) {
+	webhooks := NewWebhooks()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/{path...}", webhooks.ReceiveHandler)
+	mux.HandleFunc("/webhooks", webhooks.DeliveriesHandler)
+	mux.HandleFunc("/webhooks/{id}", webhooks.DeliveryHandler)
+	mux.HandleFunc("/webhooks/{id}/replay", webhooks.ReplayHandler)
+
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	req := httptest.NewRequest("POST", "/webhook/github", strings.NewReader(`{"action":"opened"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hub-Signature-256", "sha256=abc")
+	req.Header.Set("Connection", "keep-alive")
+	if rr := do(req); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	req = httptest.NewRequest("PUT", "/webhook/custom?signature_header=x-acme-sig", bytes.NewReader([]byte{0xff}))
+	req.Header.Set("X-Acme-Sig", "t=1,v1=def")
+	do(req)
+
+	var listed WebhookDeliveriesResponse
+	json.NewDecoder(do(httptest.NewRequest("GET", "/webhooks", nil)).Body).Decode(&listed)
+	if len(listed.Deliveries) != 2 {
+		t.Fatalf("Expected 2 deliveries, got %d", len(listed.Deliveries))
+	}
+	first, second := listed.Deliveries[0], listed.Deliveries[1]
+	if first.ID != 1 || first.SignatureHeader != "X-Hub-Signature-256" || first.Signature != "sha256=abc" || first.Body != `{"action":"opened"}` {
+		t.Errorf("Unexpected first delivery: %+v", first)
+	}
+	if second.SignatureHeader != "X-Acme-Sig" || second.Signature != "t=1,v1=def" || second.BodyEncoding != "base64" {
+		t.Errorf("Unexpected second delivery: %+v", second)
+	}
+
+	var received *http.Request
+	var receivedBody []byte
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("X-Consumer", "ok")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "thanks")
+	}))
+	defer target.Close()
+
+	rr := do(httptest.NewRequest("POST", "/webhooks/1/replay?url="+target.URL+"/hooks", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body)
+	}
+	var replayed WebhookReplayResponse
+	json.NewDecoder(rr.Body).Decode(&replayed)
+	if replayed.Status != http.StatusAccepted || replayed.Body != "thanks" || http.Header(replayed.Headers).Get("X-Consumer") != "ok" {
+		t.Errorf("Unexpected replay response: %+v", replayed)
+	}
+	if received.Method != "POST" || received.URL.Path != "/hooks" || string(receivedBody) != `{"action":"opened"}` {
+		t.Errorf("Unexpected replayed request: %s %s %q", received.Method, received.URL, receivedBody)
+	}
+	if received.Header.Get("X-Hub-Signature-256") != "sha256=abc" || received.Header.Get(ReplayHeader) != "1" {
+		t.Errorf("Expected original and replay headers, got %v", received.Header)
+	}
+
+	do(httptest.NewRequest("POST", "/webhooks/2/replay?url="+target.URL, nil))
+	if received.Method != "PUT" || !bytes.Equal(receivedBody, []byte{0xff}) {
+		t.Errorf("Expected the binary body to be replayed, got %s %q", received.Method, receivedBody)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"get delivery", "GET", "/webhooks/1", http.StatusOK},
+		{"unknown delivery", "GET", "/webhooks/99", http.StatusNotFound},
+		{"receive with GET", "GET", "/webhook/x", http.StatusMethodNotAllowed},
+		{"replay without url", "POST", "/webhooks/1/replay", http.StatusBadRequest},
+		{"replay to non-http url", "POST", "/webhooks/1/replay?url=file:///etc/passwd", http.StatusBadRequest},
+		{"replay unknown delivery", "POST", "/webhooks/99/replay?url=" + target.URL, http.StatusNotFound},
+		{"replay with GET", "GET", "/webhooks/1/replay?url=" + target.URL, http.StatusMethodNotAllowed},
+		{"replay to closed port", "POST", "/webhooks/1/replay?url=http://127.0.0.1:1", http.StatusBadGateway},
+		{"clear deliveries", "DELETE", "/webhooks", http.StatusNoContent},
+		{"cleared delivery", "GET", "/webhooks/1", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := do(httptest.NewRequest(tt.method, tt.path, nil)); rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// TestTemplateHandler tests rendering mock responses from templates
+func TestTemplateHandler(t *testing.T) {
+	dir := t.TempDir()
+	templates := map[string]string{
+		"user.json.tmpl": `{{status 201}}{{header "Location" (printf "/users/%s" (index .Segments 0))}}{"id": {{json (index .Segments 0)}}, "name": {{json (default "anonymous" .JSON.name)}}}`,
+		"echo.tmpl":      `{{.Method}} {{.Path}} q={{.Query.Get "q"}} h={{.Headers.Get "X-Test"}} {{upper .Body}}`,
+		"broken.tmpl":    `{{.Nope}`,
+		"fails.tmpl":     `{{status 42}}`,
+	}
+	for name, text := range templates {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/template/{name}", TemplateHandler)
+	mux.HandleFunc("/template/{name}/{path...}", TemplateHandler)
+
+	tests := []struct {
+		name                string
+		dir                 string
+		method              string
+		path                string
+		body                string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"json template", dir, "POST", "/template/user/42", `{"name":"ada"}`, http.StatusCreated, "application/json", `{"id": "42", "name": "ada"}`},
+		{"default value", dir, "POST", "/template/user/7", `not json`, http.StatusCreated, "application/json", `{"id": "7", "name": "anonymous"}`},
+		{"request fields", dir, "PUT", "/template/echo/a/b?q=1", "hi", http.StatusOK, "text/plain; charset=utf-8", "PUT /a/b q=1 h=yes HI"},
+		{"unknown template", dir, "GET", "/template/missing", "", http.StatusNotFound, "", ""},
+		{"invalid name", dir, "GET", "/template/.hidden", "", http.StatusBadRequest, "", ""},
+		{"parse error", dir, "GET", "/template/broken", "", http.StatusInternalServerError, "", ""},
+		{"execution error", dir, "GET", "/template/fails", "", http.StatusInternalServerError, "", ""},
+		{"no directory", "", "GET", "/template/echo", "", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-Test", "yes")
+			req = req.WithContext(WithSettings(req.Context(), &Settings{TemplatesDir: tt.dir}))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedBody == "" {
+				return
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, ct)
+			}
+			if rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest("POST", "/template/user/42", nil)
+	req = req.WithContext(WithSettings(req.Context(), &Settings{TemplatesDir: dir}))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if location := rr.Header().Get("Location"); location != "/users/42" {
+		t.Errorf("Expected Location /users/42, got %q", location)
+	}
+}
+
+// TestCSVHandler tests the generated CSV, its header and disposition
+func TestCSVHandler(t *testing.T) {
+	tests := []struct {
+		name                string
+		query               string
+		expectedStatus      int
+		expectedRows        int
+		expectedCols        int
+		expectedContentType string
+		expectedDisposition string
+	}{
+		{"defaults", "", http.StatusOK, 11, 4, "text/csv; charset=utf-8; header=present", ""},
+		{"sized", "?rows=50&cols=7", http.StatusOK, 51, 7, "text/csv; charset=utf-8; header=present", ""},
+		{"no header", "?rows=3&header=false", http.StatusOK, 3, 4, "text/csv; charset=utf-8; header=absent", ""},
+		{"empty", "?rows=0", http.StatusOK, 1, 4, "text/csv; charset=utf-8; header=present", ""},
+		{"single column", "?cols=1", http.StatusOK, 11, 1, "text/csv; charset=utf-8; header=present", ""},
+		{"filename", "?filename=export.csv", http.StatusOK, 11, 4, "text/csv; charset=utf-8; header=present", "attachment; filename=export.csv"},
+		{"capped", "?cols=1000&rows=1", http.StatusOK, 2, 100, "text/csv; charset=utf-8; header=present", ""},
+		{"invalid rows", "?rows=-1", http.StatusBadRequest, 0, 0, "", ""},
+		{"no columns", "?cols=0", http.StatusBadRequest, 0, 0, "", ""},
+		{"invalid header", "?header=maybe", http.StatusBadRequest, 0, 0, "", ""},
+		{"invalid filename", "?filename=../x.csv", http.StatusBadRequest, 0, 0, "", ""},
+		{"invalid seed", "?seed=x", http.StatusBadRequest, 0, 0, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			CSVHandler(rr, httptest.NewRequest("GET", "/csv"+tt.query, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, got)
+			}
+			if got := rr.Header().Get("Content-Disposition"); got != tt.expectedDisposition {
+				t.Errorf("Expected Content-Disposition %q, got %q", tt.expectedDisposition, got)
+			}
+
+			records, err := csv.NewReader(rr.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("Failed to parse CSV: %v", err)
+			}
+			if len(records) != tt.expectedRows {
+				t.Fatalf("Expected %d records, got %d", tt.expectedRows, len(records))
+			}
+			for _, record := range records {
+				if len(record) != tt.expectedCols {
+					t.Fatalf("Expected %d columns, got %d", tt.expectedCols, len(record))
+				}
+			}
+		})
+	}
+
+	t.Run("seed", func(t *testing.T) {
+		bodies := make([]string, 2)
+		for i := range bodies {
+			rr := httptest.NewRecorder()
+			CSVHandler(rr, httptest.NewRequest("GET", "/csv?rows=20&seed=3", nil))
+			bodies[i] = rr.Body.String()
+		}
+		if bodies[0] != bodies[1] {
+			t.Error("Expected the same seed to produce the same CSV")
+		}
+		if !strings.HasPrefix(bodies[0], "id,text1,number2,amount3\r\n1,") {
+			t.Errorf("Expected a header row and CRLF line endings, got %q", bodies[0][:40])
+		}
+	})
+}
+
+// TestPaginateHandler tests page-numbered and cursor pagination
+func TestPaginateHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedIDs    []int
+		expectedLinks  []string
+	}{
+		{"first page", "/paginate?total=25&per_page=10", http.StatusOK, []int{1, 10}, []string{`?page=1&per_page=10&total=25>; rel="first"`, `?page=2&per_page=10&total=25>; rel="next"`, `?page=3&per_page=10&total=25>; rel="last"`}},
+		{"middle page", "/paginate?total=25&per_page=10&page=2", http.StatusOK, []int{11, 20}, []string{`?page=3&per_page=10&total=25>; rel="next"`, `?page=1&per_page=10&total=25>; rel="prev"`}},
+		{"last page", "/paginate?total=25&per_page=10&page=3", http.StatusOK, []int{21, 25}, []string{`?page=2&per_page=10&total=25>; rel="prev"`}},
+		{"past the end", "/paginate?total=25&per_page=10&page=9", http.StatusOK, nil, []string{`?page=3&per_page=10&total=25>; rel="prev"`}},
+		{"defaults", "/paginate", http.StatusOK, []int{1, 10}, []string{`?page=10>; rel="last"`}},
+		{"cursor start", "/paginate?total=25&per_page=10&style=cursor", http.StatusOK, []int{1, 10}, []string{`cursor=` + encodeCursor(10) + `&per_page=10&style=cursor&total=25>; rel="next"`}},
+		{"cursor middle", "/paginate?total=25&per_page=10&cursor=" + encodeCursor(10), http.StatusOK, []int{11, 20}, []string{`cursor=` + encodeCursor(0)}},
+		{"invalid cursor", "/paginate?cursor=nope", http.StatusBadRequest, nil, nil},
+		{"invalid page", "/paginate?page=0", http.StatusBadRequest, nil, nil},
+		{"invalid per_page", "/paginate?per_page=x", http.StatusBadRequest, nil, nil},
+		{"invalid total", "/paginate?total=-1", http.StatusBadRequest, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			PaginateHandler(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var response PaginateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if tt.expectedIDs == nil {
+				if len(response.Items) != 0 {
+					t.Errorf("Expected no items, got %d", len(response.Items))
+				}
+			} else if len(response.Items) == 0 || response.Items[0].ID != tt.expectedIDs[0] || response.Items[len(response.Items)-1].ID != tt.expectedIDs[1] {
+				t.Errorf("Expected items %d to %d, got %+v", tt.expectedIDs[0], tt.expectedIDs[1], response.Items)
+			}
+			link := rr.Header().Get("Link")
+			for _, expected := range tt.expectedLinks {
+				if !strings.Contains(link, expected) {
+					t.Errorf("Expected Link to contain %q, got %q", expected, link)
+				}
+			}
+		})
+	}
+}
+
+// TestCacheControlHandler tests building Cache-Control from the query
+func TestCacheControlHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{"durations and flags", "?stale-while-revalidate=30&max-age=60&public&s-maxage=300", http.StatusOK, "public, max-age=60, s-maxage=300, stale-while-revalidate=30"},
+		{"no store", "?no-store&private=true&no-cache=false", http.StatusOK, "private, no-store"},
+		{"empty", "", http.StatusOK, ""},
+		{"unknown parameters ignored", "?max-stale=5&immutable", http.StatusOK, "immutable"},
+		{"invalid seconds", "?max-age=soon", http.StatusBadRequest, ""},
+		{"negative seconds", "?s-maxage=-1", http.StatusBadRequest, ""},
+		{"invalid flag", "?no-store=maybe", http.StatusBadRequest, ""},
+		{"public and private", "?public&private", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			CacheControlHandler(rr, httptest.NewRequest("GET", "/cache-control"+tt.query, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Cache-Control"); got != tt.expectedHeader {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.expectedHeader, got)
+			}
+			var response CacheControlResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.CacheControl != tt.expectedHeader || time.Since(response.GeneratedAt) > time.Minute {
+				t.Errorf("Unexpected response %+v", response)
+			}
+		})
+	}
+}
+
+// TestVaryHandler tests echoing selected headers and listing them in Vary
+func TestVaryHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		expectedStatus  int
+		expectedVary    string
+		expectedHeaders map[string]string
+	}{
+		{"default", "", http.StatusOK, "Accept-Language", map[string]string{"Accept-Language": "de"}},
+		{"selected", "?headers=x-tenant,%20Accept-Language,X-Tenant", http.StatusOK, "X-Tenant, Accept-Language", map[string]string{"X-Tenant": "a", "Accept-Language": "de"}},
+		{"missing header", "?headers=X-Missing", http.StatusOK, "X-Missing", map[string]string{"X-Missing": ""}},
+		{"wildcard", "?headers=*", http.StatusOK, "*", map[string]string{}},
+		{"invalid name", "?headers=Bad%20Name", http.StatusBadRequest, "", nil},
+		{"too many", "?headers=X-0,X-1,X-2,X-3,X-4,X-5,X-6,X-7,X-8,X-9,X-10,X-11,X-12,X-13,X-14,X-15,X-16,X-17,X-18,X-19,X-20", http.StatusBadRequest, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/vary"+tt.query, nil)
+			req.Header.Set("Accept-Language", "de")
+			req.Header.Set("X-Tenant", "a")
+			rr := httptest.NewRecorder()
+			VaryHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if vary := rr.Header().Values("Vary"); len(vary) == 0 || vary[0] != tt.expectedVary {
+				t.Errorf("Expected Vary %q, got %q", tt.expectedVary, vary)
+			}
+			var response VaryResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(response.Headers, tt.expectedHeaders) || len(response.Variant) != 16 {
+				t.Errorf("Unexpected response %+v", response)
+			}
+		})
+	}
+
+	variant := func(tenant string) string {
+		req := httptest.NewRequest("GET", "/vary?headers=X-Tenant", nil)
+		req.Header.Set("X-Tenant", tenant)
+		rr := httptest.NewRecorder()
+		VaryHandler(rr, req)
+		var response VaryResponse
+		json.NewDecoder(rr.Body).Decode(&response)
+		return response.Variant
+	}
+	if variant("a") != variant("a") || variant("a") == variant("b") {
+		t.Error("Expected the variant to follow the header values")
+	}
+}
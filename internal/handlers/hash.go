@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+)
+
+// hashAlgorithms are the digests /hash/{algo} computes, by name
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// HashResponse is the body of /hash/{algo}
+type HashResponse struct {
+	Algorithm string `json:"algorithm"`
+	Bytes     int64  `json:"bytes"`
+	Hex       string `json:"hex"`
+	Base64    string `json:"base64"`
+}
+
+// HashHandler streams the request body through the hash /hash/{algo}
+// names and returns its digest in hex and base64 with the number of bytes
+// hashed. The body is hashed exactly as received, with any
+// Content-Encoding left in place, so clients can tell whether an
+// intermediary altered it.
+func HashHandler(w http.ResponseWriter, r *http.Request) {
+	algo := r.PathValue("algo")
+	newHash, ok := hashAlgorithms[algo]
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Unsupported hash algorithm "+algo+"; use md5, sha1, sha256 or sha512")
+		return
+	}
+
+	h := newHash()
+	n, err := io.Copy(h, r.Body)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	sum := h.Sum(nil)
+	writeJSONResponse(w, r, http.StatusOK, HashResponse{
+		Algorithm: algo,
+		Bytes:     n,
+		Hex:       hex.EncodeToString(sum),
+		Base64:    base64.StdEncoding.EncodeToString(sum),
+	})
+}
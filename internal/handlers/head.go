@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// withAutoHead makes a GET-capable route answer HEAD with the headers of
+// the equivalent GET, including its Content-Length, and no body. Routes
+// that list HEAD themselves are left alone.
+func withAutoHead(route Route) Route {
+	if len(route.Methods) > 0 {
+		if !slices.Contains(route.Methods, http.MethodGet) || slices.Contains(route.Methods, http.MethodHead) {
+			return route
+		}
+		route.Methods = append(slices.Clone(route.Methods), http.MethodHead)
+	}
+
+	next := route.Handler
+	route.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		get := r.Clone(r.Context())
+		get.Method = http.MethodGet
+		hw := &headWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(hw, get)
+		hw.finish()
+	})
+	return route
+}
+
+// headWriter discards the body of a GET response served for HEAD, holding
+// back the headers until the handler returns so Content-Length can be
+// set to the size of the discarded body
+type headWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (hw *headWriter) WriteHeader(status int) {
+	// Informational responses are passed on; the final one is held back
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		hw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	hw.status = status
+}
+
+func (hw *headWriter) Write(b []byte) (int, error) {
+	hw.size += int64(len(b))
+	return len(b), nil
+}
+
+// finish sends the held back headers
+func (hw *headWriter) finish() {
+	header := hw.ResponseWriter.Header()
+	if header.Get("Content-Length") == "" && bodyAllowedForStatus(hw.status) {
+		header.Set("Content-Length", strconv.FormatInt(hw.size, 10))
+	}
+	hw.ResponseWriter.WriteHeader(hw.status)
+}
+
+// bodyAllowedForStatus reports whether a response with status may have a
+// body, and thus a meaningful Content-Length
+func bodyAllowedForStatus(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// HealthStatus is the body returned by the health endpoints
+type HealthStatus struct {
+	Status        string    `json:"status"`
+	Ready         bool      `json:"ready"`
+	Build         BuildInfo `json:"build"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+}
+
+// Health tracks liveness and readiness of the server
+type Health struct {
+	build   BuildInfo
+	started time.Time
+	ready   atomic.Bool
+}
+
+// NewHealth creates a Health tracker that starts out ready
+func NewHealth(build BuildInfo) *Health {
+	h := &Health{
+		build:   build,
+		started: time.Now(),
+	}
+	h.ready.Store(true)
+	return h
+}
+
+// SetReady toggles readiness; a non-ready server keeps serving traffic
+// but fails /readyz so load balancers stop routing new requests to it
+func (h *Health) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// Ready reports whether the server is ready to receive traffic
+func (h *Health) Ready() bool {
+	return h.ready.Load()
+}
+
+// status builds the health response body
+func (h *Health) status(status string) HealthStatus {
+	return HealthStatus{
+		Status:        status,
+		Ready:         h.Ready(),
+		Build:         h.build,
+		StartedAt:     h.started.UTC(),
+		UptimeSeconds: time.Since(h.started).Seconds(),
+	}
+}
+
+// LivenessHandler reports that the process is alive (/healthz, /livez)
+func (h *Health) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, r, http.StatusOK, h.status("ok"))
+}
+
+// ReadinessHandler reports whether the server accepts traffic (/readyz)
+func (h *Health) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.Ready() {
+		writeJSONResponse(w, r, http.StatusServiceUnavailable, h.status("draining"))
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, h.status("ready"))
+}
+
+// ReadyToggleHandler lets operators drain or restore readiness:
+// PUT marks the server ready, DELETE marks it as draining and GET
+// reports the current state
+func (h *Health) ReadyToggleHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		h.SetReady(true)
+	case http.MethodDelete:
+		h.SetReady(false)
+	default:
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	writeJSONResponse(w, r, http.StatusOK, map[string]bool{"ready": h.Ready()})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// hijack takes over the connection, answering 501 if it cannot be, as
+// with HTTP/2 or writers that hide the connection
+func hijack(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.Writer, bool) {
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeJSONError(w, r, http.StatusNotImplemented, "This connection cannot be hijacked; use HTTP/1.1")
+		return nil, nil, false
+	}
+	return conn, brw.Writer, true
+}
+
+// tcpConn finds the TCP connection beneath TLS or PROXY protocol wrappers
+func tcpConn(conn net.Conn) (*net.TCPConn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// dropModes are the points at which /close and /reset can drop the
+// connection
+var dropModes = []string{"none", "headers", "body", "chunked"}
+
+// CloseHandler drops the connection mid-response with a FIN, waiting
+// ?delay= after the partial response, to test how clients and proxies
+// handle truncated responses. ?mode= chooses how much is sent first:
+// none (the default) closes without a response, headers stops part-way
+// through the headers, body sends half of a response with a
+// Content-Length, and chunked omits the final chunk.
+func CloseHandler(w http.ResponseWriter, r *http.Request) {
+	dropConnection(w, r, false)
+}
+
+// ResetHandler is like CloseHandler but sets SO_LINGER to zero before
+// closing, so the client sees a TCP RST instead of a FIN
+func ResetHandler(w http.ResponseWriter, r *http.Request) {
+	dropConnection(w, r, true)
+}
+
+// dropConnection sends part of a response as ?mode= chooses, then closes
+// the connection, resetting it if reset is set
+func dropConnection(w http.ResponseWriter, r *http.Request, reset bool) {
+	query := r.URL.Query()
+
+	mode := query.Get("mode")
+	if mode == "" {
+		mode = "none"
+	}
+	if !slices.Contains(dropModes, mode) {
+		writeJSONError(w, r, http.StatusBadRequest, fmt.Sprintf("mode must be one of %v", dropModes))
+		return
+	}
+
+	var delay time.Duration
+	if v := query.Get("delay"); v != "" {
+		var err error
+		if delay, err = parseDelay(v, settingsFrom(r).maxDelay()); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid delay value")
+			return
+		}
+	}
+
+	conn, bw, ok := hijack(w, r)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	if reset {
+		// Discard unsent data and send RST on close
+		if tc, ok := tcpConn(conn); ok {
+			tc.SetLinger(0)
+		} else {
+			slog.Warn("Cannot reset a non-TCP connection; closing it instead", "path", r.URL.Path)
+		}
+	}
+
+	const body = "This response was cut short.\n"
+	switch mode {
+	case "headers":
+		bw.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/pl")
+	case "body":
+		bw.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\n")
+		bw.WriteString("Content-Length: " + strconv.Itoa(2*len(body)) + "\r\n\r\n")
+		bw.WriteString(body)
+	case "chunked":
+		bw.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\n")
+		bw.WriteString("Transfer-Encoding: chunked\r\n\r\n")
+		fmt.Fprintf(bw, "%x\r\n%s\r\n", len(body), body)
+	}
+	bw.Flush()
+	wait(r.Context(), delay)
+}
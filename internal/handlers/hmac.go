@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HMACKeyHeader and HMACKeyQuery supply the /hmac key; the header keeps it
+// out of access logs
+const (
+	HMACKeyHeader = "X-HMAC-Key"
+	HMACKeyQuery  = "key"
+)
+
+// HMACMessageQuery is the query parameter signed by /hmac in place of the
+// request body
+const HMACMessageQuery = "message"
+
+// HMACResponse is the body of /hmac/{algo}. Header is the signature as
+// webhook senders such as GitHub write it, e.g. sha256=<hex>.
+type HMACResponse struct {
+	Algorithm string `json:"algorithm"`
+	Bytes     int64  `json:"bytes"`
+	Hex       string `json:"hex"`
+	Base64    string `json:"base64"`
+	Base64URL string `json:"base64url"`
+	Header    string `json:"header"`
+}
+
+// HMACHandler signs ?message=, or else the request body as received, with
+// the key from the X-HMAC-Key header or ?key= using the HMAC of
+// /hmac/{algo}, and returns the signature in several encodings, so tests
+// can compute the signatures they send to webhook receivers
+func HMACHandler(w http.ResponseWriter, r *http.Request) {
+	algo := r.PathValue("algo")
+	newHash, ok := hashAlgorithms[algo]
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Unsupported HMAC algorithm "+algo+"; use md5, sha1, sha256 or sha512")
+		return
+	}
+	query := r.URL.Query()
+	key := r.Header.Get(HMACKeyHeader)
+	if key == "" {
+		key = query.Get(HMACKeyQuery)
+	}
+	if key == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "Missing key: set the "+HMACKeyHeader+" header or ?key=")
+		return
+	}
+
+	var message io.Reader = r.Body
+	if query.Has(HMACMessageQuery) {
+		message = strings.NewReader(query.Get(HMACMessageQuery))
+	}
+	mac := hmac.New(newHash, []byte(key))
+	n, err := io.Copy(mac, message)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	sum := mac.Sum(nil)
+	writeJSONResponse(w, r, http.StatusOK, HMACResponse{
+		Algorithm: algo,
+		Bytes:     n,
+		Hex:       hex.EncodeToString(sum),
+		Base64:    base64.StdEncoding.EncodeToString(sum),
+		Base64URL: base64.RawURLEncoding.EncodeToString(sum),
+		Header:    algo + "=" + hex.EncodeToString(sum),
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"os"
+)
+
+// ServedByHeader is the /hostname response header naming the instance
+// that answered, for clients that only look at headers
+const ServedByHeader = "X-Served-By"
+
+// HostnameResponse is the body of /hostname. PodIP comes from the POD_IP
+// environment variable, as set by the Kubernetes downward API, falling
+// back to the IP the request arrived on.
+type HostnameResponse struct {
+	Hostname   string `json:"hostname"`
+	PodIP      string `json:"pod_ip,omitempty"`
+	ListenAddr string `json:"listen_addr,omitempty"`
+}
+
+// HostnameHandler reports which instance served the request: its
+// hostname, which is the pod name in Kubernetes, its IP and the local
+// address the connection was accepted on. With several replicas behind a
+// load balancer this shows how requests are spread.
+func HostnameHandler(w http.ResponseWriter, r *http.Request) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Cannot determine the hostname")
+		return
+	}
+	resp := HostnameResponse{Hostname: hostname, PodIP: os.Getenv("POD_IP")}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		resp.ListenAddr = addr.String()
+		if host, _, err := net.SplitHostPort(resp.ListenAddr); err == nil && resp.PodIP == "" {
+			resp.PodIP = host
+		}
+	}
+
+	w.Header().Set(ServedByHeader, hostname)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// indexTemplate renders the landing page served at /
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>httpbin</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; }
+h2 { border-bottom: 1px solid #ddd; padding-bottom: .2em; }
+table { border-collapse: collapse; width: 100%; }
+td { padding: .3em .5em; vertical-align: top; border-bottom: 1px solid #eee; }
+.method { font-weight: bold; white-space: nowrap; }
+code { background: #f5f5f5; padding: .1em .3em; }
+</style>
+</head>
+<body>
+<h1>httpbin</h1>
+<p>An HTTP request and response service for testing. The endpoints are also listed as JSON at <a href="{{.Base}}/endpoints">/endpoints</a>.</p>
+{{range .Groups}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<p>{{.Description}}</p>
+<table>
+{{range .Endpoints}}<tr>
+<td class="method">{{.Methods}}</td>
+<td>{{if .Link}}<a href="{{.Link}}">{{.Pattern}}</a>{{else}}{{.Pattern}}{{end}}</td>
+<td>{{.Description}}<br><code>{{.Curl}}</code></td>
+</tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// indexEndpoint is an endpoint as rendered on the landing page
+type indexEndpoint struct {
+	Pattern     string
+	Methods     string
+	Description string
+	// Link is set for endpoints that can be opened in a browser
+	Link string
+	Curl string
+}
+
+// indexGroup is a group as rendered on the landing page
+type indexGroup struct {
+	Name        string
+	Description string
+	Endpoints   []indexEndpoint
+}
+
+// IndexHandler serves an HTML page listing the routes returned by catalog,
+// grouped by endpoint group, with links and example curl commands
+func IndexHandler(catalog func() []GroupRoutes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		base := baseURL(r)
+		var groups []indexGroup
+		for _, g := range catalog() {
+			group := indexGroup{Name: g.Name, Description: g.Description}
+			for _, route := range g.Routes {
+				group.Endpoints = append(group.Endpoints, describeIndexEndpoint(route, base))
+			}
+			groups = append(groups, group)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		// Headers are already sent, so a failure can only truncate the page
+		_ = indexTemplate.Execute(w, struct {
+			Base   string
+			Groups []indexGroup
+		}{base, groups})
+	}
+}
+
+// describeIndexEndpoint prepares a route for the landing page
+func describeIndexEndpoint(route Route, base string) indexEndpoint {
+	methods := "ANY"
+	if len(route.Methods) > 0 {
+		methods = strings.Join(route.Methods, ", ")
+	}
+
+	example := base + route.ExamplePath()
+	endpoint := indexEndpoint{
+		Pattern:     route.Pattern,
+		Methods:     methods,
+		Description: route.Description,
+	}
+
+	method := http.MethodGet
+	if len(route.Methods) > 0 && !slices.Contains(route.Methods, http.MethodGet) {
+		method = route.Methods[0]
+	}
+	if method == http.MethodGet {
+		endpoint.Link = example
+		endpoint.Curl = "curl '" + example + "'"
+	} else {
+		endpoint.Curl = "curl -X " + method + " '" + example + "'"
+	}
+	return endpoint
+}
+
+// baseURL returns the scheme, host and mount prefix the request was
+// received under, so links work when the handler is mounted below a
+// prefix with http.StripPrefix
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	requested := r.URL.Path
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		requested = u.Path
+	}
+	prefix := strings.TrimSuffix(strings.TrimSuffix(requested, r.URL.Path), "/")
+
+	return scheme + "://" + r.Host + prefix
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultPodInfoDir is where /k8s looks for downward-API volume files
+// unless configured otherwise
+const DefaultPodInfoDir = "/etc/podinfo"
+
+// serviceAccountDir holds the namespace file Kubernetes mounts into pods
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// K8sResponse is the body of /k8s. Fields the pod does not expose are
+// omitted.
+type K8sResponse struct {
+	InCluster      bool              `json:"in_cluster"`
+	Namespace      string            `json:"namespace,omitempty"`
+	PodName        string            `json:"pod_name,omitempty"`
+	PodIP          string            `json:"pod_ip,omitempty"`
+	NodeName       string            `json:"node_name,omitempty"`
+	NodeIP         string            `json:"node_ip,omitempty"`
+	ServiceAccount string            `json:"service_account,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+}
+
+// firstEnv returns the first of the named environment variables that is
+// set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// readPodInfoFile reads a downward-API file of key="value" lines, as
+// written for metadata.labels and metadata.annotations; it returns nil
+// if the file is missing
+func readPodInfoFile(path string) map[string]string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, quoted, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			value = quoted
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// K8sHandler reports the pod's Kubernetes metadata, sourced from the
+// downward API: the POD_NAMESPACE, POD_NAME, POD_IP, NODE_NAME, NODE_IP
+// and POD_SERVICE_ACCOUNT environment variables, and labels and
+// annotations files in the pod info directory. The namespace falls back
+// to the one mounted with the service account token, and the pod name to
+// the hostname when running in a cluster.
+func K8sHandler(w http.ResponseWriter, r *http.Request) {
+	resp := K8sResponse{
+		InCluster:      os.Getenv("KUBERNETES_SERVICE_HOST") != "",
+		Namespace:      os.Getenv("POD_NAMESPACE"),
+		PodName:        os.Getenv("POD_NAME"),
+		PodIP:          os.Getenv("POD_IP"),
+		NodeName:       os.Getenv("NODE_NAME"),
+		NodeIP:         firstEnv("NODE_IP", "HOST_IP"),
+		ServiceAccount: firstEnv("POD_SERVICE_ACCOUNT", "SERVICE_ACCOUNT"),
+	}
+	if resp.Namespace == "" {
+		if ns, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace")); err == nil {
+			resp.Namespace = strings.TrimSpace(string(ns))
+		}
+	}
+	if resp.PodName == "" && resp.InCluster {
+		resp.PodName, _ = os.Hostname()
+	}
+	if dir := settingsFrom(r).PodInfoDir; dir != "" {
+		resp.Labels = readPodInfoFile(filepath.Join(dir, "labels"))
+		resp.Annotations = readPodInfoFile(filepath.Join(dir, "annotations"))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(w, r, http.StatusOK, resp)
+}
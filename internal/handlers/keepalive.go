@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Query parameters controlling keepalives during long responses
+const (
+	// KeepaliveQuery sets the keepalive interval, e.g. ?keepalive=5s
+	KeepaliveQuery = "keepalive"
+	// KeepaliveModeQuery picks newline (the default) or processing
+	KeepaliveModeQuery = "keepalive_mode"
+)
+
+// minKeepalive keeps clients from asking for a flood of keepalives
+const minKeepalive = 100 * time.Millisecond
+
+// keepalive describes how to keep an idle response alive. Newlines are
+// sent as part of the body, which JSON, XML and YAML parsers skip as
+// leading whitespace; processing sends 102 Processing interim responses
+// instead and so only works before the final response has started.
+type keepalive struct {
+	interval   time.Duration
+	processing bool
+}
+
+// parseKeepalive reads ?keepalive= and ?keepalive_mode=; a zero interval
+// disables keepalives, and intervals are capped at limit
+func parseKeepalive(query url.Values, limit time.Duration) (keepalive, bool) {
+	var k keepalive
+	if raw := query.Get(KeepaliveQuery); raw != "" {
+		interval, err := parseDelay(raw, limit)
+		if err != nil || interval == 0 {
+			return k, false
+		}
+		k.interval = max(interval, minKeepalive)
+	}
+
+	switch query.Get(KeepaliveModeQuery) {
+	case "", "newline":
+	case "processing", "102":
+		k.processing = true
+	default:
+		return k, false
+	}
+	return k, true
+}
+
+// newlines reports whether keepalives are written into the body
+func (k keepalive) newlines() bool {
+	return k.interval > 0 && !k.processing
+}
+
+// keepaliveWriter sends keepalives while a handler waits. Once a newline
+// has committed the status, later WriteHeader calls are dropped rather
+// than logged as superfluous.
+type keepaliveWriter struct {
+	http.ResponseWriter
+	k         keepalive
+	committed bool
+}
+
+// newKeepaliveWriter wraps w to send keepalives as k describes
+func newKeepaliveWriter(w http.ResponseWriter, k keepalive) *keepaliveWriter {
+	return &keepaliveWriter{ResponseWriter: w, k: k}
+}
+
+// WriteHeader passes on interim responses and the first final status
+func (kw *keepaliveWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		if !kw.committed {
+			kw.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
+	if kw.committed {
+		return
+	}
+	kw.committed = true
+	kw.ResponseWriter.WriteHeader(code)
+}
+
+// Write commits the response and writes b
+func (kw *keepaliveWriter) Write(b []byte) (int, error) {
+	kw.committed = true
+	return kw.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (kw *keepaliveWriter) Unwrap() http.ResponseWriter {
+	return kw.ResponseWriter
+}
+
+// wait blocks for d like the package-level wait, sending a keepalive
+// after every interval of silence
+func (kw *keepaliveWriter) wait(r *http.Request, d time.Duration) bool {
+	if kw.k.interval <= 0 {
+		return wait(r.Context(), d)
+	}
+	deadline := time.Now().Add(d)
+	for {
+		left := time.Until(deadline)
+		if left <= kw.k.interval {
+			return wait(r.Context(), left)
+		}
+		if !wait(r.Context(), kw.k.interval) {
+			return false
+		}
+		kw.send()
+	}
+}
+
+// send writes one keepalive. Interim responses are sent immediately;
+// flushing after one would commit a 200.
+func (kw *keepaliveWriter) send() {
+	if kw.k.processing {
+		kw.WriteHeader(http.StatusProcessing)
+		return
+	}
+	kw.Write([]byte("\n"))
+	http.NewResponseController(kw).Flush()
+}
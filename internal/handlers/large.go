@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxLargeBytes caps the body size of /large
+const maxLargeBytes = 10 << 30
+
+// sizeUnits maps size suffixes to bytes, IEC before SI so KiB is not read
+// as K followed by iB
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"kib", 1 << 10},
+	{"mib", 1 << 20},
+	{"gib", 1 << 30},
+	{"kb", 1e3},
+	{"mb", 1e6},
+	{"gb", 1e9},
+	{"b", 1},
+}
+
+// parseSize parses a size such as 512, 64KiB or 100MB as bytes; suffixes
+// are case-insensitive
+func parseSize(raw string) (int64, bool) {
+	number, scale := strings.ToLower(strings.TrimSpace(raw)), int64(1)
+	for _, u := range sizeUnits {
+		if n, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, scale = strings.TrimSpace(n), u.bytes
+			break
+		}
+	}
+	v, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || v < 0 || v > maxLargeBytes/scale {
+		return 0, false
+	}
+	return v * scale, true
+}
+
+// largeBlock is the pattern /large repeats: the alphabet, as on /range,
+// in a whole number of alphabets so blocks join seamlessly
+var largeBlock = rangeBody(26 * 2520)
+
+// LargeHandler streams /large/{size} bytes of the repeated alphabet, with
+// an exact Content-Length, writing one block at a time so the size is not
+// held in memory. Sizes are bytes or take a suffix such as KB or MiB, up
+// to 10GiB, and ?rate= paces the body.
+func LargeHandler(w http.ResponseWriter, r *http.Request) {
+	n, ok := parseSize(r.PathValue("size"))
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Size must be between 0 and 10GiB")
+		return
+	}
+	out, ok := throttled(w, r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid rate")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	w.WriteHeader(http.StatusOK)
+
+	// Flush each block so buffering middleware never holds the body
+	rc := http.NewResponseController(w)
+	for n > 0 {
+		c := largeBlock[:min(n, int64(len(largeBlock)))]
+		if _, err := out.Write(c); err != nil {
+			return
+		}
+		rc.Flush()
+		n -= int64(len(c))
+	}
+}
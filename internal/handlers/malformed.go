@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// malformedResponses are the raw responses /malformed can send, keyed by
+// mode
+var malformedResponses = map[string]string{
+	// A chunk size that is not hexadecimal
+	"chunk-size": "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"zz\r\nThis chunk has an invalid size.\r\n0\r\n\r\n",
+	// A Content-Length shorter than the body, leaving bytes that look
+	// like the start of the next response
+	"content-length": "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\n" +
+		"shortHTTP/1.1 200 OK\r\nX-Smuggled: true\r\n\r\n",
+	// A control byte in a header value and a space in a header name
+	"header-bytes": "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nX-Bad-Value: a\x00b\x7fc\r\nBad Name: x\r\nContent-Length: 0\r\n\r\n",
+	// Two different Content-Lengths, as in response splitting
+	"duplicate-headers": "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 4\r\nContent-Length: 12\r\n\r\n" +
+		"four or twelve",
+}
+
+// MalformedHandler writes a deliberately invalid HTTP/1.1 response over
+// the hijacked connection, then closes it, as a hardening target for
+// HTTP parsers. ?mode= is one of chunk-size, content-length,
+// header-bytes or duplicate-headers.
+func MalformedHandler(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	response, ok := malformedResponses[mode]
+	if !ok {
+		modes := make([]string, 0, len(malformedResponses))
+		for m := range malformedResponses {
+			modes = append(modes, m)
+		}
+		slices.Sort(modes)
+		writeJSONError(w, r, http.StatusBadRequest, fmt.Sprintf("mode must be one of %v", modes))
+		return
+	}
+
+	conn, bw, ok := hijack(w, r)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	bw.WriteString(response)
+	bw.Flush()
+}
+
+// GarbageHandler writes /garbage/{n} random bytes over the hijacked
+// connection instead of an HTTP response, then closes it, to test
+// protocol error handling and port or ALPN misconfiguration detection.
+// ?seed= makes the bytes reproducible.
+func GarbageHandler(w http.ResponseWriter, r *http.Request) {
+	n, ok := parseByteCount(strings.TrimPrefix(r.URL.Path, "/garbage/"))
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Byte count must be between 0 and "+strconv.Itoa(maxStreamBytes))
+		return
+	}
+	src, ok := randomSource(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
+		return
+	}
+
+	garbage := make([]byte, n)
+	src.Read(garbage)
+	// Never start like a status line, so the bytes cannot pass for HTTP
+	if n > 0 && garbage[0] == 'H' {
+		garbage[0] = 0
+	}
+
+	conn, bw, ok := hijack(w, r)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	bw.Write(garbage)
+	bw.Flush()
+}
@@ -2,41 +2,68 @@ package handlers
 
 import (
 	"encoding/json"
-	"io"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"gopkg.in/yaml.v3"
 )
 
 // RequestInfo represents the details of an HTTP request
 type RequestInfo struct {
-	Method  string              `json:"method"`
-	URL     string              `json:"url"`
-	Args    map[string][]string `json:"args"`
-	Headers map[string][]string `json:"headers"`
-	Origin  string              `json:"origin"`
-	Body    string              `json:"body,omitempty"`
-	JSON    any                 `json:"json,omitempty"`
+	Method          string                `json:"method"`
+	URL             string                `json:"url"`
+	Args            map[string][]string   `json:"args"`
+	Headers         map[string][]string   `json:"headers"`
+	Cookies         map[string]string     `json:"cookies,omitempty"`
+	Origin          string                `json:"origin"`
+	Body            string                `json:"body,omitempty"`
+	JSON            any                   `json:"json,omitempty"`
+	Form            map[string][]string   `json:"form,omitempty"`
+	Files           map[string][]FileInfo `json:"files,omitempty"`
+	ContentEncoding string                `json:"content_encoding,omitempty"`
 }
 
 // extractRequestInfo extracts information from an HTTP request
 func extractRequestInfo(r *http.Request) (*RequestInfo, error) {
-	// Read request body
-	body, err := io.ReadAll(r.Body)
+	// Read request body, decompressing it if needed
+	body, encoding, err := readBody(r)
 	if err != nil {
 		return nil, err
 	}
-	defer r.Body.Close()
 
 	info := &RequestInfo{
-		Method:  r.Method,
-		URL:     r.URL.String(),
-		Args:    r.URL.Query(),
-		Headers: r.Header,
-		Origin:  getOriginIP(r),
-		Body:    string(body),
+		Method:          r.Method,
+		URL:             r.URL.String(),
+		Args:            r.URL.Query(),
+		Headers:         r.Header,
+		Cookies:         requestCookies(r),
+		Origin:          reportedOrigin(r),
+		ContentEncoding: encoding,
+	}
+
+	// Report form fields and files instead of the raw form body
+	if boundary := multipartBoundary(r); boundary != "" && len(body) > 0 {
+		info.Form, info.Files, err = parseMultipart(body, boundary, wantFileContent(r))
+		if err != nil {
+			return nil, err
+		}
+		return info, nil
 	}
+	if isURLEncodedForm(r) && len(body) > 0 {
+		info.Form, err = parseURLEncoded(body)
+		if err != nil {
+			return nil, err
+		}
+		return info, nil
+	}
+	info.Body = string(body)
 
 	// Try to parse JSON body if Content-Type is application/json
 	if len(body) > 0 && strings.Contains(r.Header.Get("Content-Type"), "application/json") {
@@ -45,42 +72,226 @@ func extractRequestInfo(r *http.Request) (*RequestInfo, error) {
 			info.JSON = jsonData
 		}
 	}
+	// YAML and CBOR bodies are reported as the equivalent JSON
+	if len(body) > 0 && bodyIs(r, yamlFormat) {
+		var yamlData any
+		if err := yaml.Unmarshal(body, &yamlData); err == nil {
+			info.JSON = jsonCompatible(yamlData)
+		}
+	}
+	if len(body) > 0 && bodyIs(r, cborFormat) {
+		var cborData any
+		if err := cbor.Unmarshal(body, &cborData); err == nil {
+			info.JSON = jsonCompatible(cborData)
+		}
+	}
 
 	return info, nil
 }
 
-// getOriginIP extracts the origin IP from the request
+// requestCookies returns the request cookies by name; the first of
+// several cookies with the same name wins, as with http.Request.Cookie
+func requestCookies(r *http.Request) map[string]string {
+	cookies := r.Cookies()
+	if len(cookies) == 0 {
+		return nil
+	}
+	byName := make(map[string]string, len(cookies))
+	for _, c := range cookies {
+		if _, ok := byName[c.Name]; !ok {
+			byName[c.Name] = c.Value
+		}
+	}
+	return byName
+}
+
+// getOriginIP extracts the origin IP from the request. Forwarding
+// headers are only honoured when the direct peer is a trusted proxy; the
+// X-Forwarded-For chain is then walked from the right, skipping trusted
+// hops, so clients cannot spoof their address by prepending entries.
 func getOriginIP(r *http.Request) string {
-	// Check X-Forwarded-For header first
+	peer := remoteIP(r)
+
+	settings := settingsFrom(r)
+	addr, err := netip.ParseAddr(peer)
+	if err != nil || !settings.trusted(addr) {
+		return peer
+	}
+
+	// Check X-Forwarded-For header first. A hop that is not an IP address
+	// ends the walk at the last valid one, never echoing arbitrary text.
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
+		hops := strings.Split(xff, ",")
+		last := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return last
+			}
+			last = addr.String()
+			if !settings.trusted(addr) || i == 0 {
+				return last
+			}
+		}
 	}
 
 	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.String()
+	}
+
+	return peer
+}
+
+// OriginChainQuery is the query parameter requesting the full forwarding
+// chain as the origin, e.g. ?origin_chain=1
+const OriginChainQuery = "origin_chain"
+
+// reportedOrigin returns the origin echoed to the client: the client IP,
+// or the whole forwarding chain if requested
+func reportedOrigin(r *http.Request) string {
+	chain := settingsFrom(r).OriginChain
+	if v := r.URL.Query().Get(OriginChainQuery); v != "" {
+		chain, _ = strconv.ParseBool(v)
+	}
+	if !chain {
+		return getOriginIP(r)
+	}
+	return forwardingChain(r)
+}
+
+// forwardingChain returns the X-Forwarded-For hops followed by the direct
+// peer, e.g. "client, proxy1, peer". The hops are reported as sent,
+// without checking the proxies are trusted.
+func forwardingChain(r *http.Request) string {
+	var hops []string
+	for _, xff := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(xff, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return strings.Join(append(hops, remoteIP(r)), ", ")
+}
+
+// OriginIP returns the client IP of the request, honouring forwarding
+// headers from trusted proxies only
+func OriginIP(r *http.Request) string {
+	return getOriginIP(r)
+}
+
+// remoteIP returns the IP of the direct peer without the port
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// parseDelay accepts a number of seconds or a Go duration, capped at
+// limit; negative and non-finite values are rejected
+func parseDelay(raw string, limit time.Duration) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(raw, 64); err == nil {
+		if secs < 0 || math.IsInf(secs, 0) || math.IsNaN(secs) {
+			return 0, strconv.ErrRange
+		}
+		// Clamp before converting so huge values cannot overflow
+		return time.Duration(min(secs, limit.Seconds()) * float64(time.Second)), nil
 	}
+	d, err := time.ParseDuration(raw)
+	if err == nil && d < 0 {
+		return 0, strconv.ErrRange
+	}
+	return min(d, limit), err
+}
+
+// parseDelayRange accepts a delay as parseDelay does, or a range
+// "low-high" from which src picks a delay uniformly at random. A value whose
+// halves do not both parse, such as "1e-3", is taken as a single delay.
+func parseDelayRange(raw string, limit time.Duration, src *rand.Rand) (time.Duration, error) {
+	low, high, isRange := strings.Cut(raw, "-")
+	if !isRange || low == "" {
+		return parseDelay(raw, limit)
+	}
+
+	lo, loErr := parseDelay(low, limit)
+	hi, hiErr := parseDelay(high, limit)
+	if loErr != nil || hiErr != nil {
+		return parseDelay(raw, limit)
+	}
+	if lo > hi {
+		return 0, strconv.ErrRange
+	}
+	return randomDuration(src, lo, hi), nil
+}
 
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	// Remove port if present
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
+// randomDuration returns a uniformly random duration in [lo, hi]
+func randomDuration(src *rand.Rand, lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
 	}
-	return ip
+	return lo + time.Duration(src.Int63n(int64(hi-lo)+1))
 }
 
-// writeJSONResponse writes a JSON response
-func writeJSONResponse(w http.ResponseWriter, status int, data any) {
-	w.Header().Set("Content-Type", "application/json")
+// writeJSONResponse writes a JSON response, or XML, YAML or MessagePack
+// if the client asked for one with ?format= or the Accept header. JSON and
+// XML are indented if requested with ?pretty= or by default, and JSON is
+// wrapped for JSONP if a ?callback= is given.
+func writeJSONResponse(w http.ResponseWriter, r *http.Request, status int, data any) {
+	format, err := negotiateFormat(r)
+	if err != nil {
+		format, status, data = jsonFormat, http.StatusBadRequest, map[string]string{"error": err.Error()}
+	}
+
+	pretty := prettyOutput(r)
+	body, err := format.marshal(data, pretty)
+	if err != nil {
+		// JSON can represent anything the handlers produce
+		format = jsonFormat
+		body, _ = format.marshal(data, pretty)
+	}
+
+	// JSONP wraps JSON responses for legacy browser clients
+	if callback := r.URL.Query().Get(CallbackQuery); callback != "" && format == jsonFormat {
+		if !jsonpCallback.MatchString(callback) {
+			status = http.StatusBadRequest
+			body, _ = format.marshal(map[string]string{"error": "Invalid callback name"}, pretty)
+		} else {
+			w.Header().Set("Content-Type", "application/javascript")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(status)
+			w.Write(wrapJSONP(callback, body))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Add("Vary", "Accept")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+	w.Write(body)
+}
+
+// writeJSONError writes a JSON error response, as an RFC 7807 problem
+// document if the server is configured to use them
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if settingsFrom(r).ProblemDetails {
+		writeProblem(w, r, status, message)
+		return
+	}
+	writeJSONResponse(w, r, status, map[string]string{"error": message})
 }
 
-// writeJSONError writes a JSON error response
-func writeJSONError(w http.ResponseWriter, status int, message string) {
-	writeJSONResponse(w, status, map[string]string{"error": message})
+// JSONError writes an error response in the same format as the handlers,
+// for use by middleware
+func JSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeJSONError(w, r, status, message)
+}
+
+// JSONResponse writes a JSON response in the same format as the handlers,
+// for use by other packages
+func JSONResponse(w http.ResponseWriter, r *http.Request, status int, data any) {
+	writeJSONResponse(w, r, status, data)
 }
 
 // MethodHandler returns a handler for a specific HTTP method
@@ -88,14 +299,14 @@ func MethodHandler(method string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Check if the request method matches
 		if r.Method != method {
-			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 
 		// Extract request information
 		info, err := extractRequestInfo(r)
 		if err != nil {
-			writeJSONError(w, http.StatusInternalServerError, "Failed to read request body")
+			writeBodyError(w, r, err)
 			return
 		}
 
@@ -111,7 +322,7 @@ func MethodHandler(method string) http.HandlerFunc {
 			w.Header().Set("Allow", "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS")
 		}
 
-		writeJSONResponse(w, http.StatusOK, info)
+		writeJSONResponse(w, r, http.StatusOK, info)
 	}
 }
 
@@ -120,15 +331,15 @@ func HeadersHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]any{
 		"headers": r.Header,
 	}
-	writeJSONResponse(w, http.StatusOK, response)
+	writeJSONResponse(w, r, http.StatusOK, response)
 }
 
 // IPHandler returns the origin IP address
 func IPHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]string{
-		"origin": getOriginIP(r),
+		"origin": reportedOrigin(r),
 	}
-	writeJSONResponse(w, http.StatusOK, response)
+	writeJSONResponse(w, r, http.StatusOK, response)
 }
 
 // UserAgentHandler returns the User-Agent header
@@ -136,33 +347,79 @@ func UserAgentHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]string{
 		"user-agent": r.Header.Get("User-Agent"),
 	}
-	writeJSONResponse(w, http.StatusOK, response)
+	writeJSONResponse(w, r, http.StatusOK, response)
+}
+
+// DelayResponse is the body returned by /delay: the echoed request plus
+// the delay applied and the configured cap
+type DelayResponse struct {
+	*RequestInfo
+	Delay    string `json:"delay"`
+	MaxDelay string `json:"max_delay"`
 }
 
-// DelayHandler delays the response for a specified number of seconds
+// DelayHandler delays the response by /delay/{delay}, given in seconds
+// (possibly fractional, e.g. 1.5) or as a Go duration such as 750ms, up
+// to the configured maximum. A range such as 100ms-2s picks a uniformly
+// random delay, and ?jitter= spreads the delay by up to ±jitter.
+// ?keepalive= sends newlines or 102 Processing while waiting.
 func DelayHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract delay from path: /delay/{seconds}
-	path := strings.TrimPrefix(r.URL.Path, "/delay/")
-	seconds, err := strconv.Atoi(path)
-	if err != nil || seconds < 0 {
-		writeJSONError(w, http.StatusBadRequest, "Invalid delay value")
+	// Extract delay from path: /delay/{delay}, capped at the maximum
+	limit := settingsFrom(r).maxDelay()
+	src, ok := randomSource(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
 		return
 	}
+	delay, err := parseDelayRange(strings.TrimPrefix(r.URL.Path, "/delay/"), limit, src)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid delay value")
+		return
+	}
+
+	// Spread the delay by up to ±jitter
+	if raw := r.URL.Query().Get("jitter"); raw != "" {
+		jitter, err := parseDelay(raw, limit)
+		if err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid jitter value")
+			return
+		}
+		delay = min(max(delay+randomDuration(src, -jitter, jitter), 0), limit)
+	}
 
-	// Cap delay at 10 seconds
-	if seconds > 10 {
-		seconds = 10
+	k, ok := parseKeepalive(r.URL.Query(), limit)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid keepalive value")
+		return
 	}
+	if k.newlines() {
+		// The first newline commits the headers, so they are set up front
+		contentType, ok := textContentType(r)
+		if !ok {
+			writeJSONError(w, r, http.StatusBadRequest, "Newline keepalives need a JSON, XML or YAML response")
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Add("Vary", "Accept")
+	}
+	kw := newKeepaliveWriter(w, k)
 
-	// Sleep for the specified duration
-	time.Sleep(time.Duration(seconds) * time.Second)
+	// Wait for the delay, giving up if the client goes away
+	if !kw.wait(r, delay) {
+		aborted(kw, r, delay)
+		return
+	}
 
 	// Extract and return request info
 	info, err := extractRequestInfo(r)
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "Failed to read request body")
+		writeBodyError(kw, r, err)
 		return
 	}
 
-	writeJSONResponse(w, http.StatusOK, info)
+	writeJSONResponse(kw, r, http.StatusOK, DelayResponse{
+		RequestInfo: info,
+		Delay:       delay.String(),
+		MaxDelay:    limit.String(),
+	})
 }
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackHandler decodes a MessagePack request body and echoes the
+// decoded structure. The reply is MessagePack, re-encoded from the decoded
+// value so binary strings and integer widths survive, unless ?format= or
+// an Accept header other than */* asks for another format.
+func MsgpackHandler(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" && !bodyIs(r, msgpackFormat) {
+		writeJSONError(w, r, http.StatusUnsupportedMediaType, "Request body must be application/msgpack")
+		return
+	}
+	body, _, err := readBody(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if len(body) == 0 {
+		writeJSONError(w, r, http.StatusBadRequest, "Request body must not be empty")
+		return
+	}
+	var data any
+	if err := msgpack.Unmarshal(body, &data); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid MessagePack body: "+err.Error())
+		return
+	}
+
+	accept := r.Header.Get("Accept")
+	if r.URL.Query().Has(FormatQuery) || (accept != "" && accept != "*/*") {
+		writeJSONResponse(w, r, http.StatusOK, jsonCompatible(data))
+		return
+	}
+	out, err := msgpack.Marshal(data)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to encode MessagePack")
+		return
+	}
+	w.Header().Set("Content-Type", msgpackFormat.contentType)
+	w.Header().Add("Vary", "Accept")
+	w.Write(out)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// nowLayouts are the names ?layout= accepts besides Go layouts
+var nowLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc822":      time.RFC822,
+	"rfc850":      time.RFC850,
+	"ansic":       time.ANSIC,
+	"kitchen":     time.Kitchen,
+	"http":        http.TimeFormat,
+	"datetime":    time.DateTime,
+	"date":        time.DateOnly,
+	"time":        time.TimeOnly,
+}
+
+// NowResponse is the body of /now. RequestDate and SkewSeconds are set
+// when the request has a Date header; a positive skew means the client's
+// clock is ahead.
+type NowResponse struct {
+	RFC3339     string   `json:"rfc3339"`
+	Unix        int64    `json:"unix"`
+	UnixMillis  int64    `json:"unix_ms"`
+	Timezone    string   `json:"timezone"`
+	Formatted   string   `json:"formatted,omitempty"`
+	RequestDate string   `json:"request_date,omitempty"`
+	SkewSeconds *float64 `json:"skew_seconds,omitempty"`
+}
+
+// NowHandler returns the server's time as RFC 3339, Unix seconds and
+// milliseconds, and formatted with ?layout=, either a Go layout such as
+// 2006-01-02 or a name like rfc1123 or http, in the ?tz= time zone (UTC by
+// default). A Date request header is echoed with the client's clock skew,
+// giving clock-sensitive auth tests a reference.
+func NowHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	query := r.URL.Query()
+
+	loc := time.UTC
+	if tz := query.Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Unknown time zone "+tz)
+			return
+		}
+	}
+	local := now.In(loc)
+
+	resp := NowResponse{
+		RFC3339:    local.Format(time.RFC3339Nano),
+		Unix:       now.Unix(),
+		UnixMillis: now.UnixMilli(),
+		Timezone:   loc.String(),
+	}
+	if layout := query.Get("layout"); layout != "" {
+		if named, ok := nowLayouts[strings.ToLower(layout)]; ok {
+			layout = named
+		}
+		resp.Formatted = local.Format(layout)
+	}
+	if date := r.Header.Get("Date"); date != "" {
+		resp.RequestDate = date
+		t, err := http.ParseTime(date)
+		if err != nil {
+			// date -R and many clients write a numeric zone
+			t, err = time.Parse(time.RFC1123Z, date)
+		}
+		if err == nil {
+			skew := t.Sub(now.Truncate(time.Second)).Seconds()
+			resp.SkewSeconds = &skew
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(w, r, http.StatusOK, resp)
+}
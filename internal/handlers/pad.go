@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// PadResponse is the body returned by /pad. SHA256 is the checksum of
+// Padding, so truncation or corruption on the way can be detected.
+type PadResponse struct {
+	Bytes   int    `json:"bytes"`
+	SHA256  string `json:"sha256"`
+	Padding string `json:"padding"`
+}
+
+// PadHandler returns a JSON envelope carrying /pad/{n} bytes of padding,
+// the repeated alphabet as on /range, and its checksum. The envelope is
+// always compact JSON with a Content-Length, so for a given n the size of
+// the response is exact, to probe MTU and buffer boundaries.
+func PadHandler(w http.ResponseWriter, r *http.Request) {
+	n, ok := parseByteCount(r.PathValue("n"))
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Byte count must be between 0 and "+strconv.Itoa(maxStreamBytes))
+		return
+	}
+
+	padding := rangeBody(n)
+	sum := sha256.Sum256(padding)
+	body, _ := json.Marshal(PadResponse{Bytes: n, SHA256: hex.EncodeToString(sum[:]), Padding: string(padding)})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
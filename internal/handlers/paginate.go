@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Pagination defaults and limits
+const (
+	defaultPaginateTotal   = 100
+	defaultPaginatePerPage = 10
+	maxPaginateTotal       = 1_000_000
+	maxPaginatePerPage     = 1000
+)
+
+// PaginateItem is one generated item; item N is always the same
+type PaginateItem struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// PaginateResponse is the body returned by /paginate. Page and Pages are
+// set for page-numbered requests and the cursors for cursor-style ones.
+type PaginateResponse struct {
+	Items      []PaginateItem `json:"items"`
+	Total      int            `json:"total"`
+	PerPage    int            `json:"per_page"`
+	Page       int            `json:"page,omitempty"`
+	Pages      int            `json:"pages,omitempty"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	PrevCursor string         `json:"prev_cursor,omitempty"`
+	Next       string         `json:"next,omitempty"`
+	Prev       string         `json:"prev,omitempty"`
+}
+
+// encodeCursor returns the opaque cursor for an item offset
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the item offset of a cursor
+func decodeCursor(cursor string) (int, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	v, ok := strings.CutPrefix(string(raw), "offset:")
+	if !ok {
+		return 0, false
+	}
+	offset, err := strconv.Atoi(v)
+	return offset, err == nil && offset >= 0
+}
+
+// queryInt reads a positive integer query parameter, capped at limit
+func queryInt(query url.Values, name string, fallback, limit int) (int, bool) {
+	v := query.Get(name)
+	if v == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return min(n, limit), true
+}
+
+// PaginateHandler serves ?total= items (default 100) in pages of
+// ?per_page= (default 10). Pages are numbered with ?page=, from 1, or
+// reached through opaque cursors with ?style=cursor and ?cursor=. Links to
+// the neighbouring pages are given in the body and a Link header, and
+// X-Total-Count reports the total. Items are deterministic, so responses
+// can be cached and compared.
+func PaginateHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	total, ok := queryInt(query, "total", defaultPaginateTotal, maxPaginateTotal)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid total value")
+		return
+	}
+	perPage, ok := queryInt(query, "per_page", defaultPaginatePerPage, maxPaginatePerPage)
+	if !ok || perPage == 0 {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid per_page value")
+		return
+	}
+
+	cursorStyle := query.Get("style") == "cursor" || query.Has("cursor")
+	var offset, page int
+	if cursorStyle {
+		if v := query.Get("cursor"); v != "" {
+			if offset, ok = decodeCursor(v); !ok {
+				writeJSONError(w, r, http.StatusBadRequest, "Invalid cursor")
+				return
+			}
+		}
+	} else {
+		page, ok = queryInt(query, "page", 1, maxPaginateTotal)
+		if !ok || page == 0 {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid page value")
+			return
+		}
+		offset = (page - 1) * perPage
+	}
+
+	response := PaginateResponse{Items: []PaginateItem{}, Total: total, PerPage: perPage}
+	for id := offset + 1; id <= min(offset+perPage, total); id++ {
+		response.Items = append(response.Items, PaginateItem{ID: id, Name: "Item " + strconv.Itoa(id)})
+	}
+
+	// link returns the URL of this request with the given parameters
+	link := func(name, value string) string {
+		q := r.URL.Query()
+		q.Set(name, value)
+		return baseURL(r) + r.URL.Path + "?" + q.Encode()
+	}
+	var links []string
+	addLink := func(rel, href string) {
+		links = append(links, "<"+href+`>; rel="`+rel+`"`)
+	}
+
+	hasNext, hasPrev := offset+perPage < total, offset > 0
+	if cursorStyle {
+		if hasNext {
+			response.NextCursor = encodeCursor(offset + perPage)
+			response.Next = link("cursor", response.NextCursor)
+		}
+		if hasPrev {
+			response.PrevCursor = encodeCursor(max(offset-perPage, 0))
+			response.Prev = link("cursor", response.PrevCursor)
+		}
+	} else {
+		response.Page = page
+		response.Pages = max((total+perPage-1)/perPage, 1)
+		addLink("first", link("page", "1"))
+		if hasNext {
+			response.Next = link("page", strconv.Itoa(page+1))
+		}
+		if hasPrev {
+			// Past the end, the previous page is the last one
+			response.Prev = link("page", strconv.Itoa(min(page-1, response.Pages)))
+		}
+	}
+	if response.Next != "" {
+		addLink("next", response.Next)
+	}
+	if response.Prev != "" {
+		addLink("prev", response.Prev)
+	}
+	if !cursorStyle {
+		addLink("last", link("page", strconv.Itoa(response.Pages)))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	writeJSONResponse(w, r, http.StatusOK, response)
+}
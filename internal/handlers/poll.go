@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+)
+
+// defaultPollTimeout is how long /poll holds a request without ?timeout=
+const defaultPollTimeout = 30 * time.Second
+
+// PollResponse is the body returned by /poll when the event fires
+type PollResponse struct {
+	Event  string `json:"event"`
+	Waited string `json:"waited"`
+}
+
+// PollHandler emulates a long-poll endpoint. The request is held until
+// an event fires after ?event_after= (a delay or a random range such as
+// 1s-5s), answering 200, or until ?timeout= (default 30s) elapses first,
+// answering 204. Both are capped at the configured maximum delay; without
+// ?event_after= every poll times out.
+func PollHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := settingsFrom(r).maxDelay()
+
+	timeout := min(defaultPollTimeout, limit)
+	if v := query.Get("timeout"); v != "" {
+		var err error
+		if timeout, err = parseDelay(v, limit); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid timeout value")
+			return
+		}
+	}
+
+	eventAfter, fires := time.Duration(0), query.Has("event_after")
+	if fires {
+		src, ok := randomSource(r)
+		if !ok {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
+			return
+		}
+		var err error
+		if eventAfter, err = parseDelayRange(query.Get("event_after"), limit, src); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid event_after value")
+			return
+		}
+	}
+
+	if !fires || eventAfter > timeout {
+		if !wait(r.Context(), timeout) {
+			aborted(w, r, timeout)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if !wait(r.Context(), eventAfter) {
+		aborted(w, r, eventAfter)
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, PollResponse{Event: "fired", Waited: eventAfter.String()})
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import "net/http"
+
+// RequestIDHeader carries the request ID reported in problem documents
+const RequestIDHeader = "X-Request-Id"
+
+// Problem is an RFC 7807 problem details document
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// RequestID echoes the request's X-Request-Id, if any
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeProblem writes an application/problem+json error response. The
+// type is about:blank, so the title is the status text as RFC 7807
+// requires.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.RequestURI(),
+		RequestID: r.Header.Get(RequestIDHeader),
+	}
+
+	body, _ := marshalJSON(problem, prettyOutput(r))
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
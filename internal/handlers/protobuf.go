@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	_ "embed"
+	"errors"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// echoProto is the schema of the /protobuf messages
+//
+//go:embed proto/echo.proto
+var echoProto []byte
+
+// protobufContentType is the Content-Type of /protobuf responses
+const protobufContentType = "application/x-protobuf"
+
+// protobufMediaTypes are the request Content-Types accepted as protobuf
+var protobufMediaTypes = []string{protobufContentType, "application/protobuf", "application/vnd.google.protobuf", "application/octet-stream"}
+
+// EchoRequest is the httpbin.v1.EchoRequest message
+type EchoRequest struct {
+	Message  string
+	Metadata map[string]string
+	Payload  []byte
+}
+
+// RequestMetadata is the httpbin.v1.RequestMetadata message
+type RequestMetadata struct {
+	Method   string
+	URL      string
+	Origin   string
+	Headers  map[string]string
+	BodySize int64
+}
+
+// EchoResponse is the httpbin.v1.EchoResponse message
+type EchoResponse struct {
+	Request          EchoRequest
+	Metadata         RequestMetadata
+	ReceivedAtUnixMS int64
+}
+
+// consumeFields calls fn for each varint and length-delimited field of
+// an encoded message, with its value or contents; fields of other wire
+// types are skipped
+func consumeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, varint uint64, bytes []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var (
+			varint uint64
+			bytes  []byte
+		)
+		switch typ {
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, typ, varint, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errWireType reports a known field sent with the wrong wire type
+var errWireType = errors.New("unexpected wire type")
+
+// unmarshalMapEntry decodes a map<string, string> entry
+func unmarshalMapEntry(b []byte) (key, value string, err error) {
+	err = consumeFields(b, func(num protowire.Number, typ protowire.Type, _ uint64, bytes []byte) error {
+		if (num == 1 || num == 2) && typ != protowire.BytesType {
+			return errWireType
+		}
+		switch num {
+		case 1:
+			key = string(bytes)
+		case 2:
+			value = string(bytes)
+		}
+		return nil
+	})
+	return key, value, err
+}
+
+// unmarshalEchoRequest decodes an EchoRequest, ignoring unknown fields
+func unmarshalEchoRequest(b []byte) (EchoRequest, error) {
+	var m EchoRequest
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, _ uint64, bytes []byte) error {
+		if num >= 1 && num <= 3 && typ != protowire.BytesType {
+			return errWireType
+		}
+		switch num {
+		case 1:
+			m.Message = string(bytes)
+		case 2:
+			key, value, err := unmarshalMapEntry(bytes)
+			if err != nil {
+				return err
+			}
+			if m.Metadata == nil {
+				m.Metadata = map[string]string{}
+			}
+			m.Metadata[key] = value
+		case 3:
+			m.Payload = slices.Clone(bytes)
+		}
+		return nil
+	})
+	return m, err
+}
+
+// appendString appends a string field, omitted when empty as in proto3
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// appendBytes appends a bytes or message field
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendInt64 appends an int64 field, omitted when zero as in proto3
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendMap appends a map<string, string> field, in key order so the
+// encoding is deterministic
+func appendMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		entry := appendString(nil, 1, k)
+		entry = appendString(entry, 2, m[k])
+		b = appendBytes(b, num, entry)
+	}
+	return b
+}
+
+// marshal encodes the message
+func (m EchoRequest) marshal() []byte {
+	b := appendString(nil, 1, m.Message)
+	b = appendMap(b, 2, m.Metadata)
+	if len(m.Payload) > 0 {
+		b = appendBytes(b, 3, m.Payload)
+	}
+	return b
+}
+
+// marshal encodes the message
+func (m RequestMetadata) marshal() []byte {
+	b := appendString(nil, 1, m.Method)
+	b = appendString(b, 2, m.URL)
+	b = appendString(b, 3, m.Origin)
+	b = appendMap(b, 4, m.Headers)
+	return appendInt64(b, 5, m.BodySize)
+}
+
+// marshal encodes the message
+func (m EchoResponse) marshal() []byte {
+	b := appendBytes(nil, 1, m.Request.marshal())
+	b = appendBytes(b, 2, m.Metadata.marshal())
+	return appendInt64(b, 3, m.ReceivedAtUnixMS)
+}
+
+// ProtobufHandler decodes an httpbin.v1.EchoRequest from the request body
+// and replies with an EchoResponse embedding it and the request's
+// metadata. The messages are defined by /protobuf/schema.
+func ProtobufHandler(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || !slices.Contains(protobufMediaTypes, mediaType) {
+			writeJSONError(w, r, http.StatusUnsupportedMediaType, "Request body must be "+protobufContentType)
+			return
+		}
+	}
+	body, _, err := readBody(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	request, err := unmarshalEchoRequest(body)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid EchoRequest: "+err.Error())
+		return
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	response := EchoResponse{
+		Request: request,
+		Metadata: RequestMetadata{
+			Method:   r.Method,
+			URL:      r.URL.String(),
+			Origin:   reportedOrigin(r),
+			Headers:  headers,
+			BodySize: int64(len(body)),
+		},
+		ReceivedAtUnixMS: time.Now().UnixMilli(),
+	}
+
+	w.Header().Set("Content-Type", protobufContentType)
+	w.Write(response.marshal())
+}
+
+// ProtobufSchemaHandler serves the .proto definition of the /protobuf
+// messages
+func ProtobufSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(echoProto)
+}
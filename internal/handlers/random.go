@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SeedQuery is the query parameter making a request's random behaviour
+// reproducible, e.g. ?seed=42
+const SeedQuery = "seed"
+
+// seedSequence hands out the per-request seeds derived from the
+// server-wide seed
+type seedSequence struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// nextSeed returns the next per-request seed drawn from the server-wide
+// seed, reporting false if there is none
+func (s *Settings) nextSeed() (int64, bool) {
+	if s.Seed == 0 {
+		return 0, false
+	}
+	s.seeds.mu.Lock()
+	defer s.seeds.mu.Unlock()
+	if s.seeds.rand == nil {
+		s.seeds.rand = rand.New(rand.NewSource(s.Seed))
+	}
+	return s.seeds.rand.Int63(), true
+}
+
+// seededSource returns the generator for a seeded request: seeded with
+// ?seed=, or failing that with the next seed derived from the server-wide
+// one. It returns nil for unseeded requests, and false if ?seed= is
+// invalid.
+func seededSource(r *http.Request) (*rand.Rand, bool) {
+	if v := r.URL.Query().Get(SeedQuery); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		return rand.New(rand.NewSource(seed)), true
+	}
+	if seed, ok := settingsFrom(r).nextSeed(); ok {
+		return rand.New(rand.NewSource(seed)), true
+	}
+	return nil, true
+}
+
+// randomSource returns the generator for a request's random behaviour,
+// seeded as by seededSource or else randomly
+func randomSource(r *http.Request) (*rand.Rand, bool) {
+	src, ok := seededSource(r)
+	if src == nil && ok {
+		src = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return src, ok
+}
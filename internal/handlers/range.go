@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxRanges bounds the ranges served from one Range header; longer lists
+// are ignored and the whole body is sent
+const maxRanges = 100
+
+// errUnsatisfiable reports a Range header none of whose ranges overlap the
+// body
+var errUnsatisfiable = errors.New("range not satisfiable")
+
+// byteRange is an inclusive span of the body
+type byteRange struct {
+	start, end int
+}
+
+func (br byteRange) length() int {
+	return br.end - br.start + 1
+}
+
+// contentRange returns the Content-Range of the span; wrong claims one
+// byte more than is sent
+func (br byteRange) contentRange(size int, wrong bool) string {
+	end := br.end
+	if wrong {
+		end++
+	}
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, end, size)
+}
+
+// rangeModes are the deliberate misbehaviours of /range, selected with
+// ?mode=
+var rangeModes = []string{"unsatisfiable", "ignore", "wrong-content-range"}
+
+// parseRanges parses a Range header for a body of size bytes. It returns
+// no ranges, and no error, for headers to be ignored: missing, malformed,
+// not in bytes, or asking for more than the whole body.
+func parseRanges(header string, size int) ([]byteRange, error) {
+	specs, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	total, satisfiable := 0, false
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, nil
+		}
+
+		var br byteRange
+		if first == "" {
+			// A suffix: the last n bytes
+			n, err := strconv.Atoi(last)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 {
+				continue
+			}
+			br = byteRange{max(size-n, 0), size - 1}
+		} else {
+			start, err := strconv.Atoi(first)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				if end, err = strconv.Atoi(last); err != nil || end < start {
+					return nil, nil
+				}
+				end = min(end, size-1)
+			}
+			if start >= size {
+				continue
+			}
+			br = byteRange{start, end}
+		}
+		satisfiable = true
+		ranges = append(ranges, br)
+		total += br.length()
+	}
+
+	if !satisfiable {
+		return nil, errUnsatisfiable
+	}
+	if len(ranges) > maxRanges || total > size {
+		// Overlapping or excessive ranges cost more than the whole body
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// rangeBody returns the deterministic body of /range/{n}: the alphabet,
+// repeated
+func rangeBody(n int) []byte {
+	body := make([]byte, n)
+	for i := range body {
+		body[i] = 'a' + byte(i%26)
+	}
+	return body
+}
+
+// RangeHandler serves /range/{n}, n bytes of the repeated alphabet, and
+// honours Range requests: one range gets a 206 with Content-Range,
+// several get a multipart/byteranges body, and none that overlap the body
+// get a 416. An If-Range that does not match the ETag sends the whole
+// body. ?mode= probes client robustness: unsatisfiable always answers
+// 416, ignore disregards the Range header, and wrong-content-range claims
+// one byte more than each range sends.
+func RangeHandler(w http.ResponseWriter, r *http.Request) {
+	n, ok := parseByteCount(r.PathValue("n"))
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Byte count must be between 0 and "+strconv.Itoa(maxStreamBytes))
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && !slices.Contains(rangeModes, mode) {
+		writeJSONError(w, r, http.StatusBadRequest, fmt.Sprintf("mode must be one of %v", rangeModes))
+		return
+	}
+	wrong := mode == "wrong-content-range"
+	body := rangeBody(n)
+	etag := fmt.Sprintf(`"range-%d"`, n)
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", etag)
+	header := r.Header.Get("Range")
+	if ifRange := r.Header.Get("If-Range"); (ifRange != "" && ifRange != etag) || mode == "ignore" {
+		header = ""
+	}
+
+	ranges, err := parseRanges(header, n)
+	if mode == "unsatisfiable" {
+		err = errUnsatisfiable
+	}
+	switch {
+	case err != nil:
+		w.Header().Set("Content-Range", "bytes */"+strconv.Itoa(n))
+		writeJSONError(w, r, http.StatusRequestedRangeNotSatisfiable, "Range not satisfiable")
+	case len(ranges) == 0:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(n))
+		w.Write(body)
+	case len(ranges) == 1:
+		br := ranges[0]
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Range", br.contentRange(n, wrong))
+		w.Header().Set("Content-Length", strconv.Itoa(br.length()))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body[br.start : br.end+1])
+	default:
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, br := range ranges {
+			part, _ := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":  {"application/octet-stream"},
+				"Content-Range": {br.contentRange(n, wrong)},
+			})
+			part.Write(body[br.start : br.end+1])
+		}
+		mw.Close()
+
+		w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxQuotaWindow caps /rate-limited windows; older windows have expired
+// and can be dropped
+const maxQuotaWindow = time.Hour
+
+// quotaWindow is one key's fixed window in /rate-limited
+type quotaWindow struct {
+	start time.Time
+	count int
+}
+
+// QuotaResponse is the body returned by /rate-limited
+type QuotaResponse struct {
+	Key       string `json:"key"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Reset     int64  `json:"reset"`
+	Allowed   bool   `json:"allowed"`
+}
+
+// RateLimited serves /rate-limited, emulating an upstream that allows
+// ?limit= requests (default 5) per ?window= (default 10s) for each key
+type RateLimited struct {
+	mu      sync.Mutex
+	windows map[string]*quotaWindow
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewRateLimited creates a RateLimited handler with no windows
+func NewRateLimited() *RateLimited {
+	return &RateLimited{windows: make(map[string]*quotaWindow), now: time.Now}
+}
+
+// Handler counts the request against its window and answers 200, or 429
+// once the quota is used up. Responses carry X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset (Unix time); 429s also carry
+// Retry-After. Keys default to the origin IP unless ?key= is given.
+func (rl *RateLimited) Handler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := 5
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	window := 10 * time.Second
+	if v := query.Get("window"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			secs, serr := strconv.Atoi(v)
+			parsed, err = time.Duration(secs)*time.Second, serr
+		}
+		if err != nil || parsed < time.Second || parsed > maxQuotaWindow {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid window; expected a duration between 1s and 1h")
+			return
+		}
+		window = parsed
+	}
+
+	key := query.Get("key")
+	if key == "" {
+		key = getOriginIP(r)
+	}
+
+	count, reset := rl.hit(fmt.Sprintf("%s|%d/%s", key, limit, window), window)
+	resp := QuotaResponse{
+		Key:       key,
+		Limit:     limit,
+		Remaining: max(limit-count, 0),
+		Reset:     reset.Unix(),
+		Allowed:   count <= limit,
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(resp.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(resp.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(resp.Reset, 10))
+
+	if !resp.Allowed {
+		retry := int(reset.Sub(rl.now()).Seconds() + 0.999)
+		w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+		writeJSONResponse(w, r, http.StatusTooManyRequests, resp)
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, resp)
+}
+
+// hit counts a request in key's current window, returning the count so
+// far and when the window ends
+func (rl *RateLimited) hit(key string, window time.Duration) (int, time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	if now.Sub(rl.swept) > time.Minute {
+		rl.swept = now
+		for k, qw := range rl.windows {
+			if now.Sub(qw.start) > maxQuotaWindow {
+				delete(rl.windows, k)
+			}
+		}
+	}
+
+	qw, ok := rl.windows[key]
+	if !ok || now.Sub(qw.start) >= window {
+		qw = &quotaWindow{start: now}
+		rl.windows[key] = qw
+	}
+	qw.count++
+	return qw.count, qw.start.Add(window)
+}
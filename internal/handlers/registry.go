@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Route is a single endpoint served by a group
+type Route struct {
+	// Pattern is the http.ServeMux pattern, e.g. "/status/"
+	Pattern string
+	// Path is the OpenAPI path template, e.g. "/status/{codes}"; it
+	// defaults to Pattern
+	Path string
+	// Methods lists the accepted methods; empty means any
+	Methods []string
+	// Description is a short, human-readable summary
+	Description string
+	// Example is a sample request path, e.g. "/status/418"; it defaults
+	// to Pattern
+	Example string
+	Handler http.Handler
+}
+
+// AdminPath reports whether path belongs to the admin or debug endpoints,
+// which middleware recording or faulting traffic leaves alone
+func AdminPath(path string) bool {
+	return strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/debug/")
+}
+
+// RouteEnv carries what route setup functions need from the server
+type RouteEnv struct {
+	Build BuildInfo
+	// Catalog returns every group being served, including the caller's;
+	// it is only valid once setup has finished, i.e. from handlers
+	Catalog func() []GroupRoutes
+	// Webhooks stores webhook deliveries so the embedding server can
+	// expose replays; a private store is used if nil
+	Webhooks *Webhooks
+}
+
+// Group is a family of endpoints that can be disabled as a whole
+type Group struct {
+	Name        string
+	Description string
+	// Setup builds the group's routes; it is called once per server, so
+	// stateful handlers are not shared between servers
+	Setup func(env RouteEnv) []Route
+}
+
+// ExamplePath returns the sample request path of the route
+func (r Route) ExamplePath() string {
+	if r.Example != "" {
+		return r.Example
+	}
+	return r.Pattern
+}
+
+// PathTemplate returns the OpenAPI path template of the route
+func (r Route) PathTemplate() string {
+	if r.Path != "" {
+		return r.Path
+	}
+	return r.Pattern
+}
+
+// GroupRoutes is a group with its routes built
+type GroupRoutes struct {
+	Name        string
+	Description string
+	Routes      []Route
+}
+
+// Registry holds endpoint groups in registration order
+type Registry struct {
+	mu     sync.RWMutex
+	groups []Group
+}
+
+// DefaultRegistry holds the built-in endpoint groups
+var DefaultRegistry = &Registry{}
+
+// Register adds a group to the default registry
+func Register(g Group) {
+	DefaultRegistry.Register(g)
+}
+
+// Register adds a group; it panics if the name is already taken, as that
+// is a programming error
+func (reg *Registry) Register(g Group) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if slices.ContainsFunc(reg.groups, func(existing Group) bool { return existing.Name == g.Name }) {
+		panic(fmt.Sprintf("handlers: endpoint group %q registered twice", g.Name))
+	}
+	reg.groups = append(reg.groups, g)
+}
+
+// Names returns the registered group names
+func (reg *Registry) Names() []string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	names := make([]string, len(reg.groups))
+	for i, g := range reg.groups {
+		names[i] = g.Name
+	}
+	return names
+}
+
+// Routes builds the routes of every group for which enabled returns true.
+// GET routes also answer HEAD, with the headers of the equivalent GET.
+func (reg *Registry) Routes(env RouteEnv, enabled func(name string) bool) []GroupRoutes {
+	reg.mu.RLock()
+	groups := slices.Clone(reg.groups)
+	reg.mu.RUnlock()
+
+	var built []GroupRoutes
+	for _, g := range groups {
+		if enabled != nil && !enabled(g.Name) {
+			continue
+		}
+		routes := g.Setup(env)
+		for i := range routes {
+			routes[i] = withAutoHead(routes[i])
+		}
+		built = append(built, GroupRoutes{
+			Name:        g.Name,
+			Description: g.Description,
+			Routes:      routes,
+		})
+	}
+	return built
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import "net/http"
+
+// ReloadHandler returns an admin handler that triggers a configuration
+// reload via reload; only POST is accepted
+func ReloadHandler(reload func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		if reload == nil {
+			writeJSONError(w, r, http.StatusNotImplemented, "Configuration reload is not available")
+			return
+		}
+
+		if err := reload(); err != nil {
+			writeJSONError(w, r, http.StatusInternalServerError, "Reload failed: "+err.Error())
+			return
+		}
+
+		writeJSONResponse(w, r, http.StatusOK, map[string]bool{"reloaded": true})
+	}
+}
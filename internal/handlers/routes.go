@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Built-in endpoint group names
+const (
+	GroupMethods    = "methods"
+	GroupInspection = "inspection"
+	GroupDelay      = "delay"
+	GroupStream     = "stream"
+	GroupStatus     = "status"
+	GroupAuth       = "auth"
+	GroupFaults     = "faults"
+	GroupDocs       = "docs"
+	GroupProtocol   = "protocol"
+	GroupBins       = "bins"
+	GroupMocks      = "mocks"
+	GroupCaching    = "caching"
+	GroupFormats    = "formats"
+	GroupUtilities  = "utilities"
+)
+
+func init() {
+	Register(Group{
+		Name:        GroupMethods,
+		Description: "Echo the request for each HTTP method",
+		Setup: func(RouteEnv) []Route {
+			var routes []Route
+			for _, m := range []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"} {
+				routes = append(routes, Route{
+					Pattern:     "/" + strings.ToLower(m),
+					Methods:     []string{m},
+					Description: "Returns the " + m + " request's method, headers, query, body and origin",
+					Handler:     MethodHandler(m),
+				})
+			}
+			return routes
+		},
+	})
+
+	Register(Group{
+		Name:        GroupInspection,
+		Description: "Inspect the request and the server",
+		Setup: func(env RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/headers", Description: "Returns the request headers", Handler: http.HandlerFunc(HeadersHandler)},
+				{Pattern: "/ip", Description: "Returns the origin IP address", Handler: http.HandlerFunc(IPHandler)},
+				{Pattern: "/user-agent", Description: "Returns the User-Agent header", Handler: http.HandlerFunc(UserAgentHandler)},
+				{Pattern: "/version", Description: "Returns the server version and build information", Handler: VersionHandler(env.Build)},
+				{Pattern: "/hostname", Description: "Returns the hostname, pod IP and listen address of the instance serving the request", Handler: http.HandlerFunc(HostnameHandler)},
+				{Pattern: "/env", Description: "Returns the environment variables with an allowed prefix, HTTPBIN_, POD_ and NODE_ by default", Handler: http.HandlerFunc(EnvHandler)},
+				{Pattern: "/k8s", Description: "Returns the pod's namespace, name, node, service account, labels and annotations from the downward API", Handler: http.HandlerFunc(K8sHandler)},
+				{Pattern: "/dump", Description: "Returns the raw request line, headers and body as text/plain", Handler: http.HandlerFunc(DumpHandler)},
+				{Pattern: "/cors-echo", Description: "Reports the CORS decision made for the request", Handler: http.HandlerFunc(CORSEchoHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupFormats,
+		Description: "Echo and convert serialisation formats",
+		Setup: func(RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/msgpack", Methods: []string{"POST", "PUT", "PATCH"}, Description: "Decodes a MessagePack body and echoes it as MessagePack, or in the format asked for", Handler: http.HandlerFunc(MsgpackHandler)},
+				{Pattern: "/protobuf", Methods: []string{"POST", "PUT"}, Description: "Decodes an httpbin.v1.EchoRequest and replies with an EchoResponse embedding the request metadata", Handler: http.HandlerFunc(ProtobufHandler)},
+				{Pattern: "/protobuf/schema", Methods: []string{"GET"}, Description: "Returns the .proto definition of the /protobuf messages", Handler: http.HandlerFunc(ProtobufSchemaHandler)},
+				{Pattern: "/convert/xml-json", Methods: []string{"POST", "PUT"}, Description: "Converts the posted XML document to JSON", Handler: http.HandlerFunc(XMLToJSONHandler)},
+				{Pattern: "/convert/json-xml", Methods: []string{"POST", "PUT"}, Description: "Converts the posted JSON document to XML", Handler: http.HandlerFunc(JSONToXMLHandler)},
+				{Pattern: "/validate", Methods: []string{"POST", "PUT"}, Description: "Validates a JSON document against a preloaded or posted JSON Schema and lists every error", Handler: http.HandlerFunc(ValidateHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupUtilities,
+		Description: "Hash, sign, encode and generate data",
+		Setup: func(RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/hash/{algo}", Methods: []string{"POST", "PUT", "PATCH"}, Description: "Returns the md5, sha1, sha256 or sha512 digest of the request body as received", Example: "/hash/sha256", Handler: http.HandlerFunc(HashHandler)},
+				{Pattern: "/hmac/{algo}", Description: "Signs ?message= or the request body with the X-HMAC-Key header or ?key= and returns the signature in several encodings", Example: "/hmac/sha256?key=secret&message=hello", Handler: http.HandlerFunc(HMACHandler)},
+				{Pattern: "/encode/base64", Description: "Base64-encodes ?value= or the request body", Example: "/encode/base64?value=hello", Handler: http.HandlerFunc(EncodeBase64Handler)},
+				{Pattern: "/decode/base64", Description: "Decodes base64 ?value= or request body, in either alphabet", Example: "/decode/base64?value=aGVsbG8", Handler: http.HandlerFunc(DecodeBase64Handler)},
+				{Pattern: "/encode/url", Description: "Percent-encodes ?value= or the request body", Example: "/encode/url?value=a%20b%26c", Handler: http.HandlerFunc(EncodeURLHandler)},
+				{Pattern: "/decode/url", Description: "Decodes percent-encoded ?value= or request body", Example: "/decode/url?value=a%2Bb%2526c", Handler: http.HandlerFunc(DecodeURLHandler)},
+				{Pattern: "/uuid", Description: "Returns a version 4, 1 or 7 UUID, or ?count= of them", Example: "/uuid?version=7&count=3", Handler: http.HandlerFunc(UUIDHandler)},
+				{Pattern: "/now", Description: "Returns the server's time in several forms, and the clock skew of a Date request header", Example: "/now?layout=rfc1123&tz=Europe/London", Handler: http.HandlerFunc(NowHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupDelay,
+		Description: "Delay responses",
+		Setup: func(RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/delay/", Path: "/delay/{delay}", Example: "/delay/750ms", Description: "Delays the response by /delay/{delay}, in seconds, as a duration or as a random range, up to the configured maximum", Handler: http.HandlerFunc(DelayHandler)},
+				{Pattern: "/poll", Example: "/poll?timeout=30s&event_after=5s", Description: "Holds a long poll until an event fires after ?event_after= (200) or ?timeout= elapses (204)", Handler: http.HandlerFunc(PollHandler)},
+				{Pattern: "/sleep-until", Example: "/sleep-until?t=2030-01-01T00:00:00Z", Description: "Holds the response until the wall-clock time ?t=, an RFC 3339 time or Unix timestamp, within the configured maximum delay", Handler: http.HandlerFunc(SleepUntilHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupStream,
+		Description: "Stream request and response bodies slowly",
+		Setup: func(RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/bytes/", Path: "/bytes/{n}", Example: "/bytes/1024?rate=8kbps", Description: "Returns {n} random bytes, reproducible with ?seed= and paced by ?rate=", Handler: http.HandlerFunc(BytesHandler)},
+				{Pattern: "/stream-bytes/", Path: "/stream-bytes/{n}", Example: "/stream-bytes/1024?chunk_size=128", Description: "Streams {n} random bytes in ?chunk_size= chunks, reproducible with ?seed= and paced by ?rate=", Handler: http.HandlerFunc(StreamBytesHandler)},
+				{Pattern: "/range/{n}", Methods: []string{"GET", "HEAD"}, Example: "/range/1024", Description: "Returns {n} bytes of the repeated alphabet, honouring single and multiple Range requests", Handler: http.HandlerFunc(RangeHandler)},
+				{Pattern: "/large/{size}", Methods: []string{"GET"}, Example: "/large/100MB", Description: "Streams {size} bytes of a deterministic pattern with an exact Content-Length", Handler: http.HandlerFunc(LargeHandler)},
+				{Pattern: "/pad/{n}", Methods: []string{"GET"}, Example: "/pad/1400", Description: "Returns a JSON envelope with {n} bytes of padding and its checksum, at an exact size", Handler: http.HandlerFunc(PadHandler)},
+				{Pattern: "/stream-post", Methods: []string{"POST", "PUT"}, Example: "/stream-post", Description: "Reads an NDJSON body as it arrives, streaming back an acknowledgement per line and a summary", Handler: http.HandlerFunc(StreamPostHandler)},
+				{Pattern: "/slow-read", Methods: []string{"POST", "PUT", "PATCH"}, Example: "/slow-read?rate=1KB/s&stall_after=4096", Description: "Reads the request body at ?rate=, stalling for ?stall= after ?stall_after= bytes", Handler: http.HandlerFunc(SlowReadHandler)},
+				{Pattern: "/drip", Example: "/drip?duration=2s&numbytes=10&delay=1s", Description: "Drips ?numbytes= bytes over ?duration= after ?delay=, with optional ?keepalive= and ?rate=", Handler: http.HandlerFunc(DripHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupStatus,
+		Description: "Return chosen status codes",
+		Setup: func(RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/status/", Path: "/status/{codes}", Example: "/status/418", Description: "Returns /status/{codes}, optionally weighted and delayed", Handler: http.HandlerFunc(StatusHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupCaching,
+		Description: "Exercise HTTP caches",
+		Setup: func(RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/cache-control", Methods: []string{"GET"}, Description: "Sets Cache-Control from the query, e.g. ?max-age=60&public, and stamps the generation time", Example: "/cache-control?max-age=60&s-maxage=300&stale-while-revalidate=30&public", Handler: http.HandlerFunc(CacheControlHandler)},
+				{Pattern: "/vary", Methods: []string{"GET"}, Description: "Echoes the request headers named in ?headers= and lists them in Vary", Example: "/vary?headers=Accept-Language,X-Tenant", Handler: http.HandlerFunc(VaryHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupAuth,
+		Description: "Authentication challenges",
+		Setup: func(RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/basic-auth/", Path: "/basic-auth/{user}/{passwd}", Example: "/basic-auth/user/passwd", Description: "Requires Basic auth for /basic-auth/{user}/{passwd}", Handler: http.HandlerFunc(BasicAuthHandler)},
+				{Pattern: "/bearer", Description: "Requires a bearer token", Handler: http.HandlerFunc(BearerHandler)},
+				{Pattern: "/digest-auth/", Path: "/digest-auth/{qop}/{user}/{passwd}", Example: "/digest-auth/auth/user/passwd", Description: "Requires Digest auth for /digest-auth/{qop}/{user}/{passwd}", Handler: http.HandlerFunc(DigestAuthHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupFaults,
+		Description: "Simulate unreliable upstreams",
+		Setup: func(RouteEnv) []Route {
+			flaky := NewFlaky()
+			return []Route{
+				{Pattern: "/flaky", Example: "/flaky?rate=0.3", Description: "Fails ?rate= of requests with ?status=", Handler: http.HandlerFunc(flaky.Handler)},
+				{Pattern: "/flaky/stats", Methods: []string{"GET", "DELETE"}, Description: "Reports or resets the /flaky counters", Handler: http.HandlerFunc(flaky.StatsHandler)},
+				{Pattern: "/unstable/", Path: "/unstable/{failures}/{successes}", Example: "/unstable/2/3", Description: "Fails the first {failures} requests per client, then succeeds for {successes}", Handler: http.HandlerFunc(NewUnstable().Handler)},
+				{Pattern: "/close", Example: "/close?mode=body", Description: "Closes the connection without a response, or after part of the ?mode=headers, body or chunked response", Handler: http.HandlerFunc(CloseHandler)},
+				{Pattern: "/reset", Example: "/reset?mode=headers", Description: "Like /close, but resets the connection with a TCP RST", Handler: http.HandlerFunc(ResetHandler)},
+				{Pattern: "/malformed", Example: "/malformed?mode=chunk-size", Description: "Sends an invalid response: ?mode=chunk-size, content-length, header-bytes or duplicate-headers", Handler: http.HandlerFunc(MalformedHandler)},
+				{Pattern: "/garbage/", Path: "/garbage/{n}", Example: "/garbage/64", Description: "Sends {n} random bytes instead of an HTTP response, then closes the connection", Handler: http.HandlerFunc(GarbageHandler)},
+				{Pattern: "/rate-limited", Example: "/rate-limited?limit=2&window=30s", Description: "Emulates an upstream quota of ?limit= requests per ?window=", Handler: http.HandlerFunc(NewRateLimited().Handler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupProtocol,
+		Description: "Exercise HTTP protocol features",
+		Setup: func(RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/trailers", Description: "Reports request trailers and sends a body checksum and ?trailer=Name:value as response trailers", Example: "/trailers?trailer=X-Status:done", Handler: http.HandlerFunc(TrailersHandler)},
+				{Pattern: "/ws", Methods: []string{"GET"}, Description: "Echoes WebSocket messages, with optional ?ping=, ?max_message=, ?close_after=, ?close_code= and ?fragment=", Example: "/ws?ping=5s&fragment=16", Handler: http.HandlerFunc(WebSocketHandler)},
+				{Pattern: "/expect-100", Methods: []string{"POST", "PUT"}, Description: "Sends 100 Continue immediately, after ?delay=, or rejects with 417 if ?reject=1", Example: "/expect-100?delay=1s", Handler: http.HandlerFunc(ExpectHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupBins,
+		Description: "Capture requests for later inspection",
+		Setup: func(env RouteEnv) []Route {
+			bins := NewBins()
+			webhooks := env.Webhooks
+			if webhooks == nil {
+				webhooks = NewWebhooks()
+			}
+			return []Route{
+				{Pattern: "/bins", Methods: []string{"POST"}, Description: "Creates a bin that captures every request to its URL", Handler: http.HandlerFunc(bins.CreateHandler)},
+				{Pattern: "/bins/{id}", Methods: []string{"DELETE"}, Description: "Deletes a bin and its captured requests", Example: "/bins/0123456789abcdef", Handler: http.HandlerFunc(bins.DeleteHandler)},
+				{Pattern: "/bins/{id}/requests", Methods: []string{"GET", "DELETE"}, Description: "Lists or clears the requests captured by a bin", Example: "/bins/0123456789abcdef/requests", Handler: http.HandlerFunc(bins.RequestsHandler)},
+				{Pattern: "/bin/{id}", Description: "Captures the request in the bin", Example: "/bin/0123456789abcdef", Handler: http.HandlerFunc(bins.CaptureHandler)},
+				{Pattern: "/bin/{id}/{path...}", Path: "/bin/{id}/{path}", Description: "Captures the request, at any path, in the bin", Example: "/bin/0123456789abcdef/callback", Handler: http.HandlerFunc(bins.CaptureHandler)},
+				{Pattern: "/webhook", Methods: []string{"POST", "PUT", "PATCH"}, Description: "Records a webhook delivery, with its signature header", Handler: http.HandlerFunc(webhooks.ReceiveHandler)},
+				{Pattern: "/webhook/{path...}", Path: "/webhook/{path}", Methods: []string{"POST", "PUT", "PATCH"}, Description: "Records a webhook delivery at any path", Example: "/webhook/github?signature_header=X-Hub-Signature-256", Handler: http.HandlerFunc(webhooks.ReceiveHandler)},
+				{Pattern: "/webhooks", Methods: []string{"GET", "DELETE"}, Description: "Lists or clears the recorded webhook deliveries", Handler: http.HandlerFunc(webhooks.DeliveriesHandler)},
+				{Pattern: "/webhooks/{id}", Description: "Returns a recorded webhook delivery", Example: "/webhooks/1", Handler: http.HandlerFunc(webhooks.DeliveryHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupMocks,
+		Description: "Serve mock responses from templates and generated data",
+		Setup: func(env RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/template/{name}", Description: "Renders the named template from the templates directory with the request's fields", Example: "/template/user?id=42", Handler: http.HandlerFunc(TemplateHandler)},
+				{Pattern: "/template/{name}/{path...}", Path: "/template/{name}/{path}", Description: "Renders the named template, with the rest of the path as .Path and .Segments", Example: "/template/user/42", Handler: http.HandlerFunc(TemplateHandler)},
+				{Pattern: "/csv", Methods: []string{"GET"}, Description: "Returns ?rows= rows of ?cols= generated columns as text/csv, reproducible with ?seed= and downloadable with ?filename=", Example: "/csv?rows=100&cols=6&seed=1", Handler: http.HandlerFunc(CSVHandler)},
+				{Pattern: "/paginate", Methods: []string{"GET"}, Description: "Pages through ?total= generated items by ?page= and ?per_page=, or by cursor with ?style=cursor, with Link headers", Example: "/paginate?total=1000&page=2&per_page=20", Handler: http.HandlerFunc(PaginateHandler)},
+				{Pattern: "/metadata/aws/{path...}", Path: "/metadata/aws/{path}", Description: "Emulates the EC2 instance metadata service, with IMDSv2 tokens, when the metadata mock is enabled", Example: "/metadata/aws/latest/meta-data/instance-id", Handler: http.HandlerFunc(AWSMetadataHandler)},
+				{Pattern: "/metadata/gcp/{path...}", Path: "/metadata/gcp/{path}", Description: "Emulates the Compute Engine metadata server when the metadata mock is enabled", Example: "/metadata/gcp/computeMetadata/v1/project/project-id", Handler: http.HandlerFunc(GCPMetadataHandler)},
+			}
+		},
+	})
+
+	Register(Group{
+		Name:        GroupDocs,
+		Description: "Discover the available endpoints",
+		Setup: func(env RouteEnv) []Route {
+			return []Route{
+				{Pattern: "/{$}", Path: "/", Methods: []string{"GET"}, Description: "Lists the served endpoints as an HTML page", Example: "/", Handler: IndexHandler(env.Catalog)},
+				{Pattern: "/spec.json", Methods: []string{"GET"}, Description: "Returns the OpenAPI 3 specification as JSON", Handler: SpecHandler(env.Build, env.Catalog, SpecJSON)},
+				{Pattern: "/spec.yaml", Methods: []string{"GET"}, Description: "Returns the OpenAPI 3 specification as YAML", Handler: SpecHandler(env.Build, env.Catalog, SpecYAML)},
+				{Pattern: "/docs", Methods: []string{"GET"}, Description: "Explore the endpoints interactively with Swagger UI", Handler: http.HandlerFunc(DocsHandler)},
+				{Pattern: "/docs/", Path: "/docs/{asset}", Methods: []string{"GET", "HEAD"}, Description: "Serves the Swagger UI scripts and styles", Example: "/docs/swagger-ui.css", Handler: DocsAssetsHandler()},
+				{Pattern: "/endpoints", Methods: []string{"GET"}, Description: "Lists the served endpoints with their methods and descriptions", Handler: EndpointsHandler(env.Catalog)},
+			}
+		},
+	})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// DefaultMaxDelay is the longest /delay served unless configured otherwise
+const DefaultMaxDelay = 10 * time.Second
+
+// DefaultTrustedProxies are the networks whose forwarding headers are
+// honoured by default: loopback only, since in containers every client
+// is a private-range peer. Ingress networks have to be trusted explicitly.
+var DefaultTrustedProxies = []string{
+	"127.0.0.0/8",
+	"::1/128",
+}
+
+// Settings holds server-wide handler configuration. The server attaches
+// it to each request context; handlers called without it use
+// DefaultSettings.
+type Settings struct {
+	// TrustedProxies lists peers allowed to set X-Forwarded-For/X-Real-IP
+	TrustedProxies []netip.Prefix
+	// ProblemDetails makes errors RFC 7807 application/problem+json
+	// documents instead of {"error": ...}
+	ProblemDetails bool
+	// PrettyJSON indents JSON and XML responses unless a request
+	// overrides it with ?pretty=
+	PrettyJSON bool
+	// OriginChain reports the whole X-Forwarded-For chain plus the direct
+	// peer as the origin, unless a request overrides it with ?origin_chain=
+	OriginChain bool
+	// MaxDelay caps /delay; zero means DefaultMaxDelay
+	MaxDelay time.Duration
+	// TemplatesDir holds the templates served by /template/{name}; empty
+	// disables them
+	TemplatesDir string
+	// EnvPrefixes are the prefixes of the environment variables /env
+	// reveals; empty reveals none
+	EnvPrefixes []string
+	// MetadataMock serves the fake cloud instance metadata below
+	// /metadata; it is off by default
+	MetadataMock bool
+	// PodInfoDir holds the downward-API labels and annotations files read
+	// by /k8s; empty skips them
+	PodInfoDir string
+	// SchemasDir holds the JSON Schemas /validate can name; empty allows
+	// only schemas sent with the request
+	SchemasDir string
+	// Seed, if non-zero, makes random behaviour reproducible: requests
+	// without ?seed= are seeded, in turn, from a sequence derived from it
+	Seed int64
+
+	seeds seedSequence
+}
+
+// DefaultSettings returns the settings used when none are configured
+func DefaultSettings() *Settings {
+	s := &Settings{EnvPrefixes: DefaultEnvPrefixes, PodInfoDir: DefaultPodInfoDir}
+	for _, cidr := range DefaultTrustedProxies {
+		s.TrustedProxies = append(s.TrustedProxies, netip.MustParsePrefix(cidr))
+	}
+	return s
+}
+
+// defaultSettings is shared by requests without attached settings
+var defaultSettings = DefaultSettings()
+
+// settingsKey is the context key for Settings
+type settingsKey struct{}
+
+// WithSettings returns a copy of ctx carrying settings
+func WithSettings(ctx context.Context, settings *Settings) context.Context {
+	return context.WithValue(ctx, settingsKey{}, settings)
+}
+
+// HasSettings reports whether ctx carries settings
+func HasSettings(ctx context.Context) bool {
+	s, ok := ctx.Value(settingsKey{}).(*Settings)
+	return ok && s != nil
+}
+
+// settingsFrom returns the settings attached to the request
+func settingsFrom(r *http.Request) *Settings {
+	if s, ok := r.Context().Value(settingsKey{}).(*Settings); ok && s != nil {
+		return s
+	}
+	return defaultSettings
+}
+
+// maxDelay returns the cap applied to /delay
+func (s *Settings) maxDelay() time.Duration {
+	if s.MaxDelay > 0 {
+		return s.MaxDelay
+	}
+	return DefaultMaxDelay
+}
+
+// trusted reports whether addr belongs to a trusted proxy
+func (s *Settings) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range s.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
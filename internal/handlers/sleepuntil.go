@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// epochMillisThreshold separates Unix seconds from milliseconds in
+// /sleep-until: as seconds it would be the year 5138
+const epochMillisThreshold = 1e11
+
+// SleepUntilResponse is the body returned by /sleep-until once the target
+// time is reached
+type SleepUntilResponse struct {
+	Target string `json:"target"`
+	Now    string `json:"now"`
+	Waited string `json:"waited"`
+	// Late is set when the target time had already passed
+	Late bool `json:"late"`
+}
+
+// parseWallClock accepts an RFC 3339 time or a Unix timestamp in seconds,
+// possibly fractional, or in milliseconds
+func parseWallClock(raw string) (time.Time, error) {
+	if n, err := strconv.ParseFloat(raw, 64); err == nil {
+		if n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+			return time.Time{}, strconv.ErrRange
+		}
+		if n >= epochMillisThreshold {
+			n /= 1e3
+		}
+		if n >= epochMillisThreshold {
+			return time.Time{}, strconv.ErrRange
+		}
+		secs, frac := math.Modf(n)
+		return time.Unix(int64(secs), int64(frac*1e9)), nil
+	}
+	if raw == "" {
+		return time.Time{}, errors.New("missing time")
+	}
+	return time.Parse(time.RFC3339Nano, raw)
+}
+
+// SleepUntilHandler holds the response until the wall-clock time ?t=, an
+// RFC 3339 time or a Unix timestamp in seconds or milliseconds, so several
+// clients can be released at the same instant. Times already past answer
+// at once; times further ahead than the configured maximum delay are
+// rejected rather than cut short, as waking early would defeat the
+// coordination.
+func SleepUntilHandler(w http.ResponseWriter, r *http.Request) {
+	target, err := parseWallClock(r.URL.Query().Get("t"))
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid t: use an RFC 3339 time or a Unix timestamp")
+		return
+	}
+	limit := settingsFrom(r).maxDelay()
+	start := time.Now()
+	delay := target.Sub(start)
+	if delay > limit {
+		writeJSONError(w, r, http.StatusBadRequest, "t is more than the maximum delay of "+limit.String()+" away")
+		return
+	}
+
+	if !wait(r.Context(), delay) {
+		aborted(w, r, delay)
+		return
+	}
+	now := time.Now()
+	writeJSONResponse(w, r, http.StatusOK, SleepUntilResponse{
+		Target: target.UTC().Format(time.RFC3339Nano),
+		Now:    now.UTC().Format(time.RFC3339Nano),
+		Waited: now.Sub(start).Round(time.Millisecond).String(),
+		Late:   delay < 0,
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SlowReadResponse is the body returned by /slow-read
+type SlowReadResponse struct {
+	BytesRead int64  `json:"bytes_read"`
+	Elapsed   string `json:"elapsed"`
+	// Stalled reports whether reading stopped at ?stall_after=
+	Stalled bool `json:"stalled"`
+}
+
+// SlowReadHandler consumes the request body slowly, to exercise request
+// write timeouts in clients and proxies. ?rate= paces the reads and
+// ?stall_after=N stops reading after N bytes for ?stall= (default and
+// at most the configured maximum delay), after which the bytes read so
+// far are reported.
+func SlowReadHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := settingsFrom(r).maxDelay()
+
+	stallAfter := int64(-1)
+	if v := query.Get("stall_after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeJSONError(w, r, http.StatusBadRequest, "stall_after must be a byte count")
+			return
+		}
+		stallAfter = n
+	}
+
+	stall := limit
+	if v := query.Get("stall"); v != "" {
+		var err error
+		if stall, err = parseDelay(v, limit); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid stall value")
+			return
+		}
+	}
+
+	var body io.Reader = r.Body
+	if raw := query.Get(RateQuery); raw != "" {
+		rate, err := parseRate(raw)
+		if err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid rate")
+			return
+		}
+		body = &throttledReader{r: r.Body, p: newPacer(r.Context(), rate)}
+	}
+	if stallAfter >= 0 {
+		body = io.LimitReader(body, stallAfter)
+	}
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, body)
+	if err != nil {
+		if errors.Is(err, r.Context().Err()) {
+			aborted(w, r, time.Since(start))
+			return
+		}
+		writeJSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	// Hold the connection without reading any further, unless the body is
+	// known to have ended
+	stalled := stallAfter >= 0 && n == stallAfter && (r.ContentLength < 0 || r.ContentLength > stallAfter)
+	if stalled && !wait(r.Context(), stall) {
+		aborted(w, r, time.Since(start))
+		return
+	}
+
+	writeJSONResponse(w, r, http.StatusOK, SlowReadResponse{
+		BytesRead: n,
+		Elapsed:   time.Since(start).Round(time.Millisecond).String(),
+		Stalled:   stalled,
+	})
+}
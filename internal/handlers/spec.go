@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec formats served by SpecHandler
+const (
+	SpecJSON = "json"
+	SpecYAML = "yaml"
+)
+
+// anyMethods are documented for routes that accept any method
+var anyMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// pathParam matches the parameters of an OpenAPI path template
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// OpenAPI document types; only the parts the generated spec uses
+type (
+	openAPIDoc struct {
+		OpenAPI string                                 `json:"openapi" yaml:"openapi"`
+		Info    openAPIInfo                            `json:"info" yaml:"info"`
+		Servers []openAPIServer                        `json:"servers,omitempty" yaml:"servers,omitempty"`
+		Tags    []openAPITag                           `json:"tags" yaml:"tags"`
+		Paths   map[string]map[string]openAPIOperation `json:"paths" yaml:"paths"`
+	}
+
+	openAPIInfo struct {
+		Title       string `json:"title" yaml:"title"`
+		Description string `json:"description" yaml:"description"`
+		Version     string `json:"version" yaml:"version"`
+	}
+
+	openAPIServer struct {
+		URL string `json:"url" yaml:"url"`
+	}
+
+	openAPITag struct {
+		Name        string `json:"name" yaml:"name"`
+		Description string `json:"description" yaml:"description"`
+	}
+
+	openAPIOperation struct {
+		OperationID string                     `json:"operationId" yaml:"operationId"`
+		Summary     string                     `json:"summary" yaml:"summary"`
+		Tags        []string                   `json:"tags" yaml:"tags"`
+		Parameters  []openAPIParameter         `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+		Responses   map[string]openAPIResponse `json:"responses" yaml:"responses"`
+	}
+
+	openAPIParameter struct {
+		Name     string            `json:"name" yaml:"name"`
+		In       string            `json:"in" yaml:"in"`
+		Required bool              `json:"required" yaml:"required"`
+		Schema   map[string]string `json:"schema" yaml:"schema"`
+	}
+
+	openAPIResponse struct {
+		Description string `json:"description" yaml:"description"`
+	}
+)
+
+// buildSpec generates an OpenAPI 3 document for the given groups
+func buildSpec(build BuildInfo, groups []GroupRoutes, server string) openAPIDoc {
+	version := build.Version
+	if version == "" {
+		version = "dev"
+	}
+
+	doc := openAPIDoc{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "httpbin",
+			Description: "HTTP request and response service for testing",
+			Version:     version,
+		},
+		Tags:  []openAPITag{},
+		Paths: map[string]map[string]openAPIOperation{},
+	}
+	if server != "" {
+		doc.Servers = []openAPIServer{{URL: server}}
+	}
+
+	for _, g := range groups {
+		doc.Tags = append(doc.Tags, openAPITag{Name: g.Name, Description: g.Description})
+		for _, route := range g.Routes {
+			path := route.PathTemplate()
+
+			var params []openAPIParameter
+			for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+				params = append(params, openAPIParameter{
+					Name:     m[1],
+					In:       "path",
+					Required: true,
+					Schema:   map[string]string{"type": "string"},
+				})
+			}
+
+			methods := route.Methods
+			if len(methods) == 0 {
+				methods = anyMethods
+			}
+
+			ops := doc.Paths[path]
+			if ops == nil {
+				ops = map[string]openAPIOperation{}
+				doc.Paths[path] = ops
+			}
+			for _, method := range methods {
+				method = strings.ToLower(method)
+				ops[method] = openAPIOperation{
+					OperationID: method + operationName(path),
+					Summary:     route.Description,
+					Tags:        []string{g.Name},
+					Parameters:  params,
+					Responses:   map[string]openAPIResponse{"default": {Description: "Response"}},
+				}
+			}
+		}
+	}
+	return doc
+}
+
+// operationName turns a path template into a camel-cased identifier,
+// e.g. "/basic-auth/{user}" becomes "BasicAuthUser"
+func operationName(path string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	if b.Len() == 0 {
+		return "Index"
+	}
+	return b.String()
+}
+
+// SpecHandler serves an OpenAPI 3 document describing the routes returned
+// by catalog, as JSON or YAML
+func SpecHandler(build BuildInfo, catalog func() []GroupRoutes, format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		doc := buildSpec(build, catalog(), baseURL(r))
+		if format == SpecYAML {
+			var out bytes.Buffer
+			enc := yaml.NewEncoder(&out)
+			enc.SetIndent(2)
+			if err := enc.Encode(doc); err != nil {
+				writeJSONError(w, r, http.StatusInternalServerError, "Failed to render specification")
+				return
+			}
+			w.Header().Set("Content-Type", "application/yaml")
+			w.WriteHeader(http.StatusOK)
+			w.Write(out.Bytes())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(doc)
+	}
+}
@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"strconv"
@@ -8,70 +12,99 @@ import (
 	"time"
 )
 
-func init() {
-	// Initialize random seed
-	rand.Seed(time.Now().UnixNano())
-}
-
-// statusWeight represents a status code with its weight
+// statusWeight represents a status code with its weight and an optional
+// delay before responding
 type statusWeight struct {
 	code   int
 	weight float64
+	delay  time.Duration
 }
 
 // parseStatusCodes parses status code specification from path
 // Supports:
 //   - Single code: "404"
+//   - Equally likely codes: "200,404,500"
 //   - Weighted codes: "200:0.9,500:0.1"
-func parseStatusCodes(path string) ([]statusWeight, error) {
+//   - Weighted codes with delays: "200:0.9:0ms,500:0.1:2s"
+//
+// Codes without a weight weigh 1, and delays are capped at limit.
+func parseStatusCodes(path string, limit time.Duration) ([]statusWeight, error) {
 	path = strings.TrimPrefix(path, "/status/")
 	if path == "" {
 		return nil, nil
 	}
 
-	// Check if it contains weights (has colon)
-	if !strings.Contains(path, ":") {
-		// Simple single status code
-		code, err := strconv.Atoi(path)
-		if err != nil {
-			return nil, err
-		}
-		return []statusWeight{{code: code, weight: 1.0}}, nil
-	}
-
-	// Parse weighted status codes
 	var weights []statusWeight
-	parts := strings.Split(path, ",")
-	for _, part := range parts {
-		codeWeight := strings.Split(strings.TrimSpace(part), ":")
-		if len(codeWeight) != 2 {
-			continue
+	for _, part := range strings.Split(path, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("invalid status entry %q", part)
 		}
 
-		code, err := strconv.Atoi(strings.TrimSpace(codeWeight[0]))
+		code, err := strconv.Atoi(strings.TrimSpace(fields[0]))
 		if err != nil {
-			continue
+			return nil, err
 		}
 
-		weight, err := strconv.ParseFloat(strings.TrimSpace(codeWeight[1]), 64)
-		if err != nil {
-			continue
+		entry := statusWeight{code: code, weight: 1}
+		if len(fields) > 1 {
+			entry.weight, err = strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+			if err != nil || entry.weight < 0 {
+				return nil, fmt.Errorf("invalid weight %q", fields[1])
+			}
+		}
+		if len(fields) > 2 {
+			entry.delay, err = time.ParseDuration(strings.TrimSpace(fields[2]))
+			if err != nil || entry.delay < 0 {
+				return nil, fmt.Errorf("invalid delay %q", fields[2])
+			}
+			entry.delay = min(entry.delay, limit)
 		}
 
-		weights = append(weights, statusWeight{code: code, weight: weight})
+		weights = append(weights, entry)
 	}
 
 	return weights, nil
 }
 
+// StatusClientClosedRequest is recorded for requests whose client went
+// away while being delayed, following nginx's convention
+const StatusClientClosedRequest = 499
+
+// aborted records a request cancelled during a delay. A disconnected
+// client gets StatusClientClosedRequest, so logs and metrics show the
+// abort; on a deadline the timeout middleware answers instead.
+func aborted(w http.ResponseWriter, r *http.Request, delay time.Duration) {
+	if !errors.Is(r.Context().Err(), context.Canceled) {
+		return
+	}
+	slog.Debug("Client disconnected during delay", "path", r.URL.Path, "delay", delay)
+	w.WriteHeader(StatusClientClosedRequest)
+}
+
+// wait blocks for d, returning false if ctx is done first
+func wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 // selectStatusCode selects a status code based on weights
-func selectStatusCode(weights []statusWeight) int {
+func selectStatusCode(weights []statusWeight, src *rand.Rand) statusWeight {
 	if len(weights) == 0 {
-		return http.StatusOK
+		return statusWeight{code: http.StatusOK}
 	}
 
 	if len(weights) == 1 {
-		return weights[0].code
+		return weights[0]
 	}
 
 	// Calculate total weight
@@ -81,36 +114,124 @@ func selectStatusCode(weights []statusWeight) int {
 	}
 
 	// Generate random number and select based on weight
-	r := rand.Float64() * totalWeight
+	r := src.Float64() * totalWeight
 	cumulative := 0.0
 	for _, w := range weights {
 		cumulative += w.weight
 		if r <= cumulative {
-			return w.code
+			return w
 		}
 	}
 
 	// Fallback to last code
-	return weights[len(weights)-1].code
+	return weights[len(weights)-1]
 }
 
 // StatusHandler returns a response with the specified status code
 func StatusHandler(w http.ResponseWriter, r *http.Request) {
-	weights, err := parseStatusCodes(r.URL.Path)
+	weights, err := parseStatusCodes(r.URL.Path, settingsFrom(r).maxDelay())
 	if err != nil || len(weights) == 0 {
-		writeJSONError(w, http.StatusBadRequest, "Invalid status code specification")
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid status code specification")
 		return
 	}
 
-	// Select status code (single or weighted random)
-	statusCode := selectStatusCode(weights)
+	query := r.URL.Query()
+	retryAfter, err := parseRetryAfter(query.Get("retry_after"))
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "retry_after must be seconds or an HTTP-date")
+		return
+	}
+
+	// Optional extra headers, given as header=Name:value
+	extra := make(http.Header)
+	for _, h := range query["header"] {
+		name, value, ok := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if !ok || !validHeaderName(name) {
+			writeJSONError(w, r, http.StatusBadRequest, "header must be given as Name:value")
+			return
+		}
+		extra.Add(name, strings.TrimSpace(value))
+	}
 
 	// Validate status code range
-	if statusCode < 100 || statusCode > 599 {
-		writeJSONError(w, http.StatusBadRequest, "Status code must be between 100 and 599")
+	for _, entry := range weights {
+		if entry.code < 100 || entry.code > 599 {
+			writeJSONError(w, r, http.StatusBadRequest, "Status code must be between 100 and 599")
+			return
+		}
+	}
+
+	// Select status code (single or weighted random)
+	src, ok := randomSource(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
+		return
+	}
+	selected := selectStatusCode(weights, src)
+	statusCode := selected.code
+
+	// Tell clients when to retry on throttling and unavailability
+	if retryAfter != "" && (statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable) {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+
+	// Degraded codes may be slower than healthy ones
+	if !wait(r.Context(), selected.delay) {
+		aborted(w, r, selected.delay)
+		return
+	}
+
+	for name, values := range extra {
+		w.Header()[http.CanonicalHeaderKey(name)] = values
+	}
+
+	// Send response with the selected status code and optional body;
+	// 1xx, 204 and 304 responses cannot carry one
+	body, hasBody := query.Get("body"), query.Has("body")
+	if !hasBody || statusCode < 200 || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		w.WriteHeader(statusCode)
 		return
 	}
 
-	// Send response with the selected status code
+	contentType := query.Get("content_type")
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
 	w.WriteHeader(statusCode)
+	w.Write([]byte(body))
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRetryAfter validates a Retry-After value given as delay seconds or
+// an HTTP-date, returning it in canonical form
+func parseRetryAfter(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return "", strconv.ErrRange
+		}
+		return strconv.Itoa(secs), nil
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format(http.TimeFormat), nil
 }
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// maxStreamPostLine bounds each line of a /stream-post body
+const maxStreamPostLine = 1 << 20
+
+// StreamPostAck acknowledges one line of a /stream-post body
+type StreamPostAck struct {
+	Line  int    `json:"line"`
+	Bytes int    `json:"bytes"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// StreamPostSummary is the last line of a /stream-post response; Bytes
+// counts the bytes of all lines, without line endings
+type StreamPostSummary struct {
+	Done    bool   `json:"done"`
+	Lines   int    `json:"lines"`
+	Valid   int    `json:"valid"`
+	Invalid int    `json:"invalid"`
+	Bytes   int64  `json:"bytes"`
+	Error   string `json:"error,omitempty"`
+}
+
+// StreamPostHandler consumes a newline-delimited JSON request body as it
+// arrives and streams back an application/x-ndjson acknowledgement for
+// each line, reporting whether it is valid JSON, then a summary. Reading
+// and writing are interleaved, over HTTP/1.1 as well as HTTP/2, so clients
+// can send more lines after seeing earlier acknowledgements. Blank lines
+// are skipped and lines are limited to 1MiB.
+func StreamPostHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// HTTP/1.1 stops reading the body once the response starts, unless
+	// full duplex is enabled; HTTP/2 is always full duplex
+	if err := rc.EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		writeJSONError(w, r, http.StatusInternalServerError, "Cannot stream the request and response together")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	enc := json.NewEncoder(w)
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxStreamPostLine)
+
+	var summary StreamPostSummary
+	for line := 1; scanner.Scan(); line++ {
+		summary.Bytes += int64(len(scanner.Bytes()))
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		ack := StreamPostAck{Line: line, Bytes: len(scanner.Bytes())}
+		var v any
+		if err := json.Unmarshal(text, &v); err != nil {
+			ack.Error = err.Error()
+			summary.Invalid++
+		} else {
+			ack.Valid = true
+			summary.Valid++
+		}
+		summary.Lines++
+		if err := enc.Encode(ack); err != nil {
+			return
+		}
+		rc.Flush()
+	}
+	if err := scanner.Err(); err != nil {
+		summary.Error = "Reading the body failed: " + err.Error()
+	}
+
+	summary.Done = summary.Error == ""
+	enc.Encode(summary)
+}
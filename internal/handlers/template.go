@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// maxTemplateBody is how much of a request body templates can see
+const maxTemplateBody = 1 << 20
+
+// templateName restricts template names to a single path segment
+var templateName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// TemplateRequest is the data a mock template is rendered with
+type TemplateRequest struct {
+	Method   string
+	URL      string
+	Host     string
+	Origin   string
+	Path     string
+	Segments []string
+	Query    url.Values
+	Headers  http.Header
+	Body     string
+	// JSON is the body decoded as JSON, or an empty object if it is not
+	// JSON so that lookups such as .JSON.name are empty rather than errors
+	JSON any
+}
+
+// templateResponse collects what a template sets besides its body
+type templateResponse struct {
+	status int
+	header http.Header
+}
+
+// templateFuncs returns the functions available to templates; status
+// and header set the response status and headers while rendering, and
+// uuid and randInt draw from src
+func templateFuncs(resp *templateResponse, src io.Reader) template.FuncMap {
+	return template.FuncMap{
+		"status": func(code int) (string, error) {
+			if code < 200 || code > 599 {
+				return "", fmt.Errorf("invalid status %d", code)
+			}
+			resp.status = code
+			return "", nil
+		},
+		"header": func(name, value string) string {
+			resp.header.Set(name, value)
+			return ""
+		},
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"default": func(fallback, v any) any {
+			if v == nil || v == "" {
+				return fallback
+			}
+			return v
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"now": func() string {
+			return time.Now().UTC().Format(time.RFC3339)
+		},
+		"uuid": func() string { return newUUID(src) },
+		"randInt": func(lo, hi int) (int, error) {
+			if hi < lo {
+				return 0, errors.New("randInt requires lo <= hi")
+			}
+			n, err := rand.Int(src, big.NewInt(int64(hi-lo)+1))
+			if err != nil {
+				return 0, err
+			}
+			return lo + int(n.Int64()), nil
+		},
+		"add": func(a, b int) int { return a + b },
+	}
+}
+
+// findTemplate returns the file for a template name in dir: name.tmpl,
+// or name.<ext>.tmpl whose extension picks the Content-Type
+func findTemplate(dir, name string) (string, error) {
+	path := filepath.Join(dir, name+".tmpl")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, name+".*.tmpl"))
+	if len(matches) == 0 {
+		return "", fs.ErrNotExist
+	}
+	return matches[0], nil
+}
+
+// TemplateHandler renders the template /template/{name} from the
+// configured templates directory. Templates see the request as a
+// TemplateRequest, with the rest of the path in .Path and .Segments, and
+// may set the status and headers with {{status 201}} and
+// {{header "Name" "value"}}. Files are read on every request, so edits
+// apply immediately.
+func TemplateHandler(w http.ResponseWriter, r *http.Request) {
+	dir := settingsFrom(r).TemplatesDir
+	if dir == "" {
+		writeJSONError(w, r, http.StatusNotFound, "No templates directory configured")
+		return
+	}
+	name := r.PathValue("name")
+	if !templateName.MatchString(name) {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid template name")
+		return
+	}
+	path, err := findTemplate(dir, name)
+	if err != nil {
+		writeJSONError(w, r, http.StatusNotFound, "Unknown template "+name)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxTemplateBody))
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	rest := r.PathValue("path")
+	data := TemplateRequest{
+		Method:   r.Method,
+		URL:      r.URL.String(),
+		Host:     r.Host,
+		Origin:   reportedOrigin(r),
+		Path:     "/" + rest,
+		Segments: strings.FieldsFunc(rest, func(c rune) bool { return c == '/' }),
+		Query:    r.URL.Query(),
+		Headers:  r.Header,
+		Body:     string(body),
+	}
+	if json.Unmarshal(body, &data.JSON) != nil {
+		data.JSON = map[string]any{}
+	}
+
+	// Seeded requests get reproducible random values
+	seeded, ok := seededSource(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
+		return
+	}
+	var src io.Reader = rand.Reader
+	if seeded != nil {
+		src = seeded
+	}
+
+	resp := &templateResponse{status: http.StatusOK, header: http.Header{}}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs(resp, src)).Option("missingkey=zero").ParseFiles(path)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Template error: "+err.Error())
+		return
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Template error: "+err.Error())
+		return
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(strings.TrimSuffix(path, ".tmpl")))
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	for name, values := range resp.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.status)
+	w.Write(out.Bytes())
+}
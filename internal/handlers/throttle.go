@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateQuery is the query parameter limiting a response's bandwidth, e.g.
+// ?rate=64kbps
+const RateQuery = "rate"
+
+// rateUnits maps bandwidth suffixes to bytes per second. Bit rates use
+// SI prefixes, as network links do; byte rates also accept IEC ones.
+var rateUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"kib/s", 1 << 10},
+	{"mib/s", 1 << 20},
+	{"gib/s", 1 << 30},
+	{"kb/s", 1e3},
+	{"mb/s", 1e6},
+	{"gb/s", 1e9},
+	{"b/s", 1},
+	{"kbps", 1e3 / 8},
+	{"mbps", 1e6 / 8},
+	{"gbps", 1e9 / 8},
+	{"bps", 1.0 / 8},
+}
+
+// parseRate parses a bandwidth as bytes per second. Plain numbers are
+// bytes per second; suffixes such as kbps (bits) or KiB/s are
+// case-insensitive.
+func parseRate(raw string) (float64, error) {
+	number, scale := strings.ToLower(strings.TrimSpace(raw)), 1.0
+	for _, u := range rateUnits {
+		if n, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, scale = strings.TrimSpace(n), u.bytes
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, err
+	}
+	if !(v*scale >= 1) || v*scale > 1e12 {
+		return 0, strconv.ErrRange
+	}
+	return v * scale, nil
+}
+
+// maxThrottleBurst bounds how many bytes a pacer lets through at once
+const maxThrottleBurst = 32 << 10
+
+// pacer is a token bucket releasing rate bytes per second, holding
+// roughly 50ms worth of bytes and starting full
+type pacer struct {
+	ctx    context.Context
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// newPacer creates a pacer whose waits end once ctx is done
+func newPacer(ctx context.Context, rate float64) *pacer {
+	burst := min(max(int(rate/20), 1), maxThrottleBurst)
+	return &pacer{ctx: ctx, rate: rate, burst: burst, tokens: float64(burst), last: time.Now(), now: time.Now}
+}
+
+// take waits until n tokens, at most one burst, are available and
+// spends them
+func (p *pacer) take(n int) error {
+	now := p.now()
+	p.tokens = min(p.tokens+now.Sub(p.last).Seconds()*p.rate, float64(p.burst))
+	p.last = now
+
+	if short := float64(n) - p.tokens; short > 0 {
+		if !wait(p.ctx, time.Duration(short/p.rate*float64(time.Second))) {
+			return p.ctx.Err()
+		}
+		p.last = p.now()
+		p.tokens = float64(n)
+	}
+	p.tokens -= float64(n)
+	return nil
+}
+
+// throttledWriter paces writes with a pacer, flushing after each burst
+// so the pacing is visible on the wire
+type throttledWriter struct {
+	w http.ResponseWriter
+	p *pacer
+}
+
+// newThrottledWriter paces writes to w; they fail once ctx is done
+func newThrottledWriter(ctx context.Context, w http.ResponseWriter, rate float64) *throttledWriter {
+	return &throttledWriter{w: w, p: newPacer(ctx, rate)}
+}
+
+// Write sends p in bursts, waiting for tokens before each
+func (tw *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b[:min(len(b), tw.p.burst)]
+		if err := tw.p.take(len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := tw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		http.NewResponseController(tw.w).Flush()
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// throttledReader paces reads with a pacer
+type throttledReader struct {
+	r io.Reader
+	p *pacer
+}
+
+// Read reads at most one burst once the tokens for it are available
+func (tr *throttledReader) Read(b []byte) (int, error) {
+	b = b[:min(len(b), tr.p.burst)]
+	if err := tr.p.take(len(b)); err != nil {
+		return 0, err
+	}
+	n, err := tr.r.Read(b)
+	// Refund the tokens for bytes that did not arrive
+	tr.p.tokens += float64(len(b) - n)
+	return n, err
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ChecksumTrailer is the response trailer carrying the SHA-256 of the body
+const ChecksumTrailer = "X-Body-Sha256"
+
+// TrailersResponse is the body returned by /trailers
+type TrailersResponse struct {
+	// RequestTrailers are the trailers received after a chunked body
+	RequestTrailers map[string][]string `json:"request_trailers"`
+	BodySize        int64               `json:"body_size"`
+	// BodySHA256 is the checksum of the request body
+	BodySHA256 string `json:"body_sha256"`
+	// Trailers lists the trailers declared on this response
+	Trailers []string `json:"trailers"`
+}
+
+// TrailersHandler reports the request trailers received on a chunked
+// upload and sends response trailers: the body checksum, plus any given
+// as ?trailer=Name:value
+func TrailersHandler(w http.ResponseWriter, r *http.Request) {
+	extra := make(http.Header)
+	for _, spec := range r.URL.Query()["trailer"] {
+		name, value, ok := strings.Cut(spec, ":")
+		if !ok || !validHeaderName(name) {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid trailer: "+spec)
+			return
+		}
+		extra.Add(name, strings.TrimSpace(value))
+	}
+
+	// Trailers only arrive once the body has been read to the end
+	hash := sha256.New()
+	size, err := io.Copy(hash, r.Body)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	received := map[string][]string{}
+	for name, values := range r.Trailer {
+		received[name] = values
+	}
+
+	trailers := []string{ChecksumTrailer}
+	for name := range extra {
+		trailers = append(trailers, name)
+	}
+	slices.Sort(trailers[1:])
+
+	body, _ := marshalJSON(TrailersResponse{
+		RequestTrailers: received,
+		BodySize:        size,
+		BodySHA256:      hex.EncodeToString(hash.Sum(nil)),
+		Trailers:        trailers,
+	}, prettyOutput(r))
+	sum := sha256.Sum256(body)
+
+	w.Header().Set("Trailer", strings.Join(trailers, ", "))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+
+	w.Header().Set(ChecksumTrailer, hex.EncodeToString(sum[:]))
+	for name, values := range extra {
+		w.Header()[name] = values
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unstableIdle is how long an /unstable sequence is kept without requests
+const unstableIdle = 10 * time.Minute
+
+// UnstableResponse describes where a request fell in its sequence
+type UnstableResponse struct {
+	Key       string `json:"key"`
+	Request   int    `json:"request"`
+	Phase     string `json:"phase"`
+	Remaining int    `json:"remaining_in_phase"`
+}
+
+// unstableSequence tracks one client's position in a sequence
+type unstableSequence struct {
+	count int
+	last  time.Time
+}
+
+// Unstable serves /unstable/{failures}/{successes}: each client's first
+// failures requests fail, the next successes succeed, and then the cycle
+// starts over, so circuit breaker transitions can be driven exactly
+type Unstable struct {
+	mu    sync.Mutex
+	seqs  map[string]*unstableSequence
+	swept time.Time
+	now   func() time.Time
+}
+
+// NewUnstable creates an Unstable handler with no sequences
+func NewUnstable() *Unstable {
+	return &Unstable{seqs: make(map[string]*unstableSequence), now: time.Now}
+}
+
+// Handler serves the unstable sequence. Clients are told apart by origin
+// IP unless they pass ?key=; ?status= sets the failure status (default 503).
+// DELETE restarts the client's sequence.
+func (u *Unstable) Handler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/unstable/"), "/")
+	if len(parts) != 2 {
+		writeJSONError(w, r, http.StatusBadRequest, "Expected /unstable/{failures}/{successes}")
+		return
+	}
+	failures, err1 := strconv.Atoi(parts[0])
+	successes, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || failures < 0 || successes < 0 || failures+successes == 0 {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid failure/success counts")
+		return
+	}
+
+	status := http.StatusServiceUnavailable
+	if v := r.URL.Query().Get("status"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 100 || parsed > 599 {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid status code")
+			return
+		}
+		status = parsed
+	}
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = getOriginIP(r)
+	}
+
+	seqKey := fmt.Sprintf("%s|%d/%d", key, failures, successes)
+	if r.Method == http.MethodDelete {
+		u.mu.Lock()
+		delete(u.seqs, seqKey)
+		u.mu.Unlock()
+		writeJSONResponse(w, r, http.StatusOK, map[string]bool{"reset": true})
+		return
+	}
+
+	n := u.next(seqKey, failures+successes)
+	resp := UnstableResponse{Key: key, Request: n + 1}
+	if n < failures {
+		resp.Phase = "failure"
+		resp.Remaining = failures - n - 1
+	} else {
+		resp.Phase = "success"
+		resp.Remaining = failures + successes - n - 1
+		status = http.StatusOK
+	}
+
+	w.Header().Set("X-Unstable-Phase", resp.Phase)
+	writeJSONResponse(w, r, status, resp)
+}
+
+// next returns the zero-based position of this request in the sequence
+// for key, wrapping around after length requests
+func (u *Unstable) next(key string, length int) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	if now.Sub(u.swept) > unstableIdle {
+		u.swept = now
+		for k, s := range u.seqs {
+			if now.Sub(s.last) > unstableIdle {
+				delete(u.seqs, k)
+			}
+		}
+	}
+
+	s, ok := u.seqs[key]
+	if !ok {
+		s = &unstableSequence{}
+		u.seqs[key] = s
+	}
+	s.last = now
+
+	n := s.count % length
+	s.count = n + 1
+	return n
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxUUIDCount caps ?count= on /uuid
+const maxUUIDCount = 1000
+
+// gregorianOffset is the number of 100ns intervals between the version 1
+// epoch, 1582-10-15, and the Unix epoch
+const gregorianOffset = 0x01B21DD213814000
+
+// seededUUIDTime is the clock of seeded requests, so time-based UUIDs are
+// reproducible too
+var seededUUIDTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// UUIDResponse is the body of /uuid
+type UUIDResponse struct {
+	UUID string `json:"uuid"`
+}
+
+// UUIDsResponse is the body of /uuid?count=N
+type UUIDsResponse struct {
+	UUIDs []string `json:"uuids"`
+}
+
+// formatUUID renders b in the 8-4-4-4-12 hex form
+func formatUUID(b [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newUUID returns a random (version 4) UUID read from src
+func newUUID(src io.Reader) string {
+	var b [16]byte
+	io.ReadFull(src, b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b)
+}
+
+// uuidGenerator generates UUIDs of one version. Time-based UUIDs it
+// generates are strictly increasing, even within a clock tick.
+type uuidGenerator struct {
+	version int
+	src     io.Reader
+	now     func() time.Time
+	// last is the timestamp of the previous UUID: 100ns intervals for
+	// version 1, milliseconds for version 7
+	last int64
+	// counter orders version 7 UUIDs within a millisecond
+	counter uint16
+	// node and clockSeq identify the version 1 generator, randomly
+	node     [6]byte
+	clockSeq uint16
+}
+
+// newUUIDGenerator returns a generator of the given version drawing
+// random bits from src and timestamps from now
+func newUUIDGenerator(version int, src io.Reader, now func() time.Time) *uuidGenerator {
+	g := &uuidGenerator{version: version, src: src, now: now}
+	if version == 1 {
+		var b [8]byte
+		io.ReadFull(src, b[:])
+		copy(g.node[:], b[:6])
+		// Random node IDs set the multicast bit so they cannot clash with
+		// hardware addresses
+		g.node[0] |= 0x01
+		g.clockSeq = binary.BigEndian.Uint16(b[6:]) & 0x3fff
+	}
+	return g
+}
+
+// next returns the next UUID
+func (g *uuidGenerator) next() string {
+	switch g.version {
+	case 1:
+		return g.nextV1()
+	case 7:
+		return g.nextV7()
+	}
+	return newUUID(g.src)
+}
+
+// nextV1 returns a version 1 UUID: a 60-bit count of 100ns intervals, the
+// clock sequence and the node ID
+func (g *uuidGenerator) nextV1() string {
+	ticks := g.now().UnixNano()/100 + gregorianOffset
+	if ticks <= g.last {
+		ticks = g.last + 1
+	}
+	g.last = ticks
+
+	var b [16]byte
+	binary.BigEndian.PutUint32(b[0:], uint32(ticks))
+	binary.BigEndian.PutUint16(b[4:], uint16(ticks>>32))
+	binary.BigEndian.PutUint16(b[6:], uint16(ticks>>48)&0x0fff|0x1000)
+	binary.BigEndian.PutUint16(b[8:], g.clockSeq|0x8000)
+	copy(b[10:], g.node[:])
+	return formatUUID(b)
+}
+
+// nextV7 returns a version 7 UUID: a 48-bit Unix millisecond timestamp, a
+// 12-bit counter starting at a random value each millisecond, and random
+// bits
+func (g *uuidGenerator) nextV7() string {
+	var b [16]byte
+	io.ReadFull(g.src, b[6:])
+
+	ms := g.now().UnixMilli()
+	if ms > g.last {
+		g.last = ms
+		// Start in the lower half so the counter has room to grow
+		g.counter = binary.BigEndian.Uint16(b[6:]) & 0x07ff
+	} else {
+		g.counter++
+		// The counter overflowed: borrow the next millisecond
+		if g.counter > 0x0fff {
+			g.last++
+			g.counter = 0
+		}
+	}
+
+	binary.BigEndian.PutUint64(b[0:], uint64(g.last)<<16)
+	binary.BigEndian.PutUint16(b[6:], g.counter|0x7000)
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b)
+}
+
+// UUIDHandler returns a UUID of ?version= 4 (the default), 1 or 7, or
+// with ?count=N an array of up to 1000 of them. Version 1 and 7 UUIDs are
+// time-ordered. Seeded requests draw the random bits from the seed and
+// time from a fixed clock starting at 2024-01-01, so every UUID is
+// reproducible.
+func UUIDHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	version := 4
+	switch strings.TrimPrefix(strings.ToLower(query.Get("version")), "v") {
+	case "", "4":
+	case "1":
+		version = 1
+	case "7":
+		version = 7
+	default:
+		writeJSONError(w, r, http.StatusBadRequest, "Unsupported UUID version; use 1, 4 or 7")
+		return
+	}
+	count, ok := queryInt(query, "count", 1, maxUUIDCount)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid count")
+		return
+	}
+	seeded, ok := seededSource(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid seed")
+		return
+	}
+
+	var src io.Reader = rand.Reader
+	now := time.Now
+	if seeded != nil {
+		src = seeded
+		now = func() time.Time { return seededUUIDTime }
+	}
+	g := newUUIDGenerator(version, src, now)
+
+	if !query.Has("count") {
+		writeJSONResponse(w, r, http.StatusOK, UUIDResponse{UUID: g.next()})
+		return
+	}
+	uuids := make([]string, count)
+	for i := range uuids {
+		uuids[i] = g.next()
+	}
+	writeJSONResponse(w, r, http.StatusOK, UUIDsResponse{UUIDs: uuids})
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// SchemaQuery and SchemaHeader name the preloaded schema /validate checks
+// the document against
+const (
+	SchemaQuery  = "schema"
+	SchemaHeader = "X-Schema"
+)
+
+// schemaBaseURL is the base URL of preloaded schemas, so $ref "other.json"
+// resolves to the schema named other
+const schemaBaseURL = "httpbin:///schemas/"
+
+// inlineSchemaURL is the URL of a schema sent in the request body: the
+// base URL itself, which no schema name maps to, so it can $ref preloaded
+// schemas without shadowing any
+const inlineSchemaURL = schemaBaseURL
+
+// schemaPrinter renders validation error messages
+var schemaPrinter = message.NewPrinter(language.English)
+
+// ValidationIssue is one way a document fails its schema. Locations are
+// JSON pointers; SchemaLocation is relative to the schemas directory.
+type ValidationIssue struct {
+	InstanceLocation string `json:"instance_location"`
+	SchemaLocation   string `json:"schema_location"`
+	Message          string `json:"message"`
+}
+
+// ValidateResponse is the body of /validate; Schema names the preloaded
+// schema used, and is empty for one sent in the body
+type ValidateResponse struct {
+	Valid  bool              `json:"valid"`
+	Schema string            `json:"schema,omitempty"`
+	Errors []ValidationIssue `json:"errors"`
+}
+
+// schemaLoader resolves $ref to schemas in dir, and nothing else, so
+// schemas cannot make the server read other files or fetch URLs
+type schemaLoader string
+
+func (dir schemaLoader) Load(rawURL string) (any, error) {
+	name, ok := strings.CutPrefix(rawURL, schemaBaseURL)
+	name, isJSON := strings.CutSuffix(name, ".json")
+	if !ok || !isJSON || !templateName.MatchString(name) {
+		return nil, errors.New("only schemas in the schemas directory can be referenced")
+	}
+	if dir == "" {
+		return nil, errors.New("no schemas directory configured")
+	}
+	f, err := os.Open(filepath.Join(string(dir), name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return jsonschema.UnmarshalJSON(f)
+}
+
+// validateParts splits a multipart/form-data body into its schema and
+// document parts, either of which may be a field or a file
+func validateParts(body []byte, boundary string) (schema, document []byte, err error) {
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, &bodyError{http.StatusBadRequest, "Invalid multipart request body"}
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, &bodyError{http.StatusBadRequest, "Invalid multipart request body"}
+		}
+		switch part.FormName() {
+		case "schema":
+			schema = data
+		case "document":
+			document = data
+		}
+	}
+	if document == nil {
+		return nil, nil, &bodyError{http.StatusBadRequest, "Multipart body has no document part"}
+	}
+	return schema, document, nil
+}
+
+// jsonPointer joins tokens into a JSON pointer
+func jsonPointer(tokens []string) string {
+	var b strings.Builder
+	escape := strings.NewReplacer("~", "~0", "/", "~1")
+	for _, tok := range tokens {
+		b.WriteByte('/')
+		escape.WriteString(&b, tok)
+	}
+	return b.String()
+}
+
+// validationIssues flattens a validation error into its failing keywords,
+// sorted by location
+func validationIssues(err *jsonschema.ValidationError) []ValidationIssue {
+	var issues []ValidationIssue
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) > 0 {
+			for _, cause := range e.Causes {
+				walk(cause)
+			}
+			return
+		}
+		issues = append(issues, ValidationIssue{
+			InstanceLocation: jsonPointer(e.InstanceLocation),
+			SchemaLocation:   strings.TrimPrefix(e.SchemaURL, schemaBaseURL) + jsonPointer(e.ErrorKind.KeywordPath()),
+			Message:          e.ErrorKind.LocalizedString(schemaPrinter),
+		})
+	}
+	walk(err)
+	slices.SortStableFunc(issues, func(a, b ValidationIssue) int {
+		return strings.Compare(a.InstanceLocation, b.InstanceLocation)
+	})
+	return issues
+}
+
+// ValidateHandler validates a JSON document against a JSON Schema and
+// details every error. The schema is either preloaded from the schemas
+// directory, named by ?schema= or the X-Schema header, or sent as the
+// schema part of a multipart/form-data body whose document part is the
+// document; otherwise the body is the document. Schemas may $ref others
+// in the schemas directory by file name, but nothing else. Valid
+// documents get a 200 and invalid ones a 422.
+func ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	body, _, err := readBody(r)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	var schema []byte
+	document := body
+	if boundary := multipartBoundary(r); boundary != "" {
+		if schema, document, err = validateParts(body, boundary); err != nil {
+			writeBodyError(w, r, err)
+			return
+		}
+	}
+
+	dir := settingsFrom(r).SchemasDir
+	compiler := jsonschema.NewCompiler()
+	compiler.UseLoader(schemaLoader(dir))
+	compiler.AssertFormat()
+
+	name := r.URL.Query().Get(SchemaQuery)
+	if name == "" {
+		name = r.Header.Get(SchemaHeader)
+	}
+	location := inlineSchemaURL
+	switch {
+	case schema != nil:
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema))
+		if err == nil {
+			err = compiler.AddResource(inlineSchemaURL, doc)
+		}
+		if err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid schema: "+err.Error())
+			return
+		}
+		name = ""
+	case name == "":
+		writeJSONError(w, r, http.StatusBadRequest, "No schema: name one with ?schema= or "+SchemaHeader+", or send a multipart body with schema and document parts")
+		return
+	case dir == "":
+		writeJSONError(w, r, http.StatusNotFound, "No schemas directory configured")
+		return
+	case !templateName.MatchString(name):
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid schema name")
+		return
+	default:
+		if _, err := os.Stat(filepath.Join(dir, name+".json")); errors.Is(err, fs.ErrNotExist) {
+			writeJSONError(w, r, http.StatusNotFound, "Unknown schema "+name)
+			return
+		}
+		location = schemaBaseURL + name + ".json"
+	}
+
+	compiled, err := compiler.Compile(location)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid schema: "+err.Error())
+		return
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(document))
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid JSON document: "+err.Error())
+		return
+	}
+
+	resp := ValidateResponse{Valid: true, Schema: name, Errors: []ValidationIssue{}}
+	status := http.StatusOK
+	var verr *jsonschema.ValidationError
+	if err := compiled.Validate(instance); errors.As(err, &verr) {
+		resp.Valid = false
+		resp.Errors = validationIssues(verr)
+		status = http.StatusUnprocessableEntity
+	} else if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Validation failed: "+err.Error())
+		return
+	}
+	writeJSONResponse(w, r, status, resp)
+}
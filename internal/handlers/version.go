@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// VersionHeader is the response header carrying the server version
+const VersionHeader = "X-Httpbin-Version"
+
+// VersionHandler returns a handler reporting the build metadata
+func VersionHandler(build BuildInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := map[string]string{
+			"version":    build.Version,
+			"commit":     build.Commit,
+			"build_time": build.BuildTime,
+			"go_version": runtime.Version(),
+		}
+		writeJSONResponse(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Webhook limits; only the most recent maxWebhooks deliveries are kept
+const (
+	maxWebhooks   = 100
+	replayTimeout = 30 * time.Second
+)
+
+// ReplayHeader marks requests sent by a webhook replay; its value is the
+// delivery id
+const ReplayHeader = "X-Httpbin-Replay"
+
+// SignatureHeaderQuery names the header carrying the signature of a
+// webhook, for senders not in signatureHeaders
+const SignatureHeaderQuery = "signature_header"
+
+// signatureHeaders are the signature headers of common webhook senders,
+// in the order they are looked for
+var signatureHeaders = []string{
+	"X-Hub-Signature-256",
+	"X-Hub-Signature",
+	"Stripe-Signature",
+	"X-Slack-Signature",
+	"X-Shopify-Hmac-Sha256",
+	"Webhook-Signature",
+	"Svix-Signature",
+	"X-Webhook-Signature",
+	"X-Signature",
+}
+
+// replayDroppedHeaders are not copied to a replayed request; they
+// describe the original connection rather than the delivery
+var replayDroppedHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authorization", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length", "Accept-Encoding",
+}
+
+// WebhookDelivery is a received webhook
+type WebhookDelivery struct {
+	CapturedRequest
+	SignatureHeader string `json:"signature_header,omitempty"`
+	Signature       string `json:"signature,omitempty"`
+}
+
+// WebhookDeliveriesResponse is the body returned by GET /webhooks
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// WebhookReplayResponse reports the target's answer to a replay
+type WebhookReplayResponse struct {
+	Delivery   int64               `json:"delivery"`
+	URL        string              `json:"url"`
+	Status     int                 `json:"status"`
+	Headers    map[string][]string `json:"headers"`
+	Body       string              `json:"body"`
+	DurationMS float64             `json:"duration_ms"`
+}
+
+// Webhooks records webhook deliveries to /webhook/... and replays them.
+// Replaying sends requests to arbitrary URLs, so ReplayHandler is meant
+// for the admin listener rather than the public endpoints.
+type Webhooks struct {
+	mu         sync.Mutex
+	nextID     int64
+	deliveries []WebhookDelivery
+	now        func() time.Time
+	client     *http.Client
+}
+
+// NewWebhooks creates a Webhooks handler with no deliveries
+func NewWebhooks() *Webhooks {
+	return &Webhooks{now: time.Now, client: &http.Client{Timeout: replayTimeout}}
+}
+
+// ReceiveHandler records a delivery to /webhook or below it
+func (wh *Webhooks) ReceiveHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	captured, err := captureRequest(r, wh.now())
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	delivery := WebhookDelivery{CapturedRequest: captured}
+	delivery.SignatureHeader, delivery.Signature = findSignature(r)
+
+	wh.mu.Lock()
+	wh.nextID++
+	delivery.ID = wh.nextID
+	wh.deliveries = append(wh.deliveries, delivery)
+	if len(wh.deliveries) > maxWebhooks {
+		wh.deliveries = wh.deliveries[len(wh.deliveries)-maxWebhooks:]
+	}
+	wh.mu.Unlock()
+
+	writeJSONResponse(w, r, http.StatusOK, map[string]any{"id": delivery.ID})
+}
+
+// findSignature returns the signature header of r and its value
+func findSignature(r *http.Request) (string, string) {
+	if name := r.URL.Query().Get(SignatureHeaderQuery); name != "" {
+		return http.CanonicalHeaderKey(name), r.Header.Get(name)
+	}
+	for _, name := range signatureHeaders {
+		if v := r.Header.Get(name); v != "" {
+			return name, v
+		}
+	}
+	return "", ""
+}
+
+// DeliveriesHandler lists the deliveries, oldest first, or clears them on
+// DELETE
+func (wh *Webhooks) DeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		wh.mu.Lock()
+		deliveries := append([]WebhookDelivery{}, wh.deliveries...)
+		wh.mu.Unlock()
+		writeJSONResponse(w, r, http.StatusOK, WebhookDeliveriesResponse{Deliveries: deliveries})
+	case http.MethodDelete:
+		wh.mu.Lock()
+		wh.deliveries = nil
+		wh.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// DeliveryHandler returns the delivery /webhooks/{id}
+func (wh *Webhooks) DeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	delivery, ok := wh.delivery(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, r, http.StatusNotFound, "Unknown delivery")
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, delivery)
+}
+
+// delivery looks up a delivery by its id
+func (wh *Webhooks) delivery(raw string) (WebhookDelivery, bool) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return WebhookDelivery{}, false
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	for _, d := range wh.deliveries {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return WebhookDelivery{}, false
+}
+
+// ReplayHandler sends the delivery /{id}/replay again, with its original
+// method, headers and body, to the URL given by ?url= and reports the
+// answer
+func (wh *Webhooks) ReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	delivery, ok := wh.delivery(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, r, http.StatusNotFound, "Unknown delivery")
+		return
+	}
+	if delivery.BodyTruncated {
+		writeJSONError(w, r, http.StatusUnprocessableEntity, "Delivery body was truncated and cannot be replayed")
+		return
+	}
+
+	target, err := url.Parse(r.URL.Query().Get("url"))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "Missing or invalid ?url=; expected an http or https URL")
+		return
+	}
+
+	resp, err := wh.replay(r.Context(), delivery, target.String())
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadGateway, "Replay failed: "+err.Error())
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, resp)
+}
+
+// replay sends delivery to target
+func (wh *Webhooks) replay(ctx context.Context, delivery WebhookDelivery, target string) (WebhookReplayResponse, error) {
+	body := []byte(delivery.Body)
+	if delivery.BodyEncoding == "base64" {
+		body, _ = base64.StdEncoding.DecodeString(delivery.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, delivery.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return WebhookReplayResponse{}, err
+	}
+	req.Header = http.Header(delivery.Headers).Clone()
+	for _, name := range replayDroppedHeaders {
+		req.Header.Del(name)
+	}
+	req.Header.Set(ReplayHeader, strconv.FormatInt(delivery.ID, 10))
+
+	start := wh.now()
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return WebhookReplayResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxCapturedBody))
+	if err != nil {
+		return WebhookReplayResponse{}, err
+	}
+	return WebhookReplayResponse{
+		Delivery:   delivery.ID,
+		URL:        target,
+		Status:     resp.StatusCode,
+		Headers:    resp.Header,
+		Body:       string(answer),
+		DurationMS: float64(wh.now().Sub(start)) / float64(time.Millisecond),
+	}, nil
+}
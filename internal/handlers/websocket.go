@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/websocket"
+)
+
+// defaultMaxMessage bounds WebSocket messages unless ?max_message= is given
+const defaultMaxMessage = 1 << 20
+
+// wsOptions are the /ws behaviours chosen by query parameters
+type wsOptions struct {
+	ping       time.Duration
+	maxMessage int64
+	// closeAfter is the number of echoes before closing; -1 never closes
+	closeAfter  int
+	closeCode   int
+	closeReason string
+	fragment    int
+}
+
+// parseWSOptions reads the /ws query parameters, returning an error
+// message for invalid ones
+func parseWSOptions(r *http.Request) (wsOptions, string) {
+	query := r.URL.Query()
+	o := wsOptions{maxMessage: defaultMaxMessage, closeAfter: -1, closeCode: websocket.CloseNormal, closeReason: query.Get("close_reason")}
+
+	if v := query.Get("ping"); v != "" {
+		d, err := parseDelay(v, settingsFrom(r).maxDelay())
+		if err != nil || d < minKeepalive {
+			return o, "ping must be a duration of at least " + minKeepalive.String()
+		}
+		o.ping = d
+	}
+	if v := query.Get("max_message"); v != "" {
+		n, ok := parseByteCount(v)
+		if !ok || n == 0 {
+			return o, "max_message must be between 1 and " + strconv.Itoa(maxStreamBytes)
+		}
+		o.maxMessage = int64(n)
+	}
+	if v := query.Get("close_after"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return o, "close_after must be a message count"
+		}
+		o.closeAfter = n
+	}
+	if v := query.Get("close_code"); v != "" {
+		code, err := strconv.Atoi(v)
+		// 1005, 1006 and 1015 are reserved for reporting, never sent
+		if err != nil || code < 1000 || code > 4999 || code == 1005 || code == 1006 || code == 1015 {
+			return o, "close_code must be a sendable close code between 1000 and 4999"
+		}
+		o.closeCode = code
+	}
+	if v := query.Get("fragment"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return o, "fragment must be a positive frame size"
+		}
+		o.fragment = n
+	}
+	return o, ""
+}
+
+// WebSocketHandler echoes WebSocket messages back with their type. Query
+// parameters shape the connection for proxy edge cases: ?ping= sends
+// pings at an interval, ?max_message= closes with 1009 on larger
+// messages, ?close_after=N closes after N echoes with ?close_code= and
+// ?close_reason=, and ?fragment= splits echoes into frames of that size.
+func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	opts, problem := parseWSOptions(r)
+	if problem != "" {
+		writeJSONError(w, r, http.StatusBadRequest, problem)
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if errors.Is(err, websocket.ErrBadHandshake) {
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeJSONError(w, r, http.StatusUpgradeRequired, "Expected a WebSocket handshake")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, r, http.StatusNotImplemented, "This connection cannot be hijacked; use HTTP/1.1")
+		return
+	}
+	defer conn.Close()
+	conn.ReadLimit = opts.maxMessage
+
+	done := make(chan struct{})
+	defer close(done)
+	if opts.ping > 0 {
+		go func() {
+			ticker := time.NewTicker(opts.ping)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if conn.Ping(nil) != nil {
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	for echoed := 0; opts.closeAfter < 0 || echoed < opts.closeAfter; echoed++ {
+		op, message, err := conn.ReadMessage()
+		if err != nil {
+			var ce *websocket.CloseError
+			if !errors.As(err, &ce) {
+				slog.Debug("WebSocket closed", "path", r.URL.Path, "error", err)
+			}
+			return
+		}
+		if err := conn.WriteMessage(op, message, opts.fragment); err != nil {
+			return
+		}
+	}
+	conn.CloseWith(opts.closeCode, opts.closeReason)
+}
@@ -0,0 +1,203 @@
+// Package history keeps a bounded log of recently handled requests so
+// testers can check what traffic actually arrived after a test run.
+package history
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/tail"
+)
+
+// DefaultSize is the number of requests kept by default
+const DefaultSize = 1000
+
+// Log is a fixed-size ring buffer of request events; once full, the
+// oldest events are overwritten
+type Log struct {
+	mu     sync.Mutex
+	events []tail.Event
+	next   int
+	full   bool
+	now    func() time.Time
+}
+
+// New creates a Log holding up to size events
+func New(size int) *Log {
+	return &Log{events: make([]tail.Event, size), now: time.Now}
+}
+
+// Add records an event, evicting the oldest one if the log is full
+func (l *Log) Add(e tail.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) == 0 {
+		return
+	}
+	l.events[l.next] = e
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Clear removes all events
+func (l *Log) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	clear(l.events)
+	l.next, l.full = 0, false
+}
+
+// Filter selects events; zero fields match everything
+type Filter struct {
+	// Path matches events whose path starts with it
+	Path   string
+	Method string
+	// Statuses lists exact codes, or classes such as 5 for 5xx
+	Statuses []int
+	Since    time.Time
+	Until    time.Time
+	// Limit keeps only the most recent matches
+	Limit int
+}
+
+// Match reports whether e passes the filter
+func (f Filter) Match(e tail.Event) bool {
+	if !strings.HasPrefix(e.Path, f.Path) {
+		return false
+	}
+	if f.Method != "" && !strings.EqualFold(e.Method, f.Method) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if len(f.Statuses) == 0 {
+		return true
+	}
+	for _, status := range f.Statuses {
+		if status == e.Status || (status < 10 && status == e.Status/100) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the matching events, oldest first
+func (l *Log) Query(f Filter) []tail.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start, n := 0, l.next
+	if l.full {
+		start, n = l.next, len(l.events)
+	}
+
+	matches := []tail.Event{}
+	for i := 0; i < n; i++ {
+		if e := l.events[(start+i)%len(l.events)]; f.Match(e) {
+			matches = append(matches, e)
+		}
+	}
+	if f.Limit > 0 && len(matches) > f.Limit {
+		matches = matches[len(matches)-f.Limit:]
+	}
+	return matches
+}
+
+// parseFilter reads a Filter from the query parameters path, method,
+// status, since, until and limit
+func parseFilter(r *http.Request, now time.Time) (Filter, error) {
+	q := r.URL.Query()
+	f := Filter{Path: q.Get("path"), Method: q.Get("method")}
+
+	if raw := q.Get("status"); raw != "" {
+		for _, s := range strings.Split(raw, ",") {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if class, ok := strings.CutSuffix(s, "xx"); ok {
+				n, err := strconv.Atoi(class)
+				if err != nil || n < 1 || n > 5 {
+					return f, fmt.Errorf("invalid status class %q", s)
+				}
+				f.Statuses = append(f.Statuses, n)
+				continue
+			}
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 100 || n > 599 {
+				return f, fmt.Errorf("invalid status %q", s)
+			}
+			f.Statuses = append(f.Statuses, n)
+		}
+	}
+
+	var err error
+	if f.Since, err = parseTime(q.Get("since"), now); err != nil {
+		return f, fmt.Errorf("invalid since: %w", err)
+	}
+	if f.Until, err = parseTime(q.Get("until"), now); err != nil {
+		return f, fmt.Errorf("invalid until: %w", err)
+	}
+
+	if raw := q.Get("limit"); raw != "" {
+		if f.Limit, err = strconv.Atoi(raw); err != nil || f.Limit < 0 {
+			return f, fmt.Errorf("invalid limit %q", raw)
+		}
+	}
+	return f, nil
+}
+
+// parseTime accepts an RFC 3339 timestamp or a duration counted back
+// from now, e.g. 5m for five minutes ago
+func parseTime(raw string, now time.Time) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// Response is the document returned by Handler
+type Response struct {
+	Requests []tail.Event `json:"requests"`
+	Count    int          `json:"count"`
+	Capacity int          `json:"capacity"`
+}
+
+// Handler lists matching requests on GET and clears the log on DELETE
+func (l *Log) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodDelete:
+			l.Clear()
+		default:
+			handlers.JSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		f, err := parseFilter(r, l.now())
+		if err != nil {
+			handlers.JSONError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		events := l.Query(f)
+		handlers.JSONResponse(w, r, http.StatusOK, Response{
+			Requests: events,
+			Count:    len(events),
+			Capacity: len(l.events),
+		})
+	}
+}
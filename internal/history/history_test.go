@@ -0,0 +1,111 @@
+package history
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/tail"
+)
+
+// TestLogRing tests that a full log evicts the oldest events
+func TestLogRing(t *testing.T) {
+	log := New(3)
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		log.Add(tail.Event{Path: path})
+	}
+
+	events := log.Query(Filter{})
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	for i, want := range []string{"/c", "/d", "/e"} {
+		if events[i].Path != want {
+			t.Errorf("Event %d: expected %s, got %s", i, want, events[i].Path)
+		}
+	}
+
+	log.Clear()
+	if events := log.Query(Filter{}); len(events) != 0 {
+		t.Errorf("Expected no events after Clear, got %d", len(events))
+	}
+}
+
+// TestHandler tests filtering, clearing and invalid queries
+func TestHandler(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	log := New(10)
+	log.now = func() time.Time { return base.Add(10 * time.Minute) }
+	for i, e := range []tail.Event{
+		{Method: "GET", Path: "/get", Status: 200},
+		{Method: "POST", Path: "/status/500", Status: 500},
+		{Method: "GET", Path: "/status/503", Status: 503},
+		{Method: "GET", Path: "/status/404", Status: 404},
+	} {
+		e.Time = base.Add(time.Duration(i) * time.Minute)
+		log.Add(e)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedPaths  []string
+	}{
+		{"all", "", http.StatusOK, []string{"/get", "/status/500", "/status/503", "/status/404"}},
+		{"path prefix", "?path=/status/", http.StatusOK, []string{"/status/500", "/status/503", "/status/404"}},
+		{"status class", "?status=5xx", http.StatusOK, []string{"/status/500", "/status/503"}},
+		{"status list", "?status=200,404", http.StatusOK, []string{"/get", "/status/404"}},
+		{"method", "?method=post", http.StatusOK, []string{"/status/500"}},
+		{"since timestamp", "?since=2024-01-01T12:02:00Z", http.StatusOK, []string{"/status/503", "/status/404"}},
+		{"since duration", "?since=8m", http.StatusOK, []string{"/status/503", "/status/404"}},
+		{"until", "?until=2024-01-01T12:01:00Z", http.StatusOK, []string{"/get", "/status/500"}},
+		{"limit keeps newest", "?limit=1", http.StatusOK, []string{"/status/404"}},
+		{"no matches", "?path=/nothing", http.StatusOK, []string{}},
+		{"invalid status", "?status=abc", http.StatusBadRequest, nil},
+		{"invalid status class", "?status=6xx", http.StatusBadRequest, nil},
+		{"invalid since", "?since=yesterday", http.StatusBadRequest, nil},
+		{"invalid limit", "?limit=-1", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			log.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/admin/requests"+tt.query, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedPaths == nil {
+				return
+			}
+
+			var resp Response
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if resp.Count != len(tt.expectedPaths) || resp.Capacity != 10 {
+				t.Fatalf("Expected %d of 10 events, got %d of %d", len(tt.expectedPaths), resp.Count, resp.Capacity)
+			}
+			for i, want := range tt.expectedPaths {
+				if resp.Requests[i].Path != want {
+					t.Errorf("Event %d: expected %s, got %s", i, want, resp.Requests[i].Path)
+				}
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	log.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/admin/requests", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for POST, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	log.Handler().ServeHTTP(rr, httptest.NewRequest("DELETE", "/admin/requests", nil))
+	if rr.Code != http.StatusOK || len(log.Query(Filter{})) != 0 {
+		t.Errorf("Expected DELETE to clear the history, got status %d", rr.Code)
+	}
+}
@@ -0,0 +1,164 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseLevel tests log level parsing
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected slog.Level
+		wantErr  bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			level, err := ParseLevel(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && level != tt.expected {
+				t.Errorf("Expected level %v, got %v", tt.expected, level)
+			}
+		})
+	}
+}
+
+// TestNewJSON tests that the json format emits parseable records
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.Debug("hidden")
+	logger.Info("hello", "status", 200)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to parse JSON log: %v (%q)", err, buf.String())
+	}
+
+	if record["msg"] != "hello" || record["status"] != float64(200) {
+		t.Errorf("Unexpected record: %v", record)
+	}
+}
+
+// TestNewText tests the text format and unknown formats
+func TestNewText(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "text", slog.LevelDebug)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.Debug("hello", "path", "/get")
+	if !strings.Contains(buf.String(), "path=/get") {
+		t.Errorf("Expected text output to contain path=/get, got %q", buf.String())
+	}
+
+	if _, err := New(&buf, "xml", slog.LevelInfo); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+// TestRotatingFileSize tests size based rotation and backup retention
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	f, err := OpenRotatingFile(path, 10, 2, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("Expected %s to contain %q, got %q", name, content, data)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected only 2 backups to be kept")
+	}
+}
+
+// TestRotatingFileInterval tests time based rotation
+func TestRotatingFileInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	f, err := OpenRotatingFile(path, 0, 1, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("old\n"))
+	time.Sleep(20 * time.Millisecond)
+	f.Write([]byte("new\n"))
+
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "old\n" {
+		t.Errorf("Expected backup to contain old entry, got %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new\n" {
+		t.Errorf("Expected current file to contain new entry, got %q", data)
+	}
+}
+
+// TestRotatingFileRenameFailure tests that a failed rotation keeps logging
+func TestRotatingFileRenameFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	// A non-empty directory at the backup path makes the rename fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "keep"), 0o755); err != nil {
+		t.Fatalf("Failed to create backup directory: %v", err)
+	}
+
+	f, err := OpenRotatingFile(path, 0, 1, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before\n"))
+	if err := f.Rotate(); err == nil {
+		t.Fatal("Expected rotation to fail")
+	}
+	if _, err := f.Write([]byte("after\n")); err != nil {
+		t.Fatalf("Expected write after failed rotation to succeed, got %v", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "before\nafter\n" {
+		t.Errorf("Expected current file to keep both entries, got %q", data)
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"expvar"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var (
+	expvarOnce  sync.Once
+	expvarStats *expvar.Map
+)
+
+// expvarRecorder publishes counters into the process-wide "httpbin" expvar
+type expvarRecorder struct {
+	stats *expvar.Map
+}
+
+// Expvar returns a Recorder that aggregates metrics into expvar so they
+// are visible at /debug/vars. Counters are process-wide, since expvar
+// names can only be published once.
+func Expvar() Recorder {
+	expvarOnce.Do(func() {
+		expvarStats = expvar.NewMap("httpbin")
+		expvar.Publish("goroutines", expvar.Func(func() any {
+			return runtime.NumGoroutine()
+		}))
+		expvar.Publish("gc", expvar.Func(gcStats))
+	})
+	return expvarRecorder{stats: expvarStats}
+}
+
+// Count adds value to the counter total and to a per-tag breakdown,
+// e.g. requests and requests.status.200
+func (e expvarRecorder) Count(name string, value int64, tags map[string]string) {
+	e.stats.Add(name, value)
+	for k, v := range tags {
+		e.stats.Add(name+"."+k+"."+v, value)
+	}
+}
+
+// Timing accumulates the sample count and total duration in milliseconds
+func (e expvarRecorder) Timing(name string, d time.Duration, tags map[string]string) {
+	e.stats.Add(name+".count", 1)
+	e.stats.AddFloat(name+".total_ms", float64(d)/float64(time.Millisecond))
+}
+
+// gcStats summarises garbage collector activity
+func gcStats() any {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return map[string]any{
+		"num_gc":         m.NumGC,
+		"pause_total_ns": m.PauseTotalNs,
+		"last_gc":        time.Unix(0, int64(m.LastGC)).UTC(),
+		"heap_alloc":     m.HeapAlloc,
+		"next_gc":        m.NextGC,
+	}
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import "time"
+
+// Recorder receives request counters and timings
+type Recorder interface {
+	// Count adds value to the named counter
+	Count(name string, value int64, tags map[string]string)
+	// Timing records a duration sample for the named timer
+	Timing(name string, d time.Duration, tags map[string]string)
+}
+
+// nopRecorder discards all metrics
+type nopRecorder struct{}
+
+func (nopRecorder) Count(string, int64, map[string]string)          {}
+func (nopRecorder) Timing(string, time.Duration, map[string]string) {}
+
+// Nop returns a Recorder that discards everything
+func Nop() Recorder {
+	return nopRecorder{}
+}
+
+// multiRecorder fans metrics out to several recorders
+type multiRecorder []Recorder
+
+func (m multiRecorder) Count(name string, value int64, tags map[string]string) {
+	for _, r := range m {
+		r.Count(name, value, tags)
+	}
+}
+
+func (m multiRecorder) Timing(name string, d time.Duration, tags map[string]string) {
+	for _, r := range m {
+		r.Timing(name, d, tags)
+	}
+}
+
+// Multi returns a Recorder that forwards to all given recorders
+func Multi(recorders ...Recorder) Recorder {
+	return multiRecorder(recorders)
+}
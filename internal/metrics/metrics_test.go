@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"expvar"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestTagFormatLine tests metric line formatting for each tag format
+func TestTagFormatLine(t *testing.T) {
+	tags := map[string]string{"status": "200", "method": "GET"}
+
+	tests := []struct {
+		format   TagFormat
+		kind     string
+		expected string
+	}{
+		{TagFormatDogStatsD, "c", "httpbin.requests:1|c|#method:GET,status:200"},
+		{TagFormatInfluxDB, "c", "httpbin.requests,method=GET,status=200:1|c"},
+		{TagFormatGraphite, "c", "httpbin.requests;method=GET;status=200:1|c"},
+		{TagFormatNone, "c", "httpbin.requests:1|c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			line := tt.format.line("httpbin.requests", "1", tt.kind, tags)
+			if line != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, line)
+			}
+		})
+	}
+}
+
+// TestParseTagFormat tests tag format validation
+func TestParseTagFormat(t *testing.T) {
+	if f, err := ParseTagFormat("DogStatsD"); err != nil || f != TagFormatDogStatsD {
+		t.Errorf("Expected dogstatsd, got %q (%v)", f, err)
+	}
+
+	if _, err := ParseTagFormat("prometheus"); err == nil {
+		t.Error("Expected error for unknown tag format")
+	}
+}
+
+// TestStatsDSend tests that metrics are delivered over UDP
+func TestStatsDSend(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer pc.Close()
+
+	s, err := NewStatsD(pc.LocalAddr().String(), "httpbin", TagFormatDogStatsD)
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	defer s.Close()
+
+	s.Timing("request.duration", 1500*time.Microsecond, map[string]string{"method": "GET"})
+
+	buf := make([]byte, 512)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read packet: %v", err)
+	}
+
+	expected := "httpbin.request.duration:1.5|ms|#method:GET"
+	if got := string(buf[:n]); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+// TestExpvar tests that counters and timings are aggregated into expvar
+func TestExpvar(t *testing.T) {
+	rec := Expvar()
+	stats := expvar.Get("httpbin").(*expvar.Map)
+
+	before := counterValue(stats, "requests.status.200")
+	rec.Count("requests", 1, map[string]string{"status": "200"})
+	rec.Count("requests", 1, map[string]string{"status": "200"})
+	rec.Timing("request.duration", 2*time.Millisecond, nil)
+
+	if got := counterValue(stats, "requests.status.200"); got != before+2 {
+		t.Errorf("Expected per-status counter to grow by 2, got %d -> %d", before, got)
+	}
+
+	if stats.Get("request.duration.count") == nil || stats.Get("request.duration.total_ms") == nil {
+		t.Error("Expected timing aggregates to be published")
+	}
+
+	// Calling Expvar again must not re-publish (which would panic)
+	Expvar()
+
+	if expvar.Get("goroutines") == nil || expvar.Get("gc") == nil {
+		t.Error("Expected runtime stats to be published")
+	}
+}
+
+// counterValue reads an integer counter from an expvar map
+func counterValue(m *expvar.Map, key string) int64 {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
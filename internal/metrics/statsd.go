@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TagFormat selects how tags are encoded in StatsD lines
+type TagFormat string
+
+const (
+	// TagFormatDogStatsD appends tags as "|#key:value,..." (Datadog)
+	TagFormatDogStatsD TagFormat = "dogstatsd"
+	// TagFormatInfluxDB appends tags to the name as ",key=value" (Telegraf)
+	TagFormatInfluxDB TagFormat = "influxdb"
+	// TagFormatGraphite appends tags to the name as ";key=value"
+	TagFormatGraphite TagFormat = "graphite"
+	// TagFormatNone drops tags entirely (plain StatsD)
+	TagFormatNone TagFormat = "none"
+)
+
+// ParseTagFormat validates a tag format name
+func ParseTagFormat(s string) (TagFormat, error) {
+	switch f := TagFormat(strings.ToLower(s)); f {
+	case TagFormatDogStatsD, TagFormatInfluxDB, TagFormatGraphite, TagFormatNone:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown statsd tag format %q", s)
+}
+
+// StatsD sends metrics to a StatsD/DogStatsD agent over UDP
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	format TagFormat
+}
+
+// NewStatsD creates a StatsD exporter sending to addr
+func NewStatsD(addr, prefix string, format TagFormat) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	return &StatsD{
+		conn:   conn,
+		prefix: prefix,
+		format: format,
+	}, nil
+}
+
+// Count sends a counter increment
+func (s *StatsD) Count(name string, value int64, tags map[string]string) {
+	s.send(name, fmt.Sprintf("%d", value), "c", tags)
+}
+
+// Timing sends a timer sample in milliseconds
+func (s *StatsD) Timing(name string, d time.Duration, tags map[string]string) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.send(name, fmt.Sprintf("%g", ms), "ms", tags)
+}
+
+// Close closes the underlying connection
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+// send writes a single metric line; UDP delivery errors are ignored
+func (s *StatsD) send(name, value, kind string, tags map[string]string) {
+	s.conn.Write([]byte(s.format.line(s.prefix+name, value, kind, tags)))
+}
+
+// line formats a metric according to the tag format
+func (f TagFormat) line(name, value, kind string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+
+	switch f {
+	case TagFormatInfluxDB:
+		for _, k := range keys {
+			fmt.Fprintf(&b, ",%s=%s", k, tags[k])
+		}
+	case TagFormatGraphite:
+		for _, k := range keys {
+			fmt.Fprintf(&b, ";%s=%s", k, tags[k])
+		}
+	}
+
+	fmt.Fprintf(&b, ":%s|%s", value, kind)
+
+	if f == TagFormatDogStatsD && len(keys) > 0 {
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + ":" + tags[k]
+		}
+		b.WriteString("|#" + strings.Join(pairs, ","))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces sensitive header and field values in body logs, the
+// request history and the tail
+const redacted = "[REDACTED]"
+
+// BodyLogConfig configures request/response body logging
+type BodyLogConfig struct {
+	// MaxBytes limits how much of each body is recorded
+	MaxBytes int
+	// RedactHeaders lists header names whose values are masked
+	RedactHeaders []string
+	// RedactFields lists JSON/form field names whose values are masked
+	RedactFields []string
+}
+
+// DefaultBodyLogConfig returns the default body logging configuration
+func DefaultBodyLogConfig() BodyLogConfig {
+	return BodyLogConfig{
+		MaxBytes:      4096,
+		RedactHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+		RedactFields:  []string{"password", "passwd", "secret", "token"},
+	}
+}
+
+// limitedBuffer records up to max bytes and notes whether more was seen
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+// Write records p, never failing so it can be used in a tee
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// captureReader records the request body as the handler reads it
+type captureReader struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyCaptureWriter records the response body as it is written
+type bodyCaptureWriter struct {
+	http.ResponseWriter
+	body *limitedBuffer
+}
+
+// Write records and forwards the response body
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *bodyCaptureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// BodyLogging is a middleware that logs request and response bodies at
+// debug level, masking configured headers and fields
+func BodyLogging(logger *slog.Logger, cfg BodyLogConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger
+			if log == nil {
+				log = slog.Default()
+			}
+
+			if !log.Enabled(r.Context(), slog.LevelDebug) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			reqBody := &limitedBuffer{max: cfg.MaxBytes}
+			r.Body = captureReader{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+
+			respBody := &limitedBuffer{max: cfg.MaxBytes}
+			wrapped := newResponseWriter(&bodyCaptureWriter{ResponseWriter: w, body: respBody})
+
+			next.ServeHTTP(wrapped, r)
+
+			log.Debug("request bodies",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", wrapped.statusCode,
+				"request_headers", redactHeaders(r.Header, cfg.RedactHeaders),
+				"request_body", redactBody(reqBody, r.Header.Get("Content-Type"), cfg.RedactFields),
+				"request_body_truncated", reqBody.truncated,
+				"response_headers", redactHeaders(w.Header(), cfg.RedactHeaders),
+				"response_body", redactBody(respBody, w.Header().Get("Content-Type"), cfg.RedactFields),
+				"response_body_truncated", respBody.truncated,
+			)
+		})
+	}
+}
+
+// redactHeaders returns a copy of h with sensitive values masked
+func redactHeaders(h http.Header, names []string) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		out[k] = v
+	}
+	for _, name := range names {
+		key := http.CanonicalHeaderKey(name)
+		if _, ok := out[key]; ok {
+			out[key] = []string{redacted}
+		}
+	}
+	return out
+}
+
+// redactBody renders a captured body, masking sensitive fields in JSON
+// and URL-encoded form payloads. Truncated JSON is returned as-is since
+// it cannot be parsed reliably.
+func redactBody(b *limitedBuffer, contentType string, fields []string) string {
+	body := b.buf.Bytes()
+	if len(body) == 0 || len(fields) == 0 {
+		return string(body)
+	}
+
+	switch {
+	case strings.Contains(contentType, "json") && !b.truncated:
+		var data any
+		if err := json.Unmarshal(body, &data); err != nil {
+			return string(body)
+		}
+		out, _ := json.Marshal(redactValue(data, fields))
+		return string(out)
+	case strings.Contains(contentType, "application/x-www-form-urlencoded"):
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return string(body)
+		}
+		for key := range values {
+			if matchesField(key, fields) {
+				values[key] = []string{redacted}
+			}
+		}
+		return values.Encode()
+	}
+	return string(body)
+}
+
+// redactValue masks matching keys in a decoded JSON value recursively
+func redactValue(v any, fields []string) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for key, child := range val {
+			if matchesField(key, fields) {
+				val[key] = redacted
+			} else {
+				val[key] = redactValue(child, fields)
+			}
+		}
+	case []any:
+		for i, child := range val {
+			val[i] = redactValue(child, fields)
+		}
+	}
+	return v
+}
+
+// matchesField reports whether key is one of fields (case-insensitive)
+func matchesField(key string, fields []string) bool {
+	for _, f := range fields {
+		if strings.EqualFold(key, f) {
+			return true
+		}
+	}
+	return false
+}
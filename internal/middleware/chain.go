@@ -0,0 +1,44 @@
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler with extra behaviour
+type Middleware func(http.Handler) http.Handler
+
+// Chain is an ordered list of middlewares. Middlewares run in the order
+// they are appended: the first sees the request first and the response
+// last. Chains are immutable; Append returns a new chain.
+type Chain struct {
+	mws []Middleware
+}
+
+// NewChain creates a chain of the given middlewares
+func NewChain(mws ...Middleware) Chain {
+	return Chain{}.Append(mws...)
+}
+
+// Append returns a chain with mws added after the existing middlewares
+func (c Chain) Append(mws ...Middleware) Chain {
+	next := make([]Middleware, 0, len(c.mws)+len(mws))
+	next = append(next, c.mws...)
+	next = append(next, mws...)
+	return Chain{mws: next}
+}
+
+// AppendIf appends the middleware built by mw if cond is true. mw is only
+// called when cond holds, so it may rely on configuration that only exists
+// in that case.
+func (c Chain) AppendIf(cond bool, mw func() Middleware) Chain {
+	if !cond {
+		return c
+	}
+	return c.Append(mw())
+}
+
+// Then wraps h in the chain's middlewares
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c.mws) - 1; i >= 0; i-- {
+		h = c.mws[i](h)
+	}
+	return h
+}
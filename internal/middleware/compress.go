@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// CompressQuery is the query parameter that toggles compression per
+// request: "false" disables it, an encoding name such as "gzip" restricts
+// the choice to that encoding
+const CompressQuery = "compress"
+
+// encodings lists the supported content codings in order of preference
+var encodings = []string{"br", "gzip", "deflate"}
+
+// CompressionConfig configures response compression
+type CompressionConfig struct {
+	// MinSize is the smallest response body, in bytes, worth compressing
+	MinSize int
+}
+
+// DefaultCompressionConfig returns the default compression configuration
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{MinSize: 1024}
+}
+
+// Compression is a middleware that compresses JSON responses with br, gzip
+// or deflate, as negotiated from the Accept-Encoding q-values. Responses
+// smaller than MinSize, already encoded or without a body are sent as is.
+func Compression(cfg CompressionConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			offered := encodings
+			switch q := strings.ToLower(r.URL.Query().Get(CompressQuery)); q {
+			case "false", "off", "0", "identity":
+				offered = nil
+			default:
+				if slices.Contains(encodings, q) {
+					offered = []string{q}
+				}
+			}
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), offered)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: cfg.MinSize}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the offered encoding with the highest q-value
+// in an Accept-Encoding header, preferring earlier offers on ties. It
+// returns "" if none is acceptable.
+func negotiateEncoding(header string, offered []string) string {
+	weights := parseQValues(header)
+	best, bestQ := "", 0.0
+	for _, enc := range offered {
+		q, ok := weights[enc]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// parseQValues parses a header such as "gzip;q=0.8, br" into weights by
+// lower-cased token; tokens without a q parameter weigh 1
+func parseQValues(header string) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(part, ";")
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 0 && v <= 1 {
+					q = v
+				} else {
+					q = 0
+				}
+			}
+		}
+		weights[token] = q
+	}
+	return weights
+}
+
+// compressWriter buffers the start of the body until it knows whether the
+// response is worth compressing, then either passes it through or
+// switches to an encoder
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	status   int
+	buf      bytes.Buffer
+	decided  bool
+	encoder  io.WriteCloser
+}
+
+// WriteHeader defers the status until the encoding is decided
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 {
+		return
+	}
+	// Informational responses go straight through
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	if !cw.eligible() {
+		cw.decide(false)
+	}
+}
+
+// Write buffers up to minSize bytes before deciding
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.encoder != nil {
+			return cw.encoder.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf.Write(b)
+	if cw.buf.Len() >= cw.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush commits to a decision and flushes any encoded data
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(cw.buf.Len() >= cw.minSize)
+	}
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Close sends whatever is buffered and finishes the encoded stream
+func (cw *compressWriter) Close() error {
+	if cw.status == 0 {
+		return nil
+	}
+	if !cw.decided {
+		cw.decide(cw.buf.Len() >= cw.minSize)
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Close()
+	}
+	return nil
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// eligible reports whether the response headers allow compression
+func (cw *compressWriter) eligible() bool {
+	h := cw.Header()
+	if cw.status == http.StatusNoContent || cw.status == http.StatusNotModified || cw.status == http.StatusPartialContent {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// decide writes the headers, starting an encoder if compress is set and
+// the response is eligible, then sends the buffered body
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	if cw.eligible() {
+		h.Add("Vary", "Accept-Encoding")
+		if compress {
+			h.Set("Content-Encoding", cw.encoding)
+			h.Del("Content-Length")
+			cw.encoder = newEncoder(cw.encoding, cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// newEncoder creates an encoder for a supported content coding
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case "br":
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	case "deflate":
+		// HTTP's deflate coding is the zlib format, not raw DEFLATE
+		return zlib.NewWriter(w)
+	default:
+		gw, _ := gzip.NewWriterLevel(w, gzip.DefaultCompression)
+		return gw
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+)
+
+// ConcurrencyConfig configures the in-flight request limit
+type ConcurrencyConfig struct {
+	// MaxInFlight is the number of requests handled at once
+	MaxInFlight int
+	// QueueDepth is the number of requests allowed to wait for a slot
+	QueueDepth int
+	// QueueTimeout is how long a queued request waits before being shed
+	QueueTimeout time.Duration
+}
+
+// Concurrency is a middleware that limits the number of requests handled
+// at once. Excess requests wait in a bounded queue; once the queue is full,
+// or a request has waited for QueueTimeout, it is shed with 503 so the
+// server degrades predictably instead of letting latency grow unbounded.
+func Concurrency(cfg ConcurrencyConfig) func(http.Handler) http.Handler {
+	slots := make(chan struct{}, cfg.MaxInFlight)
+	var queued atomic.Int64
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				if !wait(r, slots, &queued, cfg) {
+					w.Header().Set("Retry-After", "1")
+					handlers.JSONError(w, r, http.StatusServiceUnavailable, "Server overloaded")
+					return
+				}
+			}
+			defer func() { <-slots }()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// wait queues the request for a slot, reporting whether it got one
+func wait(r *http.Request, slots chan struct{}, queued *atomic.Int64, cfg ConcurrencyConfig) bool {
+	if queued.Add(1) > int64(cfg.QueueDepth) {
+		queued.Add(-1)
+		return false
+	}
+	defer queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+)
+
+// CORSConfig configures the CORS policy
+type CORSConfig struct {
+	// AllowedOrigins lists allowed origins; "*" allows any, and an entry
+	// such as "https://*.example.com" allows any subdomain
+	AllowedOrigins []string
+	// AllowedMethods lists methods allowed in preflight requests
+	AllowedMethods []string
+	// AllowedHeaders lists request headers allowed in preflight requests;
+	// "*" allows whatever the client asks for
+	AllowedHeaders []string
+	// ExposedHeaders lists response headers readable by the browser
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and auth headers; the origin is then
+	// echoed instead of answering "*"
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight results
+	MaxAge time.Duration
+}
+
+// DefaultCORSConfig returns the default CORS policy, with no origins allowed
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"*"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// CORS is a middleware applying a CORS policy. Preflight requests are
+// answered directly with 204, or 403 if the origin, method or headers are
+// not allowed. The decision is attached to the request context for the
+// /cors-echo endpoint.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			d := &handlers.CORSDecision{Enabled: true, Origin: origin, Preflight: preflight}
+			r = r.WithContext(handlers.WithCORSDecision(r.Context(), d))
+
+			switch {
+			case origin == "":
+				d.Reason = "no Origin header"
+			case !cfg.originAllowed(origin):
+				d.Reason = "origin not allowed"
+			default:
+				d.Allowed = true
+				d.Reason = "origin allowed"
+			}
+
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				if d.Allowed {
+					cfg.preflight(w, r, d)
+				}
+				if !d.Allowed {
+					handlers.JSONError(w, r, http.StatusForbidden, "CORS preflight rejected: "+d.Reason)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if d.Allowed {
+				cfg.allowOrigin(w, origin, d)
+				if len(cfg.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// preflight checks the requested method and headers, setting the
+// preflight response headers if they are allowed
+func (cfg CORSConfig) preflight(w http.ResponseWriter, r *http.Request, d *handlers.CORSDecision) {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !containsFold(cfg.AllowedMethods, method) {
+		d.Allowed = false
+		d.Reason = "method " + method + " not allowed"
+		return
+	}
+
+	requested := splitHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+	if !containsFold(cfg.AllowedHeaders, "*") {
+		for _, h := range requested {
+			if !containsFold(cfg.AllowedHeaders, h) {
+				d.Allowed = false
+				d.Reason = "header " + h + " not allowed"
+				return
+			}
+		}
+	}
+
+	d.Reason = "preflight allowed"
+	d.Methods = cfg.AllowedMethods
+	d.Headers = requested
+	d.MaxAge = int(cfg.MaxAge.Seconds())
+
+	cfg.allowOrigin(w, r.Header.Get("Origin"), d)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+	if len(requested) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if d.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(d.MaxAge))
+	}
+}
+
+// allowOrigin sets the origin and credentials headers
+func (cfg CORSConfig) allowOrigin(w http.ResponseWriter, origin string, d *handlers.CORSDecision) {
+	if containsFold(cfg.AllowedOrigins, "*") && !cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		d.Credentials = true
+	}
+}
+
+// originAllowed matches origin against the allowed origins
+func (cfg CORSConfig) originAllowed(origin string) bool {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok &&
+			len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+			strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitHeaderList splits a comma-separated header value
+func splitHeaderList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+package middleware
+
+import "net/http"
+
+// Header is a middleware that sets a fixed header on every response
+func Header(key, value string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(key, value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/history"
+)
+
+// History is a middleware that records every handled request in log,
+// with the values of the redact headers masked. Admin and debug requests
+// are left out so that inspecting the history does not fill it.
+func History(log *history.Log, redact []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if handlers.AdminPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			wrapped := newResponseWriter(w)
+			next.ServeHTTP(wrapped, r)
+
+			log.Add(requestEvent(r, wrapped.statusCode, start, redact))
+		})
+	}
+}
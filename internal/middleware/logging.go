@@ -1,7 +1,7 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -11,6 +11,7 @@ type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	written    bool
+	bytes      int64
 }
 
 // newResponseWriter creates a new responseWriter
@@ -24,6 +25,13 @@ func newResponseWriter(w http.ResponseWriter) *responseWriter {
 
 // WriteHeader captures the status code
 func (rw *responseWriter) WriteHeader(code int) {
+	// Informational responses go straight through
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		if !rw.written {
+			rw.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
 	if !rw.written {
 		rw.statusCode = code
 		rw.written = true
@@ -36,25 +44,57 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	if !rw.written {
 		rw.WriteHeader(http.StatusOK)
 	}
-	return rw.ResponseWriter.Write(b)
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
 // Logging is a middleware that logs HTTP requests and responses
+// to the default logger
 func Logging(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+	return LoggingTo(nil)(next)
+}
 
-		// Wrap the response writer to capture status code
-		wrapped := newResponseWriter(w)
+// LoggingTo is a middleware that logs HTTP requests and responses to
+// logger, falling back to the default logger when logger is nil
+func LoggingTo(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
 
-		// Log the incoming request
-		log.Printf("[%s] %s %s from %s", r.Method, r.URL.Path, r.Proto, r.RemoteAddr)
+			log := logger
+			if log == nil {
+				log = slog.Default()
+			}
 
-		// Call the next handler
-		next.ServeHTTP(wrapped, r)
+			// Wrap the response writer to capture status code
+			wrapped := newResponseWriter(w)
 
-		// Log the response
-		duration := time.Since(start)
-		log.Printf("[%s] %s %s - %d (%v)", r.Method, r.URL.Path, r.Proto, wrapped.statusCode, duration)
-	})
+			// Log the incoming request
+			log.Debug("request started",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"proto", r.Proto,
+				"remote_addr", r.RemoteAddr,
+			)
+
+			// Call the next handler
+			next.ServeHTTP(wrapped, r)
+
+			// Log the response
+			log.Info("request completed",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"proto", r.Proto,
+				"remote_addr", r.RemoteAddr,
+				"status", wrapped.statusCode,
+				"duration", time.Since(start),
+			)
+		})
+	}
 }
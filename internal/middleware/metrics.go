@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/metrics"
+)
+
+// Metrics is a middleware that records request counters and timings
+func Metrics(rec metrics.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			// Wrap the response writer to capture status code
+			wrapped := newResponseWriter(w)
+			next.ServeHTTP(wrapped, r)
+
+			tags := map[string]string{
+				"method": r.Method,
+				"status": strconv.Itoa(wrapped.statusCode),
+			}
+			rec.Count("requests", 1, tags)
+			rec.Count("response.bytes", wrapped.bytes, tags)
+			rec.Timing("request.duration", time.Since(start), tags)
+		})
+	}
+}
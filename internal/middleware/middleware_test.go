@@ -1,9 +1,25 @@
 package middleware
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/ratelimit"
+	"github.com/andybalholm/brotli"
 )
 
 // TestLoggingMiddleware tests that the logging middleware doesn't break the request flow
@@ -133,3 +149,795 @@ func TestResponseWriterImplicitOK(t *testing.T) {
 		t.Errorf("Expected status 200 (implicit), got %d", rr.Code)
 	}
 }
+
+// fakeRecorder collects metrics for assertions
+type fakeRecorder struct {
+	counts  map[string]int64
+	timings map[string]int
+	tags    map[string]string
+}
+
+func (f *fakeRecorder) Count(name string, value int64, tags map[string]string) {
+	f.counts[name] += value
+	f.tags = tags
+}
+
+func (f *fakeRecorder) Timing(name string, d time.Duration, tags map[string]string) {
+	f.timings[name]++
+}
+
+// TestMetricsMiddleware tests that request counters and timings are recorded
+func TestMetricsMiddleware(t *testing.T) {
+	rec := &fakeRecorder{counts: map[string]int64{}, timings: map[string]int{}}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	wrapped := Metrics(rec)(handler)
+	req := httptest.NewRequest("DELETE", "/test", nil)
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	if rec.counts["requests"] != 1 {
+		t.Errorf("Expected 1 request counted, got %d", rec.counts["requests"])
+	}
+
+	if rec.timings["request.duration"] != 1 {
+		t.Errorf("Expected 1 timing sample, got %d", rec.timings["request.duration"])
+	}
+
+	if rec.tags["method"] != "DELETE" || rec.tags["status"] != "418" {
+		t.Errorf("Unexpected tags: %v", rec.tags)
+	}
+}
+
+// TestLoggingToLogger tests that request logs go to the given logger
+func TestLoggingToLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	wrapped := LoggingTo(logger)(handler)
+	req := httptest.NewRequest("PUT", "/access", nil)
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to parse log record: %v (%q)", err, buf.String())
+	}
+
+	if record["path"] != "/access" || record["status"] != float64(http.StatusAccepted) {
+		t.Errorf("Unexpected log record: %v", record)
+	}
+}
+
+// TestBodyLogging tests body capture, truncation and redaction
+func TestBodyLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"echo":` + string(body) + `,"token":"abc"}`))
+	})
+
+	cfg := DefaultBodyLogConfig()
+	wrapped := BodyLogging(logger, cfg)(handler)
+
+	req := httptest.NewRequest("POST", "/post", strings.NewReader(`{"user":"bob","password":"hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	// The handler must still see the full, unredacted body
+	if !strings.Contains(rr.Body.String(), "hunter2") {
+		t.Errorf("Expected handler to receive original body, got %q", rr.Body.String())
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to parse log record: %v (%q)", err, buf.String())
+	}
+
+	if got := record["request_body"].(string); strings.Contains(got, "hunter2") || !strings.Contains(got, "bob") {
+		t.Errorf("Expected password to be redacted from request body, got %q", got)
+	}
+
+	if got := record["response_body"].(string); strings.Contains(got, "abc") {
+		t.Errorf("Expected token to be redacted from response body, got %q", got)
+	}
+
+	headers := record["request_headers"].(map[string]any)
+	if auth := headers["Authorization"].([]any); auth[0] != "[REDACTED]" {
+		t.Errorf("Expected Authorization header to be redacted, got %v", auth)
+	}
+}
+
+// TestBodyLoggingTruncation tests that bodies are capped at MaxBytes
+func TestBodyLoggingTruncation(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	})
+
+	wrapped := BodyLogging(logger, BodyLogConfig{MaxBytes: 4})(handler)
+	req := httptest.NewRequest("POST", "/post", strings.NewReader("0123456789"))
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	if rr.Body.String() != "0123456789" {
+		t.Errorf("Expected full body to be echoed, got %q", rr.Body.String())
+	}
+
+	var record map[string]any
+	json.Unmarshal(buf.Bytes(), &record)
+
+	if record["request_body"] != "0123" || record["request_body_truncated"] != true {
+		t.Errorf("Expected truncated request body, got %v", record)
+	}
+	if record["response_body"] != "0123" || record["response_body_truncated"] != true {
+		t.Errorf("Expected truncated response body, got %v", record)
+	}
+}
+
+// TestRateLimit tests 429 responses and rate limit headers
+func TestRateLimit(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrapped := RateLimit(ratelimit.NewTokenBucket(1, 2), ClientIPKey)(handler)
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		wrapped.ServeHTTP(rr, httptest.NewRequest("GET", "/get", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to pass, got %d", i+1, rr.Code)
+		}
+		if rr.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("Expected RateLimit-Limit 2, got %q", rr.Header().Get("RateLimit-Limit"))
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	wrapped.ServeHTTP(rr, httptest.NewRequest("GET", "/get", nil))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", rr.Header().Get("Retry-After"))
+	}
+	if rr.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected RateLimit-Remaining 0, got %q", rr.Header().Get("RateLimit-Remaining"))
+	}
+
+	// A different client has its own bucket
+	req := httptest.NewRequest("GET", "/get", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	rr = httptest.NewRecorder()
+	wrapped.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected other client to pass, got %d", rr.Code)
+	}
+}
+
+// failingLimiter always returns an error
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(string) (ratelimit.Decision, error) {
+	return ratelimit.Decision{}, errors.New("backend down")
+}
+
+// TestRateLimitFailOpen tests that limiter errors let requests through
+func TestRateLimitFailOpen(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rr := httptest.NewRecorder()
+	RateLimit(failingLimiter{}, GlobalKey)(handler).ServeHTTP(rr, httptest.NewRequest("GET", "/get", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected request to pass when limiter fails, got %d", rr.Code)
+	}
+}
+
+// TestConcurrency tests queueing and shedding beyond the in-flight limit
+func TestConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrapped := Concurrency(ConcurrencyConfig{MaxInFlight: 1, QueueDepth: 1, QueueTimeout: time.Second})(handler)
+
+	serve := func() <-chan int {
+		done := make(chan int, 1)
+		go func() {
+			rr := httptest.NewRecorder()
+			wrapped.ServeHTTP(rr, httptest.NewRequest("GET", "/get", nil))
+			done <- rr.Code
+		}()
+		return done
+	}
+
+	first := serve()
+	<-started
+	second := serve()
+
+	// Give the second request time to be queued, then overflow the queue
+	time.Sleep(20 * time.Millisecond)
+	rr := httptest.NewRecorder()
+	wrapped.ServeHTTP(rr, httptest.NewRequest("GET", "/get", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected request beyond the queue to be shed with 503, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After on shed request")
+	}
+
+	close(release)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("Expected first request to succeed, got %d", code)
+	}
+	if code := <-second; code != http.StatusOK {
+		t.Errorf("Expected queued request to succeed, got %d", code)
+	}
+}
+
+// TestConcurrencyQueueTimeout tests that queued requests are shed after the timeout
+func TestConcurrencyQueueTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	wrapped := Concurrency(ConcurrencyConfig{MaxInFlight: 1, QueueDepth: 1, QueueTimeout: 20 * time.Millisecond})(handler)
+
+	go wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/get", nil))
+	<-started
+
+	rr := httptest.NewRecorder()
+	wrapped.ServeHTTP(rr, httptest.NewRequest("GET", "/get", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected queued request to be shed with 503, got %d", rr.Code)
+	}
+}
+
+// TestTimeout tests handler timeouts and the X-Timeout override
+func TestTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.Header().Set("X-Late", "true")
+		w.WriteHeader(http.StatusOK)
+	})
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Fast", "true")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("done"))
+	})
+
+	tests := []struct {
+		name           string
+		handler        http.Handler
+		def, max       time.Duration
+		header         string
+		expectedStatus int
+	}{
+		{"Default timeout expires", slow, 20 * time.Millisecond, time.Minute, "", http.StatusGatewayTimeout},
+		{"Fast handler passes", fast, 20 * time.Millisecond, time.Minute, "", http.StatusCreated},
+		{"Header sets timeout", slow, 0, time.Minute, "20ms", http.StatusGatewayTimeout},
+		{"Header in seconds", slow, 0, time.Minute, "0.02", http.StatusGatewayTimeout},
+		{"Header capped at max", slow, 0, 20 * time.Millisecond, "10s", http.StatusGatewayTimeout},
+		{"Header of zero disables", fast, 20 * time.Millisecond, time.Minute, "0", http.StatusCreated},
+		{"Invalid header", fast, 0, time.Minute, "soon", http.StatusBadRequest},
+		{"Negative header", fast, 0, time.Minute, "-1s", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/get", nil)
+			if tt.header != "" {
+				req.Header.Set(TimeoutHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			start := time.Now()
+			Timeout(tt.def, tt.max)(tt.handler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			switch rr.Code {
+			case http.StatusGatewayTimeout:
+				if time.Since(start) > 500*time.Millisecond {
+					t.Error("Expected timeout to cut the handler short")
+				}
+				if !strings.Contains(rr.Header().Get("Content-Type"), "application/json") {
+					t.Error("Expected JSON error body")
+				}
+				if rr.Header().Get("X-Late") != "" {
+					t.Error("Expected headers set after the timeout to be dropped")
+				}
+			case http.StatusCreated:
+				if rr.Header().Get("X-Fast") != "true" || rr.Body.String() != "done" {
+					t.Error("Expected handler response to pass through")
+				}
+			}
+		})
+	}
+}
+
+// TestCORS tests simple and preflight requests against a CORS policy
+func TestCORS(t *testing.T) {
+	cfg := DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://app.example.com", "https://*.test.example"}
+	cfg.AllowedHeaders = []string{"Content-Type", "Authorization"}
+	cfg.ExposedHeaders = []string{"X-Request-Id"}
+	cfg.AllowCredentials = true
+
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		requestMethod  string
+		requestHeaders string
+		expectedStatus int
+		expectedOrigin string
+		expectedReason string
+	}{
+		{"Simple allowed", "GET", "https://app.example.com", "", "", http.StatusOK, "https://app.example.com", "origin allowed"},
+		{"Simple wildcard subdomain", "GET", "https://a.test.example", "", "", http.StatusOK, "https://a.test.example", "origin allowed"},
+		{"Simple disallowed", "GET", "https://evil.example", "", "", http.StatusOK, "", "origin not allowed"},
+		{"No origin", "GET", "", "", "", http.StatusOK, "", "no Origin header"},
+		{"Plain OPTIONS passes through", "OPTIONS", "https://app.example.com", "", "", http.StatusOK, "https://app.example.com", "origin allowed"},
+		{"Preflight allowed", "OPTIONS", "https://app.example.com", "PUT", "content-type", http.StatusNoContent, "https://app.example.com", ""},
+		{"Preflight bad method", "OPTIONS", "https://app.example.com", "TRACE", "", http.StatusForbidden, "", ""},
+		{"Preflight bad header", "OPTIONS", "https://app.example.com", "GET", "X-Secret", http.StatusForbidden, "", ""},
+		{"Preflight bad origin", "OPTIONS", "https://evil.example", "GET", "", http.StatusForbidden, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/cors-echo", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			if tt.requestHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+			rr := httptest.NewRecorder()
+
+			CORS(cfg)(http.HandlerFunc(handlers.CORSEchoHandler)).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.expectedOrigin, got)
+			}
+			if !strings.Contains(strings.Join(rr.Header().Values("Vary"), ","), "Origin") {
+				t.Error("Expected Vary: Origin")
+			}
+
+			if tt.expectedStatus == http.StatusNoContent {
+				if rr.Header().Get("Access-Control-Max-Age") != "600" {
+					t.Errorf("Expected Access-Control-Max-Age 600, got %q", rr.Header().Get("Access-Control-Max-Age"))
+				}
+				if rr.Header().Get("Access-Control-Allow-Headers") != "content-type" {
+					t.Errorf("Expected requested headers to be allowed, got %q", rr.Header().Get("Access-Control-Allow-Headers"))
+				}
+			}
+
+			if tt.expectedReason != "" {
+				var resp handlers.CORSEchoResponse
+				if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if resp.Decision.Reason != tt.expectedReason {
+					t.Errorf("Expected reason %q, got %q", tt.expectedReason, resp.Decision.Reason)
+				}
+				if tt.expectedOrigin != "" && resp.ResponseHeaders["Access-Control-Allow-Credentials"] != "true" {
+					t.Error("Expected credentials header to be reported")
+				}
+			}
+		})
+	}
+}
+
+// TestCORSAnyOrigin tests that "*" is answered literally without credentials
+func TestCORSAnyOrigin(t *testing.T) {
+	cfg := DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"*"}
+
+	req := httptest.NewRequest("GET", "/get", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	rr := httptest.NewRecorder()
+	CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected Access-Control-Allow-Origin *, got %q", got)
+	}
+}
+
+// TestCompression tests encoding negotiation, thresholds and the query toggle
+func TestCompression(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("a", 2048) + `"}`
+	jsonHandler := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		})
+	}
+	textHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(large))
+	})
+
+	tests := []struct {
+		name             string
+		handler          http.Handler
+		acceptEncoding   string
+		query            string
+		expectedEncoding string
+	}{
+		{"gzip", jsonHandler(large), "gzip", "", "gzip"},
+		{"deflate", jsonHandler(large), "deflate", "", "deflate"},
+		{"br preferred on tie", jsonHandler(large), "gzip, deflate, br", "", "br"},
+		{"q-values respected", jsonHandler(large), "br;q=0.5, gzip;q=0.9", "", "gzip"},
+		{"q=0 refuses", jsonHandler(large), "gzip;q=0", "", ""},
+		{"wildcard", jsonHandler(large), "*", "", "br"},
+		{"wildcard with exclusion", jsonHandler(large), "br;q=0, *", "", "gzip"},
+		{"no Accept-Encoding", jsonHandler(large), "", "", ""},
+		{"below threshold", jsonHandler(`{"small":true}`), "gzip", "", ""},
+		{"non-JSON", textHandler, "gzip", "", ""},
+		{"query disables", jsonHandler(large), "gzip, br", "compress=false", ""},
+		{"query selects encoding", jsonHandler(large), "gzip, br", "compress=gzip", "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/get?"+tt.query, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+
+			Compression(DefaultCompressionConfig())(tt.handler).ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tt.expectedEncoding, got)
+			}
+
+			var body io.Reader = rr.Body
+			switch tt.expectedEncoding {
+			case "gzip":
+				zr, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatalf("Failed to open gzip body: %v", err)
+				}
+				body = zr
+			case "deflate":
+				zr, err := zlib.NewReader(rr.Body)
+				if err != nil {
+					t.Fatalf("Failed to open deflate body: %v", err)
+				}
+				body = zr
+			case "br":
+				body = brotli.NewReader(rr.Body)
+			}
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("Failed to decode body: %v", err)
+			}
+			if tt.expectedEncoding != "" && string(decoded) != large {
+				t.Error("Expected decoded body to match the original")
+			}
+		})
+	}
+}
+
+// TestChain tests middleware ordering and conditional inclusion
+func TestChain(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	base := NewChain(tag("a"))
+	chain := base.
+		Append(tag("b")).
+		AppendIf(false, func() Middleware {
+			t.Error("Excluded middleware was built")
+			return tag("skipped")
+		}).
+		AppendIf(true, func() Middleware { return tag("c") })
+
+	handler := chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got := strings.Join(order, ","); got != "a,b,c,handler" {
+		t.Errorf("Expected order a,b,c,handler, got %s", got)
+	}
+
+	// Appending must not change the chain it was derived from
+	order = nil
+	base.Then(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(order, ","); got != "a" {
+		t.Errorf("Expected base chain to run a only, got %s", got)
+	}
+}
+
+// TestRecover tests that panics become 500 responses
+func TestRecover(t *testing.T) {
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rr.Code)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body["error"] == "" {
+		t.Errorf("Expected JSON error body, got %q", rr.Body.String())
+	}
+
+	// Deliberate aborts still propagate to the server
+	abort := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("Expected ErrAbortHandler to propagate, got %v", p)
+		}
+	}()
+	abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+// TestTimeoutTrailers tests that trailers set after a flush are passed on
+func TestTimeoutTrailers(t *testing.T) {
+	handler := Timeout(time.Minute, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("body"))
+		w.(http.Flusher).Flush()
+		w.Header().Set("X-Checksum", "abc")
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got := resp.Trailer.Get("X-Checksum"); got != "abc" {
+		t.Errorf("Expected trailer abc, got %q", got)
+	}
+}
+
+// TestInterimResponses tests that 1xx responses pass through the logging
+// and timeout writers without being taken as the final status
+func TestInterimResponses(t *testing.T) {
+	handler := Logging(Timeout(time.Minute, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusProcessing)
+		w.WriteHeader(http.StatusCreated)
+	})))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	var interim []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, _ textproto.MIMEHeader) error {
+			interim = append(interim, code)
+			return nil
+		},
+	}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", resp.StatusCode)
+	}
+	if len(interim) != 1 || interim[0] != http.StatusProcessing {
+		t.Errorf("Expected one 102 response, got %v", interim)
+	}
+}
+
+// TestTimeoutLargeBody tests that large bodies are committed once the
+// buffer fills rather than held in memory until the handler returns
+func TestTimeoutLargeBody(t *testing.T) {
+	const size = 1 << 20
+	chunk := bytes.Repeat([]byte("x"), 4096)
+	rr := httptest.NewRecorder()
+	handler := Timeout(time.Minute, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := w.Write(chunk); err != nil {
+				t.Errorf("Write failed: %v", err)
+				return
+			}
+			if written == 2*timeoutBufferMax && rr.Body.Len() < timeoutBufferMax {
+				t.Errorf("Expected the response to be committed after %d bytes, %d written through", written, rr.Body.Len())
+			}
+		}
+	}))
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/large", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.Len() != size {
+		t.Errorf("Expected %d bytes with status 200, got %d bytes with %d", size, rr.Body.Len(), rr.Code)
+	}
+}
+
+// TestTimeoutHijack tests that handlers can hijack the connection under
+// the timeout middleware, and that it leaves the connection alone
+// afterwards whether the handler returns or times out
+func TestTimeoutHijack(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		hold    time.Duration
+	}{
+		{"returns in time", time.Minute, 0},
+		{"outlives the timeout", 20 * time.Millisecond, 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Timeout(tt.timeout, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, _, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Errorf("Hijack failed: %v", err)
+					return
+				}
+				defer conn.Close()
+				time.Sleep(tt.hold)
+				conn.Write([]byte("HTTP/1.1 202 Accepted\r\nContent-Length: 2\r\n\r\nok"))
+			}))
+			var serverLog bytes.Buffer
+			srv := httptest.NewUnstartedServer(handler)
+			srv.Config.ErrorLog = log.New(&serverLog, "", 0)
+			srv.Start()
+
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusAccepted || string(body) != "ok" {
+				t.Errorf("Expected the hijacked response, got %d %q", resp.StatusCode, body)
+			}
+			// Let the middleware finish with the connection before checking
+			time.Sleep(50 * time.Millisecond)
+			srv.Close()
+			if serverLog.Len() > 0 {
+				t.Errorf("Expected no server errors, got %q", serverLog.String())
+			}
+		})
+	}
+}
+
+// TestMirror tests that requests are copied to the mirror URL without
+// changing the primary response
+func TestMirror(t *testing.T) {
+	type received struct {
+		method, uri, host, marker string
+		body                      string
+	}
+	copies := make(chan received, 10)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		copies <- received{r.Method, r.RequestURI, r.Header.Get("X-Forwarded-Host"), r.Header.Get(MirrorHeader), string(body)}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer target.Close()
+
+	mirror, err := NewMirror(MirrorConfig{URL: target.URL + "/shadow", Timeout: time.Second, QueueSize: 10, MaxBody: 16})
+	if err != nil {
+		t.Fatalf("NewMirror failed: %v", err)
+	}
+	defer mirror.Close()
+
+	// The handler reads only part of the body; the copy gets all of it
+	handler := mirror.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadFull(r.Body, make([]byte, 3))
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		mirrored bool
+	}{
+		{"post with body", "POST", "/post?x=1", "hello world", true},
+		{"get", "GET", "/get", "", true},
+		{"admin request", "GET", "/admin/requests", "", false},
+		{"body too large", "POST", "/post", strings.Repeat("x", 17), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rr.Code != http.StatusCreated {
+				t.Errorf("Expected primary status 201, got %d", rr.Code)
+			}
+
+			select {
+			case c := <-copies:
+				if !tt.mirrored {
+					t.Fatalf("Expected no copy, got %+v", c)
+				}
+				want := received{tt.method, "/shadow" + tt.path, "example.com", "true", tt.body}
+				if c != want {
+					t.Errorf("Expected copy %+v, got %+v", want, c)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tt.mirrored {
+					t.Fatal("Timed out waiting for the copy")
+				}
+			}
+		})
+	}
+
+	// A full queue drops copies instead of blocking
+	blocked := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-blocked }))
+	defer slow.Close()
+	defer close(blocked)
+	stuck, _ := NewMirror(MirrorConfig{URL: slow.URL, Timeout: 5 * time.Second, QueueSize: 1, MaxBody: 16})
+	defer stuck.Close()
+
+	done := make(chan struct{})
+	go func() {
+		h := stuck.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for range mirrorWorkers + 10 {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/get", nil))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Requests blocked on a full mirror queue")
+	}
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+)
+
+// MirrorHeader marks mirrored requests so the receiver can tell them apart
+const MirrorHeader = "X-Httpbin-Mirror"
+
+// mirrorWorkers is the number of requests mirrored at once
+const mirrorWorkers = 4
+
+// mirrorDroppedHeaders describe the original connection and are not
+// copied to mirrored requests
+var mirrorDroppedHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer",
+	"Transfer-Encoding", "Upgrade", "Content-Length", "Accept-Encoding",
+}
+
+// MirrorConfig configures request mirroring
+type MirrorConfig struct {
+	// URL receives the copies; the request path and query are appended to
+	// its path
+	URL string
+	// Timeout bounds each mirrored request
+	Timeout time.Duration
+	// QueueSize is the number of copies waiting to be sent; further copies
+	// are dropped
+	QueueSize int
+	// MaxBody is the largest body mirrored; requests with larger bodies
+	// are not mirrored
+	MaxBody int64
+}
+
+// DefaultMirrorConfig returns the default mirroring settings
+func DefaultMirrorConfig() MirrorConfig {
+	return MirrorConfig{
+		Timeout:   5 * time.Second,
+		QueueSize: 100,
+		MaxBody:   1 << 20,
+	}
+}
+
+// mirrored is a request copy waiting to be sent
+type mirrored struct {
+	method string
+	url    string
+	header http.Header
+	body   []byte
+}
+
+// Mirror sends a copy of every request to another URL in the background.
+// Copies are sent after the primary response by a few workers; when they
+// fall behind, copies are dropped rather than delaying requests.
+type Mirror struct {
+	cfg    MirrorConfig
+	target *url.URL
+	client *http.Client
+	logger *slog.Logger
+
+	mu     sync.RWMutex
+	queue  chan mirrored
+	closed bool
+}
+
+// NewMirror starts the workers mirroring requests to cfg.URL
+func NewMirror(cfg MirrorConfig) (*Mirror, error) {
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mirror{
+		cfg:    cfg,
+		target: target,
+		client: &http.Client{Timeout: cfg.Timeout},
+		logger: slog.Default(),
+		queue:  make(chan mirrored, cfg.QueueSize),
+	}
+	for range mirrorWorkers {
+		go m.work()
+	}
+	return m, nil
+}
+
+// Close stops mirroring; copies already queued are still sent
+func (m *Mirror) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	return nil
+}
+
+// Middleware copies each request, including the body the handler reads,
+// and queues the copy once the handler returns. Admin and debug requests
+// are not mirrored.
+func (m *Mirror) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handlers.AdminPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Record the body as the handler reads it, so slow readers are
+		// not affected, and collect what it left unread afterwards
+		body := &limitedBuffer{max: int(m.cfg.MaxBody)}
+		original := r.Body
+		r.Body = captureReader{Reader: io.TeeReader(original, body), Closer: original}
+
+		next.ServeHTTP(w, r)
+
+		_, err := io.Copy(body, io.LimitReader(original, m.cfg.MaxBody+1))
+		if (err != nil && !errors.Is(err, http.ErrBodyReadAfterClose)) || body.truncated {
+			m.logger.Debug("Request not mirrored", "path", r.URL.Path, "reason", "body unreadable or too large")
+			return
+		}
+		m.enqueue(mirrored{
+			method: r.Method,
+			url:    m.targetURL(r.URL),
+			header: mirrorHeader(r),
+			body:   body.buf.Bytes(),
+		})
+	})
+}
+
+// targetURL maps a request URL onto the mirror URL
+func (m *Mirror) targetURL(u *url.URL) string {
+	target := *m.target
+	target.Path = m.target.Path + u.Path
+	target.RawPath = ""
+	target.RawQuery = u.RawQuery
+	return target.String()
+}
+
+// mirrorHeader copies the request headers, keeping the original host
+func mirrorHeader(r *http.Request) http.Header {
+	header := r.Header.Clone()
+	for _, name := range mirrorDroppedHeaders {
+		header.Del(name)
+	}
+	header.Set(MirrorHeader, "true")
+	header.Set("X-Forwarded-Host", r.Host)
+	return header
+}
+
+// enqueue queues a copy without blocking
+func (m *Mirror) enqueue(req mirrored) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return
+	}
+	select {
+	case m.queue <- req:
+	default:
+		m.logger.Debug("Mirror queue full, dropping request", "url", req.url)
+	}
+}
+
+// work sends queued copies until the mirror is closed
+func (m *Mirror) work() {
+	for req := range m.queue {
+		if err := m.send(req); err != nil {
+			m.logger.Debug("Mirroring request failed", "url", req.url, "error", err)
+		}
+	}
+}
+
+// send delivers one copy, discarding the answer
+func (m *Mirror) send(req mirrored) error {
+	out, err := http.NewRequest(req.method, req.url, bytes.NewReader(req.body))
+	if err != nil {
+		return err
+	}
+	out.Header = req.header
+
+	resp, err := m.client.Do(out)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
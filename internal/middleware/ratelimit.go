@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/ratelimit"
+)
+
+// RateLimit is a middleware that rejects requests exceeding the limiter's
+// quota with 429. key maps a request to its bucket, e.g. per client IP.
+// Every response carries RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers; rejected ones also carry Retry-After.
+func RateLimit(limiter ratelimit.Limiter, key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d, err := limiter.Allow(key(r))
+			if err != nil {
+				// Fail open: a broken limiter backend must not take the service down
+				slog.Warn("rate limiter unavailable", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+
+			if !d.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(d.RetryAfter), 1)))
+				handlers.JSONError(w, r, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GlobalKey puts all requests in a single bucket
+func GlobalKey(*http.Request) string {
+	return "global"
+}
+
+// ClientIPKey buckets requests by client IP
+func ClientIPKey(r *http.Request) string {
+	return handlers.OriginIP(r)
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/tail"
+)
+
+// Tail is a middleware that publishes an event per handled request to
+// hub, with the values of the redact headers masked
+func Tail(hub *tail.Hub, redact []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Skip the bookkeeping entirely when nobody is watching
+			if !hub.Active() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			wrapped := newResponseWriter(w)
+			next.ServeHTTP(wrapped, r)
+
+			hub.Publish(requestEvent(r, wrapped.statusCode, start, redact))
+		})
+	}
+}
+
+// requestEvent describes a request handled since start, masking the
+// values of the redact headers
+func requestEvent(r *http.Request, status int, start time.Time, redact []string) tail.Event {
+	return tail.Event{
+		Time:       start.UTC(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Status:     status,
+		DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+		RemoteAddr: r.RemoteAddr,
+		Headers:    redactHeaders(r.Header, redact),
+	}
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+)
+
+// TimeoutHeader lets a client choose the handler timeout for its request
+const TimeoutHeader = "X-Timeout"
+
+// timeoutBufferMax is how much of the body is held back before the
+// response is committed, after which a 504 can no longer be sent
+const timeoutBufferMax = 64 << 10
+
+// Timeout is a middleware that bounds how long a handler may run. The
+// timeout is def unless the request sets X-Timeout (a duration such as
+// "1.5s", or plain seconds), which is capped at max; zero disables it.
+// When the timeout expires the request context is cancelled and, unless
+// the handler has already started responding or hijacked the connection,
+// a 504 is returned. Responses start once the handler flushes or writes
+// more than 64KiB, so large bodies are never held in memory.
+func Timeout(def, max time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := def
+			if raw := r.Header.Get(TimeoutHeader); raw != "" {
+				d, err := parseTimeout(raw)
+				if err != nil {
+					handlers.JSONError(w, r, http.StatusBadRequest, "Invalid "+TimeoutHeader+" header")
+					return
+				}
+				timeout = d
+				if max > 0 && timeout > max {
+					timeout = max
+				}
+			}
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{w: w, h: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				// A hijacked connection belongs to the handler
+				if tw.hijacked {
+					return
+				}
+				tw.flush()
+				tw.copyTrailers()
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if !tw.wroteHeader && !tw.hijacked {
+					handlers.JSONError(w, r, http.StatusGatewayTimeout, "Handler timed out after "+timeout.String())
+				}
+			}
+		})
+	}
+}
+
+// parseTimeout accepts a Go duration or a number of seconds
+func parseTimeout(raw string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(raw, 64); err == nil {
+		if secs < 0 {
+			return 0, strconv.ErrRange
+		}
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err == nil && d < 0 {
+		return 0, strconv.ErrRange
+	}
+	return d, err
+}
+
+// timeoutWriter keeps the handler from touching the real response after
+// the timeout. Headers are kept separately until the status is written,
+// and body writes are buffered until the handler flushes, returns or
+// fills the buffer.
+// It deliberately has no Unwrap, which would let writes bypass the guard,
+// but handlers may still hijack the connection before writing.
+type timeoutWriter struct {
+	mu          sync.Mutex
+	w           http.ResponseWriter
+	h           http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+	hijacked    bool
+}
+
+// Header returns the handler's own header map
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+// WriteHeader records the status code
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	// Informational responses go straight through
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		tw.w.WriteHeader(code)
+		return
+	}
+	tw.status = code
+}
+
+// Write buffers the body unless the timeout has passed. Once the buffer
+// would exceed timeoutBufferMax the response is committed and written
+// straight through.
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	if !tw.wroteHeader && tw.buf.Len()+len(b) > timeoutBufferMax {
+		tw.flush()
+	}
+	if tw.wroteHeader {
+		return tw.w.Write(b)
+	}
+	return tw.buf.Write(b)
+}
+
+// Hijack hands the connection to the handler if nothing has been written
+// yet; the handler then answers for it, timeout or not
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	if tw.wroteHeader {
+		return nil, nil, errors.New("timeout: cannot hijack after the response has started")
+	}
+	conn, brw, err := http.NewResponseController(tw.w).Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, brw, err
+}
+
+// EnableFullDuplex lets the handler keep reading the request body while
+// it writes the response
+func (tw *timeoutWriter) EnableFullDuplex() error {
+	return http.NewResponseController(tw.w).EnableFullDuplex()
+}
+
+// Flush commits the response so far, for streaming handlers
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	tw.flush()
+	http.NewResponseController(tw.w).Flush()
+}
+
+// flush writes the status, headers and buffered body; callers hold mu
+func (tw *timeoutWriter) flush() {
+	if !tw.wroteHeader {
+		for k, v := range tw.h {
+			tw.w.Header()[k] = v
+		}
+		if tw.status == 0 {
+			tw.status = http.StatusOK
+		}
+		tw.w.WriteHeader(tw.status)
+		tw.wroteHeader = true
+	}
+	if tw.buf.Len() > 0 {
+		tw.w.Write(tw.buf.Bytes())
+		tw.buf.Reset()
+	}
+}
+
+// copyTrailers passes on trailer values the handler set after the headers
+// were flushed; callers hold mu
+func (tw *timeoutWriter) copyTrailers() {
+	declared := map[string]bool{}
+	for _, v := range tw.h.Values("Trailer") {
+		for _, name := range strings.Split(v, ",") {
+			declared[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+	for k, v := range tw.h {
+		if declared[k] || strings.HasPrefix(k, http.TrailerPrefix) {
+			tw.w.Header()[k] = v
+		}
+	}
+}
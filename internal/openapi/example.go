@@ -0,0 +1,150 @@
+package openapi
+
+import (
+	"strings"
+)
+
+// maxDepth bounds how deeply schemas are expanded, stopping recursive
+// schemas
+const maxDepth = 8
+
+// Schema is the part of a JSON schema needed to derive an example
+type Schema struct {
+	Ref        string             `yaml:"$ref"`
+	Type       any                `yaml:"type"`
+	Format     string             `yaml:"format"`
+	Example    any                `yaml:"example"`
+	Examples   []any              `yaml:"examples"`
+	Default    any                `yaml:"default"`
+	Const      any                `yaml:"const"`
+	Enum       []any              `yaml:"enum"`
+	Properties map[string]*Schema `yaml:"properties"`
+	Items      *Schema            `yaml:"items"`
+	MinItems   int                `yaml:"minItems"`
+	Minimum    *float64           `yaml:"minimum"`
+	AllOf      []*Schema          `yaml:"allOf"`
+	OneOf      []*Schema          `yaml:"oneOf"`
+	AnyOf      []*Schema          `yaml:"anyOf"`
+}
+
+// typeName returns the schema's type; OpenAPI 3.1 allows a list such as
+// [string, "null"], of which the first non-null type is used
+func (sc *Schema) typeName() string {
+	switch t := sc.Type.(type) {
+	case string:
+		return t
+	case []any:
+		for _, v := range t {
+			if name, ok := v.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	switch {
+	case sc.Properties != nil:
+		return "object"
+	case sc.Items != nil:
+		return "array"
+	}
+	return ""
+}
+
+// formatExamples are the example strings for well-known formats
+var formatExamples = map[string]string{
+	"date-time": "2024-01-01T00:00:00Z",
+	"date":      "2024-01-01",
+	"time":      "00:00:00Z",
+	"email":     "user@example.com",
+	"uuid":      "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+	"uri":       "https://example.com",
+	"url":       "https://example.com",
+	"hostname":  "example.com",
+	"ipv4":      "192.0.2.1",
+	"ipv6":      "2001:db8::1",
+	"byte":      "ZXhhbXBsZQ==",
+	"password":  "********",
+}
+
+// resolve follows a local $ref to a component schema
+func (s *spec) resolve(sc *Schema) *Schema {
+	for seen := 0; sc != nil && sc.Ref != "" && seen < maxDepth; seen++ {
+		name, ok := strings.CutPrefix(sc.Ref, "#/components/schemas/")
+		if !ok {
+			return nil
+		}
+		sc = s.doc.Components.Schemas[name]
+	}
+	return sc
+}
+
+// exampleFor derives an example value from a schema, preferring the
+// values it documents: example, examples, const, default and enum
+func (s *spec) exampleFor(sc *Schema, depth int) any {
+	sc = s.resolve(sc)
+	if sc == nil || depth > maxDepth {
+		return nil
+	}
+	switch {
+	case sc.Example != nil:
+		return sc.Example
+	case len(sc.Examples) > 0:
+		return sc.Examples[0]
+	case sc.Const != nil:
+		return sc.Const
+	case sc.Default != nil:
+		return sc.Default
+	case len(sc.Enum) > 0:
+		return sc.Enum[0]
+	case len(sc.AllOf) > 0:
+		merged := map[string]any{}
+		for _, part := range sc.AllOf {
+			if obj, ok := s.exampleFor(part, depth+1).(map[string]any); ok {
+				for k, v := range obj {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	case len(sc.OneOf) > 0:
+		return s.exampleFor(sc.OneOf[0], depth+1)
+	case len(sc.AnyOf) > 0:
+		return s.exampleFor(sc.AnyOf[0], depth+1)
+	}
+
+	switch sc.typeName() {
+	case "object":
+		obj := map[string]any{}
+		for name, prop := range sc.Properties {
+			if depth < maxDepth {
+				obj[name] = s.exampleFor(prop, depth+1)
+			}
+		}
+		return obj
+	case "array":
+		items := []any{}
+		if depth < maxDepth {
+			for i := 0; i < max(sc.MinItems, 1); i++ {
+				items = append(items, s.exampleFor(sc.Items, depth+1))
+			}
+		}
+		return items
+	case "string":
+		if example, ok := formatExamples[sc.Format]; ok {
+			return example
+		}
+		return "string"
+	case "integer":
+		if sc.Minimum != nil {
+			return int64(*sc.Minimum)
+		}
+		return 0
+	case "number":
+		if sc.Minimum != nil {
+			return *sc.Minimum
+		}
+		return 0.0
+	case "boolean":
+		return true
+	}
+	return nil
+}
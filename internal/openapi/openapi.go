@@ -0,0 +1,417 @@
+// Package openapi serves mock responses for the operations of an OpenAPI
+// 3 document, taken from its examples or derived from its schemas, so a
+// contract mock needs nothing but the spec.
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/routing"
+)
+
+// maxSpecSize bounds uploaded documents
+const maxSpecSize = 10 << 20
+
+// Document is the part of an OpenAPI 3 document needed to mock it
+type Document struct {
+	OpenAPI string `yaml:"openapi"`
+	Info    struct {
+		Title   string `yaml:"title"`
+		Version string `yaml:"version"`
+	} `yaml:"info"`
+	Servers []struct {
+		URL string `yaml:"url"`
+	} `yaml:"servers"`
+	Paths      map[string]PathItem `yaml:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+// PathItem holds the operations of one path
+type PathItem struct {
+	Get     *Operation `yaml:"get"`
+	Put     *Operation `yaml:"put"`
+	Post    *Operation `yaml:"post"`
+	Delete  *Operation `yaml:"delete"`
+	Options *Operation `yaml:"options"`
+	Head    *Operation `yaml:"head"`
+	Patch   *Operation `yaml:"patch"`
+	Trace   *Operation `yaml:"trace"`
+}
+
+// operations returns the item's operations by method
+func (p PathItem) operations() map[string]*Operation {
+	ops := map[string]*Operation{
+		http.MethodGet: p.Get, http.MethodPut: p.Put, http.MethodPost: p.Post, http.MethodDelete: p.Delete,
+		http.MethodOptions: p.Options, http.MethodHead: p.Head, http.MethodPatch: p.Patch, http.MethodTrace: p.Trace,
+	}
+	for method, op := range ops {
+		if op == nil {
+			delete(ops, method)
+		}
+	}
+	return ops
+}
+
+// Operation is one method of a path, with its documented responses keyed
+// by status code, NXX range or "default"
+type Operation struct {
+	OperationID string               `yaml:"operationId"`
+	Responses   map[string]*Response `yaml:"responses"`
+}
+
+// Response is a documented response
+type Response struct {
+	Content map[string]MediaType `yaml:"content"`
+	Headers map[string]struct {
+		Schema  *Schema `yaml:"schema"`
+		Example any     `yaml:"example"`
+	} `yaml:"headers"`
+}
+
+// MediaType is the body of a response in one content type
+type MediaType struct {
+	Schema   *Schema `yaml:"schema"`
+	Example  any     `yaml:"example"`
+	Examples map[string]struct {
+		Value any `yaml:"value"`
+	} `yaml:"examples"`
+}
+
+// Parse decodes an OpenAPI 3 document in JSON or YAML
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q, want 3.x", doc.OpenAPI)
+	}
+	if len(doc.Paths) == 0 {
+		return nil, errors.New("document has no paths")
+	}
+	return &doc, nil
+}
+
+// OperationInfo describes a mocked operation
+type OperationInfo struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	OperationID string `json:"operation_id,omitempty"`
+}
+
+// SpecResponse is the body returned by Mock.Handler
+type SpecResponse struct {
+	Loaded     bool            `json:"loaded"`
+	Source     string          `json:"source,omitempty"`
+	Title      string          `json:"title,omitempty"`
+	Version    string          `json:"version,omitempty"`
+	Operations []OperationInfo `json:"operations"`
+}
+
+// spec is a loaded document with the mux routing to its operations
+type spec struct {
+	doc        *Document
+	source     string
+	mux        *http.ServeMux
+	operations []OperationInfo
+}
+
+// templateParam matches the parameters of an OpenAPI path template
+var templateParam = regexp.MustCompile(`\{[^{}]*\}`)
+
+// basePath returns the path of the document's first server URL, which
+// prefixes every operation path
+func (d *Document) basePath() string {
+	if len(d.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(d.Servers[0].URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(u.Path, "/")
+}
+
+// compile routes the document's operations
+func compile(doc *Document, source string) (*spec, error) {
+	s := &spec{doc: doc, source: source, mux: http.NewServeMux()}
+	base := doc.basePath()
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("path %q must start with /", path)
+		}
+		// Parameter names need not be valid Go identifiers
+		n := 0
+		pattern := templateParam.ReplaceAllStringFunc(base+path, func(string) string {
+			n++
+			return "{p" + strconv.Itoa(n) + "}"
+		})
+		if strings.HasSuffix(pattern, "/") {
+			// Match the path itself rather than everything below it
+			pattern += "{$}"
+		}
+		ops := doc.Paths[path].operations()
+		methods := make([]string, 0, len(ops))
+		for method := range ops {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			op := ops[method]
+			if err := routing.Register(s.mux, method+" "+pattern, s.handler(op)); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			s.operations = append(s.operations, OperationInfo{Method: method, Path: base + path, OperationID: op.OperationID})
+		}
+	}
+	return s, nil
+}
+
+// Mock serves the operations of the loaded document and passes every
+// other request on. A document can be loaded, replaced or removed at
+// any time.
+type Mock struct {
+	current atomic.Pointer[spec]
+}
+
+// NewMock creates a Mock with no document loaded
+func NewMock() *Mock {
+	return &Mock{}
+}
+
+// Load parses data as an OpenAPI document and starts serving it in
+// place of any earlier one; source describes where it came from
+func (m *Mock) Load(data []byte, source string) error {
+	doc, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	s, err := compile(doc, source)
+	if err != nil {
+		return err
+	}
+	m.current.Store(s)
+	return nil
+}
+
+// Middleware serves requests matching an operation and the rest with
+// next
+func (m *Mock) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := m.current.Load()
+		if s == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		routing.Fallback(s.mux, next).ServeHTTP(w, r)
+	})
+}
+
+// Handler reports the loaded document and its operations on GET,
+// replaces it with the request body on PUT and removes it on DELETE
+func (m *Mock) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut:
+			data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSpecSize))
+			if err != nil {
+				handlers.JSONError(w, r, http.StatusRequestEntityTooLarge, "Document too large")
+				return
+			}
+			if err := m.Load(data, "upload"); err != nil {
+				handlers.JSONError(w, r, http.StatusBadRequest, "Invalid OpenAPI document: "+err.Error())
+				return
+			}
+		case http.MethodDelete:
+			m.current.Store(nil)
+		default:
+			handlers.JSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		response := SpecResponse{Operations: []OperationInfo{}}
+		if s := m.current.Load(); s != nil {
+			response = SpecResponse{
+				Loaded:     true,
+				Source:     s.source,
+				Title:      s.doc.Info.Title,
+				Version:    s.doc.Info.Version,
+				Operations: s.operations,
+			}
+		}
+		handlers.JSONResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// handler answers an operation with one of its documented responses
+func (s *spec) handler(op *Operation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefer := parsePrefer(r.Header.Get("Prefer"))
+		code, resp := pickResponse(op.Responses, prefer["code"])
+		if resp == nil {
+			w.WriteHeader(code)
+			return
+		}
+
+		for name, h := range resp.Headers {
+			value := h.Example
+			if value == nil && h.Schema != nil {
+				value = s.exampleFor(h.Schema, 0)
+			}
+			if value != nil {
+				w.Header().Set(name, fmt.Sprint(value))
+			}
+		}
+
+		contentType, media, ok := pickContent(resp.Content)
+		if !ok {
+			w.WriteHeader(code)
+			return
+		}
+		var value any
+		switch {
+		case prefer["example"] != "" && media.Examples[prefer["example"]].Value != nil:
+			value = media.Examples[prefer["example"]].Value
+		case media.Example != nil:
+			value = media.Example
+		case len(media.Examples) > 0:
+			names := make([]string, 0, len(media.Examples))
+			for name := range media.Examples {
+				names = append(names, name)
+			}
+			value = media.Examples[slices.Min(names)].Value
+		case media.Schema != nil:
+			value = s.exampleFor(media.Schema, 0)
+		}
+
+		var body []byte
+		if text, isString := value.(string); isString && !isJSON(contentType) {
+			body = []byte(text)
+		} else {
+			var err error
+			if body, err = json.Marshal(value); err != nil {
+				handlers.JSONError(w, r, http.StatusInternalServerError, "Failed to encode example: "+err.Error())
+				return
+			}
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(code)
+		w.Write(body)
+	}
+}
+
+// parsePrefer reads the Prefer header's code= and example= preferences,
+// with which clients pick a documented response and a named example
+func parsePrefer(header string) map[string]string {
+	prefs := map[string]string{}
+	for _, part := range strings.FieldsFunc(header, func(c rune) bool { return c == ',' || c == ';' }) {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		prefs[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return prefs
+}
+
+// pickResponse selects the response for code if documented, and
+// otherwise the lowest 2xx, then any other status, then "default". It
+// returns the status to send with it.
+func pickResponse(responses map[string]*Response, code string) (int, *Response) {
+	if code != "" {
+		if status, err := strconv.Atoi(code); err == nil && status >= 100 && status <= 599 {
+			for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+				if resp, ok := responses[key]; ok {
+					return status, resp
+				}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(responses))
+	for key := range responses {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := keyRank(keys[i]), keyRank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) == 0 {
+		return http.StatusOK, nil
+	}
+	return statusFor(keys[0]), responses[keys[0]]
+}
+
+// keyRank orders response keys: success first, then other codes, then
+// "default"
+func keyRank(key string) int {
+	switch {
+	case strings.HasPrefix(key, "2"):
+		return 0
+	case key == "default":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// statusFor returns the status to send for a response key
+func statusFor(key string) int {
+	if status, err := strconv.Atoi(key); err == nil {
+		return status
+	}
+	if len(key) == 3 && strings.EqualFold(key[1:], "XX") && key[0] >= '1' && key[0] <= '5' {
+		return int(key[0]-'0') * 100
+	}
+	return http.StatusOK
+}
+
+// pickContent selects the JSON content type if documented, and otherwise
+// the first in sorted order
+func pickContent(content map[string]MediaType) (string, MediaType, bool) {
+	if len(content) == 0 {
+		return "", MediaType{}, false
+	}
+	types := make([]string, 0, len(content))
+	for contentType := range content {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	chosen := types[0]
+	for _, contentType := range types {
+		if isJSON(contentType) {
+			chosen = contentType
+			break
+		}
+	}
+	return chosen, content[chosen], true
+}
+
+// isJSON reports whether a content type is JSON or a JSON-based type
+func isJSON(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
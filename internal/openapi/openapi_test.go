@@ -0,0 +1,238 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fallback answers requests that no operation matches
+var fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "local")
+})
+
+const petstore = `
+openapi: 3.0.3
+info: {title: Petstore, version: 1.0.0}
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      responses:
+        "200":
+          description: A list of pets
+          headers:
+            X-Total: {schema: {type: integer, minimum: 3}}
+          content:
+            application/json:
+              schema:
+                type: array
+                items: {$ref: "#/components/schemas/Pet"}
+    post:
+      responses:
+        "201":
+          description: Created
+          content:
+            application/json:
+              examples:
+                cat: {value: {id: 2, name: Tom}}
+                dog: {value: {id: 1, name: Rex}}
+        "422":
+          description: Invalid
+          content:
+            application/problem+json:
+              example: {title: invalid}
+  /pets/{pet-id}:
+    get:
+      responses:
+        "200":
+          content:
+            application/json:
+              example: {id: 7, name: Rex}
+        4XX:
+          description: Not found
+  /health:
+    get:
+      responses:
+        default:
+          content:
+            text/plain:
+              example: ok
+components:
+  schemas:
+    Pet:
+      allOf:
+        - type: object
+          properties:
+            id: {type: integer, format: int64}
+            name: {type: string}
+        - type: object
+          properties:
+            born: {type: string, format: date}
+            tags: {type: array, items: {type: string, enum: [cute, lazy]}}
+            owner: {$ref: "#/components/schemas/Owner"}
+    Owner:
+      type: object
+      properties:
+        email: {type: string, format: email}
+        pets: {type: array, items: {$ref: "#/components/schemas/Pet"}}
+`
+
+// TestMock tests serving responses from examples and schemas
+func TestMock(t *testing.T) {
+	mock := NewMock()
+	if err := mock.Load([]byte(petstore), "petstore.yaml"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	handler := mock.Middleware(fallback)
+
+	tests := []struct {
+		name                string
+		method              string
+		path                string
+		prefer              string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"named example", "POST", "/v1/pets", "example=dog", http.StatusCreated, "application/json", `{"id":1,"name":"Rex"}`},
+		{"first example", "POST", "/v1/pets", "", http.StatusCreated, "application/json", `{"id":2,"name":"Tom"}`},
+		{"preferred status", "POST", "/v1/pets", "code=422", http.StatusUnprocessableEntity, "application/problem+json", `{"title":"invalid"}`},
+		{"status range", "GET", "/v1/pets/abc", "code=404", http.StatusNotFound, "", ""},
+		{"path parameter", "GET", "/v1/pets/abc", "", http.StatusOK, "application/json", `{"id":7,"name":"Rex"}`},
+		{"default response", "GET", "/v1/health", "", http.StatusOK, "text/plain", "ok"},
+		{"undocumented method", "DELETE", "/v1/pets", "", http.StatusOK, "", "local"},
+		{"outside base path", "GET", "/pets", "", http.StatusOK, "", "local"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.prefer != "" {
+				req.Header.Set("Prefer", tt.prefer)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedContentType != "" && rr.Header().Get("Content-Type") != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, rr.Header().Get("Content-Type"))
+			}
+			if rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body)
+			}
+		})
+	}
+}
+
+// TestSchemaExample tests deriving a response from schemas
+func TestSchemaExample(t *testing.T) {
+	mock := NewMock()
+	if err := mock.Load([]byte(petstore), "petstore.yaml"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	mock.Middleware(fallback).ServeHTTP(rr, httptest.NewRequest("GET", "/v1/pets", nil))
+
+	if rr.Header().Get("X-Total") != "3" {
+		t.Errorf("Expected X-Total 3, got %q", rr.Header().Get("X-Total"))
+	}
+	var pets []struct {
+		ID    *int     `json:"id"`
+		Name  string   `json:"name"`
+		Born  string   `json:"born"`
+		Tags  []string `json:"tags"`
+		Owner struct {
+			Email string `json:"email"`
+			Pets  []any  `json:"pets"`
+		} `json:"owner"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &pets); err != nil {
+		t.Fatalf("Failed to decode response %s: %v", rr.Body, err)
+	}
+	if len(pets) != 1 {
+		t.Fatalf("Expected one pet, got %s", rr.Body)
+	}
+	pet := pets[0]
+	if pet.ID == nil || pet.Name != "string" || pet.Born != "2024-01-01" || len(pet.Tags) != 1 || pet.Tags[0] != "cute" {
+		t.Errorf("Unexpected pet %s", rr.Body)
+	}
+	if pet.Owner.Email != "user@example.com" || len(pet.Owner.Pets) != 1 {
+		t.Errorf("Expected the recursive owner to be expanded, got %s", rr.Body)
+	}
+}
+
+// TestHandler tests uploading, reporting and removing documents
+func TestHandler(t *testing.T) {
+	mock := NewMock()
+	handler := mock.Middleware(fallback)
+	admin := func(method, body string) (int, SpecResponse) {
+		rr := httptest.NewRecorder()
+		mock.Handler()(rr, httptest.NewRequest(method, "/admin/openapi", strings.NewReader(body)))
+		var response SpecResponse
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response
+	}
+	get := func(path string) string {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Body.String()
+	}
+
+	if _, response := admin("GET", ""); response.Loaded || get("/v1/health") != "local" {
+		t.Fatalf("Expected no document to be loaded, got %+v", response)
+	}
+	code, response := admin("PUT", petstore)
+	if code != http.StatusOK || !response.Loaded || response.Title != "Petstore" || len(response.Operations) != 4 {
+		t.Fatalf("Unexpected upload response %d %+v", code, response)
+	}
+	if response.Operations[0] != (OperationInfo{Method: "GET", Path: "/v1/health"}) {
+		t.Errorf("Unexpected first operation %+v", response.Operations[0])
+	}
+	if get("/v1/health") != "ok" {
+		t.Error("Expected the uploaded document to be served")
+	}
+	if code, _ := admin("PUT", "swagger: '2.0'\n"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unsupported document, got %d", code)
+	}
+	if get("/v1/health") != "ok" {
+		t.Error("Expected a failed upload to keep the earlier document")
+	}
+	if _, response := admin("DELETE", ""); response.Loaded || get("/v1/health") != "local" {
+		t.Error("Expected the document to be removed")
+	}
+	if code, _ := admin("POST", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", code)
+	}
+}
+
+// TestParse tests rejection of unusable documents
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"not yaml", "{"},
+		{"swagger 2", "swagger: '2.0'\npaths: {/a: {get: {}}}\n"},
+		{"no paths", "openapi: 3.1.0\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewMock().Load([]byte(tt.doc), "test"); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	if err := NewMock().Load([]byte(`{"openapi": "3.1.0", "paths": {"/a": {"get": {"responses": {"204": {}}}}}}`), "test"); err != nil {
+		t.Errorf("Expected a JSON document to load, got %v", err)
+	}
+}
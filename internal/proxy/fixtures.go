@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+)
+
+// Fixture modes
+const (
+	FixturesRecord = "record"
+	FixturesReplay = "replay"
+)
+
+// FixtureHeader reports on replayed responses whether a recording was
+// found
+const FixtureHeader = "X-Httpbin-Fixture"
+
+// maxFixtureBody bounds the request and response bodies of a fixture;
+// larger exchanges are proxied without being recorded
+const maxFixtureBody = 10 << 20
+
+// Fixtures records upstream responses to Dir, or replays them from there
+// without contacting the upstream
+type Fixtures struct {
+	Mode string `yaml:"mode" json:"mode,omitempty"`
+	Dir  string `yaml:"dir" json:"dir,omitempty"`
+}
+
+// validate checks the fixture settings
+func (f Fixtures) validate() error {
+	switch f.Mode {
+	case "":
+		return nil
+	case FixturesRecord, FixturesReplay:
+		if f.Dir == "" {
+			return fmt.Errorf("fixtures mode %s requires a dir", f.Mode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown fixtures mode %q", f.Mode)
+	}
+}
+
+// fixture is a recorded upstream response, stored as JSON
+type fixture struct {
+	Method       string              `json:"method"`
+	URL          string              `json:"url"`
+	BodySHA256   string              `json:"body_sha256"`
+	Status       int                 `json:"status"`
+	Headers      map[string][]string `json:"headers"`
+	Body         string              `json:"body"`
+	BodyEncoding string              `json:"body_encoding,omitempty"`
+}
+
+// fixtureKeyContextKey carries the fixture key of a request being recorded
+type fixtureKeyContextKey struct{}
+
+// fixtureKey derives the key of a request from its method, path and
+// query, and the SHA-256 of its body, which it reads and replaces
+func fixtureKey(r *http.Request) (key, bodyHash string, err error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxFixtureBody+1))
+	if err != nil {
+		return "", "", err
+	}
+	// Put back what was read, followed by anything left unread
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if len(body) > maxFixtureBody {
+		return "", "", errors.New("request body too large to key a fixture")
+	}
+
+	sum := sha256.Sum256(body)
+	bodyHash = hex.EncodeToString(sum[:])
+	key = r.Method + " " + r.URL.RequestURI() + " " + bodyHash
+	return key, bodyHash, nil
+}
+
+// path returns the file holding the fixture for key
+func (f Fixtures) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// save writes the upstream response resp as the fixture for the request
+// with the given key. The body is read and replaced so it can still be
+// proxied, in full even when it is too large to record.
+func (f Fixtures) save(key, bodyHash string, resp *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFixtureBody+1))
+	if err == nil && len(body) > maxFixtureBody {
+		// Put back what was read, followed by anything left unread
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return errors.New("response body too large to record")
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	fx := fixture{
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.RequestURI(),
+		BodySHA256: bodyHash,
+		Status:     resp.StatusCode,
+		Headers:    resp.Header.Clone(),
+		Body:       string(body),
+	}
+	if !utf8.Valid(body) {
+		fx.Body, fx.BodyEncoding = base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	data, err := json.MarshalIndent(fx, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+
+	// Write atomically so a concurrent replay never sees half a fixture;
+	// each writer has its own temporary file, so concurrent recordings of
+	// the same request cannot interleave
+	tmp, err := os.CreateTemp(f.Dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0o644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(key))
+}
+
+// load reads the fixture for key as a response to r
+func (f Fixtures) load(key string, r *http.Request) (*http.Response, error) {
+	data, err := os.ReadFile(f.path(key))
+	if err != nil {
+		return nil, err
+	}
+	var fx fixture
+	if err := json.Unmarshal(data, &fx); err != nil {
+		return nil, err
+	}
+	body := []byte(fx.Body)
+	if fx.BodyEncoding == "base64" {
+		if body, err = base64.StdEncoding.DecodeString(fx.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	header := http.Header(fx.Headers)
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		StatusCode: fx.Status,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+// serve answers a request to a route with fixtures
+func (b backend) serve(p *Proxy, w http.ResponseWriter, r *http.Request) {
+	key, bodyHash, err := fixtureKey(r)
+	switch {
+	case err != nil && b.route.Fixtures.Mode == FixturesReplay:
+		handlers.JSONError(w, r, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case err != nil:
+		// Too large to record, but it can still be proxied
+		b.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	if b.route.Fixtures.Mode == FixturesRecord {
+		ctx := context.WithValue(r.Context(), fixtureKeyContextKey{}, [2]string{key, bodyHash})
+		b.proxy.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+
+	resp, err := b.route.Fixtures.load(key, r)
+	if err != nil {
+		w.Header().Set(FixtureHeader, "miss")
+		handlers.JSONError(w, r, http.StatusBadGateway, "No recorded response for "+r.Method+" "+r.URL.RequestURI())
+		return
+	}
+	defer resp.Body.Close()
+
+	if err := p.injectFaults(b.route, resp); err != nil {
+		p.handleError(w, r, err)
+		return
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(FixtureHeader, "hit")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
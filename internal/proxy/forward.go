@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+)
+
+// Forward proxy limits
+const (
+	forwardRecords = 100
+	dialTimeout    = 10 * time.Second
+)
+
+// viaHeader identifies httpbin on forwarded requests and responses
+const viaHeader = "1.1 httpbin"
+
+// Exchange records one request handled by the forward proxy. Tunnels
+// report the bytes copied each way, since their content is opaque.
+type Exchange struct {
+	ID         int64               `json:"id"`
+	Time       time.Time           `json:"time"`
+	Method     string              `json:"method"`
+	Target     string              `json:"target"`
+	Headers    map[string][]string `json:"headers"`
+	Status     int                 `json:"status"`
+	BytesOut   int64               `json:"bytes_out,omitempty"`
+	BytesIn    int64               `json:"bytes_in,omitempty"`
+	DurationMS float64             `json:"duration_ms"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// ExchangesResponse is the body returned by Forward.Handler
+type ExchangesResponse struct {
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+// Forward is an HTTP forward proxy: CONNECT requests are tunnelled and
+// absolute-form requests are forwarded, each recorded for inspection
+type Forward struct {
+	mu        sync.Mutex
+	nextID    int64
+	exchanges []Exchange
+	now       func() time.Time
+
+	proxy *httputil.ReverseProxy
+	dial  func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// NewForward creates a forward proxy with no recorded exchanges
+func NewForward() *Forward {
+	f := &Forward{now: time.Now}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	f.dial = dialer.DialContext
+
+	// Never chain to another proxy from the environment
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	f.proxy = &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetXForwarded()
+			pr.Out.Header.Add("Via", viaHeader)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			resp.Header.Add("Via", viaHeader)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if !errors.Is(err, context.Canceled) {
+				handlers.JSONError(w, r, http.StatusBadGateway, "Upstream request failed: "+err.Error())
+			}
+		},
+	}
+	return f
+}
+
+// IsProxyRequest reports whether r is meant for a forward proxy, i.e. a
+// CONNECT request or one with an absolute-form target
+func IsProxyRequest(r *http.Request) bool {
+	return r.Method == http.MethodConnect || r.URL.IsAbs()
+}
+
+// ServeHTTP tunnels or forwards a proxy request
+func (f *Forward) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e := Exchange{Time: f.now(), Method: r.Method, Target: r.URL.String(), Headers: r.Header.Clone()}
+	if r.Method == http.MethodConnect {
+		e.Target = r.Host
+		f.tunnel(w, r, &e)
+	} else {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		f.proxy.ServeHTTP(rec, r)
+		e.Status = rec.status
+	}
+	e.DurationMS = float64(f.now().Sub(e.Time)) / float64(time.Millisecond)
+	f.record(e)
+}
+
+// tunnel connects to the CONNECT target and copies bytes both ways until
+// either side closes
+func (f *Forward) tunnel(w http.ResponseWriter, r *http.Request, e *Exchange) {
+	upstream, err := f.dial(r.Context(), "tcp", r.Host)
+	if err != nil {
+		e.Status, e.Error = http.StatusBadGateway, err.Error()
+		handlers.JSONError(w, r, http.StatusBadGateway, "Failed to connect to "+r.Host)
+		return
+	}
+	defer upstream.Close()
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		e.Status, e.Error = http.StatusNotImplemented, err.Error()
+		handlers.JSONError(w, r, http.StatusNotImplemented, "Tunnelling is not supported on this connection")
+		return
+	}
+	defer conn.Close()
+	// The server's request deadlines do not apply to the tunnel
+	conn.SetDeadline(time.Time{})
+
+	e.Status = http.StatusOK
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\nVia: "+viaHeader+"\r\n\r\n"); err != nil {
+		e.Error = err.Error()
+		return
+	}
+
+	// Closing both ends once either copy finishes ends the other
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// The reader may hold bytes the client sent right after CONNECT
+		e.BytesOut, _ = io.Copy(upstream, brw.Reader)
+		upstream.Close()
+		conn.Close()
+	}()
+	e.BytesIn, _ = io.Copy(conn, upstream)
+	conn.Close()
+	upstream.Close()
+	wg.Wait()
+}
+
+// record stores an exchange, keeping only the most recent ones
+func (f *Forward) record(e Exchange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	e.ID = f.nextID
+	f.exchanges = append(f.exchanges, e)
+	if len(f.exchanges) > forwardRecords {
+		f.exchanges = f.exchanges[len(f.exchanges)-forwardRecords:]
+	}
+}
+
+// Handler lists the recorded exchanges, oldest first, on GET and clears
+// them on DELETE
+func (f *Forward) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodDelete:
+			f.exchanges = nil
+		default:
+			f.mu.Unlock()
+			handlers.JSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		exchanges := append([]Exchange{}, f.exchanges...)
+		f.mu.Unlock()
+
+		handlers.JSONResponse(w, r, http.StatusOK, ExchangesResponse{Exchanges: exchanges})
+	}
+}
+
+// statusRecorder remembers the status written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if code >= 200 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,216 @@
+// Package proxy forwards configured path prefixes to real upstreams and
+// injects faults into their responses, making httpbin a lightweight
+// fault-injecting shim in front of a service under test.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/chaos"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+)
+
+// Headers mutates the headers of proxied responses: Remove is applied
+// first, then Set
+type Headers struct {
+	Set    map[string]string `yaml:"set" json:"set,omitempty"`
+	Remove []string          `yaml:"remove" json:"remove,omitempty"`
+}
+
+// Route forwards requests whose path starts with Prefix to Upstream. The
+// faults are applied to the upstream's response: latency delays it, an
+// error replaces it and an abort drops the connection instead. With
+// Fixtures, responses are recorded to disk or replayed from there, in
+// which case Upstream is optional.
+type Route struct {
+	Prefix      string        `yaml:"prefix" json:"prefix"`
+	Upstream    string        `yaml:"upstream" json:"upstream"`
+	StripPrefix bool          `yaml:"strip_prefix" json:"strip_prefix,omitempty"`
+	Headers     Headers       `yaml:"headers" json:"headers"`
+	Latency     chaos.Latency `yaml:"latency" json:"latency"`
+	Error       chaos.Error   `yaml:"error" json:"error"`
+	Abort       chaos.Abort   `yaml:"abort" json:"abort"`
+	Fixtures    Fixtures      `yaml:"fixtures" json:"fixtures"`
+}
+
+// Validate checks a route for invalid values
+func (route Route) Validate() error {
+	if !strings.HasPrefix(route.Prefix, "/") {
+		return fmt.Errorf("proxy route prefix %q must start with /", route.Prefix)
+	}
+	if err := route.Fixtures.validate(); err != nil {
+		return fmt.Errorf("proxy route %s: %w", route.Prefix, err)
+	}
+	if route.Upstream != "" || route.Fixtures.Mode != FixturesReplay {
+		u, err := url.Parse(route.Upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("proxy route %s: upstream %q must be an http or https URL", route.Prefix, route.Upstream)
+		}
+	}
+	for _, p := range []float64{route.Latency.Probability, route.Error.Probability, route.Abort.Probability} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("proxy route %s: probability %v out of range [0, 1]", route.Prefix, p)
+		}
+	}
+	if route.Latency.Min < 0 || route.Latency.Max < route.Latency.Min {
+		return fmt.Errorf("proxy route %s: latency requires 0 <= min <= max", route.Prefix)
+	}
+	if route.Error.Probability > 0 && len(route.Error.Statuses) == 0 {
+		return fmt.Errorf("proxy route %s: error injection requires statuses", route.Prefix)
+	}
+	for _, status := range route.Error.Statuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("proxy route %s: invalid status %d", route.Prefix, status)
+		}
+	}
+	return nil
+}
+
+// errAbort and injectedError are returned from ModifyResponse to replace
+// the upstream's response
+var errAbort = errors.New("injected abort")
+
+type injectedError struct {
+	status int
+}
+
+func (e injectedError) Error() string {
+	return fmt.Sprintf("injected error %d", e.status)
+}
+
+// backend is a route with its reverse proxy
+type backend struct {
+	route Route
+	proxy *httputil.ReverseProxy
+}
+
+// Proxy forwards requests matching its routes, the first matching prefix
+// winning, and passes everything else on
+type Proxy struct {
+	backends []backend
+	rand     func() float64
+}
+
+// New creates a Proxy for the given routes
+func New(routes []Route) (*Proxy, error) {
+	p := &Proxy{rand: rand.Float64}
+	for _, route := range routes {
+		if err := route.Validate(); err != nil {
+			return nil, err
+		}
+		// Replay-only routes have no upstream and never proxy
+		upstream, _ := url.Parse(route.Upstream)
+		p.backends = append(p.backends, backend{route: route, proxy: p.reverseProxy(route, upstream)})
+	}
+	return p, nil
+}
+
+// Middleware proxies matching requests and serves the rest with next
+func (p *Proxy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, b := range p.backends {
+			if !strings.HasPrefix(r.URL.Path, b.route.Prefix) {
+				continue
+			}
+			if b.route.Fixtures.Mode != "" {
+				b.serve(p, w, r)
+			} else {
+				b.proxy.ServeHTTP(w, r)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// roll reports whether an event with probability p happens
+func (p *Proxy) roll(probability float64) bool {
+	return probability > 0 && p.rand() < probability
+}
+
+// reverseProxy builds the reverse proxy for one route
+func (p *Proxy) reverseProxy(route Route, upstream *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if route.StripPrefix {
+				pr.Out.URL.Path = "/" + strings.TrimLeft(strings.TrimPrefix(pr.Out.URL.Path, route.Prefix), "/")
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(upstream)
+			pr.SetXForwarded()
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if key, ok := resp.Request.Context().Value(fixtureKeyContextKey{}).([2]string); ok {
+				if err := route.Fixtures.save(key[0], key[1], resp); err != nil {
+					slog.Warn("Failed to record fixture", "url", resp.Request.URL.String(), "error", err)
+				}
+			}
+			return p.injectFaults(route, resp)
+		},
+		ErrorHandler: p.handleError,
+	}
+}
+
+// handleError answers a request whose upstream response was replaced by
+// an injected fault or could not be fetched
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	var injected injectedError
+	switch {
+	case errors.Is(err, errAbort):
+		// The server closes the connection without logging a panic
+		panic(http.ErrAbortHandler)
+	case errors.As(err, &injected):
+		w.Header().Add(chaos.Header, fmt.Sprintf("error=%d", injected.status))
+		handlers.JSONError(w, r, injected.status, "Injected fault")
+	case errors.Is(err, context.Canceled):
+		// The client went away; nobody is left to answer
+	default:
+		handlers.JSONError(w, r, http.StatusBadGateway, "Upstream request failed: "+err.Error())
+	}
+}
+
+// injectFaults applies the route's header mutations and faults to an
+// upstream response
+func (p *Proxy) injectFaults(route Route, resp *http.Response) error {
+	for _, name := range route.Headers.Remove {
+		resp.Header.Del(name)
+	}
+	for name, value := range route.Headers.Set {
+		resp.Header.Set(name, value)
+	}
+
+	if p.roll(route.Latency.Probability) {
+		delay := time.Duration(route.Latency.Min)
+		if spread := route.Latency.Max - route.Latency.Min; spread > 0 {
+			delay += time.Duration(p.rand() * float64(spread))
+		}
+		resp.Header.Add(chaos.Header, "latency="+delay.String())
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-resp.Request.Context().Done():
+			return resp.Request.Context().Err()
+		}
+	}
+
+	if p.roll(route.Abort.Probability) {
+		return errAbort
+	}
+
+	if p.roll(route.Error.Probability) {
+		statuses := route.Error.Statuses
+		return injectedError{statuses[min(int(p.rand()*float64(len(statuses))), len(statuses)-1)]}
+	}
+	return nil
+}
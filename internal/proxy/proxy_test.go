@@ -0,0 +1,363 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/chaos"
+)
+
+// fallback answers requests that no route matches
+var fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "local")
+})
+
+// TestMiddleware tests forwarding and fault injection on proxied responses
+func TestMiddleware(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "upstream")
+		w.Header().Set("X-Path", r.URL.RequestURI())
+		w.Header().Set("X-Forwarded-By", r.Header.Get("X-Forwarded-Host"))
+		io.WriteString(w, "upstream")
+	}))
+	defer upstream.Close()
+
+	p, err := New([]Route{
+		{Prefix: "/api/", Upstream: upstream.URL + "/v1", StripPrefix: true, Headers: Headers{
+			Set:    map[string]string{"Cache-Control": "no-store"},
+			Remove: []string{"Server"},
+		}},
+		{Prefix: "/slow/", Upstream: upstream.URL, Latency: chaos.Latency{Probability: 1, Min: chaos.Duration(10 * time.Millisecond), Max: chaos.Duration(10 * time.Millisecond)}},
+		{Prefix: "/broken/", Upstream: upstream.URL, Error: chaos.Error{Probability: 0.5, Statuses: []int{502, 503}}},
+		{Prefix: "/down/", Upstream: "http://127.0.0.1:1"},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	p.rand = func() float64 { return 0.4 }
+	handler := p.Middleware(fallback)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+		expectedHeader map[string]string
+	}{
+		{"strip prefix", "/api/users?id=1", http.StatusOK, "upstream", map[string]string{"X-Path": "/v1/users?id=1", "X-Forwarded-By": "example.com", "Cache-Control": "no-store", "Server": ""}},
+		{"latency", "/slow/item", http.StatusOK, "upstream", map[string]string{"X-Path": "/slow/item", chaos.Header: "latency=10ms", "Server": "upstream"}},
+		{"injected error", "/broken/item", http.StatusBadGateway, "Injected fault", map[string]string{chaos.Header: "error=502"}},
+		{"upstream down", "/down/item", http.StatusBadGateway, "Upstream request failed", nil},
+		{"unmatched", "/get", http.StatusOK, "local", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tt.expectedBody, rr.Body)
+			}
+			for name, want := range tt.expectedHeader {
+				if got := rr.Header().Get(name); got != want {
+					t.Errorf("Expected %s %q, got %q", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestAbort tests that an injected abort drops the connection
+func TestAbort(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	p, _ := New([]Route{{Prefix: "/", Upstream: upstream.URL, Abort: chaos.Abort{Probability: 1}}})
+	server := httptest.NewServer(p.Middleware(fallback))
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "/get"); err == nil {
+		resp.Body.Close()
+		t.Errorf("Expected the connection to be dropped, got status %d", resp.StatusCode)
+	}
+}
+
+// TestRouteValidate tests rejection of invalid routes
+func TestRouteValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		route Route
+	}{
+		{"relative prefix", Route{Prefix: "api", Upstream: "http://localhost"}},
+		{"missing upstream", Route{Prefix: "/api/"}},
+		{"upstream without scheme", Route{Prefix: "/api/", Upstream: "localhost:8080"}},
+		{"bad probability", Route{Prefix: "/api/", Upstream: "http://localhost", Abort: chaos.Abort{Probability: 2}}},
+		{"error without statuses", Route{Prefix: "/api/", Upstream: "http://localhost", Error: chaos.Error{Probability: 1}}},
+		{"inverted latency", Route{Prefix: "/api/", Upstream: "http://localhost", Latency: chaos.Latency{Min: 2, Max: 1}}},
+		{"unknown fixtures mode", Route{Prefix: "/api/", Upstream: "http://localhost", Fixtures: Fixtures{Mode: "playback", Dir: "fixtures"}}},
+		{"fixtures without dir", Route{Prefix: "/api/", Upstream: "http://localhost", Fixtures: Fixtures{Mode: FixturesRecord}}},
+		{"record without upstream", Route{Prefix: "/api/", Fixtures: Fixtures{Mode: FixturesRecord, Dir: "fixtures"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.route.Validate(); err == nil {
+				t.Error("Expected an error")
+			}
+			if _, err := New([]Route{tt.route}); err == nil {
+				t.Error("Expected New to reject the route")
+			}
+		})
+	}
+}
+
+// TestForward tests forwarding absolute-form requests, tunnelling CONNECT
+// requests and recording both
+func TestForward(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Via", r.Header.Get("Via"))
+		io.WriteString(w, "plain "+r.URL.Path)
+	}))
+	defer upstream.Close()
+	tlsUpstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "tunnelled "+r.URL.Path)
+	}))
+	defer tlsUpstream.Close()
+
+	forward := NewForward()
+	proxyServer := httptest.NewServer(forward)
+	defer proxyServer.Close()
+	proxyURL, _ := url.Parse(proxyServer.URL)
+
+	transport := tlsUpstream.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	client := &http.Client{Transport: transport}
+
+	get := func(target string) (*http.Response, string) {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", target, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get(upstream.URL + "/plain")
+	if body != "plain /plain" || resp.Header.Get("X-Via") != viaHeader || resp.Header.Get("Via") != viaHeader {
+		t.Errorf("Unexpected forwarded response: %q %v", body, resp.Header)
+	}
+
+	if _, body := get(tlsUpstream.URL + "/secure"); body != "tunnelled /secure" {
+		t.Errorf("Unexpected tunnelled response: %q", body)
+	}
+	// Tunnels are recorded once they close
+	transport.CloseIdleConnections()
+
+	req, _ := http.NewRequest("CONNECT", proxyServer.URL, nil)
+	req.Host = "127.0.0.1:1"
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("CONNECT failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status 502 for an unreachable target, got %d", resp.StatusCode)
+	}
+
+	var exchanges []Exchange
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		rr := httptest.NewRecorder()
+		forward.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/admin/forward-proxy", nil))
+		var listed ExchangesResponse
+		json.NewDecoder(rr.Body).Decode(&listed)
+		if exchanges = listed.Exchanges; len(exchanges) == 3 {
+			break
+		}
+	}
+	if len(exchanges) != 3 {
+		t.Fatalf("Expected 3 exchanges, got %+v", exchanges)
+	}
+
+	byMethod := map[string][]Exchange{}
+	for _, e := range exchanges {
+		byMethod[e.Method] = append(byMethod[e.Method], e)
+	}
+	if g := byMethod["GET"]; len(g) != 1 || g[0].Target != upstream.URL+"/plain" || g[0].Status != http.StatusOK {
+		t.Errorf("Unexpected GET exchange: %+v", g)
+	}
+	var tunnel, failed Exchange
+	for _, e := range byMethod["CONNECT"] {
+		if e.Status == http.StatusOK {
+			tunnel = e
+		} else {
+			failed = e
+		}
+	}
+	if tunnel.Target != strings.TrimPrefix(tlsUpstream.URL, "https://") || tunnel.BytesOut == 0 || tunnel.BytesIn == 0 {
+		t.Errorf("Unexpected tunnel exchange: %+v", tunnel)
+	}
+	if failed.Status != http.StatusBadGateway || failed.Error == "" {
+		t.Errorf("Unexpected failed exchange: %+v", failed)
+	}
+
+	rr := httptest.NewRecorder()
+	forward.Handler().ServeHTTP(rr, httptest.NewRequest("DELETE", "/admin/forward-proxy", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"exchanges":[]`) {
+		t.Errorf("Expected DELETE to clear the exchanges, got %d %s", rr.Code, rr.Body)
+	}
+}
+
+// TestFixtures tests recording upstream responses and replaying them
+// without the upstream
+func TestFixtures(t *testing.T) {
+	hits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(append([]byte(r.Method+" "+r.URL.RequestURI()+" "), body...))
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	recorder, err := New([]Route{{Prefix: "/api/", Upstream: upstream.URL, Fixtures: Fixtures{Mode: FixturesRecord, Dir: dir}}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	record := recorder.Middleware(fallback)
+	for _, body := range []string{"one", "two", "\xff\xfe"} {
+		rr := httptest.NewRecorder()
+		record.ServeHTTP(rr, httptest.NewRequest("POST", "/api/orders?page=1", strings.NewReader(body)))
+		if rr.Code != http.StatusCreated || rr.Body.String() != "POST /api/orders?page=1 "+body {
+			t.Fatalf("Unexpected recorded response: %d %q", rr.Code, rr.Body)
+		}
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 3 {
+		t.Fatalf("Expected 3 fixture files, got %d", len(files))
+	}
+
+	// Replay needs no upstream and applies the route's header mutations
+	replayer, err := New([]Route{{Prefix: "/api/", Fixtures: Fixtures{Mode: FixturesReplay, Dir: dir}, Headers: Headers{Set: map[string]string{"X-Replayed": "true"}}}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	replay := replayer.Middleware(fallback)
+	upstream.Close()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+		expectedHeader string
+	}{
+		{"recorded", "POST", "/api/orders?page=1", "two", http.StatusCreated, "POST /api/orders?page=1 two", "hit"},
+		{"binary body", "POST", "/api/orders?page=1", "\xff\xfe", http.StatusCreated, "POST /api/orders?page=1 \xff\xfe", "hit"},
+		{"other body", "POST", "/api/orders?page=1", "three", http.StatusBadGateway, "No recorded response", "miss"},
+		{"other query", "POST", "/api/orders?page=2", "one", http.StatusBadGateway, "No recorded response", "miss"},
+		{"other method", "PUT", "/api/orders?page=1", "one", http.StatusBadGateway, "No recorded response", "miss"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			replay.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tt.expectedBody, rr.Body)
+			}
+			if got := rr.Header().Get(FixtureHeader); got != tt.expectedHeader {
+				t.Errorf("Expected %s %q, got %q", FixtureHeader, tt.expectedHeader, got)
+			}
+			if tt.expectedHeader == "hit" && (rr.Header().Get("X-Upstream") != "yes" || rr.Header().Get("X-Replayed") != "true") {
+				t.Errorf("Expected recorded and mutated headers, got %v", rr.Header())
+			}
+		})
+	}
+	if hits != 3 {
+		t.Errorf("Expected the upstream to be hit only while recording, got %d hits", hits)
+	}
+}
+
+// TestFixturesLargeResponse tests that responses too large to record are
+// still proxied in full
+func TestFixturesLargeResponse(t *testing.T) {
+	const size = maxFixtureBody + 1000
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Write(bytes.Repeat([]byte("x"), size))
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	p, err := New([]Route{{Prefix: "/api/", Upstream: upstream.URL, Fixtures: Fixtures{Mode: FixturesRecord, Dir: dir}}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	p.Middleware(fallback).ServeHTTP(rr, httptest.NewRequest("GET", "/api/export", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.Len() != size {
+		t.Errorf("Expected the full %d byte body, got %d bytes with status %d", size, rr.Body.Len(), rr.Code)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected nothing to be recorded, got %d files", len(files))
+	}
+}
+
+// TestFixturesConcurrentSave tests that concurrent recordings of the same
+// request leave one complete fixture and no temporary files
+func TestFixturesConcurrentSave(t *testing.T) {
+	dir := t.TempDir()
+	f := Fixtures{Mode: FixturesRecord, Dir: dir}
+	req := httptest.NewRequest("GET", "/api/orders", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(strings.Repeat(string(rune('a'+i)), (i+1)<<12))),
+				Request:    req,
+			}
+			if err := f.save("key", "", resp); err != nil {
+				t.Errorf("save failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("Expected a single fixture file, got %d", len(files))
+	}
+	var fx fixture
+	data, _ := os.ReadFile(f.path("key"))
+	if err := json.Unmarshal(data, &fx); err != nil || fx.Body == "" || strings.Trim(fx.Body, fx.Body[:1]) != "" {
+		t.Errorf("Expected one complete fixture, got %d bytes (%v)", len(data), err)
+	}
+}
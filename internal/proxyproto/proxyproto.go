@@ -0,0 +1,224 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHeaderTimeout bounds how long a connection may take to send
+// its PROXY header
+const DefaultHeaderTimeout = 5 * time.Second
+
+// v1MaxLength is the maximum length of a v1 header including CRLF
+const v1MaxLength = 107
+
+// v2Signature starts every v2 header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidHeader is returned when a connection does not start with a
+// valid PROXY protocol header
+var ErrInvalidHeader = errors.New("proxyproto: invalid PROXY protocol header")
+
+// Listener wraps a net.Listener, requiring every accepted connection to
+// start with a PROXY protocol v1 or v2 header. The addresses it carries
+// are reported by the connection's RemoteAddr and LocalAddr.
+type Listener struct {
+	net.Listener
+	HeaderTimeout time.Duration
+}
+
+// NewListener wraps ln with PROXY protocol parsing
+func NewListener(ln net.Listener) *Listener {
+	return &Listener{Listener: ln, HeaderTimeout: DefaultHeaderTimeout}
+}
+
+// Accept waits for the next connection. The header is parsed lazily on
+// first use, so a slow client cannot stall the accept loop.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn, r: bufio.NewReader(conn), timeout: l.HeaderTimeout}, nil
+}
+
+// Conn is a connection whose addresses come from a PROXY header
+type Conn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	remote net.Addr
+	local  net.Addr
+	err    error
+}
+
+// Read reads data following the PROXY header
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, falling back
+// to the peer address for LOCAL/UNKNOWN headers
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address from the header, falling
+// back to the socket address
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// NetConn returns the underlying connection, as tls.Conn does
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// readHeader parses the header, closing the connection if it is invalid
+func (c *Conn) readHeader() {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+	}
+
+	c.remote, c.local, c.err = parseHeader(c.r)
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+// parseHeader reads a v1 or v2 header from r
+func parseHeader(r *bufio.Reader) (remote, local net.Addr, err error) {
+	sig, err := r.Peek(len(v2Signature))
+	if err == nil && bytes.Equal(sig, v2Signature) {
+		return parseV2(r)
+	}
+
+	prefix, err := r.Peek(6)
+	if err != nil || string(prefix) != "PROXY " {
+		return nil, nil, ErrInvalidHeader
+	}
+	return parseV1(r)
+}
+
+// parseV1 parses "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n"
+func parseV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, ErrInvalidHeader
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	src, err := tcpAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := tcpAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+// tcpAddr builds a TCP address from textual IP and port
+func tcpAddr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	p, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// parseV2 parses the binary v2 header
+func parseV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	verCmd, famProto := header[12], header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+
+	if verCmd>>4 != 2 {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	// LOCAL command: connection from the proxy itself (e.g. health checks)
+	if verCmd&0x0f == 0 {
+		return nil, nil, nil
+	}
+	if verCmd&0x0f != 1 {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	var ipLen int
+	switch famProto >> 4 {
+	case 1: // AF_INET
+		ipLen = net.IPv4len
+	case 2: // AF_INET6
+		ipLen = net.IPv6len
+	default:
+		// AF_UNSPEC or AF_UNIX: no usable IP addresses
+		return nil, nil, nil
+	}
+
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, fmt.Errorf("%w: short address block", ErrInvalidHeader)
+	}
+
+	src := &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+	return src, dst, nil
+}
@@ -0,0 +1,104 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// v2Header builds a binary v2 PROXY header
+func v2Header(cmd, fam byte, addrs []byte) []byte {
+	h := append([]byte{}, v2Signature...)
+	h = append(h, 0x20|cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(h[14:], uint16(len(addrs)))
+	return append(h, addrs...)
+}
+
+// TestParseHeader tests v1 and v2 header parsing
+func TestParseHeader(t *testing.T) {
+	v4 := append(append(net.IPv4(10, 0, 0, 1).To4(), net.IPv4(10, 0, 0, 2).To4()...), 0x1f, 0x90, 0x00, 0x50)
+	v6 := append(append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...), 0x1f, 0x90, 0x00, 0x50)
+
+	tests := []struct {
+		name    string
+		header  string
+		remote  string
+		local   string
+		wantErr bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n", "192.0.2.1:56324", "192.0.2.2:443", false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", "[2001:db8::2]:443", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\n", "", "", false},
+		{"v1 bad ip", "PROXY TCP4 nope 192.0.2.2 1 2\r\n", "", "", true},
+		{"v1 bad port", "PROXY TCP4 192.0.2.1 192.0.2.2 99999 2\r\n", "", "", true},
+		{"v1 no crlf", "PROXY TCP4 192.0.2.1 192.0.2.2 1 2" + strings.Repeat(" ", 100), "", "", true},
+		{"v2 ipv4", string(v2Header(0x1, 0x11, v4)), "10.0.0.1:8080", "10.0.0.2:80", false},
+		{"v2 ipv6", string(v2Header(0x1, 0x21, v6)), "[2001:db8::1]:8080", "[2001:db8::2]:80", false},
+		{"v2 local", string(v2Header(0x0, 0x00, nil)), "", "", false},
+		{"v2 short", string(v2Header(0x1, 0x11, v4[:4])), "", "", true},
+		{"no header", "GET / HTTP/1.1\r\n", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote, local, err := parseHeader(bufio.NewReader(strings.NewReader(tt.header)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := addrString(remote); got != tt.remote {
+				t.Errorf("Expected remote %q, got %q", tt.remote, got)
+			}
+			if got := addrString(local); got != tt.local {
+				t.Errorf("Expected local %q, got %q", tt.local, got)
+			}
+		})
+	}
+}
+
+// addrString renders a possibly nil address
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
+
+// TestListener tests that accepted connections expose header addresses
+func TestListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ln := NewListener(inner)
+	defer ln.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "PROXY TCP4 203.0.113.7 192.0.2.2 4242 443\r\nhello")
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer conn.Close()
+
+	if got := conn.RemoteAddr().String(); got != "203.0.113.7:4242" {
+		t.Errorf("Expected remote 203.0.113.7:4242, got %s", got)
+	}
+
+	data, _ := io.ReadAll(conn)
+	if string(data) != "hello" {
+		t.Errorf("Expected payload after header, got %q", data)
+	}
+}
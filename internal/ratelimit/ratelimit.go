@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the quota is fully replenished
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether a request identified by key may proceed
+type Limiter interface {
+	Allow(key string) (Decision, error)
+}
+
+// sweepInterval is how often idle buckets are dropped
+const sweepInterval = time.Minute
+
+// bucket is a single token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucket is an in-memory token bucket limiter with one bucket per key
+type TokenBucket struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewTokenBucket creates a limiter refilling rate tokens per second up
+// to burst tokens
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket for key if one is available
+func (tb *TokenBucket) Allow(key string) (Decision, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.now()
+	tb.sweep(now)
+
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(tb.burst), last: now}
+		tb.buckets[key] = b
+	}
+
+	// Refill based on elapsed time
+	b.tokens = math.Min(float64(tb.burst), b.tokens+now.Sub(b.last).Seconds()*tb.rate)
+	b.last = now
+
+	d := Decision{Limit: tb.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = tb.duration(1 - b.tokens)
+	}
+
+	d.Remaining = int(b.tokens)
+	d.Reset = tb.duration(float64(tb.burst) - b.tokens)
+	return d, nil
+}
+
+// duration returns how long it takes to refill n tokens
+func (tb *TokenBucket) duration(n float64) time.Duration {
+	if tb.rate <= 0 {
+		return 0
+	}
+	return time.Duration(n / tb.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have been idle long enough to be full again
+func (tb *TokenBucket) sweep(now time.Time) {
+	if now.Sub(tb.swept) < sweepInterval {
+		return
+	}
+	tb.swept = now
+
+	full := tb.duration(float64(tb.burst))
+	for key, b := range tb.buckets {
+		if now.Sub(b.last) > full {
+			delete(tb.buckets, key)
+		}
+	}
+}
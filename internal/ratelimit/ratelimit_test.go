@@ -0,0 +1,258 @@
+package ratelimit
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a controllable time source
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// TestTokenBucket tests burst, exhaustion and refill
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	tb := NewTokenBucket(2, 3)
+	tb.now = clock.now
+
+	for i := 0; i < 3; i++ {
+		d, _ := tb.Allow("a")
+		if !d.Allowed {
+			t.Fatalf("Expected request %d to be allowed within burst", i+1)
+		}
+		if d.Remaining != 2-i {
+			t.Errorf("Expected %d remaining, got %d", 2-i, d.Remaining)
+		}
+	}
+
+	d, _ := tb.Allow("a")
+	if d.Allowed {
+		t.Fatal("Expected request beyond burst to be rejected")
+	}
+	if d.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected retry after 500ms, got %v", d.RetryAfter)
+	}
+	if d.Reset != 1500*time.Millisecond {
+		t.Errorf("Expected reset in 1.5s, got %v", d.Reset)
+	}
+
+	// Other keys have their own bucket
+	if d, _ := tb.Allow("b"); !d.Allowed {
+		t.Error("Expected a separate bucket per key")
+	}
+
+	// Half a second refills one token at 2/s
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	if d, _ := tb.Allow("a"); !d.Allowed {
+		t.Error("Expected request to be allowed after refill")
+	}
+}
+
+// TestTokenBucketSweep tests that idle buckets are dropped
+func TestTokenBucketSweep(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	tb := NewTokenBucket(1, 1)
+	tb.now = clock.now
+
+	tb.Allow("idle")
+	clock.t = clock.t.Add(2 * sweepInterval)
+	tb.Allow("active")
+
+	if _, ok := tb.buckets["idle"]; ok {
+		t.Error("Expected idle bucket to be swept")
+	}
+	if _, ok := tb.buckets["active"]; !ok {
+		t.Error("Expected active bucket to be kept")
+	}
+}
+
+// fakeRedis is a tiny RESP server implementing the commands used by the
+// Redis limiter, with keys that never expire on their own
+type fakeRedis struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	keys map[string]int64
+	ttls map[string]int64
+}
+
+// newFakeRedis starts a fake Redis server on a random port
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, keys: map[string]int64{}, ttls: map[string]int64{}}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// serve answers commands on a single connection
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	c := &respConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), timeout: time.Second}
+	for {
+		req, err := c.read()
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range req.([]any) {
+			args = append(args, a.(string))
+		}
+		fmt.Fprint(conn, f.exec(args))
+	}
+}
+
+// exec runs a command and returns the encoded reply
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := args[1]
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		if _, ok := f.keys[key]; ok {
+			return "$-1\r\n"
+		}
+		f.keys[key], _ = strconv.ParseInt(args[2], 10, 64)
+		f.ttls[key], _ = strconv.ParseInt(args[4], 10, 64)
+		return "+OK\r\n"
+	case "INCR":
+		f.keys[key]++
+		return fmt.Sprintf(":%d\r\n", f.keys[key])
+	case "PTTL":
+		ttl, ok := f.ttls[key]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", ttl)
+	case "PEXPIRE":
+		f.ttls[key], _ = strconv.ParseInt(args[2], 10, 64)
+		return ":1\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// TestRedis tests the Redis limiter against a fake server
+func TestRedis(t *testing.T) {
+	f := newFakeRedis(t)
+	rl := NewRedis(f.ln.Addr().String(), "test:", 2, 3)
+	defer rl.Close()
+
+	for i := 0; i < 3; i++ {
+		d, err := rl.Allow("a")
+		if err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+		if !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("Expected request %d allowed with %d remaining, got %+v", i+1, 2-i, d)
+		}
+	}
+
+	d, err := rl.Allow("a")
+	if err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	if d.Allowed {
+		t.Fatal("Expected request beyond limit to be rejected")
+	}
+	if d.RetryAfter != 1500*time.Millisecond {
+		t.Errorf("Expected retry after the 1.5s window, got %v", d.RetryAfter)
+	}
+
+	if _, ok := f.keys["test:a"]; !ok {
+		t.Error("Expected key to be prefixed")
+	}
+	if d, _ := rl.Allow("b"); !d.Allowed {
+		t.Error("Expected a separate counter per key")
+	}
+}
+
+// TestRedisUnavailable tests that connection failures surface as errors
+func TestRedisUnavailable(t *testing.T) {
+	f := newFakeRedis(t)
+	addr := f.ln.Addr().String()
+	f.ln.Close()
+
+	rl := NewRedis(addr, "test:", 1, 1)
+	if _, err := rl.Allow("a"); err == nil {
+		t.Error("Expected an error when Redis is unreachable")
+	}
+}
+
+// TestRedisUnresponsive tests that a Redis server which accepts but never
+// answers delays concurrent requests by one timeout, not one each, and
+// that later requests fail fast while backing off
+func TestRedisUnresponsive(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	var mu sync.Mutex
+	var held []net.Conn
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range held {
+			conn.Close()
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			held = append(held, conn)
+			mu.Unlock()
+		}
+	}()
+
+	rl := NewRedis(ln.Addr().String(), "test:", 1, 1)
+	defer rl.Close()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rl.Allow("a"); err == nil {
+				t.Error("Expected an error when Redis does not answer")
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 3*redisTimeout {
+		t.Errorf("Expected concurrent requests to time out together, took %v", elapsed)
+	}
+
+	start = time.Now()
+	if _, err := rl.Allow("a"); err == nil {
+		t.Error("Expected an error while backing off")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected a fast failure while backing off, took %v", elapsed)
+	}
+}
@@ -0,0 +1,204 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRedisPrefix namespaces rate limit keys in Redis
+const DefaultRedisPrefix = "httpbin:ratelimit:"
+
+// redisTimeout bounds dialing and each round trip to Redis
+const redisTimeout = time.Second
+
+// Connection failures back off from redisMinBackoff, doubling up to
+// redisMaxBackoff, and up to redisMaxIdle connections are kept for reuse
+const (
+	redisMinBackoff = 100 * time.Millisecond
+	redisMaxBackoff = 5 * time.Second
+	redisMaxIdle    = 16
+)
+
+// Redis is a limiter shared by all replicas through a Redis server. It
+// uses a fixed window of burst requests per burst/rate seconds, which
+// enforces the same sustained rate as the token bucket with a single
+// round trip per request.
+type Redis struct {
+	mu       sync.Mutex
+	addr     string
+	prefix   string
+	burst    int
+	window   time.Duration
+	idle     []*respConn
+	closed   bool
+	failures int
+	retryAt  time.Time
+	lastErr  error
+}
+
+// NewRedis creates a limiter storing its counters in the Redis server at
+// addr. Connections are established lazily, used by one request at a
+// time and re-established after errors. After a connection failure,
+// requests fail straight away until a backoff passes, so a Redis outage
+// fails requests quickly instead of queueing them behind timeouts.
+func NewRedis(addr, prefix string, rate float64, burst int) *Redis {
+	window := time.Duration(float64(burst) / rate * float64(time.Second))
+	return &Redis{
+		addr:   addr,
+		prefix: prefix,
+		burst:  burst,
+		window: max(window, time.Millisecond),
+	}
+}
+
+// Allow increments the counter for key's current window
+func (rl *Redis) Allow(key string) (Decision, error) {
+	conn, err := rl.get()
+	if err != nil {
+		return Decision{}, err
+	}
+
+	count, ttl, err := rl.incr(conn, rl.prefix+key)
+	var replyErr respError
+	if errors.As(err, &replyErr) {
+		// The server answered, so the connection is still good
+		rl.put(conn)
+		return Decision{}, err
+	}
+	if err != nil {
+		conn.Close()
+		rl.fail(err)
+		return Decision{}, err
+	}
+	rl.put(conn)
+
+	d := Decision{
+		Allowed:   count <= int64(rl.burst),
+		Limit:     rl.burst,
+		Remaining: max(rl.burst-int(count), 0),
+		Reset:     ttl,
+	}
+	if !d.Allowed {
+		d.RetryAfter = ttl
+	}
+	return d, nil
+}
+
+// get returns an idle connection or dials a new one, failing straight
+// away while backing off. Dialing happens without holding mu.
+func (rl *Redis) get() (*respConn, error) {
+	rl.mu.Lock()
+	if n := len(rl.idle); n > 0 {
+		conn := rl.idle[n-1]
+		rl.idle = rl.idle[:n-1]
+		rl.mu.Unlock()
+		return conn, nil
+	}
+	now := time.Now()
+	if now.Before(rl.retryAt) {
+		err := rl.lastErr
+		rl.mu.Unlock()
+		return nil, fmt.Errorf("redis unavailable, retrying in %s: %w", rl.retryAt.Sub(now).Round(time.Millisecond), err)
+	}
+	if rl.failures > 0 {
+		// Only this request probes a failing server; the others keep
+		// failing fast until it succeeds or the next backoff passes
+		rl.retryAt = now.Add(rl.backoff())
+	}
+	rl.mu.Unlock()
+
+	conn, err := dialRESP(rl.addr, redisTimeout)
+	if err != nil {
+		rl.fail(err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// put returns a working connection for reuse, ending any backoff
+func (rl *Redis) put(conn *respConn) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.failures = 0
+	rl.retryAt = time.Time{}
+	if rl.closed || len(rl.idle) >= redisMaxIdle {
+		conn.Close()
+		return
+	}
+	rl.idle = append(rl.idle, conn)
+}
+
+// fail records a connection failure and starts the next backoff
+func (rl *Redis) fail(err error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.failures++
+	rl.lastErr = err
+	rl.retryAt = time.Now().Add(rl.backoff())
+}
+
+// backoff returns how long to wait after the current run of failures;
+// callers hold mu
+func (rl *Redis) backoff() time.Duration {
+	d := redisMinBackoff
+	for i := 1; i < rl.failures && d < redisMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, redisMaxBackoff)
+}
+
+// incr counts a request in the window for key over conn and returns the
+// count and the time left in the window
+func (rl *Redis) incr(conn *respConn, key string) (int64, time.Duration, error) {
+	window := strconv.FormatInt(rl.window.Milliseconds(), 10)
+
+	// SET NX starts a window with an expiry; INCR then never creates a key
+	// without one, except if the window expires in between
+	replies, err := conn.pipeline(
+		[]string{"SET", key, "0", "PX", window, "NX"},
+		[]string{"INCR", key},
+		[]string{"PTTL", key},
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(respError); ok {
+			return 0, 0, err
+		}
+	}
+
+	count, ok1 := replies[1].(int64)
+	ttl, ok2 := replies[2].(int64)
+	if !ok1 || !ok2 {
+		return 0, 0, fmt.Errorf("redis: unexpected reply %v", replies)
+	}
+
+	if ttl < 0 {
+		if _, err := conn.pipeline([]string{"PEXPIRE", key, window}); err != nil {
+			return 0, 0, err
+		}
+		ttl = rl.window.Milliseconds()
+	}
+	return count, time.Duration(ttl) * time.Millisecond, nil
+}
+
+// Close closes the idle connections to Redis; connections in use are
+// closed when their request finishes
+func (rl *Redis) Close() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.closed = true
+	var err error
+	for _, conn := range rl.idle {
+		err = errors.Join(err, conn.Close())
+	}
+	rl.idle = nil
+	return err
+}
@@ -0,0 +1,32 @@
+// Package routing holds the ServeMux helpers shared by the packages that
+// serve configured routes in front of the built-in endpoints.
+package routing
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Register adds a handler to mux, reporting invalid or conflicting
+// patterns as errors instead of panics
+func Register(mux *http.ServeMux, pattern string, h http.Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	mux.Handle(pattern, h)
+	return nil
+}
+
+// Fallback serves requests matching a pattern of mux with mux and the
+// rest with next
+func Fallback(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
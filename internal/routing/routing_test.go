@@ -0,0 +1,40 @@
+package routing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRegister tests that bad patterns are reported rather than panicking
+func TestRegister(t *testing.T) {
+	mux := http.NewServeMux()
+	if err := Register(mux, "GET /orders/{id}", http.NotFoundHandler()); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	for _, pattern := range []string{"GET /orders/{id}", "GET /orders/{id", ""} {
+		if err := Register(mux, pattern, http.NotFoundHandler()); err == nil {
+			t.Errorf("Expected an error for pattern %q", pattern)
+		}
+	}
+}
+
+// TestFallback tests that only matching requests are served by the mux
+func TestFallback(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "order "+r.PathValue("id"))
+	})
+	handler := Fallback(mux, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "next")
+	}))
+
+	for path, expected := range map[string]string{"/orders/7": "order 7", "/get": "next"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Body.String() != expected {
+			t.Errorf("%s: expected %q, got %q", path, expected, rr.Body)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Package scenario serves configured routes with a scripted sequence of
+// responses per client session, e.g. a 500 followed by a 200, to test
+// retry and pagination logic deterministically.
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/chaos"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/routing"
+)
+
+// SessionHeader keys the progress through a scenario unless a scenario
+// names its own header; requests without it share one session
+const SessionHeader = "X-Httpbin-Session"
+
+// StepHeader reports which response of the sequence was served, from 1
+const StepHeader = "X-Httpbin-Scenario-Step"
+
+// maxSessions bounds the sessions tracked per scenario
+const maxSessions = 1000
+
+// Response is one step of a scenario. Body is sent as is and JSON is
+// encoded as JSON; Delay holds the response back.
+type Response struct {
+	Status  int               `yaml:"status" json:"status,omitempty"`
+	Headers map[string]string `yaml:"headers" json:"headers,omitempty"`
+	Body    string            `yaml:"body" json:"body,omitempty"`
+	JSON    any               `yaml:"json" json:"json,omitempty"`
+	Delay   chaos.Duration    `yaml:"delay" json:"delay,omitempty"`
+}
+
+// Scenario answers requests matching Pattern, a ServeMux pattern such as
+// "GET /orders", with Responses in turn. After the last response the
+// sequence starts over if Loop is set, and repeats the last one otherwise.
+type Scenario struct {
+	Name          string     `yaml:"name" json:"name"`
+	Pattern       string     `yaml:"pattern" json:"pattern"`
+	SessionHeader string     `yaml:"session_header" json:"session_header,omitempty"`
+	Loop          bool       `yaml:"loop" json:"loop,omitempty"`
+	Responses     []Response `yaml:"responses" json:"responses"`
+}
+
+// Validate checks a scenario for invalid values
+func (sc Scenario) Validate() error {
+	if sc.Name == "" {
+		return fmt.Errorf("scenario %q requires a name", sc.Pattern)
+	}
+	if err := routing.Register(http.NewServeMux(), sc.Pattern, http.NotFoundHandler()); err != nil {
+		return fmt.Errorf("scenario %s: %w", sc.Name, err)
+	}
+	if len(sc.Responses) == 0 {
+		return fmt.Errorf("scenario %s requires responses", sc.Name)
+	}
+	for i, resp := range sc.Responses {
+		if resp.Status != 0 && (resp.Status < 200 || resp.Status > 599) {
+			return fmt.Errorf("scenario %s: response %d has invalid status %d", sc.Name, i+1, resp.Status)
+		}
+		if resp.Body != "" && resp.JSON != nil {
+			return fmt.Errorf("scenario %s: response %d sets both body and json", sc.Name, i+1)
+		}
+		if resp.Delay < 0 {
+			return fmt.Errorf("scenario %s: response %d has a negative delay", sc.Name, i+1)
+		}
+		if _, err := json.Marshal(resp.JSON); err != nil {
+			return fmt.Errorf("scenario %s: response %d: %w", sc.Name, i+1, err)
+		}
+	}
+	return nil
+}
+
+// state is a scenario with its encoded responses and the number of
+// calls made by each session
+type state struct {
+	Scenario
+	bodies [][]byte
+	calls  map[string]int
+}
+
+// Scenarios serves the requests matching its scenarios and passes
+// everything else on
+type Scenarios struct {
+	mux *http.ServeMux
+
+	mu     sync.Mutex
+	states []*state
+}
+
+// New creates Scenarios for the given scenarios
+func New(scenarios []Scenario) (*Scenarios, error) {
+	s := &Scenarios{mux: http.NewServeMux()}
+	for _, sc := range scenarios {
+		if err := sc.Validate(); err != nil {
+			return nil, err
+		}
+		if s.find(sc.Name) != nil {
+			return nil, fmt.Errorf("duplicate scenario %s", sc.Name)
+		}
+		if sc.SessionHeader == "" {
+			sc.SessionHeader = SessionHeader
+		}
+
+		st := &state{Scenario: sc, calls: map[string]int{}}
+		for _, resp := range sc.Responses {
+			body := []byte(resp.Body)
+			if resp.JSON != nil {
+				body, _ = json.Marshal(resp.JSON)
+			}
+			st.bodies = append(st.bodies, body)
+		}
+		if err := routing.Register(s.mux, sc.Pattern, s.handler(st)); err != nil {
+			return nil, fmt.Errorf("scenario %s: %w", sc.Name, err)
+		}
+		s.states = append(s.states, st)
+	}
+	return s, nil
+}
+
+// find returns the named scenario, or nil
+func (s *Scenarios) find(name string) *state {
+	for _, st := range s.states {
+		if st.Name == name {
+			return st
+		}
+	}
+	return nil
+}
+
+// Middleware serves requests matching a scenario and the rest with next
+func (s *Scenarios) Middleware(next http.Handler) http.Handler {
+	return routing.Fallback(s.mux, next)
+}
+
+// next advances a session through a scenario and returns the index of
+// the response to serve
+func (s *Scenarios) next(st *state, session string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calls, ok := st.calls[session]
+	if !ok && len(st.calls) >= maxSessions {
+		// Forget an arbitrary session to make room
+		for old := range st.calls {
+			delete(st.calls, old)
+			break
+		}
+	}
+	st.calls[session] = calls + 1
+
+	if st.Loop {
+		return calls % len(st.Responses)
+	}
+	return min(calls, len(st.Responses)-1)
+}
+
+// handler serves the responses of one scenario
+func (s *Scenarios) handler(st *state) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		i := s.next(st, r.Header.Get(st.SessionHeader))
+		resp := st.Responses[i]
+
+		if resp.Delay > 0 {
+			timer := time.NewTimer(time.Duration(resp.Delay))
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		switch {
+		case resp.JSON != nil:
+			w.Header().Set("Content-Type", "application/json")
+		case resp.Body != "":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		for name, value := range resp.Headers {
+			w.Header().Set(name, value)
+		}
+		w.Header().Set(StepHeader, strconv.Itoa(i+1))
+		status := resp.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		w.Write(st.bodies[i])
+	}
+}
+
+// Status reports a scenario and the calls made by each of its sessions
+type Status struct {
+	Name          string         `json:"name"`
+	Pattern       string         `json:"pattern"`
+	SessionHeader string         `json:"session_header"`
+	Loop          bool           `json:"loop"`
+	Responses     int            `json:"responses"`
+	Sessions      map[string]int `json:"sessions"`
+}
+
+// StatusResponse is the body returned by Handler
+type StatusResponse struct {
+	Scenarios []Status `json:"scenarios"`
+}
+
+// Handler reports the scenarios, in configured order, on GET and resets
+// their progress on DELETE. A {name} path value selects one scenario,
+// and ?session= resets only that session.
+func (s *Scenarios) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		states := s.states
+		if name := r.PathValue("name"); name != "" {
+			st := s.find(name)
+			if st == nil {
+				handlers.JSONError(w, r, http.StatusNotFound, "Unknown scenario "+name)
+				return
+			}
+			states = []*state{st}
+		}
+
+		s.mu.Lock()
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodDelete:
+			query := r.URL.Query()
+			for _, st := range states {
+				if query.Has("session") {
+					delete(st.calls, query.Get("session"))
+				} else {
+					clear(st.calls)
+				}
+			}
+		default:
+			s.mu.Unlock()
+			handlers.JSONError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		response := StatusResponse{Scenarios: []Status{}}
+		for _, st := range states {
+			sessions := make(map[string]int, len(st.calls))
+			for session, calls := range st.calls {
+				sessions[session] = calls
+			}
+			response.Scenarios = append(response.Scenarios, Status{
+				Name:          st.Name,
+				Pattern:       st.Pattern,
+				SessionHeader: st.SessionHeader,
+				Loop:          st.Loop,
+				Responses:     len(st.Responses),
+				Sessions:      sessions,
+			})
+		}
+		s.mu.Unlock()
+
+		handlers.JSONResponse(w, r, http.StatusOK, response)
+	}
+}
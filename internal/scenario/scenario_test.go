@@ -0,0 +1,162 @@
+package scenario
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/chaos"
+)
+
+// fallback answers requests that no scenario matches
+var fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "local")
+})
+
+// TestMiddleware tests stepping through scenarios per session
+func TestMiddleware(t *testing.T) {
+	s, err := New([]Scenario{
+		{Name: "retry", Pattern: "GET /orders", Responses: []Response{
+			{Status: 500},
+			{Status: 200, Body: "A", Headers: map[string]string{"X-Page": "1"}},
+		}},
+		{Name: "pages", Pattern: "/pages", Loop: true, SessionHeader: "X-Client", Responses: []Response{
+			{JSON: map[string]any{"page": 1, "next": "/pages"}},
+			{JSON: map[string]any{"page": 2}, Delay: chaos.Duration(10 * time.Millisecond)},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Middleware(fallback)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		header         string
+		session        string
+		expectedStatus int
+		expectedBody   string
+		expectedStep   string
+	}{
+		{"first call", "GET", "/orders", SessionHeader, "a", http.StatusInternalServerError, "", "1"},
+		{"second call", "GET", "/orders", SessionHeader, "a", http.StatusOK, "A", "2"},
+		{"repeat last", "GET", "/orders", SessionHeader, "a", http.StatusOK, "A", "2"},
+		{"other session", "GET", "/orders", SessionHeader, "b", http.StatusInternalServerError, "", "1"},
+		{"no session", "GET", "/orders", SessionHeader, "", http.StatusInternalServerError, "", "1"},
+		{"unmatched method", "POST", "/orders", SessionHeader, "a", http.StatusOK, "local", ""},
+		{"unmatched path", "GET", "/get", SessionHeader, "a", http.StatusOK, "local", ""},
+		{"loop first", "GET", "/pages", "X-Client", "a", http.StatusOK, `{"next":"/pages","page":1}`, "1"},
+		{"loop second", "GET", "/pages", "X-Client", "a", http.StatusOK, `{"page":2}`, "2"},
+		{"loop again", "GET", "/pages", "X-Client", "a", http.StatusOK, `{"next":"/pages","page":1}`, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.session != "" {
+				req.Header.Set(tt.header, tt.session)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body)
+			}
+			if step := rr.Header().Get(StepHeader); step != tt.expectedStep {
+				t.Errorf("Expected step %q, got %q", tt.expectedStep, step)
+			}
+		})
+	}
+}
+
+// TestHandler tests reporting and resetting scenario progress
+func TestHandler(t *testing.T) {
+	s, err := New([]Scenario{
+		{Name: "a", Pattern: "/a", Responses: []Response{{Status: 500}, {Status: 200}}},
+		{Name: "b", Pattern: "/b", Responses: []Response{{Status: 500}, {Status: 200}}},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Middleware(fallback)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/scenarios", s.Handler())
+	mux.HandleFunc("/admin/scenarios/{name}", s.Handler())
+
+	call := func(path, session string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(SessionHeader, session)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	admin := func(method, path string) (int, StatusResponse) {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		var response StatusResponse
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response
+	}
+
+	call("/a", "x")
+	call("/a", "y")
+	call("/b", "x")
+
+	_, listed := admin("GET", "/admin/scenarios")
+	if len(listed.Scenarios) != 2 || listed.Scenarios[0].Name != "a" || listed.Scenarios[0].Sessions["x"] != 1 || listed.Scenarios[0].SessionHeader != SessionHeader {
+		t.Fatalf("Unexpected scenarios: %+v", listed)
+	}
+
+	admin("DELETE", "/admin/scenarios/a?session=x")
+	if call("/a", "x") != 500 || call("/a", "y") != 200 {
+		t.Error("Expected only session x of scenario a to be reset")
+	}
+	admin("DELETE", "/admin/scenarios")
+	if call("/a", "y") != 500 || call("/b", "x") != 500 {
+		t.Error("Expected all scenarios to be reset")
+	}
+
+	if code, _ := admin("GET", "/admin/scenarios/missing"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown scenario, got %d", code)
+	}
+	if code, _ := admin("POST", "/admin/scenarios"); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", code)
+	}
+}
+
+// TestValidate tests rejection of invalid scenarios
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario Scenario
+	}{
+		{"no name", Scenario{Pattern: "/a", Responses: []Response{{}}}},
+		{"bad pattern", Scenario{Name: "a", Pattern: "a", Responses: []Response{{}}}},
+		{"no responses", Scenario{Name: "a", Pattern: "/a"}},
+		{"bad status", Scenario{Name: "a", Pattern: "/a", Responses: []Response{{Status: 99}}}},
+		{"body and json", Scenario{Name: "a", Pattern: "/a", Responses: []Response{{Body: "x", JSON: 1}}}},
+		{"negative delay", Scenario{Name: "a", Pattern: "/a", Responses: []Response{{Delay: -1}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.scenario.Validate(); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	dup := Scenario{Name: "a", Pattern: "/a", Responses: []Response{{}}}
+	if _, err := New([]Scenario{dup, {Name: "a", Pattern: "/b", Responses: []Response{{}}}}); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("Expected a duplicate scenario error, got %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+// Package script serves configured routes whose responses are computed
+// by Starlark scripts, so mocks with conditional errors or computed
+// fields need no code changes.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkjson"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/routing"
+)
+
+// Script limits
+const (
+	// maxBody is how much of a request body scripts can see
+	maxBody = 1 << 20
+	// maxSteps bounds the work of one call, stopping runaway loops
+	maxSteps = 1_000_000
+)
+
+// entryPoint is the function every script must define
+const entryPoint = "handle"
+
+// wildcard matches the wildcards of a ServeMux pattern
+var wildcard = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(?:\.\.\.)?\}`)
+
+// fileOptions enables the Starlark features a script may reasonably use
+var fileOptions = &syntax.FileOptions{While: true, TopLevelControl: true, GlobalReassign: true}
+
+// Route serves requests matching Pattern, a ServeMux pattern such as
+// "GET /orders/{id}", with the script's handle(req) function. The script
+// is given inline as Source or read from File.
+type Route struct {
+	Pattern string `yaml:"pattern" json:"pattern"`
+	Source  string `yaml:"source" json:"source,omitempty"`
+	File    string `yaml:"file" json:"file,omitempty"`
+}
+
+// Validate checks a route for invalid values; scripts are compiled by New
+func (route Route) Validate() error {
+	if (route.Source == "") == (route.File == "") {
+		return fmt.Errorf("script route %q requires exactly one of source or file", route.Pattern)
+	}
+	if err := routing.Register(http.NewServeMux(), route.Pattern, http.NotFoundHandler()); err != nil {
+		return fmt.Errorf("script route %q: %w", route.Pattern, err)
+	}
+	return nil
+}
+
+// Scripts serves the requests matching its routes and passes everything
+// else on
+type Scripts struct {
+	mux *http.ServeMux
+}
+
+// New compiles the scripts of the given routes
+func New(routes []Route) (*Scripts, error) {
+	s := &Scripts{mux: http.NewServeMux()}
+	for _, route := range routes {
+		if err := route.Validate(); err != nil {
+			return nil, err
+		}
+		src, name := route.Source, route.Pattern
+		if route.File != "" {
+			data, err := os.ReadFile(route.File)
+			if err != nil {
+				return nil, fmt.Errorf("script route %q: %w", route.Pattern, err)
+			}
+			src, name = string(data), route.File
+		}
+		handle, err := compile(name, src)
+		if err != nil {
+			return nil, fmt.Errorf("script route %q: %w", route.Pattern, err)
+		}
+
+		params := wildcard.FindAllStringSubmatch(route.Pattern, -1)
+		h := &scriptHandler{handle: handle}
+		for _, param := range params {
+			h.params = append(h.params, param[1])
+		}
+		if err := routing.Register(s.mux, route.Pattern, h); err != nil {
+			return nil, fmt.Errorf("script route %q: %w", route.Pattern, err)
+		}
+	}
+	return s, nil
+}
+
+// compile runs a script's top level and returns its handle function
+func compile(name, src string) (starlark.Callable, error) {
+	thread := &starlark.Thread{Name: "load " + name}
+	thread.SetMaxExecutionSteps(maxSteps)
+	globals, err := starlark.ExecFileOptions(fileOptions, thread, name, src, predeclared())
+	if err != nil {
+		return nil, err
+	}
+	handle, ok := globals[entryPoint].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script does not define %s(req)", entryPoint)
+	}
+	// Frozen globals can be shared by concurrent requests
+	globals.Freeze()
+	return handle, nil
+}
+
+// predeclared returns the names available to every script
+func predeclared() starlark.StringDict {
+	return starlark.StringDict{
+		"json":   starlarkjson.Module,
+		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+	}
+}
+
+// Middleware serves requests matching a route and the rest with next
+func (s *Scripts) Middleware(next http.Handler) http.Handler {
+	return routing.Fallback(s.mux, next)
+}
+
+// scriptHandler answers requests with a script's handle function
+type scriptHandler struct {
+	handle starlark.Callable
+	params []string
+}
+
+func (h *scriptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		handlers.JSONError(w, r, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	thread := &starlark.Thread{
+		Name: r.Method + " " + r.URL.Path,
+		Print: func(_ *starlark.Thread, msg string) {
+			slog.Debug("Script output", "path", r.URL.Path, "message", msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(maxSteps)
+	stop := context.AfterFunc(r.Context(), func() { thread.Cancel("request cancelled") })
+	defer stop()
+
+	req := h.request(thread, r, body)
+	result, err := starlark.Call(thread, h.handle, starlark.Tuple{req}, nil)
+	if err != nil {
+		if r.Context().Err() != nil {
+			// The client went away; nobody is left to answer
+			return
+		}
+		handlers.JSONError(w, r, http.StatusInternalServerError, "Script error: "+scriptError(err))
+		return
+	}
+	if err := writeResult(thread, w, result); err != nil {
+		handlers.JSONError(w, r, http.StatusInternalServerError, "Script error: "+err.Error())
+	}
+}
+
+// scriptError describes a script failure, with its Starlark backtrace
+func scriptError(err error) string {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return evalErr.Backtrace()
+	}
+	return err.Error()
+}
+
+// request builds the req struct passed to handle: method, path, url,
+// host, query, headers and params as dicts of strings, the raw body, and
+// json, the body decoded as JSON or None
+func (h *scriptHandler) request(thread *starlark.Thread, r *http.Request, body []byte) starlark.Value {
+	query := starlark.NewDict(len(r.URL.Query()))
+	for name, values := range r.URL.Query() {
+		query.SetKey(starlark.String(name), starlark.String(values[0]))
+	}
+	headers := starlark.NewDict(len(r.Header))
+	for name, values := range r.Header {
+		headers.SetKey(starlark.String(name), starlark.String(strings.Join(values, ", ")))
+	}
+	params := starlark.NewDict(len(h.params))
+	for _, name := range h.params {
+		params.SetKey(starlark.String(name), starlark.String(r.PathValue(name)))
+	}
+
+	var decoded starlark.Value = starlark.None
+	if len(body) > 0 {
+		decode := starlarkjson.Module.Members["decode"]
+		if v, err := starlark.Call(thread, decode, starlark.Tuple{starlark.String(body)}, nil); err == nil {
+			decoded = v
+		}
+	}
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"method":  starlark.String(r.Method),
+		"path":    starlark.String(r.URL.Path),
+		"url":     starlark.String(r.URL.RequestURI()),
+		"host":    starlark.String(r.Host),
+		"query":   query,
+		"headers": headers,
+		"params":  params,
+		"body":    starlark.String(body),
+		"json":    decoded,
+	})
+}
+
+// writeResult writes the dict returned by handle: status (default 200),
+// headers, and body, sent as is if it is a string or bytes and as JSON
+// otherwise
+func writeResult(thread *starlark.Thread, w http.ResponseWriter, result starlark.Value) error {
+	dict, ok := result.(*starlark.Dict)
+	if !ok {
+		return fmt.Errorf("%s must return a dict, got %s", entryPoint, result.Type())
+	}
+
+	status := http.StatusOK
+	if v, found, _ := dict.Get(starlark.String("status")); found {
+		code, err := starlark.AsInt32(v)
+		if err != nil || code < 200 || code > 599 {
+			return fmt.Errorf("invalid status %s", v)
+		}
+		status = code
+	}
+
+	header := http.Header{}
+	if v, found, _ := dict.Get(starlark.String("headers")); found {
+		headers, ok := v.(*starlark.Dict)
+		if !ok {
+			return fmt.Errorf("headers must be a dict, got %s", v.Type())
+		}
+		for _, item := range headers.Items() {
+			name, ok1 := starlark.AsString(item[0])
+			value, ok2 := starlark.AsString(item[1])
+			if !ok1 || !ok2 {
+				return fmt.Errorf("header %s: names and values must be strings", item[0])
+			}
+			header.Set(name, value)
+		}
+	}
+
+	var body []byte
+	contentType := "text/plain; charset=utf-8"
+	if v, found, _ := dict.Get(starlark.String("body")); found && v != starlark.None {
+		switch v := v.(type) {
+		case starlark.String:
+			body = []byte(v)
+		case starlark.Bytes:
+			body, contentType = []byte(v), "application/octet-stream"
+		default:
+			encoded, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{v}, nil)
+			if err != nil {
+				return fmt.Errorf("encoding body: %w", err)
+			}
+			body, contentType = []byte(encoded.(starlark.String)), "application/json"
+		}
+	}
+
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", contentType)
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+	return nil
+}
@@ -0,0 +1,139 @@
+package script
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fallback answers requests that no route matches
+var fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "local")
+})
+
+// orders computes fields and fails conditionally
+const orders = `
+def handle(req):
+    if req.headers.get("Authorization") == None:
+        return {"status": 401, "body": {"error": "unauthorized"}}
+    qty = int(req.query.get("qty", "1"))
+    return {
+        "status": 201 if req.method == "POST" else 200,
+        "headers": {"X-Order": req.params["id"]},
+        "body": {"id": req.params["id"], "total": qty * 5, "item": req.json["item"] if req.json else None},
+    }
+`
+
+// TestMiddleware tests answering routes with scripts
+func TestMiddleware(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "echo.star")
+	os.WriteFile(file, []byte("def handle(req):\n    return {\"body\": req.method + \" \" + req.path, \"headers\": {\"Content-Type\": \"text/csv\"}}\n"), 0o644)
+
+	s, err := New([]Route{
+		{Pattern: "/orders/{id}", Source: orders},
+		{Pattern: "GET /echo/{rest...}", File: file},
+		{Pattern: "/bad", Source: "def handle(req):\n    return 1 // 0\n"},
+		{Pattern: "/not-dict", Source: "def handle(req):\n    return 'hi'\n"},
+		{Pattern: "/loop", Source: "def handle(req):\n    while True:\n        pass\n"},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Middleware(fallback)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		auth           bool
+		expectedStatus int
+		expectedBody   string
+		expectedHeader map[string]string
+	}{
+		{"computed fields", "POST", "/orders/7?qty=3", `{"item":"book"}`, true, http.StatusCreated, `{"id":"7","item":"book","total":15}`, map[string]string{"X-Order": "7", "Content-Type": "application/json"}},
+		{"conditional error", "GET", "/orders/7", "", false, http.StatusUnauthorized, `{"error":"unauthorized"}`, nil},
+		{"script file", "GET", "/echo/a/b", "", false, http.StatusOK, "GET /echo/a/b", map[string]string{"Content-Type": "text/csv"}},
+		{"method not matched", "POST", "/echo/a", "", false, http.StatusOK, "local", nil},
+		{"unmatched", "GET", "/get", "", false, http.StatusOK, "local", nil},
+		{"runtime error", "GET", "/bad", "", false, http.StatusInternalServerError, "division by zero", nil},
+		{"bad result", "GET", "/not-dict", "", false, http.StatusInternalServerError, "must return a dict", nil},
+		{"step limit", "GET", "/loop", "", false, http.StatusInternalServerError, "too many steps", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.auth {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tt.expectedBody, rr.Body)
+			}
+			for name, want := range tt.expectedHeader {
+				if got := rr.Header().Get(name); got != want {
+					t.Errorf("Expected %s %q, got %q", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestCancel tests that scripts stop when the request is cancelled
+func TestCancel(t *testing.T) {
+	s, err := New([]Route{{Pattern: "/loop", Source: "def handle(req):\n    while True:\n        pass\n"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Middleware(fallback).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/loop", nil).WithContext(ctx))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Script kept running after the request was cancelled")
+	}
+}
+
+// TestNew tests rejection of invalid routes and scripts
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name  string
+		route Route
+	}{
+		{"no script", Route{Pattern: "/a"}},
+		{"source and file", Route{Pattern: "/a", Source: "x", File: "x.star"}},
+		{"bad pattern", Route{Pattern: "GET a", Source: "x"}},
+		{"missing file", Route{Pattern: "/a", File: "/does/not/exist.star"}},
+		{"syntax error", Route{Pattern: "/a", Source: "def handle(req)\n"}},
+		{"no handle", Route{Pattern: "/a", Source: "x = 1\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]Route{tt.route}); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	if _, err := New([]Route{{Pattern: "/a", Source: "def handle(req):\n    pass\n"}, {Pattern: "/a", Source: "def handle(req):\n    pass\n"}}); err == nil {
+		t.Error("Expected an error for conflicting patterns")
+	}
+}
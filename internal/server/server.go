@@ -2,65 +2,551 @@ package server
 
 import (
 	"context"
+	"expvar"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
 
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/chaos"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/config"
 	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/history"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/metrics"
 	"github.com/TykTechnologies/tyk-devops-assignement/internal/middleware"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/openapi"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/proxy"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/proxyproto"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/ratelimit"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/scenario"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/script"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/tail"
+	"github.com/TykTechnologies/tyk-devops-assignement/pkg/httpbin"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	httpServer *http.Server
-	mux        *http.ServeMux
+	httpServer  *http.Server
+	mux         *http.ServeMux
+	adminAddr   string
+	adminServer *http.Server
+	adminMux    *http.ServeMux
+	tail        *tail.Hub
+	history     *history.Log
+	webhooks    *handlers.Webhooks
+	mirror      *middleware.Mirror
+	proxy       *proxy.Proxy
+	forward     *proxy.Forward
+	scripts     *script.Scripts
+	scenarios   *scenario.Scenarios
+	mock        *openapi.Mock
+	health      *handlers.Health
+	build       handlers.BuildInfo
+	pprof       bool
+	timeouts    config.Timeouts
+	tls         config.TLS
+	reload      func() error
+	endpoints   config.Endpoints
+	listeners   []config.Listener
+	inherited   []net.Listener
+	proxyProto  bool
+	settings    atomic.Pointer[handlers.Settings]
+	limiter     ratelimit.Limiter
+	limitKey    func(*http.Request) string
+	metrics     metrics.Recorder
+	accessLog   *slog.Logger
+	bodyLog     *middleware.BodyLogConfig
+	redact      []string
+	concurrency *middleware.ConcurrencyConfig
+	cors        *middleware.CORSConfig
+	compression *middleware.CompressionConfig
+	chaos       *chaos.Engine
+}
+
+// Option configures optional Server behaviour
+type Option func(*Server)
+
+// WithMetrics sets the recorder that receives request metrics
+func WithMetrics(rec metrics.Recorder) Option {
+	return func(s *Server) {
+		s.metrics = rec
+	}
+}
+
+// WithHistory keeps the last size requests for /admin/requests; zero
+// disables the history
+func WithHistory(size int) Option {
+	return func(s *Server) {
+		s.history = nil
+		if size > 0 {
+			s.history = history.New(size)
+		}
+	}
+}
+
+// WithMirror sends a copy of every request through mirror
+func WithMirror(mirror *middleware.Mirror) Option {
+	return func(s *Server) {
+		s.mirror = mirror
+	}
+}
+
+// WithProxy forwards the proxy's routes to their upstreams instead of
+// serving them from the endpoints
+func WithProxy(p *proxy.Proxy) Option {
+	return func(s *Server) {
+		s.proxy = p
+	}
+}
+
+// WithScripts answers the scripts' routes with their scripts, ahead of
+// proxy routes and the endpoints
+func WithScripts(scripts *script.Scripts) Option {
+	return func(s *Server) {
+		s.scripts = scripts
+	}
+}
+
+// WithScenarios answers the scenarios' routes with their sequences of
+// responses, after script routes and ahead of proxy routes and the
+// endpoints
+func WithScenarios(scenarios *scenario.Scenarios) Option {
+	return func(s *Server) {
+		s.scenarios = scenarios
+	}
+}
+
+// WithOpenAPI serves mock responses for the operations of the mock's
+// OpenAPI document, after scenarios and ahead of proxy routes and the
+// endpoints. Without it the server starts with no document loaded.
+func WithOpenAPI(mock *openapi.Mock) Option {
+	return func(s *Server) {
+		s.mock = mock
+	}
+}
+
+// WithForwardProxy makes the server act as an HTTP forward proxy for
+// CONNECT and absolute-form requests
+func WithForwardProxy() Option {
+	return func(s *Server) {
+		s.forward = proxy.NewForward()
+	}
+}
+
+// WithAccessLogger sends per-request access logs to logger instead of
+// the default application logger
+func WithAccessLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.accessLog = logger
+	}
+}
+
+// WithBodyLogging enables debug logging of request and response bodies
+func WithBodyLogging(cfg middleware.BodyLogConfig) Option {
+	return func(s *Server) {
+		s.bodyLog = &cfg
+	}
+}
+
+// WithRedactHeaders sets the headers whose values are masked in the
+// request history and on /admin/tail
+func WithRedactHeaders(names []string) Option {
+	return func(s *Server) {
+		s.redact = names
+	}
+}
+
+// WithAdminAddr serves admin endpoints on a separate listener at addr.
+// Without it, admin endpoints are served by the main listener.
+func WithAdminAddr(addr string) Option {
+	return func(s *Server) {
+		s.adminAddr = addr
+	}
+}
+
+// WithBuildInfo sets the build metadata reported by the health endpoints
+func WithBuildInfo(build handlers.BuildInfo) Option {
+	return func(s *Server) {
+		s.build = build
+	}
+}
+
+// WithPprof exposes net/http/pprof handlers under /debug/pprof/ on the
+// admin listener
+func WithPprof() Option {
+	return func(s *Server) {
+		s.pprof = true
+	}
+}
+
+// WithTimeouts sets the HTTP server read, write and idle timeouts
+func WithTimeouts(timeouts config.Timeouts) Option {
+	return func(s *Server) {
+		s.timeouts = timeouts
+	}
+}
+
+// WithTLS sets the certificate served by TLS listeners. Without
+// WithListeners, the main address is served over HTTPS.
+func WithTLS(tls config.TLS) Option {
+	return func(s *Server) {
+		s.tls = tls
+	}
+}
+
+// WithReloadFunc sets the function invoked by POST /admin/reload
+func WithReloadFunc(reload func() error) Option {
+	return func(s *Server) {
+		s.reload = reload
+	}
+}
+
+// WithEndpoints selects which endpoint groups are served; routes of
+// disabled groups are not registered and return 404
+func WithEndpoints(endpoints config.Endpoints) Option {
+	return func(s *Server) {
+		s.endpoints = endpoints
+	}
+}
+
+// WithListeners binds the server to several addresses instead of the
+// address passed to New; all listeners share handlers and shutdown
+func WithListeners(listeners []config.Listener) Option {
+	return func(s *Server) {
+		s.listeners = listeners
+	}
+}
+
+// WithInheritedListeners serves on already-open sockets, e.g. passed by
+// systemd socket activation, instead of binding the configured addresses.
+// Inherited sockets use TLS when it is configured.
+func WithInheritedListeners(listeners []net.Listener) Option {
+	return func(s *Server) {
+		s.inherited = listeners
+	}
+}
+
+// WithProxyProtocol requires a PROXY protocol header on connections to
+// the main listeners, reporting the proxied client as the remote address
+func WithProxyProtocol() Option {
+	return func(s *Server) {
+		s.proxyProto = true
+	}
+}
+
+// WithSettings sets the handler configuration attached to every request
+func WithSettings(settings *handlers.Settings) Option {
+	return func(s *Server) {
+		s.settings.Store(settings)
+	}
+}
+
+// WithChaos injects faults according to the engine's rules
+func WithChaos(engine *chaos.Engine) Option {
+	return func(s *Server) {
+		s.chaos = engine
+	}
+}
+
+// WithCompression compresses JSON responses for clients accepting it
+func WithCompression(cfg middleware.CompressionConfig) Option {
+	return func(s *Server) {
+		s.compression = &cfg
+	}
+}
+
+// WithCORS applies a CORS policy to all endpoints
+func WithCORS(cfg middleware.CORSConfig) Option {
+	return func(s *Server) {
+		s.cors = &cfg
+	}
+}
+
+// WithConcurrencyLimit sheds requests beyond the in-flight limit and
+// queue with 503
+func WithConcurrencyLimit(cfg middleware.ConcurrencyConfig) Option {
+	return func(s *Server) {
+		s.concurrency = &cfg
+	}
+}
+
+// WithRateLimit rejects requests beyond the limiter's quota with 429;
+// key selects the bucket for each request
+func WithRateLimit(limiter ratelimit.Limiter, key func(*http.Request) string) Option {
+	return func(s *Server) {
+		s.limiter = limiter
+		s.limitKey = key
+	}
 }
 
 // New creates a new Server instance
-func New(addr string) *Server {
+func New(addr string, opts ...Option) *Server {
 	mux := http.NewServeMux()
 	s := &Server{
-		mux: mux,
-		httpServer: &http.Server{
-			Addr:    addr,
-			Handler: middleware.Logging(mux),
-		},
+		mux:      mux,
+		adminMux: mux,
+		tail:     tail.NewHub(),
+		history:  history.New(history.DefaultSize),
+		webhooks: handlers.NewWebhooks(),
+		mock:     openapi.NewMock(),
+		metrics:  metrics.Nop(),
+		redact:   middleware.DefaultBodyLogConfig().RedactHeaders,
+	}
+	s.chaos, _ = chaos.NewEngine(nil)
+	s.settings.Store(handlers.DefaultSettings())
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.health = handlers.NewHealth(s.build)
+	if len(s.inherited) > 0 {
+		s.listeners = nil
+		for _, ln := range s.inherited {
+			s.listeners = append(s.listeners, config.Listener{Addr: ln.Addr().String(), TLS: s.tls.Enabled()})
+		}
+	} else if len(s.listeners) == 0 {
+		s.listeners = []config.Listener{{Addr: addr, TLS: s.tls.Enabled()}}
+	}
+
+	// Assemble the middleware chain, outermost first
+	chain := middleware.NewChain().
+		AppendIf(s.build.Version != "", func() middleware.Middleware {
+			return middleware.Header(handlers.VersionHeader, s.build.Version)
+		}).
+		Append(s.withSettings, middleware.LoggingTo(s.accessLog)).
+		AppendIf(s.bodyLog != nil, func() middleware.Middleware {
+			return middleware.BodyLogging(s.accessLog, *s.bodyLog)
+		}).
+		Append(
+			middleware.Metrics(metrics.Multi(s.metrics, metrics.Expvar())),
+			middleware.Recover,
+			middleware.Tail(s.tail, s.redact),
+		).
+		AppendIf(s.history != nil, func() middleware.Middleware {
+			return middleware.History(s.history, s.redact)
+		}).
+		AppendIf(s.mirror != nil, func() middleware.Middleware {
+			return s.mirror.Middleware
+		}).
+		AppendIf(s.compression != nil, func() middleware.Middleware {
+			return middleware.Compression(*s.compression)
+		}).
+		AppendIf(s.cors != nil, func() middleware.Middleware {
+			return middleware.CORS(*s.cors)
+		}).
+		AppendIf(s.concurrency != nil, func() middleware.Middleware {
+			return middleware.Concurrency(*s.concurrency)
+		}).
+		AppendIf(s.limiter != nil, func() middleware.Middleware {
+			return middleware.RateLimit(s.limiter, s.limitKey)
+		}).
+		Append(
+			middleware.Timeout(s.timeouts.Handler, s.timeouts.HandlerMax),
+			s.chaos.Middleware,
+		)
+
+	var endpoints http.Handler = mux
+	if s.proxy != nil {
+		endpoints = s.proxy.Middleware(mux)
+	}
+	endpoints = s.mock.Middleware(endpoints)
+	if s.scenarios != nil {
+		endpoints = s.scenarios.Middleware(endpoints)
+	}
+	if s.scripts != nil {
+		endpoints = s.scripts.Middleware(endpoints)
+	}
+	handler := chain.Then(endpoints)
+
+	// Health probes bypass the middleware chain to keep logs and metrics
+	// free of probe noise
+	root := http.NewServeMux()
+	root.Handle("/", handler)
+	root.HandleFunc("/healthz", s.health.LivenessHandler)
+	root.HandleFunc("/livez", s.health.LivenessHandler)
+	root.HandleFunc("/readyz", s.health.ReadinessHandler)
+
+	// Forward proxy requests never reach the endpoints, whatever their path
+	var serverHandler http.Handler = root
+	if s.forward != nil {
+		forward := chain.Then(s.forward)
+		serverHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if proxy.IsProxyRequest(r) {
+				forward.ServeHTTP(w, r)
+				return
+			}
+			root.ServeHTTP(w, r)
+		})
+	}
+
+	s.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           serverHandler,
+		ReadHeaderTimeout: s.timeouts.ReadHeader,
+		ReadTimeout:       s.timeouts.Read,
+		WriteTimeout:      s.timeouts.Write,
+		IdleTimeout:       s.timeouts.Idle,
+	}
+	s.httpServer.RegisterOnShutdown(s.tail.Close)
+
+	if s.adminAddr != "" {
+		s.adminMux = http.NewServeMux()
+		s.adminServer = &http.Server{
+			Addr:    s.adminAddr,
+			Handler: s.adminMux,
+		}
 	}
 
 	s.setupRoutes()
+	s.setupAdminRoutes()
 	return s
 }
 
-// setupRoutes configures all the HTTP routes
+// withSettings attaches the current handler settings to each request
+func (s *Server) withSettings(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(handlers.WithSettings(r.Context(), s.settings.Load())))
+	})
+}
+
+// SetSettings replaces the handler settings; requests already in flight
+// keep the settings they started with
+func (s *Server) SetSettings(settings *handlers.Settings) {
+	s.settings.Store(settings)
+}
+
+// setupRoutes mounts the enabled endpoint groups
 func (s *Server) setupRoutes() {
-	// HTTP method endpoints
-	s.mux.HandleFunc("/get", handlers.MethodHandler("GET"))
-	s.mux.HandleFunc("/post", handlers.MethodHandler("POST"))
-	s.mux.HandleFunc("/put", handlers.MethodHandler("PUT"))
-	s.mux.HandleFunc("/patch", handlers.MethodHandler("PATCH"))
-	s.mux.HandleFunc("/delete", handlers.MethodHandler("DELETE"))
-	s.mux.HandleFunc("/head", handlers.MethodHandler("HEAD"))
-	s.mux.HandleFunc("/options", handlers.MethodHandler("OPTIONS"))
-
-	// Utility endpoints
-	s.mux.HandleFunc("/headers", handlers.HeadersHandler)
-	s.mux.HandleFunc("/ip", handlers.IPHandler)
-	s.mux.HandleFunc("/user-agent", handlers.UserAgentHandler)
-	s.mux.HandleFunc("/delay/", handlers.DelayHandler)
-
-	// Status code endpoint
-	s.mux.HandleFunc("/status/", handlers.StatusHandler)
-
-	// Authentication endpoints
-	s.mux.HandleFunc("/basic-auth/", handlers.BasicAuthHandler)
-	s.mux.HandleFunc("/bearer", handlers.BearerHandler)
-	s.mux.HandleFunc("/digest-auth/", handlers.DigestAuthHandler)
-}
-
-// Start starts the HTTP server
+	settings := s.settings.Load()
+	opts := []httpbin.Option{
+		httpbin.WithBuildInfo(httpbin.BuildInfo(s.build)),
+		httpbin.WithDisabledGroups(s.endpoints.Disabled...),
+		httpbin.WithTrustedProxies(settings.TrustedProxies...),
+		httpbin.WithEnvPrefixes(settings.EnvPrefixes...),
+		httpbin.WithPodInfoDir(settings.PodInfoDir),
+		httpbin.WithWebhooks(s.webhooks),
+	}
+	if settings.ProblemDetails {
+		opts = append(opts, httpbin.WithProblemDetails())
+	}
+	if settings.PrettyJSON {
+		opts = append(opts, httpbin.WithPrettyJSON())
+	}
+	if settings.OriginChain {
+		opts = append(opts, httpbin.WithOriginChain())
+	}
+	if settings.MaxDelay > 0 {
+		opts = append(opts, httpbin.WithMaxDelay(settings.MaxDelay))
+	}
+	if settings.TemplatesDir != "" {
+		opts = append(opts, httpbin.WithTemplatesDir(settings.TemplatesDir))
+	}
+	if settings.SchemasDir != "" {
+		opts = append(opts, httpbin.WithSchemasDir(settings.SchemasDir))
+	}
+	if settings.MetadataMock {
+		opts = append(opts, httpbin.WithMetadataMock())
+	}
+	if settings.Seed != 0 {
+		opts = append(opts, httpbin.WithSeed(settings.Seed))
+	}
+	s.mux.Handle("/", httpbin.New(opts...))
+}
+
+// setupAdminRoutes configures the admin endpoints
+func (s *Server) setupAdminRoutes() {
+	if !s.endpoints.Enabled(config.GroupAdmin) {
+		return
+	}
+
+	s.adminMux.HandleFunc("/admin/tail", s.tail.Handler())
+	if s.history != nil {
+		s.adminMux.HandleFunc("/admin/requests", s.history.Handler())
+	}
+	s.adminMux.HandleFunc("/admin/ready", s.health.ReadyToggleHandler)
+	s.adminMux.HandleFunc("/admin/reload", handlers.ReloadHandler(s.reload))
+	s.adminMux.HandleFunc("/admin/chaos", s.chaos.Handler())
+	s.adminMux.HandleFunc("/admin/openapi", s.mock.Handler())
+	if s.forward != nil {
+		s.adminMux.HandleFunc("/admin/forward-proxy", s.forward.Handler())
+	}
+	if s.scenarios != nil {
+		s.adminMux.HandleFunc("/admin/scenarios", s.scenarios.Handler())
+		s.adminMux.HandleFunc("/admin/scenarios/{name}", s.scenarios.Handler())
+	}
+	// Replay can reach any URL, so it is only served on a separate admin
+	// listener, never on the public one
+	if s.adminAddr != "" && s.endpoints.Enabled(handlers.GroupBins) {
+		s.adminMux.HandleFunc("/admin/webhooks/{id}/replay", s.webhooks.ReplayHandler)
+	}
+	s.adminMux.Handle("/debug/vars", expvar.Handler())
+
+	if s.pprof {
+		s.adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+		s.adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		s.adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		s.adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		s.adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+}
+
+// Start binds all listeners and serves until the server is shut down.
+// It returns the first error encountered by any listener.
 func (s *Server) Start() error {
-	return s.httpServer.ListenAndServe()
+	listeners := s.inherited
+	if len(listeners) == 0 {
+		for _, l := range s.listeners {
+			ln, err := net.Listen("tcp", l.Addr)
+			if err != nil {
+				for _, open := range listeners {
+					open.Close()
+				}
+				return err
+			}
+			listeners = append(listeners, ln)
+		}
+	}
+
+	errc := make(chan error, len(listeners)+1)
+	if s.adminServer != nil {
+		go func() { errc <- s.adminServer.ListenAndServe() }()
+	}
+	for i, ln := range listeners {
+		if s.proxyProto {
+			ln = proxyproto.NewListener(ln)
+		}
+		go func() { errc <- s.serve(ln, s.listeners[i].TLS) }()
+	}
+	return <-errc
+}
+
+// serve serves the main handler on ln over HTTP or HTTPS
+func (s *Server) serve(ln net.Listener, useTLS bool) error {
+	if useTLS {
+		return s.httpServer.ServeTLS(ln, s.tls.CertFile, s.tls.KeyFile)
+	}
+	return s.httpServer.Serve(ln)
+}
+
+// Listeners returns the addresses the server binds to
+func (s *Server) Listeners() []config.Listener {
+	return s.listeners
+}
+
+// SetReady toggles the readiness reported by /readyz
+func (s *Server) SetReady(ready bool) {
+	s.health.SetReady(ready)
 }
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.SetReady(false)
+	if s.adminServer != nil {
+		s.tail.Close()
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
 	return s.httpServer.Shutdown(ctx)
 }
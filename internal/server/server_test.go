@@ -1,13 +1,23 @@
 package server
 
 import (
+	"bufio"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/config"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/history"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/middleware"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/scenario"
 )
 
 // TestServerRouting tests that all routes are properly configured
@@ -256,3 +266,617 @@ func TestServerGracefulShutdown(t *testing.T) {
 		t.Error("Expected error when connecting to closed server")
 	}
 }
+
+// TestServerAdminTail tests that handled requests are streamed on /admin/tail
+func TestServerAdminTail(t *testing.T) {
+	srv := New(":0")
+	testServer := httptest.NewServer(srv.httpServer.Handler)
+	defer testServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", testServer.URL+"/admin/tail", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	for !srv.tail.Active() {
+		time.Sleep(time.Millisecond)
+	}
+
+	getReq, _ := http.NewRequest("GET", testServer.URL+"/status/201", nil)
+	getReq.Header.Set("Authorization", "Bearer secret")
+	getResp, err := http.DefaultClient.Do(getReq)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	getResp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			if !strings.Contains(line, `"path":"/status/201"`) || !strings.Contains(line, `"status":201`) ||
+				!strings.Contains(line, `"Authorization":["[REDACTED]"]`) {
+				t.Errorf("Unexpected event: %s", line)
+			}
+			return
+		}
+	}
+	t.Fatal("Stream ended without an event")
+}
+
+// TestServerSetSettings tests that replaced settings apply to the next
+// request, including endpoints served by the embedded handler
+func TestServerSetSettings(t *testing.T) {
+	srv := New(":0")
+	handler := srv.httpServer.Handler
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/validate", nil))
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("Expected a JSON error, got %q", got)
+	}
+
+	srv.SetSettings(&handlers.Settings{ProblemDetails: true})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/validate", nil))
+	if got := rr.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("Expected a problem details error after SetSettings, got %q", got)
+	}
+}
+
+// TestServerAdminRequests tests that handled requests can be queried on
+// /admin/requests, leaving admin requests out and credentials masked
+func TestServerAdminRequests(t *testing.T) {
+	srv := New(":0", WithHistory(10))
+	handler := srv.httpServer.Handler
+
+	for _, path := range []string{"/status/201", "/status/503", "/admin/ready", "/get"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Cookie", "session=secret")
+		req.Header.Set("X-Request-Id", "abc")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/requests?path=/status/&status=5xx", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	var resp history.Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Count != 1 || resp.Requests[0].Path != "/status/503" || resp.Capacity != 10 {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	headers := http.Header(resp.Requests[0].Headers)
+	for _, name := range []string{"Authorization", "Cookie"} {
+		if got := headers.Get(name); got != "[REDACTED]" {
+			t.Errorf("Expected %s to be redacted, got %q", name, got)
+		}
+	}
+	if got := headers.Get("X-Request-Id"); got != "abc" {
+		t.Errorf("Expected X-Request-Id to be kept, got %q", got)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/requests", nil))
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Count != 3 {
+		t.Errorf("Expected 3 recorded requests, got %d", resp.Count)
+	}
+
+	// A disabled history serves no endpoint
+	rr = httptest.NewRecorder()
+	New(":0", WithHistory(0)).httpServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/requests", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 with history disabled, got %d", rr.Code)
+	}
+}
+
+// TestServerWebhookReplay tests that deliveries received on the main
+// listener can be replayed through the admin listener
+func TestServerWebhookReplay(t *testing.T) {
+	srv := New(":0", WithAdminAddr("127.0.0.1:0"))
+	handler := srv.httpServer.Handler
+
+	var replayed string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		replayed = string(body)
+	}))
+	defer target.Close()
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/webhook/orders", strings.NewReader("order created")))
+
+	rr := httptest.NewRecorder()
+	srv.adminServer.Handler.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/webhooks/1/replay?url="+target.URL, nil))
+	if rr.Code != http.StatusOK || replayed != "order created" {
+		t.Errorf("Expected the delivery to be replayed, got status %d and body %q", rr.Code, replayed)
+	}
+}
+
+// TestServerForwardProxy tests that absolute-form requests are forwarded,
+// even for paths the server itself serves
+func TestServerForwardProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream "+r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	srv := New(":0", WithForwardProxy())
+	for _, path := range []string{"/healthz", "/get"} {
+		rr := httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", upstream.URL+path, nil))
+		if rr.Body.String() != "upstream "+path {
+			t.Errorf("Expected %s to be forwarded, got %d %q", path, rr.Code, rr.Body)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/forward-proxy", nil))
+	if !strings.Contains(rr.Body.String(), upstream.URL+"/healthz") {
+		t.Errorf("Expected the exchange to be recorded, got %s", rr.Body)
+	}
+}
+
+// TestServerScenarios tests serving scenarios and resetting them via admin
+func TestServerScenarios(t *testing.T) {
+	scenarios, err := scenario.New([]scenario.Scenario{
+		{Name: "flaky", Pattern: "/get", Responses: []scenario.Response{{Status: 500}, {Status: 200}}},
+	})
+	if err != nil {
+		t.Fatalf("scenario.New failed: %v", err)
+	}
+	srv := New(":0", WithScenarios(scenarios))
+	get := func(path string) int {
+		rr := httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Code
+	}
+
+	if first, second := get("/get"), get("/get"); first != 500 || second != 200 {
+		t.Errorf("Expected 500 then 200, got %d then %d", first, second)
+	}
+	rr := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest("DELETE", "/admin/scenarios/flaky", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected reset to succeed, got %d", rr.Code)
+	}
+	if code := get("/get"); code != 500 {
+		t.Errorf("Expected the scenario to start over after a reset, got %d", code)
+	}
+}
+
+// TestServerOpenAPI tests mocking an uploaded OpenAPI document
+func TestServerOpenAPI(t *testing.T) {
+	srv := New(":0")
+	spec := `{"openapi": "3.0.0", "paths": {"/get": {"get": {"responses": {"200": {"content": {"application/json": {"example": {"mocked": true}}}}}}}}}`
+
+	rr := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest("PUT", "/admin/openapi", strings.NewReader(spec)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected upload to succeed, got %d: %s", rr.Code, rr.Body)
+	}
+
+	for path, expected := range map[string]string{"/get": `{"mocked":true}`, "/headers": `"headers"`} {
+		rr = httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("Expected %s to contain %s, got %s", path, expected, rr.Body)
+		}
+	}
+}
+
+// TestServerAdminAddr tests that admin routes move off the main mux
+func TestServerAdminAddr(t *testing.T) {
+	srv := New(":0", WithAdminAddr("127.0.0.1:0"))
+
+	rr := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/tail", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected /admin/tail to be absent from main mux, got %d", rr.Code)
+	}
+
+	if srv.adminServer == nil {
+		t.Fatal("Expected admin server to be configured")
+	}
+}
+
+// TestServerWebhookReplayAdminOnly tests that webhook replay is only
+// served on a separate admin listener
+func TestServerWebhookReplayAdminOnly(t *testing.T) {
+	const pattern = "/admin/webhooks/{id}/replay"
+	req := httptest.NewRequest("POST", "/admin/webhooks/1/replay?url=http://127.0.0.1/", nil)
+
+	srv := New(":0")
+	if _, got := srv.adminMux.Handler(req); got == pattern {
+		t.Error("Expected replay to be absent from the public mux by default")
+	}
+	rr := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 on the public listener, got %d", rr.Code)
+	}
+
+	srv = New(":0", WithAdminAddr("127.0.0.1:0"))
+	if _, got := srv.adminMux.Handler(req); got != pattern {
+		t.Errorf("Expected replay on the admin listener, got pattern %q", got)
+	}
+	if _, got := srv.mux.Handler(req); got == pattern {
+		t.Error("Expected replay to be absent from the main mux")
+	}
+}
+
+// TestServerHealthBypass tests that health probes skip the middleware chain
+func TestServerHealthBypass(t *testing.T) {
+	srv := New(":0")
+	handler := srv.httpServer.Handler
+
+	for _, path := range []string{"/healthz", "/livez", "/readyz"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", path, rr.Code)
+		}
+
+		// Health endpoints are not part of the instrumented mux
+		rr = httptest.NewRecorder()
+		srv.mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected probe to bypass the main mux, got %d", path, rr.Code)
+		}
+	}
+
+	srv.SetReady(false)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 when not ready, got %d", rr.Code)
+	}
+}
+
+// TestServerPprof tests that pprof endpoints are only exposed when enabled
+func TestServerPprof(t *testing.T) {
+	rr := httptest.NewRecorder()
+	New(":0").adminMux.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected pprof to be disabled by default, got %d", rr.Code)
+	}
+
+	srv := New(":0", WithAdminAddr("127.0.0.1:0"), WithPprof())
+
+	rr = httptest.NewRecorder()
+	srv.adminMux.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/heap?debug=1", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected pprof heap profile on admin listener, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.mux.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected pprof to be absent from main listener, got %d", rr.Code)
+	}
+}
+
+// TestServerExpvar tests that request counters show up at /debug/vars
+func TestServerExpvar(t *testing.T) {
+	srv := New(":0")
+	handler := srv.httpServer.Handler
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/get", nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/vars", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var vars map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	stats, ok := vars["httpbin"].(map[string]any)
+	if !ok {
+		t.Fatalf("Expected httpbin stats, got %v", vars["httpbin"])
+	}
+	if n, _ := stats["requests"].(float64); n < 1 {
+		t.Errorf("Expected at least one request counted, got %v", stats["requests"])
+	}
+	if _, ok := stats["response.bytes"]; !ok {
+		t.Error("Expected bytes written to be counted")
+	}
+	if _, ok := vars["goroutines"]; !ok {
+		t.Error("Expected goroutine count to be published")
+	}
+}
+
+// TestServerVersionHeader tests that responses carry the version header
+func TestServerVersionHeader(t *testing.T) {
+	srv := New(":0", WithBuildInfo(handlers.BuildInfo{Version: "v9.9.9"}))
+
+	rr := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/version", nil))
+
+	if got := rr.Header().Get(handlers.VersionHeader); got != "v9.9.9" {
+		t.Errorf("Expected version header v9.9.9, got %q", got)
+	}
+	if !strings.Contains(rr.Body.String(), `"version":"v9.9.9"`) {
+		t.Errorf("Expected version in body, got %s", rr.Body.String())
+	}
+}
+
+// TestServerDisabledEndpoints tests that disabled groups return 404
+func TestServerDisabledEndpoints(t *testing.T) {
+	srv := New(":0", WithEndpoints(config.Endpoints{Disabled: []string{config.GroupAuth, config.GroupAdmin}}))
+	handler := srv.httpServer.Handler
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/get", http.StatusOK},
+		{"/status/204", http.StatusNoContent},
+		{"/basic-auth/user/passwd", http.StatusNotFound},
+		{"/bearer", http.StatusNotFound},
+		{"/digest-auth/auth/user/passwd", http.StatusNotFound},
+		{"/admin/ready", http.StatusNotFound},
+		{"/debug/vars", http.StatusNotFound},
+		{"/healthz", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// freeAddr returns a loopback address with a currently unused port
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// TestServerMultipleListeners tests serving and shutting down several listeners
+func TestServerMultipleListeners(t *testing.T) {
+	addrs := []string{freeAddr(t), freeAddr(t)}
+	srv := New(":0", WithListeners([]config.Listener{{Addr: addrs[0]}, {Addr: addrs[1]}}))
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Start() }()
+
+	for _, addr := range addrs {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get("http://" + addr + "/get"); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("Failed to reach %s: %v", addr, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", addr, resp.StatusCode)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := <-errc; err != http.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+
+	for _, addr := range addrs {
+		if _, err := http.Get("http://" + addr + "/get"); err == nil {
+			t.Errorf("%s: expected listener to be closed", addr)
+		}
+	}
+}
+
+// TestServerInheritedListeners tests serving on already-open sockets
+func TestServerInheritedListeners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	srv := New(":0", WithInheritedListeners([]net.Listener{ln}))
+	if got := srv.Listeners(); len(got) != 1 || got[0].Addr != ln.Addr().String() {
+		t.Errorf("Expected inherited listener to be reported, got %v", got)
+	}
+
+	go srv.Start()
+	defer srv.Shutdown(context.Background())
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/get")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+// TestServerProxyProtocol tests that the PROXY header sets the origin IP
+func TestServerProxyProtocol(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	srv := New(":0", WithInheritedListeners([]net.Listener{ln}), WithProxyProtocol())
+	go srv.Start()
+	defer srv.Shutdown(context.Background())
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "PROXY TCP4 203.0.113.7 192.0.2.2 4242 80\r\nGET /ip HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var data map[string]string
+	json.NewDecoder(resp.Body).Decode(&data)
+	if data["origin"] != "203.0.113.7" {
+		t.Errorf("Expected origin 203.0.113.7, got %q", data["origin"])
+	}
+}
+
+// TestServerChaos tests that chaos rules set via the admin API apply to requests
+func TestServerChaos(t *testing.T) {
+	srv := New(":0")
+	handler := srv.httpServer.Handler
+
+	rules := `{"rules":[{"path":"/get","error":{"probability":1,"statuses":[503]}}]}`
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("PUT", "/admin/chaos", strings.NewReader(rules)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected rules to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/get", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected injected 503, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/headers", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected unmatched route to pass, got %d", rr.Code)
+	}
+}
+
+// TestServerProblemDetails tests that handler and middleware errors become
+// problem documents when configured
+func TestServerProblemDetails(t *testing.T) {
+	srv := New(":0", WithSettings(&handlers.Settings{ProblemDetails: true}))
+	handler := srv.httpServer.Handler
+
+	for _, tt := range []struct {
+		name           string
+		req            *http.Request
+		expectedStatus int
+	}{
+		{"handler", httptest.NewRequest("GET", "/status/abc", nil), http.StatusBadRequest},
+		{"middleware", func() *http.Request {
+			req := httptest.NewRequest("GET", "/get", nil)
+			req.Header.Set("X-Timeout", "soon")
+			return req
+		}(), http.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, tt.req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Expected application/problem+json, got %q", ct)
+			}
+			var problem handlers.Problem
+			if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil || problem.Status != tt.expectedStatus {
+				t.Errorf("Expected problem with status %d, got %+v (%v)", tt.expectedStatus, problem, err)
+			}
+		})
+	}
+}
+
+// TestServerWebSocket tests that /ws can hijack the connection through
+// the full middleware chain, including compression and handler timeouts
+func TestServerWebSocket(t *testing.T) {
+	srv := New(":0", WithCompression(middleware.DefaultCompressionConfig()))
+	testServer := httptest.NewServer(srv.httpServer.Handler)
+	defer testServer.Close()
+
+	conn, err := net.Dial("tcp", testServer.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Accept-Encoding: gzip\r\nX-Timeout: 1m\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+
+	// A masked text frame "hi" with an all-zero mask
+	conn.Write([]byte{0x81, 0x82, 0, 0, 0, 0, 'h', 'i'})
+	frame := make([]byte, 4)
+	if _, err := io.ReadFull(br, frame); err != nil || string(frame) != "\x81\x02hi" {
+		t.Errorf("Expected the echoed frame, got %q (%v)", frame, err)
+	}
+}
+
+// TestServerStreamPost tests that /stream-post can read the body while
+// streaming acknowledgements through the full middleware chain
+func TestServerStreamPost(t *testing.T) {
+	srv := New(":0", WithCompression(middleware.DefaultCompressionConfig()))
+	testServer := httptest.NewServer(srv.httpServer.Handler)
+	defer testServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	// The transport waits on the body, so fail it rather than hang
+	context.AfterFunc(ctx, func() { pw.CloseWithError(ctx.Err()) })
+	req, _ := http.NewRequestWithContext(ctx, "POST", testServer.URL+"/stream-post", pr)
+	req.Header.Set("X-Timeout", "1m")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for i := 1; i <= 2; i++ {
+		io.WriteString(pw, `{"ok":true}`+"\n")
+		var ack handlers.StreamPostAck
+		if err := dec.Decode(&ack); err != nil {
+			t.Fatalf("Expected acknowledgement %d before the body ends: %v", i, err)
+		}
+		if ack.Line != i || !ack.Valid {
+			t.Errorf("Unexpected acknowledgement %+v", ack)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd (SD_LISTEN_FDS_START)
+const listenFDsStart = 3
+
+// Listeners returns the sockets passed by systemd socket activation
+// (sd_listen_fds). It returns nil when the process was not socket
+// activated. The LISTEN_* variables are unset so child processes do not
+// inherit them.
+func Listeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	return listenersFrom(os.Getpid(), os.LookupEnv, listenFDsStart)
+}
+
+// listenersFrom implements Listeners for a given pid, environment and
+// first descriptor number
+func listenersFrom(pid int, lookup func(string) (string, bool), startFD int) ([]net.Listener, error) {
+	pidStr, ok := lookup("LISTEN_PID")
+	if !ok {
+		return nil, nil
+	}
+	if listenPID, err := strconv.Atoi(pidStr); err != nil || listenPID != pid {
+		// The sockets were meant for another process
+		return nil, nil
+	}
+
+	fdsStr, _ := lookup("LISTEN_FDS")
+	count, err := strconv.Atoi(fdsStr)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fdsStr)
+	}
+
+	var names []string
+	if s, ok := lookup("LISTEN_FDNAMES"); ok {
+		names = strings.Split(s, ":")
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("LISTEN_FD_%d", startFD+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(startFD+i), name)
+		ln, err := net.FileListener(f)
+		// FileListener dups the descriptor, so the original can go
+		f.Close()
+		if err != nil {
+			for _, open := range listeners {
+				open.Close()
+			}
+			return nil, fmt.Errorf("socket %s is not a listener: %w", name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
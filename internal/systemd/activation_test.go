@@ -0,0 +1,75 @@
+package systemd
+
+import (
+	"net"
+	"testing"
+)
+
+// envMap returns a lookup function backed by a map
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+// TestListenersNotActivated tests that missing or foreign LISTEN_PID yields no listeners
+func TestListenersNotActivated(t *testing.T) {
+	lns, err := listenersFrom(100, envMap(nil), listenFDsStart)
+	if err != nil || lns != nil {
+		t.Errorf("Expected no listeners without LISTEN_PID, got %v (%v)", lns, err)
+	}
+
+	lns, err = listenersFrom(100, envMap(map[string]string{"LISTEN_PID": "200", "LISTEN_FDS": "1"}), listenFDsStart)
+	if err != nil || lns != nil {
+		t.Errorf("Expected no listeners for another pid, got %v (%v)", lns, err)
+	}
+
+	if _, err := listenersFrom(100, envMap(map[string]string{"LISTEN_PID": "100", "LISTEN_FDS": "x"}), listenFDsStart); err == nil {
+		t.Error("Expected error for invalid LISTEN_FDS")
+	}
+}
+
+// TestListenersInherited tests turning a passed descriptor into a listener
+func TestListenersInherited(t *testing.T) {
+	orig, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer orig.Close()
+
+	f, err := orig.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("Failed to get file: %v", err)
+	}
+
+	env := envMap(map[string]string{
+		"LISTEN_PID":     "100",
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "http",
+	})
+	lns, err := listenersFrom(100, env, int(f.Fd()))
+	if err != nil {
+		t.Fatalf("listenersFrom failed: %v", err)
+	}
+	if len(lns) != 1 {
+		t.Fatalf("Expected 1 listener, got %d", len(lns))
+	}
+	defer lns[0].Close()
+
+	if lns[0].Addr().String() != orig.Addr().String() {
+		t.Errorf("Expected listener on %s, got %s", orig.Addr(), lns[0].Addr())
+	}
+
+	// The inherited socket must accept connections
+	go func() {
+		if conn, err := lns[0].Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("tcp", lns[0].Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	conn.Close()
+}
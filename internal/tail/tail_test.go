@@ -0,0 +1,106 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHubPublish tests delivery to subscribers and unsubscription
+func TestHubPublish(t *testing.T) {
+	hub := NewHub()
+	if hub.Active() {
+		t.Error("Expected new hub to have no subscribers")
+	}
+
+	ch := hub.Subscribe()
+	if !hub.Active() {
+		t.Error("Expected hub to be active after Subscribe")
+	}
+
+	hub.Publish(Event{Path: "/get"})
+
+	select {
+	case e := <-ch:
+		if e.Path != "/get" {
+			t.Errorf("Expected path /get, got %s", e.Path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+
+	hub.Unsubscribe(ch)
+	if _, ok := <-ch; ok {
+		t.Error("Expected channel to be closed after Unsubscribe")
+	}
+}
+
+// TestHubPublishNonBlocking tests that a full subscriber does not block publishers
+func TestHubPublishNonBlocking(t *testing.T) {
+	hub := NewHub()
+	hub.Subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < subscriberBuffer*2; i++ {
+			hub.Publish(Event{})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+}
+
+// TestHandlerStream tests that events are streamed as SSE
+func TestHandlerStream(t *testing.T) {
+	hub := NewHub()
+	srv := httptest.NewServer(hub.Handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	// Wait for the handler to subscribe before publishing
+	for !hub.Active() {
+		time.Sleep(time.Millisecond)
+	}
+	hub.Publish(Event{Method: "POST", Path: "/post", Status: 200})
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var e Event
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+			t.Fatalf("Failed to parse event: %v", err)
+		}
+		if e.Method != "POST" || e.Path != "/post" || e.Status != 200 {
+			t.Errorf("Unexpected event: %+v", e)
+		}
+		return
+	}
+	t.Fatal("Stream ended without an event")
+}
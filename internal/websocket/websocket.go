@@ -0,0 +1,362 @@
+// Package websocket is a minimal RFC 6455 server implementation. It
+// exposes frame-level control, such as fragment sizes and close codes,
+// that test endpoints need and general-purpose libraries hide.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xa
+)
+
+// Close codes
+const (
+	CloseNormal         = 1000
+	CloseGoingAway      = 1001
+	CloseProtocolError  = 1002
+	CloseNoStatus       = 1005
+	CloseInvalidPayload = 1007
+	CloseMessageTooBig  = 1009
+	CloseInternalError  = 1011
+)
+
+// maxControlPayload is the largest payload a control frame may carry
+const maxControlPayload = 125
+
+// closeHandshakeWindow is how long CloseWith waits for the peer's close
+const closeHandshakeWindow = time.Second
+
+// acceptGUID is appended to the client key to derive Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrBadHandshake is returned by Upgrade for requests that are not valid
+// WebSocket handshakes
+var ErrBadHandshake = errors.New("websocket: not a valid WebSocket handshake")
+
+// ErrMessageTooBig is returned by ReadMessage when a message exceeds the
+// read limit; the connection has been closed with CloseMessageTooBig
+var ErrMessageTooBig = errors.New("websocket: message too big")
+
+// CloseError is returned by ReadMessage once the peer has closed the
+// connection
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with code %d %s", e.Code, e.Reason)
+}
+
+// IsUpgrade reports whether r asks to switch to the WebSocket protocol
+func IsUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+// headerHasToken reports whether the comma-separated header contains
+// token, compared case-insensitively
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Accept returns the Sec-WebSocket-Accept value for a client key
+func Accept(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Conn is a server-side WebSocket connection. Reads must come from one
+// goroutine; writes may come from several.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu sync.Mutex
+	w  *bufio.Writer
+	// closeSent is set once a close frame has been written
+	closeSent bool
+
+	// ReadLimit bounds the size of a message; zero means unlimited
+	ReadLimit int64
+}
+
+// Upgrade completes the handshake for r by hijacking the connection. It
+// returns ErrBadHandshake, without writing a response, for requests that
+// are not WebSocket handshakes.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !IsUpgrade(r) || key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, ErrBadHandshake
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// The server's request deadlines do not apply to the WebSocket
+	conn.SetDeadline(time.Time{})
+
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	brw.WriteString("Sec-WebSocket-Accept: " + Accept(key) + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, r: brw.Reader, w: brw.Writer}, nil
+}
+
+// Close closes the underlying connection without a close handshake
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// ReadMessage reads the next text or binary message, reassembling
+// fragments. Pings are answered with pongs and pongs are ignored. When
+// the peer sends a close frame it is echoed and a *CloseError returned.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		op      int
+		message []byte
+	)
+	for {
+		fin, frameOp, payload, err := c.readFrame()
+		var pe *protocolError
+		if errors.As(err, &pe) {
+			return 0, nil, c.fail(pe.code, pe.reason)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOp {
+		case OpPing:
+			c.writeFrame(true, OpPong, payload)
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			return 0, nil, c.handleClose(payload)
+		case OpText, OpBinary:
+			if op != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "expected a continuation frame")
+			}
+			op = frameOp
+		case OpContinuation:
+			if op == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+
+		if c.ReadLimit > 0 && int64(len(message)+len(payload)) > c.ReadLimit {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		message = append(message, payload...)
+		if fin {
+			return op, message, nil
+		}
+	}
+}
+
+// protocolError is a peer error that ends the connection with code
+type protocolError struct {
+	code   int
+	reason string
+}
+
+func (e *protocolError) Error() string {
+	return "websocket: " + e.reason
+}
+
+// readFrame reads one frame, unmasking its payload
+func (c *Conn) readFrame() (fin bool, op int, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+	fin, op = head[0]&0x80 != 0, int(head[0]&0x0f)
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, &protocolError{CloseProtocolError, "reserved bits set"}
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, &protocolError{CloseProtocolError, "client frames must be masked"}
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= OpClose && (length > maxControlPayload || !fin) {
+		return false, 0, nil, &protocolError{CloseProtocolError, "invalid control frame"}
+	}
+	if c.ReadLimit > 0 && length > uint64(c.ReadLimit) {
+		return false, 0, nil, &protocolError{CloseMessageTooBig, "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// handleClose answers a close frame from the peer and reports it
+func (c *Conn) handleClose(payload []byte) error {
+	ce := &CloseError{Code: CloseNoStatus}
+	if len(payload) >= 2 {
+		ce.Code = int(binary.BigEndian.Uint16(payload))
+		ce.Reason = string(payload[2:])
+	}
+
+	c.mu.Lock()
+	sent := c.closeSent
+	c.mu.Unlock()
+	if !sent {
+		// Echo the code, as the close handshake requires
+		echo := payload
+		if len(payload) >= 2 {
+			echo = payload[:2]
+		}
+		c.writeFrame(true, OpClose, echo)
+	}
+	c.conn.Close()
+	return ce
+}
+
+// fail closes the connection with code after a protocol violation
+func (c *Conn) fail(code int, reason string) error {
+	c.CloseWith(code, reason)
+	if code == CloseMessageTooBig {
+		return ErrMessageTooBig
+	}
+	return &protocolError{code, reason}
+}
+
+// WriteMessage writes a text or binary message, split into frames of at
+// most fragment bytes if fragment is positive
+func (c *Conn) WriteMessage(op int, data []byte, fragment int) error {
+	if fragment <= 0 || len(data) <= fragment {
+		return c.writeFrame(true, op, data)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for first := true; ; first = false {
+		n := min(fragment, len(data))
+		frameOp := op
+		if !first {
+			frameOp = OpContinuation
+		}
+		if err := c.writeFrameLocked(n == len(data), frameOp, data[:n]); err != nil {
+			return err
+		}
+		if data = data[n:]; len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+// Ping sends a ping frame
+func (c *Conn) Ping(payload []byte) error {
+	return c.writeFrame(true, OpPing, payload)
+}
+
+// CloseWith starts the close handshake with code and reason, waits
+// briefly for the peer's close frame and closes the connection
+func (c *Conn) CloseWith(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason[:min(len(reason), maxControlPayload-2)]...)
+	err := c.writeFrame(true, OpClose, payload)
+
+	// Give the peer a moment to answer, discarding anything else it sends
+	c.conn.SetReadDeadline(time.Now().Add(closeHandshakeWindow))
+	for {
+		_, op, _, rerr := c.readFrame()
+		if rerr != nil || op == OpClose {
+			break
+		}
+	}
+	c.conn.Close()
+	return err
+}
+
+// writeFrame writes one unmasked frame
+func (c *Conn) writeFrame(fin bool, op int, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeFrameLocked(fin, op, payload)
+}
+
+// writeFrameLocked writes one unmasked frame; callers hold mu
+func (c *Conn) writeFrameLocked(fin bool, op int, payload []byte) error {
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if op == OpClose {
+		c.closeSent = true
+	}
+
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	head := []byte{b0}
+	switch n := len(payload); {
+	case n < 126:
+		head = append(head, byte(n))
+	case n <= 0xffff:
+		head = append(head, 126)
+		head = binary.BigEndian.AppendUint16(head, uint16(n))
+	default:
+		head = append(head, 127)
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	c.w.Write(head)
+	c.w.Write(payload)
+	return c.w.Flush()
+}
@@ -0,0 +1,204 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAccept tests the key derivation against RFC 6455's example
+func TestAccept(t *testing.T) {
+	if got := Accept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Expected the RFC 6455 accept value, got %q", got)
+	}
+}
+
+// TestIsUpgrade tests handshake header detection
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection string
+		upgrade    string
+		expected   bool
+	}{
+		{"upgrade", "Upgrade", "websocket", true},
+		{"token list", "keep-alive, Upgrade", "WebSocket", true},
+		{"no connection token", "keep-alive", "websocket", false},
+		{"other protocol", "Upgrade", "h2c", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Connection", tt.connection)
+			r.Header.Set("Upgrade", tt.upgrade)
+			if got := IsUpgrade(r); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// clientFrame encodes a masked client frame
+func clientFrame(fin bool, op int, payload []byte) []byte {
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame decodes an unmasked server frame
+func readServerFrame(t *testing.T, r io.Reader) (bool, int, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	length := int(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	io.ReadFull(r, payload)
+	return head[0]&0x80 != 0, int(head[0] & 0x0f), payload
+}
+
+// dial upgrades a connection to srv, serving it with handle
+func dial(t *testing.T, handle func(*Conn)) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected a 101 handshake, got %d %v", resp.StatusCode, resp.Header)
+	}
+	return conn, br
+}
+
+// TestConn tests reading, writing and closing messages
+func TestConn(t *testing.T) {
+	t.Run("fragmented echo", func(t *testing.T) {
+		conn, br := dial(t, func(c *Conn) {
+			op, msg, err := c.ReadMessage()
+			if err != nil {
+				t.Errorf("ReadMessage failed: %v", err)
+				return
+			}
+			c.WriteMessage(op, msg, 4)
+		})
+		conn.Write(clientFrame(false, OpText, []byte("hello ")))
+		conn.Write(clientFrame(true, OpPing, []byte("p")))
+		conn.Write(clientFrame(true, OpContinuation, []byte("world")))
+
+		if _, op, payload := readServerFrame(t, br); op != OpPong || string(payload) != "p" {
+			t.Errorf("Expected a pong, got op %d %q", op, payload)
+		}
+		var frames []string
+		for {
+			fin, op, payload := readServerFrame(t, br)
+			if len(frames) == 0 && op != OpText || len(frames) > 0 && op != OpContinuation {
+				t.Errorf("Unexpected opcode %d for frame %d", op, len(frames))
+			}
+			frames = append(frames, string(payload))
+			if fin {
+				break
+			}
+		}
+		if strings.Join(frames, "|") != "hell|o wo|rld" {
+			t.Errorf("Expected 4 byte fragments, got %q", frames)
+		}
+	})
+
+	t.Run("read limit", func(t *testing.T) {
+		conn, br := dial(t, func(c *Conn) {
+			c.ReadLimit = 4
+			if _, _, err := c.ReadMessage(); !errors.Is(err, ErrMessageTooBig) {
+				t.Errorf("Expected ErrMessageTooBig, got %v", err)
+			}
+		})
+		conn.Write(clientFrame(true, OpBinary, []byte("too long")))
+		if _, op, payload := readServerFrame(t, br); op != OpClose || binary.BigEndian.Uint16(payload) != CloseMessageTooBig {
+			t.Errorf("Expected a 1009 close, got op %d %v", op, payload)
+		}
+		conn.Write(clientFrame(true, OpClose, closePayload(CloseMessageTooBig)))
+	})
+
+	t.Run("unmasked frames", func(t *testing.T) {
+		conn, br := dial(t, func(c *Conn) {
+			c.ReadMessage()
+		})
+		conn.Write([]byte{0x81, 0x01, 'x'})
+		if _, op, payload := readServerFrame(t, br); op != OpClose || binary.BigEndian.Uint16(payload) != CloseProtocolError {
+			t.Errorf("Expected a 1002 close, got op %d %v", op, payload)
+		}
+	})
+
+	t.Run("peer close", func(t *testing.T) {
+		conn, br := dial(t, func(c *Conn) {
+			var ce *CloseError
+			if _, _, err := c.ReadMessage(); !errors.As(err, &ce) || ce.Code != 4001 || ce.Reason != "bye" {
+				t.Errorf("Expected a 4001 CloseError, got %v", err)
+			}
+		})
+		conn.Write(clientFrame(true, OpClose, append(closePayload(4001), "bye"...)))
+		if _, op, payload := readServerFrame(t, br); op != OpClose || binary.BigEndian.Uint16(payload) != 4001 {
+			t.Errorf("Expected the close to be echoed, got op %d %v", op, payload)
+		}
+	})
+}
+
+// closePayload encodes a close code
+func closePayload(code int) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(code))
+}
@@ -0,0 +1,242 @@
+// Package httpbin exposes the httpbin endpoints as an http.Handler, so
+// other Go services and tests can mount them inside their own servers:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/httpbin/", http.StripPrefix("/httpbin", httpbin.New()))
+//
+// The handler serves the endpoint groups only; server concerns such as
+// health probes and admin endpoints are left to the embedding server.
+// Logging, recovery and custom middlewares such as auth can be composed
+// around the endpoints with a Chain:
+//
+//	h := httpbin.New(httpbin.WithMiddleware(
+//		httpbin.Logging(logger),
+//		httpbin.Recover,
+//		requireToken,
+//	))
+package httpbin
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/handlers"
+	"github.com/TykTechnologies/tyk-devops-assignement/internal/middleware"
+)
+
+// Middleware wraps a handler with extra behaviour
+type Middleware = middleware.Middleware
+
+// Chain is an ordered list of middlewares; the first one appended sees the
+// request first. See NewChain.
+type Chain = middleware.Chain
+
+// NewChain creates a chain of the given middlewares
+func NewChain(mws ...Middleware) Chain {
+	return middleware.NewChain(mws...)
+}
+
+// Logging logs every request to logger, like the httpbin server does
+func Logging(logger *slog.Logger) Middleware {
+	return middleware.LoggingTo(logger)
+}
+
+// Recover turns handler panics into 500 JSON responses
+func Recover(next http.Handler) http.Handler {
+	return middleware.Recover(next)
+}
+
+// BuildInfo describes the build reported by /version
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	BuildTime string
+}
+
+// options collects the settings applied by Option values
+type options struct {
+	build    handlers.BuildInfo
+	disabled []string
+	settings *handlers.Settings
+	chain    Chain
+	webhooks *handlers.Webhooks
+}
+
+// Option configures the handler returned by New
+type Option func(*options)
+
+// WithBuildInfo sets the build information reported by /version
+func WithBuildInfo(build BuildInfo) Option {
+	return func(o *options) {
+		o.build = handlers.BuildInfo{
+			Version:   build.Version,
+			Commit:    build.Commit,
+			BuildTime: build.BuildTime,
+		}
+	}
+}
+
+// WithDisabledGroups stops serving the named endpoint groups; see Groups
+func WithDisabledGroups(groups ...string) Option {
+	return func(o *options) {
+		o.disabled = append(o.disabled, groups...)
+	}
+}
+
+// WithTrustedProxies sets the peers whose X-Forwarded-For and X-Real-IP
+// headers are honoured; by default only loopback is trusted
+func WithTrustedProxies(prefixes ...netip.Prefix) Option {
+	return func(o *options) {
+		o.settings.TrustedProxies = prefixes
+	}
+}
+
+// WithEnvPrefixes sets the prefixes of the environment variables /env
+// reveals; by default HTTPBIN_, POD_ and NODE_
+func WithEnvPrefixes(prefixes ...string) Option {
+	return func(o *options) {
+		o.settings.EnvPrefixes = prefixes
+	}
+}
+
+// WithPodInfoDir sets the directory of the downward-API labels and
+// annotations files reported by /k8s; by default /etc/podinfo
+func WithPodInfoDir(dir string) Option {
+	return func(o *options) {
+		o.settings.PodInfoDir = dir
+	}
+}
+
+// WithProblemDetails reports errors as RFC 7807 application/problem+json
+// documents instead of {"error": "..."}
+func WithProblemDetails() Option {
+	return func(o *options) {
+		o.settings.ProblemDetails = true
+	}
+}
+
+// WithMiddleware wraps the endpoints in mws, in order; the first one sees
+// the request first. Repeated calls append to the chain.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(o *options) {
+		o.chain = o.chain.Append(mws...)
+	}
+}
+
+// WithPrettyJSON indents JSON and XML responses unless a request
+// overrides it with ?pretty=
+func WithPrettyJSON() Option {
+	return func(o *options) {
+		o.settings.PrettyJSON = true
+	}
+}
+
+// WithOriginChain reports the whole X-Forwarded-For chain plus the direct
+// peer as origin, unless a request overrides it with ?origin_chain=
+func WithOriginChain() Option {
+	return func(o *options) {
+		o.settings.OriginChain = true
+	}
+}
+
+// WithMaxDelay sets the longest delay /delay will apply; the default is
+// 10 seconds
+func WithMaxDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.settings.MaxDelay = d
+	}
+}
+
+// WithTemplatesDir serves the templates in dir on /template/{name}
+func WithTemplatesDir(dir string) Option {
+	return func(o *options) {
+		o.settings.TemplatesDir = dir
+	}
+}
+
+// WithSchemasDir lets /validate name the JSON Schemas in dir, as
+// {name}.json
+func WithSchemasDir(dir string) Option {
+	return func(o *options) {
+		o.settings.SchemasDir = dir
+	}
+}
+
+// WithMetadataMock serves fake AWS and GCP instance metadata below
+// /metadata, for testing SSRF defences and metadata clients
+func WithMetadataMock() Option {
+	return func(o *options) {
+		o.settings.MetadataMock = true
+	}
+}
+
+// WithSeed makes random behaviour reproducible: requests without ?seed=
+// are seeded in turn from a sequence derived from seed
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.settings.Seed = seed
+	}
+}
+
+// Webhooks stores the deliveries received on /webhook. Its ReplayHandler
+// sends a delivery to any URL, so mount it on an admin-only listener:
+//
+//	webhooks := httpbin.NewWebhooks()
+//	h := httpbin.New(httpbin.WithWebhooks(webhooks))
+//	admin.HandleFunc("/admin/webhooks/{id}/replay", webhooks.ReplayHandler)
+type Webhooks = handlers.Webhooks
+
+// NewWebhooks creates an empty webhook store
+func NewWebhooks() *Webhooks {
+	return handlers.NewWebhooks()
+}
+
+// WithWebhooks records webhook deliveries in webhooks instead of a store
+// private to the handler
+func WithWebhooks(webhooks *Webhooks) Option {
+	return func(o *options) {
+		o.webhooks = webhooks
+	}
+}
+
+// Groups returns the names of the endpoint groups that can be disabled
+func Groups() []string {
+	return handlers.DefaultRegistry.Names()
+}
+
+// New returns a handler serving all enabled endpoint groups
+func New(opts ...Option) http.Handler {
+	o := &options{settings: handlers.DefaultSettings()}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	mux := http.NewServeMux()
+	var groups []handlers.GroupRoutes
+	env := handlers.RouteEnv{
+		Build:    o.build,
+		Catalog:  func() []handlers.GroupRoutes { return groups },
+		Webhooks: o.webhooks,
+	}
+	enabled := func(name string) bool { return !slices.Contains(o.disabled, name) }
+	groups = handlers.DefaultRegistry.Routes(env, enabled)
+	for _, group := range groups {
+		for _, route := range group.Routes {
+			mux.Handle(route.Pattern, route.Handler)
+		}
+	}
+
+	handler := o.chain.Then(mux)
+	settings := o.settings
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Settings attached by the embedding server, which may change
+		// them at runtime, take precedence
+		if !handlers.HasSettings(r.Context()) {
+			r = r.WithContext(handlers.WithSettings(r.Context(), settings))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,287 @@
+package httpbin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestNew tests serving the endpoints from an embedded handler
+func TestNew(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/httpbin/", http.StripPrefix("/httpbin", New(
+		WithBuildInfo(BuildInfo{Version: "v1.0.0"}),
+		WithDisabledGroups("auth"),
+	)))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/httpbin/get", http.StatusOK},
+		{"/httpbin/status/418", http.StatusTeapot},
+		{"/httpbin/bearer", http.StatusNotFound},
+		{"/httpbin/healthz", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/httpbin/version")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var version map[string]string
+	json.NewDecoder(resp.Body).Decode(&version)
+	if version["version"] != "v1.0.0" {
+		t.Errorf("Expected version v1.0.0, got %v", version)
+	}
+}
+
+// TestTrustedProxies tests that forwarding headers follow the trusted proxies
+func TestTrustedProxies(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		handler  http.Handler
+		expected string
+	}{
+		{"Private peer untrusted by default", New(), "10.0.0.1"},
+		{"No trusted proxies", New(WithTrustedProxies()), "10.0.0.1"},
+		{"Explicit trusted proxy", New(WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8"))), "203.0.113.7"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ip", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, req)
+
+			var body map[string]string
+			json.Unmarshal(rr.Body.Bytes(), &body)
+			if body["origin"] != tt.expected {
+				t.Errorf("Expected origin %s, got %s", tt.expected, body["origin"])
+			}
+		})
+	}
+}
+
+// TestGroups tests that the built-in groups are listed
+func TestGroups(t *testing.T) {
+	groups := Groups()
+	for _, name := range []string{"methods", "status", "auth"} {
+		if !slices.Contains(groups, name) {
+			t.Errorf("Expected group %q in %v", name, groups)
+		}
+	}
+}
+
+// TestWithMiddleware tests composing middlewares around the endpoints
+func TestWithMiddleware(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	requireToken := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	h := New(WithMiddleware(tag("first"), Recover), WithMiddleware(tag("second"), requireToken))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+	if !slices.Equal(order, []string{"first", "second"}) {
+		t.Errorf("Expected middlewares to run in order, got %v", order)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+}
+
+// TestEndpoints tests that /endpoints lists exactly the served groups
+func TestEndpoints(t *testing.T) {
+	h := New(WithDisabledGroups("auth"))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/endpoints", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var response struct {
+		Groups []struct {
+			Name      string `json:"name"`
+			Endpoints []struct {
+				Pattern string `json:"pattern"`
+			} `json:"endpoints"`
+		} `json:"groups"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	var names, patterns []string
+	for _, g := range response.Groups {
+		names = append(names, g.Name)
+		for _, e := range g.Endpoints {
+			patterns = append(patterns, e.Pattern)
+		}
+	}
+	if slices.Contains(names, "auth") || !slices.Contains(names, "docs") {
+		t.Errorf("Expected served groups only, got %v", names)
+	}
+	if !slices.Contains(patterns, "/get") || !slices.Contains(patterns, "/endpoints") {
+		t.Errorf("Expected /get and /endpoints to be listed, got %v", patterns)
+	}
+}
+
+// TestIndex tests that the landing page links below the mount prefix
+func TestIndex(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/httpbin/", http.StripPrefix("/httpbin", New()))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/httpbin/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if want := `href="` + srv.URL + `/httpbin/get"`; !strings.Contains(string(body), want) {
+		t.Errorf("Expected page to contain %s", want)
+	}
+
+	// Only the root itself serves the page
+	resp, err = http.Get(srv.URL + "/httpbin/nope")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+// TestDocs tests that the Swagger UI page and its assets are served below
+// the mount prefix
+func TestDocs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/httpbin/", http.StripPrefix("/httpbin", New()))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	tests := []struct {
+		path           string
+		expectedStatus int
+		contentType    string
+	}{
+		{"/httpbin/docs", http.StatusOK, "text/html; charset=utf-8"},
+		{"/httpbin/docs/swagger-ui-bundle.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{"/httpbin/docs/swagger-ui.css", http.StatusOK, "text/css; charset=utf-8"},
+		{"/httpbin/docs/missing.js", http.StatusNotFound, ""},
+		{"/httpbin/docs/", http.StatusFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := client.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.contentType != "" && resp.Header.Get("Content-Type") != tt.contentType {
+				t.Errorf("Expected content type %s, got %s", tt.contentType, resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+// TestAutoHead tests that GET endpoints answer HEAD like GET, without a body
+func TestAutoHead(t *testing.T) {
+	srv := httptest.NewServer(New())
+	defer srv.Close()
+
+	for _, path := range []string{"/get", "/headers", "/status/418", "/endpoints", "/spec.json"} {
+		t.Run(path, func(t *testing.T) {
+			get, err := http.Get(srv.URL + path)
+			if err != nil {
+				t.Fatalf("GET failed: %v", err)
+			}
+			body, _ := io.ReadAll(get.Body)
+			get.Body.Close()
+
+			head, err := http.Head(srv.URL + path)
+			if err != nil {
+				t.Fatalf("HEAD failed: %v", err)
+			}
+			head.Body.Close()
+
+			if head.StatusCode != get.StatusCode {
+				t.Errorf("Expected status %d, got %d", get.StatusCode, head.StatusCode)
+			}
+			if head.Header.Get("Content-Type") != get.Header.Get("Content-Type") {
+				t.Errorf("Expected content type %q, got %q", get.Header.Get("Content-Type"), head.Header.Get("Content-Type"))
+			}
+			// The echoed headers differ slightly between GET and HEAD, so
+			// only check the length is plausible for the paths that echo
+			if path != "/get" && path != "/headers" && head.ContentLength != int64(len(body)) {
+				t.Errorf("Expected Content-Length %d, got %d", len(body), head.ContentLength)
+			}
+			if head.ContentLength <= 0 && len(body) > 0 {
+				t.Errorf("Expected a Content-Length, got %d", head.ContentLength)
+			}
+		})
+	}
+
+	// Routes that don't accept GET don't gain HEAD
+	resp, err := http.Head(srv.URL + "/post")
+	if err != nil {
+		t.Fatalf("HEAD failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for HEAD /post, got %d", resp.StatusCode)
+	}
+}